@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Private Mode ---
+
+// Private mode is on while ALLOWED_CHAT_IDS is set; otherwise everyone may use
+// the bot. Invitations handed out by an allowed chat (cosigner and debtor
+// links, shared ledgers) and payments of its invoices keep working for other
+// chats. OWNER_CHAT_IDS lists the chats of whoever runs the bot, which may use
+// admin commands such as /status.
+
+// loadChatIDs reads a list of chat IDs separated by commas, spaces or semicolons.
+func loadChatIDs(env envSource, name string) (map[int64]bool, error) {
+	value := env.get(name)
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	chats := make(map[int64]bool)
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == ';' }) {
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: expected chat IDs separated by commas", name, value)
+		}
+		chats[id] = true
+	}
+	return chats, nil
+}
+
+func chatAllowed(chatID int64) bool {
+	if len(config.AllowedChats) == 0 || config.AllowedChats[chatID] || config.OwnerChats[chatID] {
+		return true
+	}
+	// Members of an allowed chat's shared ledger work with its data.
+	ledger := ledgerChatID(chatID)
+	return ledger != chatID && config.AllowedChats[ledger]
+}
+
+// updateAllowed lets through updates from allowed chats and the replies to
+// invitations, which carry their own tokens.
+func updateAllowed(update tgbotapi.Update, chatID int64) bool {
+	if chatAllowed(chatID) {
+		return true
+	}
+	if update.Message != nil {
+		if update.Message.SuccessfulPayment != nil {
+			return true
+		}
+		if update.Message.IsCommand() && update.Message.Command() == "start" {
+			payload := update.Message.CommandArguments()
+			return strings.HasPrefix(payload, cosignerStartArg) || strings.HasPrefix(payload, debtorLinkStartArg) || strings.HasPrefix(payload, ledgerStartArg)
+		}
+		return false
+	}
+	if update.CallbackQuery != nil {
+		data, ok := decodeCallbackData(update.CallbackQuery.Data)
+		return ok && (strings.HasPrefix(data, "cosign_") || strings.HasPrefix(data, "link_") || strings.HasPrefix(data, "ledger_join:"))
+	}
+	return true
+}
+
+func denyAccess(bot Sender, update tgbotapi.Update, chatID int64) {
+	user := ""
+	if from := update.SentFrom(); from != nil {
+		user = from.UserName
+	}
+	log.Printf("Denied access to chat %d (user @%s)", chatID, user)
+	if update.Message != nil {
+		sendSimpleMessage(bot, chatID, "Извини, это частный бот — им могут пользоваться только те, кого добавил владелец.")
+	}
+}
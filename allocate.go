@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Payment Allocation ---
+
+// A payment recorded for the debtor as a whole is split across their open
+// debts. Loans are left out: their payments are split into interest and
+// principal and are recorded from the loan card instead.
+
+// maxCombinationDebts bounds the exhaustive search for debts that add up to
+// the payment exactly (2^n subsets).
+const maxCombinationDebts = 16
+
+type allocationPart struct {
+	Debt   Debt
+	Amount Money
+}
+
+type allocationOption struct {
+	Title string
+	Parts []allocationPart
+}
+
+// allocatableDebts returns the debtor's open debts that are not loans, oldest first.
+func allocatableDebts(debtorID int) ([]Debt, error) {
+	debts, err := listDebts(debtorID)
+	if err != nil {
+		return nil, err
+	}
+	var result []Debt
+	for _, debt := range debts {
+		if !debt.LoanID.Valid {
+			debt.DebtorID = debtorID
+			result = append(result, debt)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// suggestAllocations offers ways to split the payment: a single debt of
+// exactly that amount, the smallest set of debts adding up to it, and the
+// chat's allocation strategy.
+func suggestAllocations(debts []Debt, amount Money, strategy string) []allocationOption {
+	var options []allocationOption
+
+	for _, debt := range debts {
+		if debt.Amount == amount {
+			options = append(options, allocationOption{
+				Title: "Ровно один долг",
+				Parts: []allocationPart{{Debt: debt, Amount: debt.Amount}},
+			})
+			break
+		}
+	}
+
+	if combination := exactCombination(debts, amount); len(combination) > 1 {
+		option := allocationOption{Title: "Несколько долгов целиком"}
+		for _, debt := range combination {
+			option.Parts = append(option.Parts, allocationPart{Debt: debt, Amount: debt.Amount})
+		}
+		options = append(options, option)
+	}
+
+	auto := strategyAllocation(debts, amount, strategy)
+	for _, option := range options {
+		if sameAllocation(option, auto) {
+			return options
+		}
+	}
+	return append(options, auto)
+}
+
+// strategyAllocation splits the amount across debts (oldest first) by the
+// given strategy. Parts keep the order of debts.
+func strategyAllocation(debts []Debt, amount Money, strategy string) allocationOption {
+	shares := make([]Money, len(debts))
+	switch strategy {
+	case AllocationProportional:
+		var total Money
+		for _, debt := range debts {
+			total += debt.Amount
+		}
+		if total <= 0 {
+			break
+		}
+		left := amount
+		for i, debt := range debts {
+			shares[i] = mulDiv(amount, debt.Amount, total)
+			left -= shares[i]
+		}
+		// Cents lost to rounding (fewer than one per debt) go to the oldest
+		// debts that still have room.
+		for i := range debts {
+			if left <= 0 {
+				break
+			}
+			extra := min(debts[i].Amount-shares[i], left)
+			shares[i] += extra
+			left -= extra
+		}
+	default:
+		order := make([]int, len(debts))
+		for i := range order {
+			order[i] = i
+		}
+		if strategy == AllocationLargest {
+			sort.SliceStable(order, func(a, b int) bool { return debts[order[a]].Amount > debts[order[b]].Amount })
+		}
+		left := amount
+		for _, i := range order {
+			shares[i] = min(debts[i].Amount, left)
+			left -= shares[i]
+		}
+	}
+
+	option := allocationOption{Title: allocationStrategyNames[strategy]}
+	for i, debt := range debts {
+		if shares[i] > 0 {
+			option.Parts = append(option.Parts, allocationPart{Debt: debt, Amount: shares[i]})
+		}
+	}
+	return option
+}
+
+// mulDiv returns a*b/c rounded down; a*b may not fit in int64.
+func mulDiv(a, b, c Money) Money {
+	product := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(int64(b)))
+	return Money(product.Quo(product, big.NewInt(int64(c))).Int64())
+}
+
+// exactCombination finds the fewest debts whose amounts add up to the given
+// amount, preferring older debts among sets of the same size.
+func exactCombination(debts []Debt, amount Money) []Debt {
+	if len(debts) > maxCombinationDebts {
+		return nil
+	}
+	best := -1
+	bestSize := len(debts) + 1
+	for mask := 1; mask < 1<<len(debts); mask++ {
+		size := 0
+		var sum Money
+		for i, debt := range debts {
+			if mask&(1<<i) != 0 {
+				size++
+				sum += debt.Amount
+			}
+		}
+		if sum != amount || size > bestSize {
+			continue
+		}
+		if size < bestSize || olderMask(mask, best, len(debts)) {
+			best, bestSize = mask, size
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	var result []Debt
+	for i, debt := range debts {
+		if best&(1<<i) != 0 {
+			result = append(result, debt)
+		}
+	}
+	return result
+}
+
+// olderMask reports whether subset a picks older debts than subset b, comparing from the oldest.
+func olderMask(a, b, n int) bool {
+	for i := 0; i < n; i++ {
+		inA, inB := a&(1<<i) != 0, b&(1<<i) != 0
+		if inA != inB {
+			return inA
+		}
+	}
+	return false
+}
+
+func sameAllocation(a, b allocationOption) bool {
+	if len(a.Parts) != len(b.Parts) {
+		return false
+	}
+	for i := range a.Parts {
+		if a.Parts[i].Debt.ID != b.Parts[i].Debt.ID || a.Parts[i].Amount != b.Parts[i].Amount {
+			return false
+		}
+	}
+	return true
+}
+
+func allocationText(settings ChatSettings, option allocationOption) string {
+	var text strings.Builder
+	for _, part := range option.Parts {
+		text.WriteString(fmt.Sprintf("- *%s* → %s", escapeBold(part.Debt.Reason), formatAmount(settings, part.Amount)))
+		if part.Amount == part.Debt.Amount {
+			text.WriteString(" (закроется)")
+		} else {
+			text.WriteString(fmt.Sprintf(" (останется %s)", formatAmount(settings, part.Debt.Amount-part.Amount)))
+		}
+		text.WriteString("\n")
+	}
+	return text.String()
+}
+
+// --- Allocation Flow ---
+
+func handleDebtorPaymentCallback(bot Sender, chatID int64, messageID int, data string) {
+	debtor, ok := callbackDebtor(chatID, strings.TrimPrefix(data, "debtor_payment:"))
+	if !ok {
+		return
+	}
+	debts, err := allocatableDebts(debtor.ID)
+	if err != nil {
+		log.Printf("Error listing debts to allocate: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при получении списка долгов.")
+		return
+	}
+	if len(debts) == 0 {
+		editMessageWithKeyboard(bot, chatID, messageID, "Нет долгов, на которые можно распределить платёж. Платежи по кредитам вносятся из карточки кредита.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	var total Money
+	for _, debt := range debts {
+		total += debt.Amount
+	}
+	setCurrentDebtor(chatID, debtor)
+	setUserState(chatID, StateEnteringDebtorPayment)
+	editPrompt(bot, chatID, messageID, fmt.Sprintf("Сколько вернул *%s*? Открыто долгов на *%s*.", escapeBold(debtor.Name), formatChatAmount(chatID, total)))
+}
+
+func handleDebtorPaymentInput(bot Sender, chatID int64, text string) {
+	amount, err := parseAmount(getChatSettings(chatID), text)
+	if err != nil || amount <= 0 {
+		sendPrompt(bot, chatID, "Пожалуйста, введи корректную сумму платежа (положительное число).")
+		return
+	}
+	debtor := currentDebtor(chatID)
+	debts, err := allocatableDebts(debtor.ID)
+	if err != nil {
+		log.Printf("Error listing debts to allocate: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при получении списка долгов.")
+		clearUserState(chatID)
+		return
+	}
+	var total Money
+	for _, debt := range debts {
+		total += debt.Amount
+	}
+	if amount > total {
+		sendPrompt(bot, chatID, fmt.Sprintf("Сумма платежа не может быть больше суммы долгов (%s).", formatChatAmount(chatID, total)))
+		return
+	}
+
+	options := suggestAllocations(debts, amount, getChatSettings(chatID).AllocationStrategy)
+	setPendingPayment(chatID, amount)
+	setAllocations(chatID, options)
+	setUserState(chatID, StateChoosingAllocation)
+
+	settings := getChatSettings(chatID)
+	var message strings.Builder
+	message.WriteString(fmt.Sprintf("Как распределить *%s* между долгами *%s*?\n", formatAmount(settings, amount), escapeBold(debtor.Name)))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, option := range options {
+		message.WriteString(fmt.Sprintf("\n*%d. %s*\n%s", i+1, option.Title, allocationText(settings, option)))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(fmt.Sprintf("%d. %s", i+1, option.Title), fmt.Sprintf("alloc:%d", i))))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton("❌ Отмена", "cancel_operation")))
+	sendWithKeyboard(bot, chatID, message.String(), tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// handleAllocationCallback handles alloc:<option> (asks for the payment
+// method) and alloc_pay:<option>:<method> (records the payment).
+func handleAllocationCallback(bot Sender, chatID int64, messageID int, data string) {
+	session := getSession(chatID)
+	command, args, _ := strings.Cut(data, ":")
+	indexText, method, _ := strings.Cut(args, ":")
+	index, err := strconv.Atoi(indexText)
+	if session.State != StateChoosingAllocation || !session.HasPendingPayment || err != nil || index < 0 || index >= len(session.Allocations) {
+		editMessageWithKeyboard(bot, chatID, messageID, "Эта операция уже завершена.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	option := session.Allocations[index]
+	settings := getChatSettings(chatID)
+
+	if command == "alloc" {
+		var row []tgbotapi.InlineKeyboardButton
+		for _, m := range paymentMethods {
+			row = append(row, callbackButton(paymentMethodNames[m], fmt.Sprintf("alloc_pay:%d:%s", index, m)))
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(row, tgbotapi.NewInlineKeyboardRow(
+			callbackButton("❌ Отмена", "cancel_operation"),
+		))
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("*%s*\n%s\nКак был получен платёж *%s*?", option.Title, allocationText(settings, option), formatAmount(settings, session.PendingPayment)), keyboard)
+		return
+	}
+	if !isPaymentMethod(method) {
+		log.Printf("Invalid payment method in allocation callback: %s", data)
+		return
+	}
+
+	// The debts may have changed since the options were offered.
+	for i, part := range option.Parts {
+		debt, err := getDebtByID(part.Debt.ID)
+		if err != nil || debt.Amount != part.Debt.Amount {
+			clearUserState(chatID)
+			editMessageWithKeyboard(bot, chatID, messageID, "⚠️ Долги изменились, введи платёж заново.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		option.Parts[i].Debt = debt
+	}
+	clearUserState(chatID)
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("✅ Платёж *%s* (%s) распределён:\n", formatAmount(settings, session.PendingPayment), paymentMethodNames[method]))
+	for _, part := range option.Parts {
+		remaining, err := recordDebtPayment(part.Debt, part.Amount, method)
+		if err != nil {
+			log.Printf("Error recording allocated payment: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось записать платёж полностью, проверь долги.")
+			showDebtorDetails(bot, chatID, session.Debtor.ID)
+			return
+		}
+		if remaining == 0 {
+			text.WriteString(fmt.Sprintf("- *%s*: %s, долг закрыт\n", escapeBold(part.Debt.Reason), formatAmount(settings, part.Amount)))
+		} else {
+			text.WriteString(fmt.Sprintf("- *%s*: %s, осталось %s\n", escapeBold(part.Debt.Reason), formatAmount(settings, part.Amount), formatAmount(settings, remaining)))
+		}
+	}
+	editMessageWithKeyboard(bot, chatID, messageID, text.String(), tgbotapi.InlineKeyboardMarkup{})
+	notifyCoOwners(bot, chatID, fmt.Sprintf("Платёж от *%s*: *%s*.", escapeBold(session.Debtor.Name), formatAmount(settings, session.PendingPayment)))
+	showDebtorDetails(bot, chatID, session.Debtor.ID)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func testDebts(amounts ...Money) []Debt {
+	debts := make([]Debt, len(amounts))
+	for i, amount := range amounts {
+		debts[i] = Debt{ID: i + 1, Amount: amount}
+	}
+	return debts
+}
+
+func allocationShares(option allocationOption, debts []Debt) []Money {
+	shares := make([]Money, len(debts))
+	for _, part := range option.Parts {
+		shares[part.Debt.ID-1] = part.Amount
+	}
+	return shares
+}
+
+func TestStrategyAllocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		debts    []Money
+		amount   Money
+		strategy string
+		want     []Money
+	}{
+		{"oldest first", []Money{1000, 2000, 3000}, 2500, AllocationOldest, []Money{1000, 1500, 0}},
+		{"largest first", []Money{1000, 2000, 3000}, 4000, AllocationLargest, []Money{0, 1000, 3000}},
+		{"proportional", []Money{1000, 3000}, 2000, AllocationProportional, []Money{500, 1500}},
+		{"proportional rounding", []Money{100, 100, 100}, 100, AllocationProportional, []Money{34, 33, 33}},
+		{"proportional all", []Money{1, 1, 1}, 3, AllocationProportional, []Money{1, 1, 1}},
+		// 30M and 40M ₽ with a 50M ₽ payment: amount*debt overflows int64.
+		{"proportional large", []Money{3_000_000_000, 4_000_000_000}, 5_000_000_000, AllocationProportional, []Money{2_142_857_143, 2_857_142_857}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			debts := testDebts(tt.debts...)
+			got := allocationShares(strategyAllocation(debts, tt.amount, tt.strategy), debts)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("strategyAllocation(%v, %d, %s) = %v, want %v", tt.debts, tt.amount, tt.strategy, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExactCombination(t *testing.T) {
+	tests := []struct {
+		name   string
+		debts  []Money
+		amount Money
+		want   []int
+	}{
+		{"single debt", []Money{100, 200, 300}, 200, []int{2}},
+		{"fewest debts", []Money{100, 200, 300}, 300, []int{3}},
+		{"older debts first", []Money{100, 200, 100, 200}, 300, []int{1, 2}},
+		{"all debts", []Money{100, 200, 300}, 600, []int{1, 2, 3}},
+		{"no match", []Money{100, 200}, 150, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, debt := range exactCombination(testDebts(tt.debts...), tt.amount) {
+				got = append(got, debt.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("exactCombination(%v, %d) = %v, want %v", tt.debts, tt.amount, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// --- Money ---
+
+// Money is an amount in minor units (kopecks, cents). Balances are stored and
+// added up as Money, so repeated payments never leave fractions of a cent
+// behind; floats are only used for interest and at the edges (the JSON API,
+// spreadsheets).
+type Money int64
+
+// moneyFromFloat rounds an amount in major units to the nearest cent.
+func moneyFromFloat(amount float64) Money {
+	return Money(math.Round(amount * 100))
+}
+
+// Float returns the amount in major units.
+func (m Money) Float() float64 {
+	return float64(m) / 100
+}
+
+// MarshalJSON writes the amount in major units, as the API has always done.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatFloat(m.Float(), 'f', -1, 64)), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var amount float64
+	if err := json.Unmarshal(data, &amount); err != nil {
+		return err
+	}
+	if math.IsNaN(amount) || math.Abs(amount) > maxAmount {
+		return fmt.Errorf("amount %v is out of range", amount)
+	}
+	*m = moneyFromFloat(amount)
+	return nil
+}
+
+// Times multiplies the amount by a factor such as an interest rate, rounding to the nearest cent.
+func (m Money) Times(factor float64) Money {
+	return Money(math.Round(float64(m) * factor))
+}
+
+// --- Amount Parsing ---
+
+// maxAmount keeps parsed amounts, in major units, well inside the range of Money.
+const maxAmount = 1e12
+
+// amountSuffixes are multipliers accepted right after a number: "1.5k", "2к", "3 тыс".
+var amountSuffixes = map[string]float64{
+	"k":   1e3,
+	"к":   1e3,
+	"тыс": 1e3,
+	"m":   1e6,
+	"м":   1e6,
+	"млн": 1e6,
+}
+
+// parseAmount reads an amount typed by a user. Besides plain numbers it
+// accepts spaces as thousand separators, a decimal comma ("1 200,50"),
+// k/к/тыс and m/м/млн suffixes, the ruble sign or the chat's currency symbol
+// before or after the number, and simple arithmetic with + - * / and
+// parentheses ("300+450"). The result is rounded to cents; callers still
+// check that it is positive.
+func parseAmount(settings ChatSettings, text string) (Money, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	for _, symbol := range []string{"₽", strings.ToLower(settings.CurrencySymbol)} {
+		if symbol != "" {
+			text = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, symbol), symbol))
+		}
+	}
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		if r == '−' || r == '–' {
+			return '-'
+		}
+		if r == '×' {
+			return '*'
+		}
+		return r
+	}, text)
+	if text == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	p := &amountParser{input: []rune(text)}
+	value, err := p.expression()
+	if err != nil {
+		return 0, err
+	}
+	if p.pos != len(p.input) {
+		return 0, fmt.Errorf("unexpected %q in amount", string(p.input[p.pos:]))
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid amount")
+	}
+	if math.Abs(value) > maxAmount {
+		return 0, fmt.Errorf("amount too large")
+	}
+	return moneyFromFloat(value), nil
+}
+
+type amountParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *amountParser) peek() rune {
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *amountParser) expression() (float64, error) {
+	value, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for p.peek() == '+' || p.peek() == '-' {
+		op := p.peek()
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			value += right
+		} else {
+			value -= right
+		}
+	}
+	return value, nil
+}
+
+func (p *amountParser) term() (float64, error) {
+	value, err := p.factor()
+	if err != nil {
+		return 0, err
+	}
+	for p.peek() == '*' || p.peek() == '/' {
+		op := p.peek()
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return 0, err
+		}
+		if op == '*' {
+			value *= right
+		} else if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		} else {
+			value /= right
+		}
+	}
+	return value, nil
+}
+
+func (p *amountParser) factor() (float64, error) {
+	if p.peek() == '(' {
+		p.pos++
+		value, err := p.expression()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return value, nil
+	}
+
+	start := p.pos
+	for unicode.IsDigit(p.peek()) || p.peek() == '.' || p.peek() == ',' {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, fmt.Errorf("number expected")
+	}
+	value, err := parseLocaleNumber(string(p.input[start:p.pos]))
+	if err != nil {
+		return 0, err
+	}
+
+	start = p.pos
+	for unicode.IsLetter(p.peek()) {
+		p.pos++
+	}
+	if suffix := string(p.input[start:p.pos]); suffix != "" {
+		multiplier, ok := amountSuffixes[suffix]
+		if !ok {
+			return 0, fmt.Errorf("unknown suffix %q", suffix)
+		}
+		value *= multiplier
+	}
+	return value, nil
+}
+
+// parseLocaleNumber accepts both "1,200.50" and "1.200,50": when both
+// separators appear the last one is the decimal point and repeated ones group
+// thousands. A single separator is a decimal point ("1,5"), unless exactly
+// three digits follow it and a non-zero number precedes it ("1,200"): people
+// type those as thousands, and reading them as 1.20 would record a debt 1000
+// times too small.
+func parseLocaleNumber(s string) (float64, error) {
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastComma > lastDot {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.Replace(s, ",", ".", 1)
+		} else {
+			s = strings.ReplaceAll(s, ",", "")
+		}
+	case strings.Count(s, ",") > 1:
+		s = strings.ReplaceAll(s, ",", "")
+	case strings.Count(s, ".") > 1:
+		s = strings.ReplaceAll(s, ".", "")
+	default:
+		if i := strings.IndexAny(s, ".,"); i >= 0 && len(s)-i-1 == 3 && strings.TrimLeft(s[:i], "0") != "" {
+			s = s[:i] + s[i+1:]
+		} else {
+			s = strings.Replace(s, ",", ".", 1)
+		}
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	rubles := ChatSettings{CurrencySymbol: "₽"}
+	dollars := ChatSettings{CurrencySymbol: "$"}
+	belarus := ChatSettings{CurrencySymbol: "Br"}
+	tests := []struct {
+		settings ChatSettings
+		text     string
+		want     Money
+		wantErr  bool
+	}{
+		{rubles, "500", 50000, false},
+		{rubles, " 1500.5 ", 150050, false},
+		{rubles, "1500,50", 150050, false},
+		{rubles, "0,5", 50, false},
+		{rubles, "1 200,50", 120050, false},
+		{rubles, "1 200 000", 120000000, false},
+
+		// Separators.
+		{rubles, "1,200", 120000, false},
+		{rubles, "1.200", 120000, false},
+		{rubles, "12,345", 1234500, false},
+		{rubles, "0,500", 50, false},
+		{rubles, "1,2345", 123, false},
+		{rubles, "1,200.50", 120050, false},
+		{rubles, "1.200,50", 120050, false},
+		{rubles, "1,200,000", 120000000, false},
+		{rubles, "1.200.000", 120000000, false},
+
+		// Suffixes.
+		{rubles, "1.5k", 150000, false},
+		{rubles, "2к", 200000, false},
+		{rubles, "3 тыс", 300000, false},
+		{rubles, "2m", 200000000, false},
+		{rubles, "1,5млн", 150000000, false},
+		{rubles, "5 рублей", 0, true},
+
+		// Currency symbols.
+		{rubles, "500₽", 50000, false},
+		{rubles, "500 ₽", 50000, false},
+		{dollars, "$500", 50000, false},
+		{dollars, "500 $", 50000, false},
+		{dollars, "500₽", 50000, false},
+		{belarus, "500 BR", 50000, false},
+		{rubles, "$500", 0, true},
+
+		// Expressions.
+		{rubles, "300+450", 75000, false},
+		{rubles, "1000 - 250,5", 74950, false},
+		{rubles, "3*150", 45000, false},
+		{rubles, "3×150", 45000, false},
+		{rubles, "100/3", 3333, false},
+		{rubles, "(100+200)*2", 60000, false},
+		{rubles, "2k+500", 250000, false},
+		{rubles, "1 − 3", -200, false},
+		{rubles, "100/0", 0, true},
+		{rubles, "(100+200", 0, true},
+		{rubles, "100+", 0, true},
+
+		// Garbage and limits.
+		{rubles, "", 0, true},
+		{rubles, "abc", 0, true},
+		{rubles, "1e5", 0, true},
+		{rubles, "2000000000000", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAmount(tt.settings, tt.text)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseAmount(%q) = %d, want an error", tt.text, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseAmount(%q) = %d, %v, want %d", tt.text, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- REST API ---
+
+// The API is disabled unless API_LISTEN is set. Every request must carry
+// "Authorization: Bearer <API_TOKEN>".
+
+type apiDebtor struct {
+	ID            int        `json:"id"`
+	Name          string     `json:"name"`
+	TotalDebt     Money      `json:"total_debt"`
+	PaymentDate   *time.Time `json:"payment_date,omitempty"`
+	PaymentAmount *Money     `json:"payment_amount,omitempty"`
+	Notes         string     `json:"notes,omitempty"`
+}
+
+type apiDebt struct {
+	ID       int    `json:"id"`
+	DebtorID int    `json:"debtor_id"`
+	Amount   Money  `json:"amount"`
+	Reason   string `json:"reason"`
+	Tag      string `json:"tag,omitempty"`
+}
+
+type apiAddDebtRequest struct {
+	Amount Money  `json:"amount"`
+	Reason string `json:"reason"`
+	Tag    string `json:"tag"`
+}
+
+type apiPaymentRequest struct {
+	Amount Money  `json:"amount"`
+	Method string `json:"method"`
+}
+
+type apiPaymentResponse struct {
+	DebtID    int   `json:"debt_id"`
+	Paid      Money `json:"paid"`
+	Remaining Money `json:"remaining"`
+	Closed    bool  `json:"closed"`
+}
+
+const maxAPIBodyBytes = 64 << 10
+
+type apiSettings struct {
+	Listen string
+	Token  string
+}
+
+// loadAPIConfig reads API_LISTEN and API_TOKEN, which it requires once the API is on.
+func loadAPIConfig(env envSource) (apiSettings, error) {
+	cfg := apiSettings{Listen: env.get("API_LISTEN"), Token: env.get("API_TOKEN")}
+	if cfg.Listen != "" && cfg.Token == "" {
+		return cfg, fmt.Errorf("API_TOKEN must be set when API_LISTEN is enabled")
+	}
+	return cfg, nil
+}
+
+func newAPIHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chats/{chatID}/debtors", apiListDebtors)
+	mux.HandleFunc("GET /api/chats/{chatID}/debtors/{debtorID}/debts", apiListDebts)
+	mux.HandleFunc("POST /api/chats/{chatID}/debtors/{debtorID}/debts", apiAddDebt)
+	mux.HandleFunc("POST /api/chats/{chatID}/debts/{debtID}/payments", apiRecordPayment)
+	return requireAPIToken(token, mux)
+}
+
+func startAPIServer(cfg apiSettings) {
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           newAPIHandler(cfg.Token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Printf("REST API listening on %s", cfg.Listen)
+		if err := server.ListenAndServe(); err != nil {
+			log.Fatalf("REST API server failed: %v", err)
+		}
+	}()
+}
+
+func requireAPIToken(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, "invalid or missing API token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing API response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func decodeAPIBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func apiPathInt(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	value, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid "+name)
+		return 0, false
+	}
+	return value, true
+}
+
+// apiChatDebtor loads a debtor and makes sure it belongs to the chat in the path.
+func apiChatDebtor(w http.ResponseWriter, r *http.Request) (int64, Debtor, bool) {
+	chatID, ok := apiPathInt(w, r, "chatID")
+	if !ok {
+		return 0, Debtor{}, false
+	}
+	debtorID, ok := apiPathInt(w, r, "debtorID")
+	if !ok {
+		return 0, Debtor{}, false
+	}
+	debtor, err := getDebtorByID(int(debtorID))
+	if err == sql.ErrNoRows || (err == nil && debtor.ChatID != ledgerChatID(chatID)) {
+		writeAPIError(w, http.StatusNotFound, "debtor not found")
+		return 0, Debtor{}, false
+	}
+	if err != nil {
+		log.Printf("API: error getting debtor: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return 0, Debtor{}, false
+	}
+	return chatID, debtor, true
+}
+
+func apiListDebtors(w http.ResponseWriter, r *http.Request) {
+	chatID, ok := apiPathInt(w, r, "chatID")
+	if !ok {
+		return
+	}
+	debtors, err := listDebtors(chatID)
+	if err != nil {
+		log.Printf("API: error listing debtors: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	result := make([]apiDebtor, 0, len(debtors))
+	for _, debtor := range debtors {
+		debts, err := listDebts(debtor.ID)
+		if err != nil {
+			log.Printf("API: error listing debts: %v", err)
+			writeAPIError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		item := apiDebtor{ID: debtor.ID, Name: debtor.Name, Notes: debtor.Notes}
+		for _, debt := range debts {
+			item.TotalDebt += debt.Amount
+		}
+		if debtor.PaymentDate.Valid {
+			item.PaymentDate = &debtor.PaymentDate.Time
+		}
+		if debtor.PaymentAmount.Valid {
+			item.PaymentAmount = &debtor.PaymentAmount.V
+		}
+		result = append(result, item)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func apiListDebts(w http.ResponseWriter, r *http.Request) {
+	_, debtor, ok := apiChatDebtor(w, r)
+	if !ok {
+		return
+	}
+	debts, err := listDebts(debtor.ID)
+	if err != nil {
+		log.Printf("API: error listing debts: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	result := make([]apiDebt, 0, len(debts))
+	for _, debt := range debts {
+		result = append(result, apiDebt{ID: debt.ID, DebtorID: debtor.ID, Amount: debt.Amount, Reason: debt.Reason, Tag: debt.Tag})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func apiAddDebt(w http.ResponseWriter, r *http.Request) {
+	_, debtor, ok := apiChatDebtor(w, r)
+	if !ok {
+		return
+	}
+	var req apiAddDebtRequest
+	if !decodeAPIBody(w, r, &req) {
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Amount <= 0 || req.Reason == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "amount must be positive and reason must not be empty")
+		return
+	}
+	if exceedsMaxDebt(getChatSettings(debtor.ChatID), req.Amount) {
+		writeAPIError(w, http.StatusUnprocessableEntity, "amount exceeds the chat's maximum debt")
+		return
+	}
+
+	var tag string
+	if req.Tag != "" {
+		if tag, ok = normalizeTag(req.Tag); !ok {
+			writeAPIError(w, http.StatusUnprocessableEntity, "tag must be a single word")
+			return
+		}
+	}
+
+	result, err := DB.Exec("INSERT INTO debts (debtor_id, amount_cents, reason, tag, created_at) VALUES (?, ?, ?, ?, ?)", debtor.ID, req.Amount, req.Reason, tag, time.Now())
+	if err != nil {
+		log.Printf("API: error adding debt: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("API: error getting debt ID: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	emitEvent(EventDebtAdded, debtor, &Debt{ID: int(id), DebtorID: debtor.ID, Amount: req.Amount, Reason: req.Reason, Tag: tag}, nil)
+	writeJSON(w, http.StatusCreated, apiDebt{ID: int(id), DebtorID: debtor.ID, Amount: req.Amount, Reason: req.Reason, Tag: tag})
+}
+
+func apiRecordPayment(w http.ResponseWriter, r *http.Request) {
+	chatID, ok := apiPathInt(w, r, "chatID")
+	if !ok {
+		return
+	}
+	debtID, ok := apiPathInt(w, r, "debtID")
+	if !ok {
+		return
+	}
+	var req apiPaymentRequest
+	if !decodeAPIBody(w, r, &req) {
+		return
+	}
+	if req.Method == "" {
+		req.Method = PaymentMethodOther
+	}
+	if !isPaymentMethod(req.Method) {
+		writeAPIError(w, http.StatusUnprocessableEntity, "method must be one of cash, transfer, other")
+		return
+	}
+
+	debt, err := getDebtByID(int(debtID))
+	if err == nil {
+		var debtor Debtor
+		debtor, err = getDebtorByID(debt.DebtorID)
+		if err == nil && debtor.ChatID != ledgerChatID(chatID) {
+			err = sql.ErrNoRows
+		}
+	}
+	if err == sql.ErrNoRows {
+		writeAPIError(w, http.StatusNotFound, "debt not found")
+		return
+	}
+	if err != nil {
+		log.Printf("API: error getting debt: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if req.Amount <= 0 || req.Amount > debt.Amount {
+		writeAPIError(w, http.StatusUnprocessableEntity, "amount must be positive and not exceed the debt")
+		return
+	}
+
+	remaining, err := recordDebtPayment(debt, req.Amount, req.Method)
+	if err != nil {
+		log.Printf("API: error recording payment: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, apiPaymentResponse{DebtID: debt.ID, Paid: req.Amount, Remaining: remaining, Closed: remaining == 0})
+}
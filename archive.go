@@ -0,0 +1,465 @@
+package main
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Chat Archiving ---
+
+// Chats that have not talked to the bot for ARCHIVE_AFTER_DAYS are exported
+// to ARCHIVE_DIR/chat_<id>.json.gz (every row that belongs to the chat, per
+// table) and removed from the database; chat_activity keeps the chat with
+// archived_at set.
+//
+// Restoring needs no operator action: the first message or button press from
+// an archived chat loads the archive back with the original row IDs and
+// deletes the file. To restore a chat by hand, make sure its archive file is
+// in ARCHIVE_DIR and have the chat send the bot any message. Archive files
+// are plain gzipped JSON and can be moved to cold storage in between, as long
+// as they are put back before the chat returns.
+
+type archiveSettings struct {
+	Dir   string
+	After time.Duration
+}
+
+const (
+	defaultArchiveAfterDays = 365
+	// archiveBatchSize limits how many chats one scheduler run archives.
+	archiveBatchSize = 50
+	// activityTouchInterval throttles last_seen updates for busy chats.
+	activityTouchInterval = time.Hour
+)
+
+// loadArchiveConfig reads ARCHIVE_DIR and ARCHIVE_AFTER_DAYS (days of inactivity before a chat is archived).
+// Archiving is off (Dir == "") unless ARCHIVE_DIR is set.
+func loadArchiveConfig(env envSource) (archiveSettings, error) {
+	var cfg archiveSettings
+	cfg.Dir = env.get("ARCHIVE_DIR")
+	if cfg.Dir == "" {
+		return cfg, nil
+	}
+
+	days := defaultArchiveAfterDays
+	if value := env.get("ARCHIVE_AFTER_DAYS"); value != "" {
+		var err error
+		if days, err = strconv.Atoi(value); err != nil || days < 30 {
+			return cfg, fmt.Errorf("invalid ARCHIVE_AFTER_DAYS %q: expected a number of days, at least 30", value)
+		}
+	}
+	cfg.After = time.Duration(days) * 24 * time.Hour
+	return cfg, nil
+}
+
+// archiveTable selects a table's rows that belong to a chat; the single
+// placeholder is the chat ID. Tables are listed in restore order.
+type archiveTable struct {
+	Name  string
+	Where string
+}
+
+const archiveDebtorFilter = "debtor_id IN (SELECT id FROM debtors WHERE chat_id = ?)"
+
+var archiveTables = []archiveTable{
+	{"chat_settings", "chat_id = ?"},
+	{"debt_groups", "chat_id = ?"},
+	{"debtors", "chat_id = ?"},
+	{"debts", archiveDebtorFilter},
+	{"installments", "debt_id IN (SELECT id FROM debts WHERE " + archiveDebtorFilter + ")"},
+	{"debt_events", archiveDebtorFilter},
+	{"loans", archiveDebtorFilter},
+	{"loan_payments", "loan_id IN (SELECT id FROM loans WHERE " + archiveDebtorFilter + ")"},
+	{"payments", archiveDebtorFilter},
+	{"forgiven_debts", archiveDebtorFilter},
+	{"cosigners", archiveDebtorFilter},
+	{"debtor_links", archiveDebtorFilter},
+	{"debtor_nudges", archiveDebtorFilter},
+	{"reason_usage", "chat_id = ?"},
+	{"trash", "chat_id = ?"},
+}
+
+type chatArchive struct {
+	ChatID     int64                               `json:"chat_id"`
+	ArchivedAt time.Time                           `json:"archived_at"`
+	Tables     map[string][]map[string]interface{} `json:"tables"`
+}
+
+var archiveColumnName = regexp.MustCompile(`^[a-z_]+$`)
+
+func archiveFilePath(cfg archiveSettings, chatID int64) string {
+	return filepath.Join(cfg.Dir, fmt.Sprintf("chat_%d.json.gz", chatID))
+}
+
+// clearDebtEvents drops the ledger rows written by the debts triggers while
+// debts are purged or restored; the archived ledger is kept as is.
+func clearDebtEvents(tx *sql.Tx, chatID int64) error {
+	_, err := tx.Exec("DELETE FROM debt_events WHERE "+archiveDebtorFilter, chatID)
+	return err
+}
+
+// inactiveChats returns chats whose last activity is before cutoff and that
+// are not archived yet. Times are compared in Go since they are stored in
+// more than one format.
+func inactiveChats(cutoff time.Time) ([]int64, error) {
+	// A shared ledger stays while any of its members is around.
+	rows, err := DB.Query("SELECT chat_id, last_seen FROM chat_activity WHERE archived_at IS NULL AND chat_id NOT IN (SELECT ledger_chat_id FROM ledger_members)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chats []int64
+	for rows.Next() {
+		var chatID int64
+		var lastSeen time.Time
+		if err := rows.Scan(&chatID, &lastSeen); err != nil {
+			return nil, err
+		}
+		if lastSeen.Before(cutoff) {
+			chats = append(chats, chatID)
+		}
+	}
+	return chats, rows.Err()
+}
+
+// archiveChat exports the chat's rows and purges them in one transaction. The
+// archive file is written before the purge is committed, and the chat is
+// skipped if it became active in the meantime.
+func archiveChat(cfg archiveSettings, chatID int64, cutoff time.Time) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec("UPDATE chat_activity SET archived_at = ? WHERE chat_id = ? AND archived_at IS NULL", now, chatID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	var lastSeen time.Time
+	if err := tx.QueryRow("SELECT last_seen FROM chat_activity WHERE chat_id = ?", chatID).Scan(&lastSeen); err != nil {
+		return false, err
+	}
+	if !lastSeen.Before(cutoff) {
+		return false, nil
+	}
+
+	archive := chatArchive{ChatID: chatID, ArchivedAt: now, Tables: make(map[string][]map[string]interface{})}
+	for _, table := range archiveTables {
+		rows, err := dumpArchiveTable(tx, table, chatID)
+		if err != nil {
+			return false, fmt.Errorf("export %s: %w", table.Name, err)
+		}
+		archive.Tables[table.Name] = rows
+	}
+	path := archiveFilePath(cfg, chatID)
+	if err := writeChatArchive(path, archive); err != nil {
+		return false, err
+	}
+
+	for i := len(archiveTables) - 1; i >= 0; i-- {
+		table := archiveTables[i]
+		if _, err := tx.Exec("DELETE FROM "+table.Name+" WHERE "+table.Where, chatID); err != nil {
+			os.Remove(path)
+			return false, fmt.Errorf("purge %s: %w", table.Name, err)
+		}
+		if table.Name == "debts" {
+			if err := clearDebtEvents(tx, chatID); err != nil {
+				os.Remove(path)
+				return false, err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		os.Remove(path)
+		return false, err
+	}
+	return true, nil
+}
+
+func dumpArchiveTable(tx *sql.Tx, table archiveTable, chatID int64) ([]map[string]interface{}, error) {
+	rows, err := tx.Query("SELECT * FROM "+table.Name+" WHERE "+table.Where, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var result []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// writeChatArchive writes to a temporary file first so a partial archive never replaces a good one.
+func writeChatArchive(path string, archive chatArchive) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".chat_*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	zw := gzip.NewWriter(tmpFile)
+	if err := json.NewEncoder(zw).Encode(archive); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+func readChatArchive(path string) (chatArchive, error) {
+	var archive chatArchive
+	f, err := os.Open(path)
+	if err != nil {
+		return archive, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return archive, err
+	}
+	defer zr.Close()
+
+	decoder := json.NewDecoder(zr)
+	decoder.UseNumber()
+	err = decoder.Decode(&archive)
+	return archive, err
+}
+
+// restoreChat loads the chat's archive back into the database and removes the file.
+func restoreChat(cfg archiveSettings, chatID int64) error {
+	if cfg.Dir == "" {
+		return fmt.Errorf("chat %d is archived but ARCHIVE_DIR is not set", chatID)
+	}
+	path := archiveFilePath(cfg, chatID)
+	archive, err := readChatArchive(path)
+	if err != nil {
+		return err
+	}
+	if archive.ChatID != chatID {
+		return fmt.Errorf("archive %s belongs to chat %d", path, archive.ChatID)
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range archiveTables {
+		for _, row := range archive.Tables[table.Name] {
+			if err := insertArchiveRow(tx, table.Name, row); err != nil {
+				return fmt.Errorf("restore %s: %w", table.Name, err)
+			}
+		}
+		if table.Name == "debts" {
+			if err := clearDebtEvents(tx, chatID); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.Exec("UPDATE chat_activity SET archived_at = NULL, last_seen = ? WHERE chat_id = ?", time.Now(), chatID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("Error deleting restored archive %s: %v", path, err)
+	}
+	return nil
+}
+
+// legacyMoneyColumns maps the REAL money columns of rows saved before amounts
+// were stored in cents (migration 0021) to the columns that replaced them.
+var legacyMoneyColumns = map[string]map[string]string{
+	"chat_settings":  {"max_debt": "max_debt_cents"},
+	"debtors":        {"payment_amount": "payment_amount_cents"},
+	"debts":          {"amount": "amount_cents"},
+	"debt_events":    {"amount": "amount_cents"},
+	"loans":          {"principal": "principal_cents"},
+	"loan_payments":  {"amount": "amount_cents", "principal_part": "principal_cents", "interest_part": "interest_cents"},
+	"payments":       {"amount": "amount_cents"},
+	"forgiven_debts": {"amount": "amount_cents"},
+	"trash":          {"debt_total": "debt_total_cents"},
+}
+
+// upgradeLegacyMoney converts money columns of an old archive or trash row to cents.
+func upgradeLegacyMoney(table string, row map[string]interface{}) (map[string]interface{}, error) {
+	legacy := legacyMoneyColumns[table]
+	upgraded := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		renamed, ok := legacy[column]
+		if !ok {
+			upgraded[column] = value
+			continue
+		}
+		if number, ok := value.(json.Number); ok {
+			amount, err := number.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s.%s: %w", table, column, err)
+			}
+			value = int64(moneyFromFloat(amount))
+		}
+		upgraded[renamed] = value
+	}
+	return upgraded, nil
+}
+
+func insertArchiveRow(tx *sql.Tx, table string, row map[string]interface{}) error {
+	row, err := upgradeLegacyMoney(table, row)
+	if err != nil {
+		return err
+	}
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		if !archiveColumnName.MatchString(column) {
+			return fmt.Errorf("invalid column name %q", column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		values[i] = row[column]
+		if number, ok := row[column].(json.Number); ok {
+			if n, err := number.Int64(); err == nil {
+				values[i] = n
+			} else if f, err := number.Float64(); err == nil {
+				values[i] = f
+			} else {
+				return err
+			}
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders), values...)
+	return err
+}
+
+func runArchiveIfDue() {
+	cfg := config.Archive
+	if cfg.Dir == "" {
+		return
+	}
+	cutoff := time.Now().Add(-cfg.After)
+	chats, err := inactiveChats(cutoff)
+	if err != nil {
+		log.Printf("Error listing inactive chats: %v", err)
+		return
+	}
+	if len(chats) > archiveBatchSize {
+		chats = chats[:archiveBatchSize]
+	}
+	for _, chatID := range chats {
+		archived, err := archiveChat(cfg, chatID, cutoff)
+		if err != nil {
+			log.Printf("Error archiving chat %d: %v", chatID, err)
+			continue
+		}
+		if archived {
+			forgetChatActivity(chatID)
+			log.Printf("Archived inactive chat %d to %s", chatID, archiveFilePath(cfg, chatID))
+		}
+	}
+}
+
+// --- Chat Activity ---
+
+var (
+	chatActivityMu   sync.Mutex
+	chatActivitySeen = make(map[int64]time.Time)
+)
+
+func forgetChatActivity(chatID int64) {
+	chatActivityMu.Lock()
+	defer chatActivityMu.Unlock()
+	delete(chatActivitySeen, chatID)
+}
+
+// touchChatActivity records that the chat is active and brings an archived
+// chat back before its update is handled.
+func touchChatActivity(bot Sender, chatID int64) {
+	now := time.Now()
+	chatActivityMu.Lock()
+	if seen, ok := chatActivitySeen[chatID]; ok && now.Sub(seen) < activityTouchInterval {
+		chatActivityMu.Unlock()
+		return
+	}
+	chatActivitySeen[chatID] = now
+	chatActivityMu.Unlock()
+
+	if err := recordChat(chatID, now); err != nil {
+		log.Printf("Error recording chat: %v", err)
+	}
+
+	var archivedAt sql.NullTime
+	err := DB.QueryRow("SELECT archived_at FROM chat_activity WHERE chat_id = ?", chatID).Scan(&archivedAt)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error checking chat activity: %v", err)
+		return
+	}
+	if archivedAt.Valid {
+		if err := restoreChat(config.Archive, chatID); err != nil {
+			log.Printf("Error restoring archived chat %d: %v", chatID, err)
+			return
+		}
+		log.Printf("Restored archived chat %d", chatID)
+		sendSimpleMessage(bot, chatID, "С возвращением! Твои долги восстановлены из архива.")
+		return
+	}
+
+	if _, err := DB.Exec(`INSERT INTO chat_activity (chat_id, last_seen) VALUES (?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET last_seen = excluded.last_seen`, chatID, now); err != nil {
+		log.Printf("Error updating chat activity: %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Scheduled Exports ---
+
+// A chat can have its export sent automatically every week (on Monday) or
+// every month (on the 1st) at a chosen hour in the chat's timezone.
+// export_sent_for remembers the last exported period, so a period missed
+// while the bot was down is still exported once it is back.
+
+const (
+	ExportWeekly      = "weekly"
+	ExportMonthly     = "monthly"
+	ExportFormatCSV   = "csv"
+	ExportFormatXLSX  = "xlsx"
+	defaultExportHour = 9
+)
+
+var exportHourPresets = []int{9, 12, 18, 21}
+
+var exportScheduleNames = map[string]string{
+	"":            "Выкл",
+	ExportWeekly:  "Раз в неделю",
+	ExportMonthly: "Раз в месяц",
+}
+
+var exportFormatNames = map[string]string{
+	ExportFormatCSV:  "CSV",
+	ExportFormatXLSX: "XLSX",
+}
+
+func exportScheduleText(settings ChatSettings) string {
+	switch settings.ExportSchedule {
+	case ExportWeekly:
+		return trf(settings, "по понедельникам в %02d:00, %s", settings.ExportHour, exportFormatNames[settings.ExportFormat])
+	case ExportMonthly:
+		return trf(settings, "1-го числа в %02d:00, %s", settings.ExportHour, exportFormatNames[settings.ExportFormat])
+	}
+	return tr(settings, "выключена")
+}
+
+// exportPeriod returns the schedule's current period and when its export is due.
+func exportPeriod(schedule string, hour int, now time.Time) (string, time.Time) {
+	if schedule == ExportMonthly {
+		return now.Format("2006-01"), time.Date(now.Year(), now.Month(), 1, hour, 0, 0, 0, now.Location())
+	}
+	year, week := now.ISOWeek()
+	monday := now.AddDate(0, 0, -((int(now.Weekday()) + 6) % 7))
+	return fmt.Sprintf("%d-W%02d", year, week), time.Date(monday.Year(), monday.Month(), monday.Day(), hour, 0, 0, 0, now.Location())
+}
+
+// skipPassedExport marks the current period as exported if its time has
+// already passed, so enabling or moving the schedule doesn't send a file right away.
+func skipPassedExport(chatID int64) error {
+	settings := getChatSettings(chatID)
+	if settings.ExportSchedule == "" {
+		return nil
+	}
+	now := time.Now().In(chatLocation(settings))
+	period, due := exportPeriod(settings.ExportSchedule, settings.ExportHour, now)
+	if now.Before(due) {
+		period = ""
+	}
+	return upsertChatSetting(chatID, "export_sent_for", period)
+}
+
+func runScheduledExports(bot Sender) {
+	rows, err := DB.Query("SELECT chat_id, export_sent_for FROM chat_settings WHERE export_schedule != ''")
+	if err != nil {
+		log.Printf("Error listing chats for scheduled exports: %v", err)
+		return
+	}
+	sentFor := make(map[int64]string)
+	for rows.Next() {
+		var chatID int64
+		var period string
+		if err := rows.Scan(&chatID, &period); err != nil {
+			log.Printf("Error scanning chat for scheduled exports: %v", err)
+			continue
+		}
+		sentFor[chatID] = period
+	}
+	rows.Close()
+
+	for chatID, lastPeriod := range sentFor {
+		if ledgerChatID(chatID) != chatID {
+			continue
+		}
+		settings := getChatSettings(chatID)
+		now := time.Now().In(chatLocation(settings))
+		period, due := exportPeriod(settings.ExportSchedule, settings.ExportHour, now)
+		if period == lastPeriod || now.Before(due) {
+			continue
+		}
+		if err := sendScheduledExport(bot, chatID, settings); err != nil {
+			// Left unmarked, so the next run tries again.
+			log.Printf("Error sending scheduled export: %v", err)
+			continue
+		}
+		if err := upsertChatSetting(chatID, "export_sent_for", period); err != nil {
+			log.Printf("Error marking scheduled export sent: %v", err)
+		}
+	}
+}
+
+func sendScheduledExport(bot Sender, chatID int64, settings ChatSettings) error {
+	var filePath string
+	var err error
+	if settings.ExportFormat == ExportFormatXLSX {
+		filePath, err = generateDebtsXLSX(chatID)
+	} else {
+		filePath, err = generateCSV(chatID, exportFilter{}, nil)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "no debtors found") {
+			return nil
+		}
+		return err
+	}
+	defer func() {
+		if err := os.Remove(filePath); err != nil {
+			log.Printf("Error deleting temp file: %v", err)
+		}
+	}()
+
+	caption := fmt.Sprintf("📤 Автовыгрузка от %s. Изменить расписание можно в /settings.", formatDate(settings, time.Now().In(chatLocation(settings))))
+	for _, id := range ledgerChats(chatID) {
+		doc := tgbotapi.NewDocument(id, tgbotapi.FilePath(filePath))
+		doc.Caption = caption
+		if _, err := sendChattable(bot, id, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateDebtsXLSX writes the same data as the CSV export as a workbook with
+// a sheet of debtors and a sheet of debts.
+func generateDebtsXLSX(chatID int64) (string, error) {
+	debtors, err := listDebtors(chatID)
+	if err != nil {
+		return "", err
+	}
+	if len(debtors) == 0 {
+		return "", fmt.Errorf("no debtors found for chat %d", chatID)
+	}
+
+	settings := getChatSettings(chatID)
+	currency := " (" + settings.CurrencySymbol + ")"
+	debtorSheet := xlsxSheet{Name: "Должники", Rows: [][]interface{}{
+		{"Должник", "Всего" + currency, "Дата платежа", "Сумма платежа" + currency, "Наличными" + currency, "Переводом" + currency, "Другое" + currency, "Заметка"},
+	}}
+	debtSheet := xlsxSheet{Name: "Долги", Rows: [][]interface{}{
+		{"Должник", "Причина", "Тег", "Сумма" + currency},
+	}}
+	for _, debtor := range debtors {
+		debts, err := listDebts(debtor.ID)
+		if err != nil {
+			return "", err
+		}
+		paid, err := sumDebtorPaymentsByMethod(debtor.ID)
+		if err != nil {
+			return "", err
+		}
+		var total Money
+		for _, debt := range debts {
+			total += debt.Amount
+			debtSheet.Rows = append(debtSheet.Rows, []interface{}{debtor.Name, debt.Reason, debt.Tag, debt.Amount})
+		}
+		var paymentDate, paymentAmount interface{} = "", ""
+		if debtor.PaymentDate.Valid {
+			paymentDate = formatDate(settings, debtor.PaymentDate.Time)
+		}
+		if debtor.PaymentAmount.Valid {
+			paymentAmount = debtor.PaymentAmount.V
+		}
+		debtorSheet.Rows = append(debtorSheet.Rows, []interface{}{debtor.Name, total, paymentDate, paymentAmount,
+			paid[PaymentMethodCash], paid[PaymentMethodTransfer], paid[PaymentMethodOther], debtor.Notes})
+	}
+
+	tmpFile, err := os.CreateTemp("", "debts_*.xlsx")
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+	if err := writeXLSX(tmpFile, []xlsxSheet{debtorSheet, debtSheet}); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+	return tmpFile.Name(), nil
+}
+
+// --- Scheduled Export Settings ---
+
+func exportSettingsMenu(chatID int64) (string, tgbotapi.InlineKeyboardMarkup) {
+	settings := getChatSettings(chatID)
+	text := tr(settings, "*Автовыгрузка*\n\nБот сам пришлёт файл с выгрузкой раз в неделю (в понедельник) или раз в месяц (1-го числа) в выбранный час.\n\n") +
+		trf(settings, "Сейчас: *%s*", exportScheduleText(settings))
+
+	var scheduleRow, hourRow, formatRow []tgbotapi.InlineKeyboardButton
+	for _, schedule := range []string{"", ExportWeekly, ExportMonthly} {
+		scheduleRow = append(scheduleRow, callbackButton(markSelected(tr(settings, exportScheduleNames[schedule]), schedule == settings.ExportSchedule), "set_export:"+schedule))
+	}
+	for _, hour := range exportHourPresets {
+		hourRow = append(hourRow, callbackButton(markSelected(fmt.Sprintf("%02d:00", hour), hour == settings.ExportHour), fmt.Sprintf("set_export_hour:%d", hour)))
+	}
+	for _, format := range []string{ExportFormatCSV, ExportFormatXLSX} {
+		formatRow = append(formatRow, callbackButton(markSelected(exportFormatNames[format], format == settings.ExportFormat), "set_export_fmt:"+format))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(scheduleRow, hourRow, formatRow,
+		tgbotapi.NewInlineKeyboardRow(callbackButton(tr(settings, "« Назад"), "settings_done")))
+	return text, keyboard
+}
+
+func handleExportSettingsCallback(bot Sender, chatID int64, messageID int, data string) {
+	var err error
+	switch {
+	case strings.HasPrefix(data, "set_export:"):
+		schedule := strings.TrimPrefix(data, "set_export:")
+		if _, ok := exportScheduleNames[schedule]; !ok {
+			log.Printf("Invalid export schedule in callback: %s", data)
+			return
+		}
+		err = upsertChatSetting(chatID, "export_schedule", schedule)
+
+	case strings.HasPrefix(data, "set_export_hour:"):
+		hour, convErr := strconv.Atoi(strings.TrimPrefix(data, "set_export_hour:"))
+		if convErr != nil || hour < 0 || hour > 23 {
+			log.Printf("Invalid export hour in callback: %s", data)
+			return
+		}
+		err = upsertChatSetting(chatID, "export_hour", hour)
+
+	case strings.HasPrefix(data, "set_export_fmt:"):
+		format := strings.TrimPrefix(data, "set_export_fmt:")
+		if _, ok := exportFormatNames[format]; !ok {
+			log.Printf("Invalid export format in callback: %s", data)
+			return
+		}
+		err = upsertChatSetting(chatID, "export_format", format)
+	}
+	if err == nil && data != "settings_export" && !strings.HasPrefix(data, "set_export_fmt:") {
+		err = skipPassedExport(chatID)
+	}
+	if err != nil {
+		log.Printf("Error updating scheduled export: %v", err)
+		sendSimpleMessage(bot, chatID, tr(getChatSettings(chatID), "Не удалось обновить автовыгрузку."))
+		return
+	}
+	text, keyboard := exportSettingsMenu(chatID)
+	editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Database Backups ---
+
+type backupSettings struct {
+	ChatID    int64
+	Interval  time.Duration
+	Dir       string
+	Retention int
+}
+
+const (
+	backupFilePrefix       = "debt_tracker_"
+	backupFileSuffix       = ".db"
+	defaultBackupDir       = "./backups"
+	defaultBackupRetention = 7
+)
+
+// loadBackupConfig reads BACKUP_CHAT_ID, BACKUP_INTERVAL (daily, weekly or a
+// Go duration), BACKUP_DIR and BACKUP_RETENTION (number of local copies kept).
+// Backups are off (ChatID == 0) unless BACKUP_CHAT_ID is set.
+func loadBackupConfig(env envSource) (backupSettings, error) {
+	var cfg backupSettings
+	chatID := env.get("BACKUP_CHAT_ID")
+	if chatID == "" {
+		return cfg, nil
+	}
+
+	var err error
+	if cfg.ChatID, err = strconv.ParseInt(chatID, 10, 64); err != nil {
+		return cfg, fmt.Errorf("invalid BACKUP_CHAT_ID %q: %w", chatID, err)
+	}
+
+	switch interval := strings.ToLower(env.get("BACKUP_INTERVAL")); interval {
+	case "", "daily":
+		cfg.Interval = 24 * time.Hour
+	case "weekly":
+		cfg.Interval = 7 * 24 * time.Hour
+	default:
+		if cfg.Interval, err = time.ParseDuration(interval); err != nil || cfg.Interval < time.Hour {
+			return cfg, fmt.Errorf("invalid BACKUP_INTERVAL %q: use daily, weekly or a duration of at least 1h", interval)
+		}
+	}
+
+	cfg.Dir = env.get("BACKUP_DIR")
+	if cfg.Dir == "" {
+		cfg.Dir = defaultBackupDir
+	}
+
+	cfg.Retention = defaultBackupRetention
+	if retention := env.get("BACKUP_RETENTION"); retention != "" {
+		if cfg.Retention, err = strconv.Atoi(retention); err != nil || cfg.Retention < 1 {
+			return cfg, fmt.Errorf("invalid BACKUP_RETENTION %q: expected a positive number", retention)
+		}
+	}
+	return cfg, nil
+}
+
+// listBackups returns the backup files in cfg.Dir, oldest first.
+func listBackups(cfg backupSettings) ([]string, error) {
+	entries, err := os.ReadDir(cfg.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupFilePrefix) && strings.HasSuffix(name, backupFileSuffix) {
+			files = append(files, filepath.Join(cfg.Dir, name))
+		}
+	}
+	// Names embed a sortable timestamp.
+	sort.Strings(files)
+	return files, nil
+}
+
+func backupDue(cfg backupSettings, now time.Time) (bool, error) {
+	files, err := listBackups(cfg)
+	if err != nil || len(files) == 0 {
+		return err == nil, err
+	}
+	info, err := os.Stat(files[len(files)-1])
+	if err != nil {
+		return false, err
+	}
+	return now.Sub(info.ModTime()) >= cfg.Interval, nil
+}
+
+// createBackup writes a consistent snapshot of the live database.
+func createBackup(cfg backupSettings, now time.Time) (string, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(cfg.Dir, backupFilePrefix+now.Format("20060102_150405")+backupFileSuffix)
+	if _, err := DB.Exec("VACUUM INTO ?", path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func pruneBackups(cfg backupSettings) error {
+	files, err := listBackups(cfg)
+	if err != nil {
+		return err
+	}
+	for len(files) > cfg.Retention {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+func runBackupIfDue(bot Sender) {
+	cfg := config.Backup
+	if cfg.ChatID == 0 {
+		return
+	}
+	now := time.Now()
+	due, err := backupDue(cfg, now)
+	if err != nil {
+		log.Printf("Error checking backups: %v", err)
+		return
+	}
+	if !due {
+		return
+	}
+
+	path, err := createBackup(cfg, now)
+	if err != nil {
+		log.Printf("Error creating backup: %v", err)
+		sendSimpleMessage(bot, cfg.ChatID, "⚠️ Не удалось создать резервную копию базы данных. Подробности в логах.")
+		return
+	}
+	log.Printf("Database backup written to %s", path)
+
+	doc := tgbotapi.NewDocument(cfg.ChatID, tgbotapi.FilePath(path))
+	doc.Caption = fmt.Sprintf("Резервная копия базы от %s", formatDateTime(getChatSettings(cfg.ChatID), now))
+	if _, err := sendChattable(bot, cfg.ChatID, doc); err != nil {
+		log.Printf("Error sending backup: %v", err)
+	}
+
+	if err := pruneBackups(cfg); err != nil {
+		log.Printf("Error pruning backups: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Batch Add ---
+
+// After a debt is added the user can go straight back to the reason step for
+// the same debtor; "Готово" then sums up everything added in this batch.
+
+func batchKeyboard(debtorID int) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(callbackButton("➕ Добавить ещё долг этому должнику", fmt.Sprintf("batch_more:%d", debtorID))),
+		tgbotapi.NewInlineKeyboardRow(callbackButton("✅ Готово", "batch_done")),
+	)
+}
+
+// clearMessageKeyboard removes the buttons from an earlier message but keeps its text.
+func clearMessageKeyboard(bot Sender, chatID int64, messageID int) {
+	edit := tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
+	if _, err := sendChattable(bot, chatID, edit); err != nil {
+		log.Printf("Error removing keyboard: %v", err)
+	}
+}
+
+func handleBatchCallback(bot Sender, chatID int64, messageID int, data string) {
+	clearMessageKeyboard(bot, chatID, messageID)
+	session := getSession(chatID)
+
+	if data == "batch_done" {
+		clearUserState(chatID)
+		if len(session.BatchDebts) < 2 {
+			return
+		}
+		settings := getChatSettings(chatID)
+		var text strings.Builder
+		var total Money
+		text.WriteString(fmt.Sprintf("📋 *Добавлено долгов для %s: %d*\n\n", escapeBold(session.Debtor.Name), len(session.BatchDebts)))
+		for _, debt := range session.BatchDebts {
+			text.WriteString(fmt.Sprintf("- *%s* за *%s*%s\n", formatAmount(settings, debt.Amount), escapeBold(debt.Reason), formatDebtTag(debt.Tag)))
+			total += debt.Amount
+		}
+		text.WriteString(fmt.Sprintf("\n*Итого: %s*", formatAmount(settings, total)))
+		sendSimpleMessage(bot, chatID, text.String())
+		return
+	}
+
+	debtorID, err := strconv.Atoi(strings.TrimPrefix(data, "batch_more:"))
+	if err != nil {
+		log.Printf("Invalid debtor ID in callback: %v", err)
+		return
+	}
+	debtor, err := getDebtorByID(debtorID)
+	if err != nil || debtor.ChatID != ledgerChatID(chatID) {
+		log.Printf("Error getting debtor %d: %v", debtorID, err)
+		sendSimpleMessage(bot, chatID, "Должник не найден.")
+		return
+	}
+	if !session.HasDebtor || session.Debtor.ID != debtorID {
+		// The batch was interrupted by another command; start a new one.
+		clearUserState(chatID)
+	}
+	askDebtReason(bot, chatID, debtor)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Birthdays ---
+
+// birthdayLeadDays is how many days ahead of a debtor's birthday the owner gets the nudge.
+const birthdayLeadDays = 3
+
+// parseBirthday accepts a day and month in the chat's date format or as
+// "ДД.ММ", with or without the year, and returns "MM-DD"; the year is not kept.
+func parseBirthday(settings ChatSettings, text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	for _, layout := range []string{dayMonthFormat(settings), settings.DateFormat, "02.01", "2.1", "02.01.2006", "2.1.2006"} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t.Format("01-02"), true
+		}
+	}
+	return "", false
+}
+
+func formatBirthday(settings ChatSettings, birthday string) string {
+	t, err := time.Parse("01-02", birthday)
+	if err != nil {
+		return birthday
+	}
+	return t.Format(dayMonthFormat(settings))
+}
+
+// birthdayInputHint is dateInputHint without the year.
+func birthdayInputHint(settings ChatSettings) string {
+	layout := strings.NewReplacer("02", "ДД", "01", "ММ").Replace(dayMonthFormat(settings))
+	return fmt.Sprintf("%s, например %s", layout, time.Date(2000, 3, 15, 0, 0, 0, 0, time.UTC).Format(dayMonthFormat(settings)))
+}
+
+func getDebtorBirthday(debtorID int) (sql.NullString, error) {
+	var birthday sql.NullString
+	err := DB.QueryRow("SELECT birthday FROM debtors WHERE id = ?", debtorID).Scan(&birthday)
+	return birthday, err
+}
+
+func updateDebtorBirthday(debtorID int, birthday string) error {
+	_, err := DB.Exec("UPDATE debtors SET birthday = ?, birthday_nudged_year = NULL WHERE id = ?", birthday, debtorID)
+	return err
+}
+
+func clearDebtorBirthday(debtorID int) error {
+	_, err := DB.Exec("UPDATE debtors SET birthday = NULL, birthday_nudged_year = NULL WHERE id = ?", debtorID)
+	return err
+}
+
+// daysUntilBirthday counts whole days from today to the next occurrence of
+// birthday. 29 February falls on 1 March in non-leap years.
+func daysUntilBirthday(birthday string, today time.Time) (int, bool) {
+	t, err := time.Parse("01-02", birthday)
+	if err != nil {
+		return 0, false
+	}
+	next := time.Date(today.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if next.Before(today) {
+		next = time.Date(today.Year()+1, t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return int(next.Sub(today).Hours() / 24), true
+}
+
+// --- Forgiveness ---
+
+// forgiveDebt closes a debt without recording a repayment and logs it as forgiven.
+func forgiveDebt(debt Debt) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO forgiven_debts (debtor_id, reason, amount_cents, forgiven_at) VALUES (?, ?, ?, ?)",
+		debt.DebtorID, debt.Reason, debt.Amount, time.Now()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM debts WHERE id = ?", debt.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE loans SET closed_at = ? WHERE debt_id = ? AND closed_at IS NULL", time.Now(), debt.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	emitDebtEvent(EventDebtClosed, debt, nil)
+	return nil
+}
+
+func handleForgiveCallback(bot Sender, chatID int64, messageID int, data string) {
+	debtID, err := strconv.Atoi(strings.TrimPrefix(data, "forgive_debt:"))
+	if err != nil {
+		log.Printf("Invalid debt ID in callback: %v", err)
+		return
+	}
+	debt, err := getDebtByID(debtID)
+	if err == sql.ErrNoRows {
+		editMessageWithKeyboard(bot, chatID, messageID, "Этот долг уже закрыт.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting debt for forgiveness: %v", err)
+		return
+	}
+	debtor, err := getDebtorByID(debt.DebtorID)
+	if err != nil || debtor.ChatID != ledgerChatID(chatID) {
+		log.Printf("Debt %d does not belong to chat %d: %v", debtID, chatID, err)
+		return
+	}
+	if err := forgiveDebt(debt); err != nil {
+		log.Printf("Error forgiving debt: %v", err)
+		sendSimpleMessage(bot, chatID, "Не удалось простить долг.")
+		return
+	}
+	editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("🎁 Долг *%s* за *%s* прощён. *%s* будет приятно!",
+		formatChatAmount(chatID, debt.Amount), escapeBold(debt.Reason), escapeBold(debtor.Name)), tgbotapi.InlineKeyboardMarkup{})
+}
+
+// --- Birthday Nudge Job ---
+
+// notifyBirthdays suggests forgiving a small debt shortly before a debtor's birthday, once a year.
+func notifyBirthdays(bot Sender) {
+	rows, err := DB.Query("SELECT id, name, chat_id, birthday, birthday_nudged_year FROM debtors WHERE birthday IS NOT NULL")
+	if err != nil {
+		log.Printf("Error listing birthdays: %v", err)
+		return
+	}
+	type candidate struct {
+		debtor     Debtor
+		birthday   string
+		nudgedYear sql.NullInt64
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.debtor.ID, &c.debtor.Name, &c.debtor.ChatID, &c.birthday, &c.nudgedYear); err != nil {
+			log.Printf("Error scanning birthday: %v", err)
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+
+	for _, c := range candidates {
+		settings := getChatSettings(c.debtor.ChatID)
+		now := time.Now().In(chatLocation(settings))
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		days, ok := daysUntilBirthday(c.birthday, today)
+		if !ok || days > birthdayLeadDays || now.Hour() < reminderHour {
+			continue
+		}
+		birthdayYear := today.AddDate(0, 0, days).Year()
+		if c.nudgedYear.Valid && int(c.nudgedYear.Int64) == birthdayYear {
+			continue
+		}
+
+		debts, err := listDebts(c.debtor.ID)
+		if err != nil {
+			log.Printf("Error listing debts for birthday nudge: %v", err)
+			continue
+		}
+		if len(debts) > 0 {
+			smallest := debts[0]
+			for _, debt := range debts[1:] {
+				if debt.Amount < smallest.Amount {
+					smallest = debt
+				}
+			}
+			when := "сегодня"
+			if days == 1 {
+				when = "завтра"
+			} else if days > 1 {
+				when = fmt.Sprintf("через %d дн.", days)
+			}
+			text := fmt.Sprintf("🎂 У *%s* %s день рождения!\n\nМожет, простить *%s* за *%s* в честь дня рождения? 🙂",
+				escapeBold(c.debtor.Name), when, formatAmount(settings, smallest.Amount), escapeBold(smallest.Reason))
+			keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+				callbackButton("🎁 Простить "+formatAmount(settings, smallest.Amount), fmt.Sprintf("forgive_debt:%d", smallest.ID)),
+				callbackButton("Открыть должника", fmt.Sprintf("select_debtor:%d", c.debtor.ID)),
+			))
+			sendToLedger(bot, c.debtor.ChatID, text, keyboard)
+		}
+		if _, err := DB.Exec("UPDATE debtors SET birthday_nudged_year = ? WHERE id = ?", birthdayYear, c.debtor.ID); err != nil {
+			log.Printf("Error marking birthday nudged: %v", err)
+		}
+	}
+}
+
+func handleBirthdayInput(bot Sender, chatID int64, text string) {
+	settings := getChatSettings(chatID)
+	birthday, ok := parseBirthday(settings, text)
+	if !ok {
+		sendPrompt(bot, chatID, "Неверный формат. Введи день рождения как "+birthdayInputHint(settings)+".")
+		return
+	}
+	debtor := currentDebtor(chatID)
+	clearUserState(chatID)
+	if err := updateDebtorBirthday(debtor.ID, birthday); err != nil {
+		log.Printf("Error updating birthday: %v", err)
+		sendSimpleMessage(bot, chatID, "Не удалось сохранить день рождения.")
+		return
+	}
+	sendSimpleMessage(bot, chatID, fmt.Sprintf("🎂 День рождения *%s* — %s.", escapeBold(debtor.Name), formatBirthday(settings, birthday)))
+	showDebtorDetails(bot, chatID, debtor.ID)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Broadcast ---
+
+// /broadcast lets owners announce maintenance or new features: the message
+// they send next is copied, formatting and media included, to every chat in
+// the chats table. Copies go out slowly so that regular replies keep their
+// share of Telegram's rate limit, and the owner gets a delivery report.
+
+// broadcastInterval paces the copies at about ten chats per second, a third of
+// what Telegram allows overall.
+const broadcastInterval = 100 * time.Millisecond
+
+// broadcastMu is held while a broadcast is being sent; only one runs at a time.
+var broadcastMu sync.Mutex
+
+func recordChat(chatID int64, now time.Time) error {
+	_, err := DB.Exec(`INSERT INTO chats (chat_id, first_seen) VALUES (?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET blocked_at = NULL`, chatID, now)
+	return err
+}
+
+// markChatBlocked excludes a chat from broadcasts until it writes again.
+func markChatBlocked(chatID int64, now time.Time) error {
+	_, err := DB.Exec("UPDATE chats SET blocked_at = ? WHERE chat_id = ?", now, chatID)
+	// The next update from the chat must reach recordChat to clear the mark.
+	forgetChatActivity(chatID)
+	return err
+}
+
+// listBroadcastChats returns the chats a broadcast goes to, except the sender's own.
+func listBroadcastChats(senderChatID int64) ([]int64, error) {
+	rows, err := DB.Query("SELECT chat_id FROM chats WHERE blocked_at IS NULL AND chat_id != ? ORDER BY chat_id", senderChatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chatIDs []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, err
+		}
+		chatIDs = append(chatIDs, chatID)
+	}
+	return chatIDs, rows.Err()
+}
+
+// chatUnreachable reports whether Telegram refused a message because the bot
+// was blocked, removed from the chat or the chat no longer exists.
+func chatUnreachable(err error) bool {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == 403 || (apiErr.Code == 400 && strings.Contains(apiErr.Message, "chat not found"))
+}
+
+type broadcastReport struct {
+	Total     int
+	Delivered int
+	Blocked   int
+	Failed    int
+	Duration  time.Duration
+}
+
+// runBroadcast copies the message to every chat, waiting broadcastInterval
+// between them on top of the usual send limits.
+func runBroadcast(bot Sender, fromChatID int64, messageID int, chatIDs []int64) broadcastReport {
+	start := time.Now()
+	report := broadcastReport{Total: len(chatIDs)}
+	for i, chatID := range chatIDs {
+		if i > 0 {
+			time.Sleep(broadcastInterval)
+		}
+		err := withRetry(chatID, func() error {
+			_, err := bot.Request(tgbotapi.NewCopyMessage(chatID, fromChatID, messageID))
+			return err
+		})
+		switch {
+		case err == nil:
+			report.Delivered++
+		case chatUnreachable(err):
+			report.Blocked++
+			if err := markChatBlocked(chatID, time.Now()); err != nil {
+				log.Printf("Error marking chat %d as blocked: %v", chatID, err)
+			}
+		default:
+			report.Failed++
+			log.Printf("Error broadcasting to chat %d: %v", chatID, err)
+		}
+	}
+	report.Duration = time.Since(start)
+	return report
+}
+
+func broadcastReportText(report broadcastReport) string {
+	text := fmt.Sprintf("📣 *Рассылка завершена* за %s\n\nДоставлено: %d из %d", formatElapsed(report.Duration), report.Delivered, report.Total)
+	if report.Blocked > 0 {
+		text += fmt.Sprintf("\nБот заблокирован или удалён из чата: %d — больше им не пишем", report.Blocked)
+	}
+	if report.Failed > 0 {
+		text += fmt.Sprintf("\nНе удалось отправить: %d, подробности в логе", report.Failed)
+	}
+	return text
+}
+
+// handleBroadcastCommand answers owners only; for everyone else /broadcast does not exist.
+func handleBroadcastCommand(bot Sender, chatID int64) {
+	if !config.OwnerChats[chatID] {
+		sendSimpleMessage(bot, chatID, "Неизвестная команда. Используй /help для списка команд.")
+		return
+	}
+	clearUserState(chatID)
+	setUserState(chatID, StateEnteringBroadcast)
+	sendPrompt(bot, chatID, "Пришли сообщение для рассылки: текст с оформлением, фото или документ. Его получат все чаты, где пользовались ботом.")
+}
+
+func handleBroadcastMessage(bot Sender, chatID int64, messageID int) {
+	chatIDs, err := listBroadcastChats(chatID)
+	if err != nil {
+		log.Printf("Error listing broadcast chats: %v", err)
+		clearUserState(chatID)
+		sendSimpleMessage(bot, chatID, "Не удалось получить список чатов.")
+		return
+	}
+	if len(chatIDs) == 0 {
+		clearUserState(chatID)
+		sendSimpleMessage(bot, chatID, "Отправлять некому: других чатов у бота пока нет.")
+		return
+	}
+	setBroadcastMessage(chatID, messageID)
+	setUserState(chatID, StateConfirmingBroadcast)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		callbackButton("📣 Разослать", "broadcast_confirm"),
+		callbackButton("❌ Отмена", "cancel_operation"),
+	))
+	text := fmt.Sprintf("Разослать это сообщение? Получателей: %d.", len(chatIDs))
+	if estimate := time.Duration(len(chatIDs)) * broadcastInterval; estimate >= time.Minute {
+		text += fmt.Sprintf(" Рассылка займёт около %s.", formatElapsed(estimate))
+	}
+	sendWithKeyboard(bot, chatID, text, keyboard)
+}
+
+func handleBroadcastConfirm(bot Sender, chatID int64, messageID int) {
+	session := getSession(chatID)
+	if !config.OwnerChats[chatID] || session.State != StateConfirmingBroadcast {
+		editMessageWithKeyboard(bot, chatID, messageID, "Эта операция уже завершена.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	if !broadcastMu.TryLock() {
+		editMessageWithKeyboard(bot, chatID, messageID, "Другая рассылка ещё идёт. Дождись отчёта и попробуй снова.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	clearUserState(chatID)
+
+	chatIDs, err := listBroadcastChats(chatID)
+	if err != nil {
+		broadcastMu.Unlock()
+		log.Printf("Error listing broadcast chats: %v", err)
+		editMessageWithKeyboard(bot, chatID, messageID, "Не удалось получить список чатов.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("📣 Рассылка началась: чатов — %d. Пришлю отчёт, когда закончу.", len(chatIDs)), tgbotapi.InlineKeyboardMarkup{})
+	log.Printf("Broadcasting message %d from chat %d to %d chats", session.BroadcastMessageID, chatID, len(chatIDs))
+
+	// The broadcast runs outside the update worker, which would otherwise
+	// hold up every chat pinned to it until the last copy is sent.
+	go func() {
+		defer broadcastMu.Unlock()
+		report := runBroadcast(bot, chatID, session.BroadcastMessageID, chatIDs)
+		log.Printf("Broadcast finished: %d of %d delivered, %d blocked, %d failed", report.Delivered, report.Total, report.Blocked, report.Failed)
+		sendSimpleMessage(bot, chatID, broadcastReportText(report))
+	}()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Callback Data Versioning ---
+
+// Inline keyboards outlive bot upgrades, so callback data carries the format
+// version it was created with: "v1|select_debtor:42". Buttons sent before
+// versioning have no prefix and count as version 0.
+//
+// When a callback format changes, bump callbackVersion and register an
+// upgrade from the previous version in callbackUpgrades that rewrites old
+// data into the new format (or rejects it). Data that cannot be upgraded, and
+// data no handler recognizes, gets the standard "button is outdated" reply.
+
+const callbackVersion = 1
+
+// callbackUpgrades rewrite data of version N into version N+1.
+var callbackUpgrades = map[int]func(data string) (string, bool){
+	// Version 1 only introduced the prefix; the payloads are unchanged.
+	0: func(data string) (string, bool) { return data, true },
+}
+
+const outdatedButtonText = "Эта кнопка устарела, открой меню заново."
+
+// callbackButton creates an inline button with versioned callback data.
+func callbackButton(text, data string) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(text, encodeCallbackData(data))
+}
+
+func encodeCallbackData(data string) string {
+	return fmt.Sprintf("v%d|%s", callbackVersion, data)
+}
+
+// decodeCallbackData strips the version prefix and upgrades old payloads to
+// the current format. ok is false for versions that cannot be handled.
+func decodeCallbackData(raw string) (data string, ok bool) {
+	version, data := 0, raw
+	if prefix, rest, found := strings.Cut(raw, "|"); found && strings.HasPrefix(prefix, "v") {
+		v, err := strconv.Atoi(strings.TrimPrefix(prefix, "v"))
+		if err != nil {
+			return "", false
+		}
+		version, data = v, rest
+	}
+	for ; version < callbackVersion; version++ {
+		upgrade, found := callbackUpgrades[version]
+		if !found {
+			return "", false
+		}
+		if data, ok = upgrade(data); !ok {
+			return "", false
+		}
+	}
+	return data, version == callbackVersion
+}
+
+func sendOutdatedButton(bot Sender, chatID int64, raw string) {
+	log.Printf("Outdated or unknown callback data: %q", raw)
+	sendSimpleMessage(bot, chatID, outdatedButtonText)
+}
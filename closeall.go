@@ -0,0 +1,265 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Close All Debts ---
+
+// The preview encodes the outstanding total (in cents) in the confirmation
+// buttons. If the debts change in the meantime, or the button is pressed a
+// second time after everything is closed, the totals no longer match and the
+// preview is shown again instead of closing anything.
+
+// closingDebt is an open debt together with the loan interest accrued on it.
+type closingDebt struct {
+	Debt
+	Loan     *Loan
+	Interest Money
+}
+
+func listClosingDebts(debtorID int) ([]closingDebt, error) {
+	debts, err := listDebts(debtorID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	closing := make([]closingDebt, 0, len(debts))
+	for _, debt := range debts {
+		debt.DebtorID = debtorID
+		item := closingDebt{Debt: debt}
+		if debt.LoanID.Valid {
+			loan, err := getLoan(int(debt.LoanID.Int64))
+			if err != nil {
+				return nil, err
+			}
+			payments, err := listLoanPayments(loan.ID)
+			if err != nil {
+				return nil, err
+			}
+			item.Loan = &loan
+			item.Interest = accruedInterest(loan, debt.Amount, payments, now)
+		}
+		closing = append(closing, item)
+	}
+	return closing, nil
+}
+
+func closingTotal(debts []closingDebt) (principal, interest Money) {
+	for _, debt := range debts {
+		principal += debt.Amount
+		interest += debt.Interest
+	}
+	return principal, interest
+}
+
+// closeAllDebts closes every debt in one transaction, either recording each
+// one as repaid with the given method (loans together with their accrued
+// interest) or logging it as forgiven when method is empty.
+func closeAllDebts(debts []closingDebt, method string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, debt := range debts {
+		if method == "" {
+			if _, err := tx.Exec("INSERT INTO forgiven_debts (debtor_id, reason, amount_cents, forgiven_at) VALUES (?, ?, ?, ?)",
+				debt.DebtorID, debt.Reason, debt.Amount, now); err != nil {
+				return err
+			}
+		} else {
+			paid := debt.Amount + debt.Interest
+			if debt.Loan != nil {
+				if _, err := tx.Exec("INSERT INTO loan_payments (loan_id, amount_cents, principal_cents, interest_cents, paid_at) VALUES (?, ?, ?, ?, ?)",
+					debt.Loan.ID, paid, debt.Amount, debt.Interest, now); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.Exec("INSERT INTO payments (debtor_id, debt_id, reason, amount_cents, method, paid_at) VALUES (?, ?, ?, ?, ?, ?)",
+				debt.DebtorID, debt.ID, debt.Reason, paid, method, now); err != nil {
+				return err
+			}
+		}
+		result, err := tx.Exec("DELETE FROM debts WHERE id = ?", debt.ID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+		if _, err := tx.Exec("UPDATE loans SET closed_at = ? WHERE debt_id = ? AND closed_at IS NULL", now, debt.ID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, debt := range debts {
+		if method != "" {
+			emitDebtEvent(EventPaymentRecorded, debt.Debt, &Payment{DebtorID: debt.DebtorID, DebtID: debt.ID, Reason: debt.Reason, Amount: debt.Amount + debt.Interest, Method: method, PaidAt: now})
+		}
+		emitDebtEvent(EventDebtClosed, debt.Debt, nil)
+	}
+	return nil
+}
+
+// --- Close All Flow ---
+
+// callbackDebtor resolves a debtor ID from callback data and makes sure the debtor belongs to the chat.
+func callbackDebtor(chatID int64, idText string) (Debtor, bool) {
+	debtorID, err := strconv.Atoi(idText)
+	if err != nil {
+		log.Printf("Invalid debtor ID in callback: %v", err)
+		return Debtor{}, false
+	}
+	return chatDebtor(chatID, debtorID)
+}
+
+// chatDebtor returns the debtor if it belongs to the chat's ledger.
+func chatDebtor(chatID int64, debtorID int) (Debtor, bool) {
+	debtor, err := getDebtorByID(debtorID)
+	if err != nil || debtor.ChatID != ledgerChatID(chatID) {
+		log.Printf("Debtor %d does not belong to chat %d: %v", debtorID, chatID, err)
+		return Debtor{}, false
+	}
+	return debtor, true
+}
+
+// callbackDebt resolves a debt ID from callback data and makes sure the debt belongs to the chat.
+func callbackDebt(chatID int64, idText string) (Debt, bool) {
+	debtID, err := strconv.Atoi(idText)
+	if err != nil {
+		log.Printf("Invalid debt ID in callback: %v", err)
+		return Debt{}, false
+	}
+	debt, err := getDebtByID(debtID)
+	if err != nil {
+		log.Printf("Error getting debt %d: %v", debtID, err)
+		return Debt{}, false
+	}
+	if _, ok := chatDebtor(chatID, debt.DebtorID); !ok {
+		return Debt{}, false
+	}
+	return debt, true
+}
+
+func showCloseAllPreview(bot Sender, chatID int64, messageID int, debtor Debtor, notice string) {
+	debts, err := listClosingDebts(debtor.ID)
+	if err != nil {
+		log.Printf("Error listing debts to close: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при получении списка долгов.")
+		return
+	}
+	if len(debts) == 0 {
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("У *%s* нет открытых долгов.", escapeBold(debtor.Name)), tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+
+	settings := getChatSettings(chatID)
+	principal, interest := closingTotal(debts)
+	var text strings.Builder
+	if notice != "" {
+		text.WriteString(notice + "\n\n")
+	}
+	text.WriteString(fmt.Sprintf("Закрыть все долги *%s*?\n\n", escapeBold(debtor.Name)))
+	for _, debt := range debts {
+		text.WriteString(fmt.Sprintf("- *%s* за *%s*", formatAmount(settings, debt.Amount), escapeBold(debt.Reason)))
+		if debt.Interest > 0 {
+			text.WriteString(fmt.Sprintf(" + проценты %s", formatAmount(settings, debt.Interest)))
+		}
+		text.WriteString("\n")
+	}
+	text.WriteString(fmt.Sprintf("\n*Итого к оплате: %s*\n", formatAmount(settings, principal+interest)))
+	text.WriteString("\nВыбери, как был получен платёж, или прости все долги.")
+
+	cents := principal + interest
+	var methodRow []tgbotapi.InlineKeyboardButton
+	for _, method := range paymentMethods {
+		methodRow = append(methodRow, callbackButton(paymentMethodNames[method], fmt.Sprintf("close_all_pay:%d:%s:%d", debtor.ID, method, cents)))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		methodRow,
+		tgbotapi.NewInlineKeyboardRow(callbackButton("🎁 Простить все", fmt.Sprintf("close_all_forgive:%d:%d", debtor.ID, cents))),
+		tgbotapi.NewInlineKeyboardRow(callbackButton("❌ Отмена", "cancel_operation")),
+	)
+	editMessageWithKeyboard(bot, chatID, messageID, text.String(), keyboard)
+}
+
+func handleCloseAllCallback(bot Sender, chatID int64, messageID int, data string) {
+	if strings.HasPrefix(data, "close_all:") {
+		if debtor, ok := callbackDebtor(chatID, strings.TrimPrefix(data, "close_all:")); ok {
+			showCloseAllPreview(bot, chatID, messageID, debtor, "")
+		}
+		return
+	}
+
+	// close_all_pay:<debtor>:<method>:<cents> or close_all_forgive:<debtor>:<cents>
+	var method string
+	parts := strings.Split(data, ":")
+	if parts[0] == "close_all_pay" && len(parts) == 4 && isPaymentMethod(parts[2]) {
+		method = parts[2]
+		parts = []string{parts[0], parts[1], parts[3]}
+	}
+	if len(parts) != 3 {
+		log.Printf("Invalid close all callback: %s", data)
+		return
+	}
+	debtor, ok := callbackDebtor(chatID, parts[1])
+	if !ok {
+		return
+	}
+	cents, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		log.Printf("Invalid total in close all callback: %v", err)
+		return
+	}
+
+	debts, err := listClosingDebts(debtor.ID)
+	if err != nil {
+		log.Printf("Error listing debts to close: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при получении списка долгов.")
+		return
+	}
+	if len(debts) == 0 {
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Все долги *%s* уже закрыты.", escapeBold(debtor.Name)), tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	principal, interest := closingTotal(debts)
+	if principal+interest != Money(cents) {
+		showCloseAllPreview(bot, chatID, messageID, debtor, "⚠️ Долги изменились, проверь сумму ещё раз.")
+		return
+	}
+
+	if err := closeAllDebts(debts, method); err == sql.ErrNoRows {
+		showCloseAllPreview(bot, chatID, messageID, debtor, "⚠️ Долги изменились, проверь сумму ещё раз.")
+		return
+	} else if err != nil {
+		log.Printf("Error closing all debts: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при закрытии долгов.")
+		return
+	}
+
+	settings := getChatSettings(chatID)
+	if method == "" {
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("🎁 Все долги *%s* на сумму *%s* прощены.", escapeBold(debtor.Name), formatAmount(settings, principal)), tgbotapi.InlineKeyboardMarkup{})
+		notifyCoOwners(bot, chatID, fmt.Sprintf("Все долги *%s* на сумму *%s* прощены.", escapeBold(debtor.Name), formatAmount(settings, principal)))
+	} else {
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("✅ Получено *%s* (%s). Все долги *%s* закрыты.", formatAmount(settings, principal+interest), paymentMethodNames[method], escapeBold(debtor.Name)),
+			receiptKeyboard(debtor.ID, principal+interest, time.Now()))
+		notifyCoOwners(bot, chatID, fmt.Sprintf("Получено *%s*, все долги *%s* закрыты.", formatAmount(settings, principal+interest), escapeBold(debtor.Name)))
+	}
+	releaseDetailsMessage(chatID, messageID)
+	clearUserState(chatID)
+}
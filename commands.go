@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Bot Commands ---
+
+// botCommand describes a command for both the Telegram "/" menu and /help.
+type botCommand struct {
+	Name string
+	// Args is shown after the command in /help, e.g. "[тег]".
+	Args string
+	// Menu is the short description for the "/" menu, up to 256 characters.
+	Menu string
+	Help string
+	// ArgsEN, MenuEN and HelpEN are the English Args, Menu and Help.
+	ArgsEN string
+	MenuEN string
+	HelpEN string
+	// PrivateOnly hides the command from the menu in group chats.
+	PrivateOnly bool
+}
+
+// botCommands is the single list of user-facing commands, in /help order.
+var botCommands = []botCommand{
+	{Name: "add", Menu: "Добавить долг", Help: "Добавить новый долг. Бот спросит имя должника, причину и сумму. Если ввести несколько имён через запятую, сумма разделится между ними. Можно добавить долг одной строкой: /add Иван 500 за обед. Хэштег в причине задаёт тег долга: «ужин #еда». Если включено распознавание речи, долг можно надиктовать голосовым сообщением: «Иван 500 за обед».", MenuEN: "Add a debt", HelpEN: "Add a new debt. The bot asks for the debtor's name, the reason and the amount. Several names separated by commas split the amount between them. A debt can be added in one line: /add John 500 for lunch. A hashtag in the reason sets the debt's tag: \"dinner #food\". With speech recognition on, a debt can be dictated in a voice message: \"John 500 for lunch\"."},
+	{Name: "debts", Args: "[тег]", Menu: "Список должников", Help: "Показать список всех твоих должников.  Можно выбрать должника, чтобы увидеть детализацию долгов, закрыть или отредактировать долги. С тегом показываются только долги этой категории.", ArgsEN: "[tag]", MenuEN: "Debtors", HelpEN: "Show all your debtors. Pick a debtor to see their debts, close or edit them. With a tag only debts of that category are shown."},
+	{Name: "total", Menu: "Общая сумма долгов", Help: "Общая сумма долгов по всем должникам.", MenuEN: "Total owed", HelpEN: "The total owed by all debtors."},
+	{Name: "summary", Menu: "Сводка долгов текстом", Help: "Короткая текстовая сводка по всем должникам с итогом — удобно переслать в другой чат или закрепить.", MenuEN: "Text summary of debts", HelpEN: "A short text summary of all debtors with the total — handy to forward to another chat or pin."},
+	{Name: "stats", Args: "[тег]", Menu: "Суммы долгов по тегам", Help: "Суммы долгов по тегам или по должникам внутри одного тега.", ArgsEN: "[tag]", MenuEN: "Debts by tag", HelpEN: "Debt totals by tag, or by debtor within one tag."},
+	{Name: "top", Menu: "Топ должников", Help: "Топ должников по сумме долга или по давности самого старого долга, с переходом в карточку должника.", MenuEN: "Top debtors", HelpEN: "Top debtors by amount owed or by the age of their oldest debt, with a link to the debtor card."},
+	{Name: "history", Menu: "Последние платежи", Help: "Последние платежи с фильтром по способу оплаты (наличные, перевод, другое) и итогами.", MenuEN: "Recent payments", HelpEN: "Recent payments, filtered by payment method (cash, transfer, other), with totals."},
+	{Name: "loan", Menu: "Оформить кредит под проценты", Help: "Оформить кредит под проценты на срок. Платежи автоматически делятся на проценты и основной долг, график доступен в карточке кредита.", MenuEN: "Set up an interest loan", HelpEN: "Set up a loan with interest for a fixed term. Payments are split into interest and principal automatically; the schedule is in the loan card."},
+	{Name: "report", Args: "[год]", Menu: "Итоги года", Help: "Итоги года: сколько дано, возвращено и прощено, остаток на конец года и главные должники. К сводке прилагается XLSX файл.", ArgsEN: "[year]", MenuEN: "Year in review", HelpEN: "Year in review: how much was lent, repaid and forgiven, the balance at the end of the year and the main debtors. An XLSX file comes with the summary."},
+	{Name: "exportcsv", Args: "[имя] [с по]", Menu: "Выгрузить данные в CSV", Help: "Выгрузить данные в CSV файл. Можно выгрузить одного должника и/или период: /exportcsv Иван 01.01.2025 31.03.2025 — тогда в файл попадут долги, созданные за период, и платежи за него.", ArgsEN: "[name] [from to]", MenuEN: "Export data to CSV", HelpEN: "Export data to a CSV file. You can export one debtor and/or a period: /exportcsv John 01.01.2025 31.03.2025 — the file then has the debts created in the period and the payments made in it."},
+	{Name: "exporthtml", Menu: "Выгрузить долги в HTML", Help: "Выгрузить долги в HTML страницу для печати или хранения: таблицы по должникам, итоги и графики.", MenuEN: "Export debts to HTML", HelpEN: "Export debts to an HTML page to print or keep: tables by debtor, totals and charts."},
+	{Name: "share", Menu: "Общий учёт с другими", Help: "Общий учёт: пригласи по ссылке тех, с кем ведёшь долги вместе. Участники видят и меняют тех же должников и получают уведомления об изменениях.", MenuEN: "Keep debts with others", HelpEN: "Shared ledger: invite the people you keep debts with by a link. Members see and change the same debtors and are notified of changes.", PrivateOnly: true},
+	{Name: "remind", Args: "<имя>", Menu: "Напомнить должнику о долге", Help: "Отправить должнику напоминание с суммой долга и датой возврата. Сначала свяжи должника с его Telegram: кнопка «🔗 Telegram должника» в карточке.", ArgsEN: "<name>", MenuEN: "Remind a debtor", HelpEN: "Send a debtor a reminder with the amount owed and the due date. First link the debtor to their Telegram: the \"🔗 Debtor's Telegram\" button on the card."},
+	{Name: "restore", Menu: "Восстановить данные из выгрузки", Help: "Восстановить данные из файла, выгруженного через /exportcsv: бот покажет, сколько должников и долгов добавится, и импортирует их после подтверждения. То, что уже есть, не дублируется.", MenuEN: "Restore data from an export", HelpEN: "Restore data from a file exported with /exportcsv: the bot shows how many debtors and debts will be added and imports them once confirmed. Nothing already there is duplicated."},
+	{Name: "trash", Menu: "Корзина удалённых должников", Help: "Корзина: удалённые должники хранятся 30 дней, и их можно восстановить со всеми долгами.", MenuEN: "Deleted debtors", HelpEN: "Trash: deleted debtors are kept for 30 days and can be restored with all their debts."},
+	{Name: "settings", Menu: "Настройки чата", Help: "Настройки чата: язык, валюта, формат даты, часовой пояс, напоминания и сортировка.", MenuEN: "Chat settings", HelpEN: "Chat settings: language, currency, date format, time zone, reminders and sorting."},
+	{Name: "deletemydata", Menu: "Удалить все данные чата", Help: "Безвозвратно удалить все данные чата: должников, долги, платежи и настройки.", MenuEN: "Delete all chat data", HelpEN: "Permanently delete all the chat's data: debtors, debts, payments and settings.", PrivateOnly: true},
+	{Name: "cancel", Menu: "Прервать текущее действие", Help: "Прервать текущее действие (например, добавление долга).", MenuEN: "Cancel the current action", HelpEN: "Cancel the current action (such as adding a debt)."},
+	{Name: "help", Menu: "Список команд", Help: "Показать это сообщение со списком команд.", MenuEN: "List of commands", HelpEN: "Show this message with the list of commands."},
+}
+
+func helpText(settings ChatSettings) string {
+	english := settings.Language == LanguageEnglish
+	var text strings.Builder
+	text.WriteString(tr(settings, "**Команды бота DebtTracker:**\n\n"))
+	for i, command := range botCommands {
+		if i > 0 {
+			text.WriteString("\n")
+		}
+		args, help := command.Args, command.Help
+		if english {
+			args, help = command.ArgsEN, command.HelpEN
+		}
+		text.WriteString("/" + command.Name)
+		if args != "" {
+			text.WriteString(" " + args)
+		}
+		text.WriteString(" - " + help)
+	}
+	return text.String()
+}
+
+func menuCommands(group bool) []tgbotapi.BotCommand {
+	return localizedMenuCommands(group, LanguageRussian)
+}
+
+func localizedMenuCommands(group bool, language string) []tgbotapi.BotCommand {
+	var commands []tgbotapi.BotCommand
+	for _, command := range botCommands {
+		if group && command.PrivateOnly {
+			continue
+		}
+		description := command.Menu
+		if language == LanguageEnglish {
+			description = command.MenuEN
+		}
+		commands = append(commands, tgbotapi.BotCommand{Command: command.Name, Description: description})
+	}
+	return commands
+}
+
+// registerBotCommands publishes the command menu for private and group chats,
+// and for the owners' chats with their extra commands. A failure is only
+// logged: the commands keep working without the menu.
+func registerBotCommands(bot Sender) {
+	configs := []tgbotapi.SetMyCommandsConfig{
+		tgbotapi.NewSetMyCommandsWithScope(tgbotapi.NewBotCommandScopeAllPrivateChats(), menuCommands(false)...),
+		tgbotapi.NewSetMyCommandsWithScope(tgbotapi.NewBotCommandScopeAllGroupChats(), menuCommands(true)...),
+		// Telegram shows this one to users whose app is in English.
+		tgbotapi.NewSetMyCommandsWithScopeAndLanguage(tgbotapi.NewBotCommandScopeAllPrivateChats(), LanguageEnglish, localizedMenuCommands(false, LanguageEnglish)...),
+		tgbotapi.NewSetMyCommandsWithScopeAndLanguage(tgbotapi.NewBotCommandScopeAllGroupChats(), LanguageEnglish, localizedMenuCommands(true, LanguageEnglish)...),
+	}
+	for chatID := range config.OwnerChats {
+		configs = append(configs, tgbotapi.NewSetMyCommandsWithScope(tgbotapi.NewBotCommandScopeChat(chatID), ownerCommands(chatID)...))
+	}
+	for _, config := range configs {
+		if _, err := bot.Request(config); err != nil {
+			log.Printf("Error registering bot commands: %v", err)
+		}
+	}
+}
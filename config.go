@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// --- Configuration ---
+
+// Config is everything the bot reads at startup from the environment, the
+// .env file and command-line flags. loadConfig checks all of it before the bot
+// connects to Telegram or opens the database and reports every invalid
+// variable at once. Optional features stay off while their variables are
+// empty; each feature's variables are parsed next to the feature itself.
+type Config struct {
+	TelegramToken string
+	DBPath        string
+	// BannerPath is the picture sent with /start; empty sends the greeting alone.
+	BannerPath string
+	// PollTimeout is how long getUpdates waits for new updates in polling mode.
+	PollTimeout time.Duration
+	// StateTTL is how long an unfinished conversation step stays valid.
+	StateTTL time.Duration
+	// DefaultDateFormat is used by chats that have not picked a date format.
+	DefaultDateFormat string
+
+	// AllowedChats turns on private mode when not empty; OwnerChats may use
+	// admin commands such as /status and /broadcast.
+	AllowedChats map[int64]bool
+	OwnerChats   map[int64]bool
+
+	Backup        backupSettings
+	Archive       archiveSettings
+	EventWebhooks eventWebhookSettings
+	// Speech is nil unless SPEECH_PROVIDER is set.
+	Speech speechRecognizer
+	// PaymentProviderToken is empty (invoices are disabled) unless set.
+	PaymentProviderToken string
+
+	HealthListen string
+	API          apiSettings
+	Webhook      webhookSettings
+}
+
+const (
+	defaultDBPath      = "./debt_tracker.db"
+	defaultBannerPath  = "botBanner.jpeg"
+	defaultEnvFile     = ".env"
+	defaultPollTimeout = 60 * time.Second
+	defaultStateTTL    = time.Hour
+)
+
+// config holds the defaults until main loads the real configuration, so that
+// code running without it (the load test) still sees sensible values.
+var config = Config{
+	DBPath:            defaultDBPath,
+	PollTimeout:       defaultPollTimeout,
+	StateTTL:          defaultStateTTL,
+	DefaultDateFormat: defaultDateFormat,
+}
+
+// envSource looks up a configuration variable, like os.LookupEnv.
+type envSource func(name string) (string, bool)
+
+func (env envSource) get(name string) string {
+	value, _ := env(name)
+	return value
+}
+
+// loadEnvFile adds the variables of a .env file to the environment without
+// overriding ones already set. A missing file is only an error when it was
+// asked for explicitly.
+func loadEnvFile(path string, required bool) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err := godotenv.Load(path); err != nil {
+		return fmt.Errorf("loading %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadConfig reads and validates the configuration; the error lists every
+// problem found, one per line.
+func loadConfig(env envSource) (Config, error) {
+	cfg := config
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.TelegramToken = env.get("TELEGRAM_API_TOKEN"); cfg.TelegramToken == "" {
+		check(fmt.Errorf("TELEGRAM_API_TOKEN is not set"))
+	}
+	if path := env.get("DB_PATH"); path != "" {
+		cfg.DBPath = path
+	}
+
+	if path, ok := env("BANNER_PATH"); !ok {
+		// The default banner is optional: without the file /start sends text only.
+		if _, err := os.Stat(defaultBannerPath); err == nil {
+			cfg.BannerPath = defaultBannerPath
+		}
+	} else if cfg.BannerPath = path; path != "" {
+		if _, err := os.Stat(path); err != nil {
+			check(fmt.Errorf("invalid BANNER_PATH %q: %w; leave it empty to send /start without a picture", path, err))
+		}
+	}
+
+	if value := env.get("POLL_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < time.Second || timeout%time.Second != 0 {
+			check(fmt.Errorf("invalid POLL_TIMEOUT %q: expected whole seconds like 60s or 2m", value))
+		}
+		cfg.PollTimeout = timeout
+	}
+	if value := env.get("STATE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			check(fmt.Errorf("invalid STATE_TTL %q: expected a positive duration like 30m or 2h", value))
+		}
+		cfg.StateTTL = ttl
+	}
+	if value := env.get("DEFAULT_DATE_FORMAT"); value != "" {
+		if !slices.Contains(dateFormatPresets, value) {
+			check(fmt.Errorf("invalid DEFAULT_DATE_FORMAT %q: use one of %s", value, strings.Join(dateFormatPresets, ", ")))
+		}
+		cfg.DefaultDateFormat = value
+	}
+
+	var err error
+	cfg.AllowedChats, err = loadChatIDs(env, "ALLOWED_CHAT_IDS")
+	check(err)
+	cfg.OwnerChats, err = loadChatIDs(env, "OWNER_CHAT_IDS")
+	check(err)
+	cfg.Backup, err = loadBackupConfig(env)
+	check(err)
+	cfg.Archive, err = loadArchiveConfig(env)
+	check(err)
+	cfg.EventWebhooks, err = loadEventWebhookConfig(env)
+	check(err)
+	cfg.Speech, err = loadSpeechRecognizer(env)
+	check(err)
+	cfg.PaymentProviderToken = env.get("PAYMENT_PROVIDER_TOKEN")
+	cfg.HealthListen = env.get("HEALTH_LISTEN")
+	cfg.API, err = loadAPIConfig(env)
+	check(err)
+	cfg.Webhook, err = loadWebhookConfig(env)
+	check(err)
+
+	return cfg, errors.Join(errs...)
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Co-signers ---
+
+// A co-signer is a secondary contact of a debtor who agreed (via an invite
+// link) to be notified once the debtor's payment is overdue by more than
+// ThresholdDays. Nothing is ever sent before the co-signer consents.
+type Cosigner struct {
+	DebtorID      int
+	ChatID        sql.NullInt64
+	InviteToken   string
+	Status        string
+	ThresholdDays int
+	NotifiedFor   sql.NullTime
+}
+
+const (
+	CosignerPending   = "pending"
+	CosignerActive    = "active"
+	CosignerDeclined  = "declined"
+	CosignerOptedOut  = "opted_out"
+	cosignerStartArg  = "cosign_"
+	defaultCosignDays = 7
+)
+
+var cosignerThresholdOptions = []int{3, 7, 14, 30}
+
+func getCosigner(debtorID int) (Cosigner, error) {
+	var c Cosigner
+	err := DB.QueryRow("SELECT debtor_id, chat_id, invite_token, status, threshold_days, notified_for FROM cosigners WHERE debtor_id = ?", debtorID).
+		Scan(&c.DebtorID, &c.ChatID, &c.InviteToken, &c.Status, &c.ThresholdDays, &c.NotifiedFor)
+	return c, err
+}
+
+func getCosignerByToken(token string) (Cosigner, error) {
+	var c Cosigner
+	err := DB.QueryRow("SELECT debtor_id, chat_id, invite_token, status, threshold_days, notified_for FROM cosigners WHERE invite_token = ?", token).
+		Scan(&c.DebtorID, &c.ChatID, &c.InviteToken, &c.Status, &c.ThresholdDays, &c.NotifiedFor)
+	return c, err
+}
+
+// createCosignerInvite replaces any previous co-signer of the debtor with a fresh pending invite.
+func createCosignerInvite(debtorID int) (Cosigner, error) {
+	tokenBytes := make([]byte, 8)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return Cosigner{}, err
+	}
+	c := Cosigner{DebtorID: debtorID, InviteToken: hex.EncodeToString(tokenBytes), Status: CosignerPending, ThresholdDays: defaultCosignDays}
+	_, err := DB.Exec(`INSERT INTO cosigners (debtor_id, chat_id, invite_token, status, threshold_days, notified_for) VALUES (?, NULL, ?, ?, ?, NULL)
+        ON CONFLICT(debtor_id) DO UPDATE SET chat_id = NULL, invite_token = excluded.invite_token, status = excluded.status, notified_for = NULL`,
+		c.DebtorID, c.InviteToken, c.Status, c.ThresholdDays)
+	if err != nil {
+		return Cosigner{}, err
+	}
+	return getCosigner(debtorID)
+}
+
+func updateCosignerStatus(debtorID int, status string, chatID sql.NullInt64) error {
+	_, err := DB.Exec("UPDATE cosigners SET status = ?, chat_id = ? WHERE debtor_id = ?", status, chatID, debtorID)
+	return err
+}
+
+func updateCosignerThreshold(debtorID int, days int) error {
+	_, err := DB.Exec("UPDATE cosigners SET threshold_days = ? WHERE debtor_id = ?", days, debtorID)
+	return err
+}
+
+func markCosignerNotified(debtorID int, paymentDate time.Time) error {
+	_, err := DB.Exec("UPDATE cosigners SET notified_for = ? WHERE debtor_id = ?", paymentDate, debtorID)
+	return err
+}
+
+func deleteCosigner(debtorID int) error {
+	_, err := DB.Exec("DELETE FROM cosigners WHERE debtor_id = ?", debtorID)
+	return err
+}
+
+func cosignerStatusText(c Cosigner) string {
+	switch c.Status {
+	case CosignerPending:
+		return "ожидает согласия"
+	case CosignerActive:
+		return fmt.Sprintf("активен, уведомление после %d дн. просрочки", c.ThresholdDays)
+	case CosignerDeclined:
+		return "отказался"
+	case CosignerOptedOut:
+		return "отписался от уведомлений"
+	}
+	return c.Status
+}
+
+// --- Owner Side ---
+
+func showCosignerMenu(bot Sender, chatID int64, messageID int) {
+	debtor := currentDebtor(chatID)
+	cosigner, err := getCosigner(debtor.ID)
+	if err == sql.ErrNoRows {
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(callbackButton("🔗 Пригласить поручителя", "cosigner_invite")),
+			tgbotapi.NewInlineKeyboardRow(callbackButton("❌ Отмена", "cancel_operation")),
+		)
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("У *%s* нет поручителя.\n\nПоручитель получит уведомление только если платёж просрочен дольше заданного срока и только после того, как сам даст согласие.", escapeBold(debtor.Name)), keyboard)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting cosigner: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при получении информации о поручителе.")
+		return
+	}
+
+	var thresholdRow []tgbotapi.InlineKeyboardButton
+	for _, days := range cosignerThresholdOptions {
+		label := markSelected(fmt.Sprintf("%d дн.", days), days == cosigner.ThresholdDays)
+		thresholdRow = append(thresholdRow, callbackButton(label, fmt.Sprintf("cosigner_threshold:%d", days)))
+	}
+
+	text := fmt.Sprintf("*Поручитель для %s:* %s", escapeBold(debtor.Name), cosignerStatusText(cosigner))
+	if cosigner.Status == CosignerPending {
+		text += fmt.Sprintf("\n\nПерешли поручителю ссылку:\n%s", cosignerInviteLink(bot, cosigner))
+	}
+	text += "\n\nЧерез сколько дней просрочки уведомлять:"
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		thresholdRow,
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton("🔗 Новая ссылка", "cosigner_invite"),
+			callbackButton("🗑️ Убрать", "cosigner_remove"),
+		),
+		tgbotapi.NewInlineKeyboardRow(callbackButton("❌ Отмена", "cancel_operation")),
+	)
+	editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+}
+
+func cosignerInviteLink(bot Sender, c Cosigner) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%s", bot.UserName(), cosignerStartArg, c.InviteToken)
+}
+
+func handleCosignerCallback(bot Sender, chatID int64, messageID int, data string) {
+	debtor, ok := lookupCurrentDebtor(chatID)
+	if !ok {
+		sendSimpleMessage(bot, chatID, "Сначала выбери должника через /debts.")
+		return
+	}
+
+	switch {
+	case data == "cosigner_menu":
+		showCosignerMenu(bot, chatID, messageID)
+
+	case data == "cosigner_invite":
+		if _, err := createCosignerInvite(debtor.ID); err != nil {
+			log.Printf("Error creating cosigner invite: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось создать приглашение.")
+			return
+		}
+		showCosignerMenu(bot, chatID, messageID)
+
+	case strings.HasPrefix(data, "cosigner_threshold:"):
+		days, err := strconv.Atoi(strings.TrimPrefix(data, "cosigner_threshold:"))
+		if err != nil || days <= 0 {
+			log.Printf("Invalid cosigner threshold in callback: %s", data)
+			return
+		}
+		if err := updateCosignerThreshold(debtor.ID, days); err != nil {
+			log.Printf("Error updating cosigner threshold: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось обновить срок уведомления.")
+			return
+		}
+		showCosignerMenu(bot, chatID, messageID)
+
+	case data == "cosigner_remove":
+		cosigner, err := getCosigner(debtor.ID)
+		if err != nil {
+			log.Printf("Error getting cosigner for removal: %v", err)
+			return
+		}
+		if err := deleteCosigner(debtor.ID); err != nil {
+			log.Printf("Error deleting cosigner: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось убрать поручителя.")
+			return
+		}
+		if cosigner.Status == CosignerActive && cosigner.ChatID.Valid {
+			sendSimpleMessage(bot, cosigner.ChatID.Int64, fmt.Sprintf("Ты больше не поручитель для *%s*. Уведомлений больше не будет.", escapeBold(debtor.Name)))
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, "Поручитель удалён.", tgbotapi.InlineKeyboardMarkup{})
+		showDebtorDetails(bot, chatID, debtor.ID)
+	}
+}
+
+// --- Co-signer Side ---
+
+func handleCosignerStart(bot Sender, chatID int64, token string) {
+	clearUserState(chatID)
+	cosigner, err := getCosignerByToken(token)
+	if err != nil || cosigner.Status != CosignerPending {
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error getting cosigner by token: %v", err)
+		}
+		sendSimpleMessage(bot, chatID, "Приглашение недействительно или уже использовано.")
+		return
+	}
+	debtor, err := getDebtorByID(cosigner.DebtorID)
+	if err != nil {
+		log.Printf("Error getting debtor for cosigner invite: %v", err)
+		sendSimpleMessage(bot, chatID, "Приглашение недействительно или уже использовано.")
+		return
+	}
+	if debtor.ChatID == ledgerChatID(chatID) {
+		sendSimpleMessage(bot, chatID, "Нельзя стать поручителем по собственному списку долгов. Перешли ссылку поручителю.")
+		return
+	}
+
+	text := fmt.Sprintf("Тебя приглашают стать поручителем для *%s*.\n\n"+
+		"Если платёж будет просрочен больше чем на %d дн., я пришлю тебе уведомление с суммой долга. "+
+		"Других сообщений не будет, а отписаться можно в любой момент.\n\nСогласен?", escapeBold(debtor.Name), cosigner.ThresholdDays)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		callbackButton("✅ Согласен", "cosign_accept:"+token),
+		callbackButton("❌ Отказаться", "cosign_decline:"+token),
+	))
+	sendWithKeyboard(bot, chatID, text, keyboard)
+}
+
+func handleCosignerResponse(bot Sender, chatID int64, messageID int, data string) {
+	parts := strings.SplitN(data, ":", 2)
+	if len(parts) != 2 {
+		return
+	}
+	action, token := parts[0], parts[1]
+
+	cosigner, err := getCosignerByToken(token)
+	if err != nil {
+		editMessageWithKeyboard(bot, chatID, messageID, "Приглашение больше не действует.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	debtor, err := getDebtorByID(cosigner.DebtorID)
+	if err != nil {
+		log.Printf("Error getting debtor for cosigner response: %v", err)
+		return
+	}
+
+	switch action {
+	case "cosign_accept", "cosign_decline":
+		if cosigner.Status != CosignerPending {
+			editMessageWithKeyboard(bot, chatID, messageID, "Приглашение уже использовано.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		status, ownerText, replyText := CosignerDeclined, fmt.Sprintf("Поручитель для *%s* отказался.", escapeBold(debtor.Name)), "Хорошо, уведомлений не будет."
+		if action == "cosign_accept" {
+			status = CosignerActive
+			ownerText = fmt.Sprintf("✅ Поручитель для *%s* дал согласие на уведомления.", escapeBold(debtor.Name))
+			replyText = fmt.Sprintf("Спасибо! Ты поручитель для *%s*.", escapeBold(debtor.Name))
+		}
+		if err := updateCosignerStatus(debtor.ID, status, sql.NullInt64{Int64: chatID, Valid: true}); err != nil {
+			log.Printf("Error updating cosigner status: %v", err)
+			sendSimpleMessage(bot, chatID, "Произошла ошибка, попробуй ещё раз.")
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, replyText, tgbotapi.InlineKeyboardMarkup{})
+		sendToLedger(bot, debtor.ChatID, ownerText, tgbotapi.InlineKeyboardMarkup{})
+
+	case "cosign_optout":
+		if cosigner.Status != CosignerActive || !cosigner.ChatID.Valid || cosigner.ChatID.Int64 != chatID {
+			editMessageWithKeyboard(bot, chatID, messageID, "Подписка уже неактивна.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		if err := updateCosignerStatus(debtor.ID, CosignerOptedOut, cosigner.ChatID); err != nil {
+			log.Printf("Error opting out cosigner: %v", err)
+			sendSimpleMessage(bot, chatID, "Произошла ошибка, попробуй ещё раз.")
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, "Ты отписался от уведомлений. Больше сообщений не будет.", tgbotapi.InlineKeyboardMarkup{})
+		sendToLedger(bot, debtor.ChatID, fmt.Sprintf("Поручитель для *%s* отписался от уведомлений.", escapeBold(debtor.Name)), tgbotapi.InlineKeyboardMarkup{})
+	}
+}
+
+// --- Escalation Job ---
+
+func notifyOverdueCosigners(bot Sender) {
+	rows, err := DB.Query(`SELECT c.debtor_id, c.chat_id, c.invite_token, c.threshold_days, c.notified_for, d.payment_date
+        FROM cosigners c JOIN debtors d ON d.id = c.debtor_id
+        WHERE c.status = ? AND c.chat_id IS NOT NULL AND d.payment_date IS NOT NULL`, CosignerActive)
+	if err != nil {
+		log.Printf("Error listing cosigners: %v", err)
+		return
+	}
+
+	type escalation struct {
+		cosigner    Cosigner
+		paymentDate time.Time
+	}
+	var candidates []escalation
+	for rows.Next() {
+		var c Cosigner
+		var paymentDate time.Time
+		if err := rows.Scan(&c.DebtorID, &c.ChatID, &c.InviteToken, &c.ThresholdDays, &c.NotifiedFor, &paymentDate); err != nil {
+			log.Printf("Error scanning cosigner: %v", err)
+			continue
+		}
+		if c.NotifiedFor.Valid && c.NotifiedFor.Time.Equal(paymentDate) {
+			continue
+		}
+		candidates = append(candidates, escalation{cosigner: c, paymentDate: paymentDate})
+	}
+	rows.Close()
+
+	for _, e := range candidates {
+		debtor, err := getDebtorByID(e.cosigner.DebtorID)
+		if err != nil {
+			log.Printf("Error getting debtor for escalation: %v", err)
+			continue
+		}
+		// Payment dates are calendar dates, so compare them with today in the chat's timezone.
+		settings := getChatSettings(debtor.ChatID)
+		local := time.Now().In(chatLocation(settings))
+		now := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+		paymentDate := time.Date(e.paymentDate.Year(), e.paymentDate.Month(), e.paymentDate.Day(), 0, 0, 0, 0, time.UTC)
+		// Escalations falling on a weekend or holiday wait for the next business day.
+		calendar := settings.HolidayCalendar
+		escalateOn := nextBusinessDay(calendar, paymentDate.AddDate(0, 0, e.cosigner.ThresholdDays))
+		if now.Before(escalateOn) || !isBusinessDay(calendar, now) || local.Hour() < reminderHour {
+			continue
+		}
+		debts, err := listDebts(debtor.ID)
+		if err != nil {
+			log.Printf("Error listing debts for escalation: %v", err)
+			continue
+		}
+		var total Money
+		for _, debt := range debts {
+			total += debt.Amount
+		}
+		if total > 0 {
+			overdueDays := int(now.Sub(paymentDate).Hours() / 24)
+			text := fmt.Sprintf("Ты поручитель для *%s*. Платёж просрочен на %d дн. (срок был %s).\n\nСумма долга: *%s*",
+				escapeBold(debtor.Name), overdueDays, formatChatDate(debtor.ChatID, e.paymentDate), formatChatAmount(debtor.ChatID, total))
+			keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+				callbackButton("🔕 Отписаться", "cosign_optout:"+e.cosigner.InviteToken),
+			))
+			sendWithKeyboard(bot, e.cosigner.ChatID.Int64, text, keyboard)
+			sendToLedger(bot, debtor.ChatID, fmt.Sprintf("Поручитель для *%s* уведомлён о просрочке.", escapeBold(debtor.Name)), tgbotapi.InlineKeyboardMarkup{})
+		}
+		if err := markCosignerNotified(debtor.ID, e.paymentDate); err != nil {
+			log.Printf("Error marking cosigner notified: %v", err)
+		}
+	}
+}
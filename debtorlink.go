@@ -0,0 +1,363 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Debtor Links ---
+
+// A debtor can link their own Telegram chat by opening an invite link from
+// the owner and confirming it. The owner can then send them a reminder with
+// /remind or from the debtor card; each reminder is logged in debtor_nudges.
+// The debtor can unlink at any time from a reminder.
+type DebtorLink struct {
+	DebtorID    int
+	ChatID      sql.NullInt64
+	InviteToken string
+	LinkedAt    sql.NullTime
+}
+
+const (
+	debtorLinkStartArg = "debtor_"
+	// remindCooldown keeps the owner from sending reminders back to back.
+	remindCooldown = time.Hour
+)
+
+// debtorCardLink is a deep link that opens the debtor card in the owner's chat,
+// for messages the owner may read outside the bot, such as reminders.
+func debtorCardLink(bot Sender, debtorID int) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%d", bot.UserName(), debtorLinkStartArg, debtorID)
+}
+
+func getDebtorLink(debtorID int) (DebtorLink, error) {
+	var l DebtorLink
+	err := DB.QueryRow("SELECT debtor_id, chat_id, invite_token, linked_at FROM debtor_links WHERE debtor_id = ?", debtorID).
+		Scan(&l.DebtorID, &l.ChatID, &l.InviteToken, &l.LinkedAt)
+	return l, err
+}
+
+func getDebtorLinkByToken(token string) (DebtorLink, error) {
+	var l DebtorLink
+	err := DB.QueryRow("SELECT debtor_id, chat_id, invite_token, linked_at FROM debtor_links WHERE invite_token = ?", token).
+		Scan(&l.DebtorID, &l.ChatID, &l.InviteToken, &l.LinkedAt)
+	return l, err
+}
+
+// createDebtorLinkInvite replaces any previous link of the debtor with a fresh invite.
+func createDebtorLinkInvite(debtorID int) (DebtorLink, error) {
+	tokenBytes := make([]byte, 8)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return DebtorLink{}, err
+	}
+	_, err := DB.Exec(`INSERT INTO debtor_links (debtor_id, chat_id, invite_token, linked_at) VALUES (?, NULL, ?, NULL)
+        ON CONFLICT(debtor_id) DO UPDATE SET chat_id = NULL, invite_token = excluded.invite_token, linked_at = NULL`,
+		debtorID, hex.EncodeToString(tokenBytes))
+	if err != nil {
+		return DebtorLink{}, err
+	}
+	return getDebtorLink(debtorID)
+}
+
+func confirmDebtorLink(debtorID int, chatID int64) error {
+	_, err := DB.Exec("UPDATE debtor_links SET chat_id = ?, linked_at = ? WHERE debtor_id = ?", chatID, time.Now(), debtorID)
+	return err
+}
+
+func deleteDebtorLink(debtorID int) error {
+	_, err := DB.Exec("DELETE FROM debtor_links WHERE debtor_id = ?", debtorID)
+	return err
+}
+
+func addDebtorNudge(debtorID int, at time.Time) error {
+	_, err := DB.Exec("INSERT INTO debtor_nudges (debtor_id, sent_at) VALUES (?, ?)", debtorID, at)
+	return err
+}
+
+// lastDebtorNudge returns when the debtor was last reminded and how many reminders were sent in total.
+func lastDebtorNudge(debtorID int) (time.Time, int, error) {
+	var count int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM debtor_nudges WHERE debtor_id = ?", debtorID).Scan(&count); err != nil || count == 0 {
+		return time.Time{}, count, err
+	}
+	var last time.Time
+	err := DB.QueryRow("SELECT sent_at FROM debtor_nudges WHERE debtor_id = ? ORDER BY sent_at DESC LIMIT 1", debtorID).Scan(&last)
+	return last, count, err
+}
+
+func debtorLinkInviteLink(bot Sender, l DebtorLink) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%s", bot.UserName(), debtorLinkStartArg, l.InviteToken)
+}
+
+// debtorLinkStatusText describes the link for the debtor card, including the last reminder.
+func debtorLinkStatusText(settings ChatSettings, l DebtorLink) string {
+	if !l.ChatID.Valid {
+		return "ожидает подтверждения"
+	}
+	text := "связан"
+	last, count, err := lastDebtorNudge(l.DebtorID)
+	if err != nil {
+		log.Printf("Error getting last reminder: %v", err)
+	} else if count > 0 {
+		text += fmt.Sprintf(", последнее напоминание %s (всего %d)", formatDateTime(settings, last), count)
+	}
+	return text
+}
+
+// --- Reminders ---
+
+// remindDebtor sends the linked debtor a reminder with their balance and
+// payment date and logs it. The returned message is for the owner.
+func remindDebtor(bot Sender, debtor Debtor) string {
+	link, err := getDebtorLink(debtor.ID)
+	if err == sql.ErrNoRows || (err == nil && !link.ChatID.Valid) {
+		return fmt.Sprintf("*%s* ещё не связан с Telegram. Открой должника и нажми «🔗 Telegram должника», чтобы получить ссылку для него.", escapeBold(debtor.Name))
+	}
+	if err != nil {
+		log.Printf("Error getting debtor link: %v", err)
+		return "Произошла ошибка при отправке напоминания."
+	}
+	settings := getChatSettings(debtor.ChatID)
+	if last, count, err := lastDebtorNudge(debtor.ID); err != nil {
+		log.Printf("Error getting last reminder: %v", err)
+	} else if count > 0 && time.Since(last) < remindCooldown {
+		return fmt.Sprintf("Ты уже напоминал *%s* в %s. Дай человеку немного времени 🙂", escapeBold(debtor.Name), formatDateTime(settings, last))
+	}
+
+	debts, err := listDebts(debtor.ID)
+	if err != nil {
+		log.Printf("Error listing debts for reminder: %v", err)
+		return "Произошла ошибка при отправке напоминания."
+	}
+	var total Money
+	for _, debt := range debts {
+		total += debt.Amount
+	}
+	if total <= 0 {
+		return fmt.Sprintf("У *%s* нет открытых долгов, напоминать не о чем.", escapeBold(debtor.Name))
+	}
+
+	text := fmt.Sprintf("👋 Привет, *%s*! Небольшое дружеское напоминание о долге.\n\nСейчас за тобой: *%s*", escapeBold(debtor.Name), formatAmount(settings, total))
+	if debtor.PaymentDate.Valid {
+		text += fmt.Sprintf("\nВернуть до: *%s*", formatDate(settings, debtor.PaymentDate.Time))
+	}
+	if debtor.PaymentAmount.Valid {
+		text += fmt.Sprintf("\nСумма платежа: *%s*", formatAmount(settings, debtor.PaymentAmount.V))
+	}
+	text += "\n\nЕсли уже вернул — просто не обращай внимания. Спасибо!"
+	msg := tgbotapi.NewMessage(link.ChatID.Int64, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		callbackButton("🔕 Больше не напоминать", "link_optout:"+link.InviteToken),
+	))
+	if _, err := sendChattable(bot, link.ChatID.Int64, msg); err != nil {
+		log.Printf("Error sending reminder to debtor %d: %v", debtor.ID, err)
+		return fmt.Sprintf("Не удалось отправить напоминание *%s*: возможно, он заблокировал бота.", escapeBold(debtor.Name))
+	}
+
+	now := time.Now()
+	if err := addDebtorNudge(debtor.ID, now); err != nil {
+		log.Printf("Error logging reminder: %v", err)
+	}
+	return fmt.Sprintf("🔔 Напоминание отправлено *%s* (%s).", escapeBold(debtor.Name), formatDateTime(settings, now))
+}
+
+func handleRemindCommand(bot Sender, chatID int64, args string) {
+	clearUserState(chatID)
+	name := strings.TrimSpace(args)
+	if name == "" {
+		sendSimpleMessage(bot, chatID, "Укажи имя должника, например: /remind Вася")
+		return
+	}
+	debtor, err := getDebtorByName(name, chatID)
+	if err == sql.ErrNoRows {
+		sendSimpleMessage(bot, chatID, fmt.Sprintf("Должник *%s* не найден.", escapeBold(name)))
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting debtor: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при поиске должника.")
+		return
+	}
+	sendSimpleMessage(bot, chatID, remindDebtor(bot, debtor))
+}
+
+func handleRemindCallback(bot Sender, chatID int64, data string) {
+	debtor, ok := callbackDebtor(chatID, strings.TrimPrefix(data, "remind:"))
+	if !ok {
+		sendSimpleMessage(bot, chatID, "Должник не найден.")
+		return
+	}
+	sendSimpleMessage(bot, chatID, remindDebtor(bot, debtor))
+}
+
+// --- Owner Side ---
+
+func showDebtorLinkMenu(bot Sender, chatID int64, messageID int) {
+	debtor := currentDebtor(chatID)
+	link, err := getDebtorLink(debtor.ID)
+	if err == sql.ErrNoRows {
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(callbackButton("🔗 Получить ссылку", "debtor_link_invite")),
+			tgbotapi.NewInlineKeyboardRow(callbackButton("❌ Отмена", "cancel_operation")),
+		)
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("*%s* не связан с Telegram.\n\nПерешли должнику ссылку: после подтверждения ему можно будет отправлять напоминания командой /remind.", escapeBold(debtor.Name)), keyboard)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting debtor link: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при получении информации о связи.")
+		return
+	}
+
+	text := fmt.Sprintf("*Telegram %s:* %s", escapeBold(debtor.Name), debtorLinkStatusText(getChatSettings(chatID), link))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if link.ChatID.Valid {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton("🔔 Напомнить", fmt.Sprintf("remind:%d", debtor.ID))))
+	} else {
+		text += fmt.Sprintf("\n\nПерешли должнику ссылку:\n`%s`", debtorLinkInviteLink(bot, link))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton("🔗 Новая ссылка", "debtor_link_invite"),
+			callbackButton("🗑️ Отвязать", "debtor_link_remove"),
+		),
+		tgbotapi.NewInlineKeyboardRow(callbackButton("❌ Отмена", "cancel_operation")),
+	)
+	editMessageWithKeyboard(bot, chatID, messageID, text, tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+func handleDebtorLinkCallback(bot Sender, chatID int64, messageID int, data string) {
+	debtor, ok := lookupCurrentDebtor(chatID)
+	if !ok {
+		sendSimpleMessage(bot, chatID, "Сначала выбери должника через /debts.")
+		return
+	}
+
+	switch data {
+	case "debtor_link_menu":
+		showDebtorLinkMenu(bot, chatID, messageID)
+
+	case "debtor_link_invite":
+		if _, err := createDebtorLinkInvite(debtor.ID); err != nil {
+			log.Printf("Error creating debtor link invite: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось создать ссылку.")
+			return
+		}
+		showDebtorLinkMenu(bot, chatID, messageID)
+
+	case "debtor_link_remove":
+		if err := deleteDebtorLink(debtor.ID); err != nil {
+			log.Printf("Error deleting debtor link: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось отвязать должника.")
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("*%s* отвязан от Telegram.", escapeBold(debtor.Name)), tgbotapi.InlineKeyboardMarkup{})
+		showDebtorDetails(bot, chatID, debtor.ID)
+	}
+}
+
+// --- Debtor Side ---
+
+// handleDebtorStart serves both kinds of debtor_ deep links: debtor_<id> opens
+// the card for the debtor's owner, anything else is a link invite token.
+func handleDebtorStart(bot Sender, chatID int64, arg string) {
+	if debtorID, err := strconv.Atoi(arg); err == nil {
+		if debtor, ok := chatDebtor(chatID, debtorID); ok {
+			clearUserState(chatID)
+			setCurrentDebtor(chatID, debtor)
+			openDebtorDetails(bot, chatID, debtor.ID)
+			return
+		}
+	}
+	handleDebtorLinkStart(bot, chatID, arg)
+}
+
+func handleDebtorLinkStart(bot Sender, chatID int64, token string) {
+	clearUserState(chatID)
+	link, err := getDebtorLinkByToken(token)
+	if err != nil || link.ChatID.Valid {
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Error getting debtor link by token: %v", err)
+		}
+		sendSimpleMessage(bot, chatID, "Ссылка недействительна или уже использована.")
+		return
+	}
+	debtor, err := getDebtorByID(link.DebtorID)
+	if err != nil {
+		log.Printf("Error getting debtor for link invite: %v", err)
+		sendSimpleMessage(bot, chatID, "Ссылка недействительна или уже использована.")
+		return
+	}
+	if debtor.ChatID == ledgerChatID(chatID) {
+		sendSimpleMessage(bot, chatID, "Это ссылка для должника. Перешли её ему.")
+		return
+	}
+
+	text := fmt.Sprintf("Тебя записали как *%s* в списке долгов.\n\n"+
+		"Если подтвердишь, тебе смогут присылать напоминания с суммой долга и датой возврата. "+
+		"Отказаться от них можно в любой момент.\n\nЭто ты?", escapeBold(debtor.Name))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		callbackButton("✅ Да, это я", "link_accept:"+token),
+		callbackButton("❌ Нет", "link_decline:"+token),
+	))
+	sendWithKeyboard(bot, chatID, text, keyboard)
+}
+
+func handleDebtorLinkResponse(bot Sender, chatID int64, messageID int, data string) {
+	action, token, ok := strings.Cut(data, ":")
+	if !ok {
+		return
+	}
+	link, err := getDebtorLinkByToken(token)
+	if err != nil {
+		editMessageWithKeyboard(bot, chatID, messageID, "Ссылка больше не действует.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	debtor, err := getDebtorByID(link.DebtorID)
+	if err != nil {
+		log.Printf("Error getting debtor for link response: %v", err)
+		return
+	}
+
+	switch action {
+	case "link_accept", "link_decline":
+		if link.ChatID.Valid {
+			editMessageWithKeyboard(bot, chatID, messageID, "Ссылка уже использована.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		if action == "link_decline" {
+			editMessageWithKeyboard(bot, chatID, messageID, "Хорошо, напоминаний не будет.", tgbotapi.InlineKeyboardMarkup{})
+			sendToLedger(bot, debtor.ChatID, fmt.Sprintf("*%s* не подтвердил связь с Telegram.", escapeBold(debtor.Name)), tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		if err := confirmDebtorLink(debtor.ID, chatID); err != nil {
+			log.Printf("Error confirming debtor link: %v", err)
+			sendSimpleMessage(bot, chatID, "Произошла ошибка, попробуй ещё раз.")
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, "Готово! Напоминания о долге будут приходить сюда.", tgbotapi.InlineKeyboardMarkup{})
+		sendToLedger(bot, debtor.ChatID, fmt.Sprintf("✅ *%s* связан с Telegram. Теперь ему можно напомнить о долге: /remind %s", escapeBold(debtor.Name), escapeMarkdown(debtor.Name)), tgbotapi.InlineKeyboardMarkup{})
+
+	case "link_optout":
+		if !link.ChatID.Valid || link.ChatID.Int64 != chatID {
+			editMessageWithKeyboard(bot, chatID, messageID, "Напоминания уже отключены.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		if err := deleteDebtorLink(debtor.ID); err != nil {
+			log.Printf("Error removing debtor link: %v", err)
+			sendSimpleMessage(bot, chatID, "Произошла ошибка, попробуй ещё раз.")
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, "Напоминания отключены. Больше сообщений не будет.", tgbotapi.InlineKeyboardMarkup{})
+		sendToLedger(bot, debtor.ChatID, fmt.Sprintf("*%s* отключил напоминания в Telegram.", escapeBold(debtor.Name)), tgbotapi.InlineKeyboardMarkup{})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// --- Similar Debtor Names ---
+
+// Before a new debtor is created the name is compared with the existing ones,
+// so that "иван", "Иван П." or a typo like "Ивна" lead to the debtor already
+// in the list instead of a near-duplicate.
+
+// normalizeDebtorName lowercases the name, folds ё into е and reduces
+// punctuation to single spaces.
+func normalizeDebtorName(name string) string {
+	name = strings.ReplaceAll(strings.ToLower(name), "ё", "е")
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// nameDistance counts the single-rune edits between two names: insertions,
+// deletions, substitutions and swaps of neighbouring runes.
+func nameDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
+
+// typoTolerance is how many edits still count as a typo for a name this long.
+func typoTolerance(length int) int {
+	switch {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	}
+	return 2
+}
+
+// tokensMatch reports whether every word of the shorter name starts a
+// different word of the longer one, in any order: "Ivan P" and "Petrov Ivan".
+func tokensMatch(a, b string) bool {
+	short, long := strings.Fields(a), strings.Fields(b)
+	if len(short) > len(long) {
+		short, long = long, short
+	}
+	used := make([]bool, len(long))
+	for _, word := range short {
+		found := false
+		for i, candidate := range long {
+			if !used[i] && strings.HasPrefix(candidate, word) {
+				used[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func namesSimilar(a, b string) bool {
+	a, b = normalizeDebtorName(a), normalizeDebtorName(b)
+	if a == "" || b == "" {
+		return false
+	}
+	if strings.Contains(a, b) || strings.Contains(b, a) || tokensMatch(a, b) {
+		return true
+	}
+	return nameDistance(a, b) <= typoTolerance(min(len([]rune(a)), len([]rune(b))))
+}
+
+// findSimilarDebtors returns the chat's debtors whose names look like name,
+// the closest first.
+func findSimilarDebtors(chatID int64, name string) ([]Debtor, error) {
+	debtors, err := listDebtors(chatID)
+	if err != nil {
+		return nil, err
+	}
+	var matches []Debtor
+	for _, debtor := range debtors {
+		if namesSimilar(debtor.Name, name) {
+			debtor.ChatID = ledgerChatID(chatID)
+			matches = append(matches, debtor)
+		}
+	}
+	normalized := normalizeDebtorName(name)
+	sort.SliceStable(matches, func(i, j int) bool {
+		return nameDistance(normalizeDebtorName(matches[i].Name), normalized) < nameDistance(normalizeDebtorName(matches[j].Name), normalized)
+	})
+	return matches, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Monthly Digest ---
+
+// At the start of each month every active chat gets a summary of the month
+// that just ended. digest_sent_for remembers the month, so each digest is sent
+// once; a digest missed for more than digestGraceDays (e.g. the bot was down)
+// is skipped rather than sent late.
+const digestGraceDays = 3
+
+// digestTopDebtors is how many of the largest balances the digest lists.
+const digestTopDebtors = 5
+
+var monthNames = [...]string{"январь", "февраль", "март", "апрель", "май", "июнь",
+	"июль", "август", "сентябрь", "октябрь", "ноябрь", "декабрь"}
+
+func runMonthlyDigests(bot Sender) {
+	rows, err := DB.Query("SELECT chat_id FROM chat_activity WHERE archived_at IS NULL")
+	if err != nil {
+		log.Printf("Error listing chats for monthly digest: %v", err)
+		return
+	}
+	var chatIDs []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			log.Printf("Error scanning chat for monthly digest: %v", err)
+			continue
+		}
+		chatIDs = append(chatIDs, chatID)
+	}
+	rows.Close()
+
+	for _, chatID := range chatIDs {
+		// Members get the digest of the ledger they joined from its owner.
+		if ledgerChatID(chatID) != chatID {
+			continue
+		}
+		settings := getChatSettings(chatID)
+		if !settings.MonthlyDigest {
+			continue
+		}
+		now := time.Now().In(chatLocation(settings))
+		if now.Day() > digestGraceDays || now.Hour() < reminderHour {
+			continue
+		}
+		end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		start := end.AddDate(0, -1, 0)
+		month := start.Format("2006-01")
+
+		var sentFor string
+		if err := DB.QueryRow("SELECT digest_sent_for FROM chat_settings WHERE chat_id = ?", chatID).Scan(&sentFor); err == nil && sentFor == month {
+			continue
+		}
+
+		report, err := buildPeriodReport(chatID, start, end)
+		if err != nil {
+			log.Printf("Error building monthly digest: %v", err)
+			continue
+		}
+		if len(report.Debtors) > 0 {
+			sendToLedger(bot, chatID, monthlyDigestText(bot, settings, start, report), tgbotapi.InlineKeyboardMarkup{})
+		}
+		if err := upsertChatSetting(chatID, "digest_sent_for", month); err != nil {
+			log.Printf("Error marking monthly digest sent: %v", err)
+		}
+	}
+}
+
+func monthlyDigestText(bot Sender, settings ChatSettings, start time.Time, report annualReport) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🗓 *Сводка за %s %d*\n\n", monthNames[start.Month()-1], start.Year()))
+	text.WriteString(fmt.Sprintf("Новых долгов: *%d* на %s\n", report.Total.Added, formatAmount(settings, report.Total.Lent)))
+	text.WriteString(fmt.Sprintf("Получено платежей: *%s*\n", formatAmount(settings, report.Total.Repaid)))
+	text.WriteString(fmt.Sprintf("Закрыто долгов: *%d*\n", report.Total.Closed))
+	if report.Total.Forgiven > 0 {
+		text.WriteString(fmt.Sprintf("Прощено: *%s*\n", formatAmount(settings, report.Total.Forgiven)))
+	}
+	text.WriteString(fmt.Sprintf("\nОстаток на конец месяца: *%s*\n\n", formatAmount(settings, report.Total.Outstanding)))
+
+	// The largest balances link to their cards, so the digest leads straight to them.
+	debtors := slices.Clone(report.Debtors)
+	slices.SortStableFunc(debtors, func(a, b debtorPeriodTotals) int { return cmp.Compare(b.Outstanding, a.Outstanding) })
+	shown := 0
+	for _, debtor := range debtors {
+		if debtor.Outstanding <= 0 || shown == digestTopDebtors {
+			break
+		}
+		if shown == 0 {
+			text.WriteString("Больше всех должны:\n")
+		}
+		text.WriteString(fmt.Sprintf("- *%s*: %s · [открыть](%s)\n", escapeBold(debtor.Name), formatAmount(settings, debtor.Outstanding), debtorCardLink(bot, debtor.DebtorID)))
+		shown++
+	}
+	if shown > 0 {
+		text.WriteString("\n")
+	}
+	text.WriteString("Отключить сводку можно в /settings.")
+	return text.String()
+}
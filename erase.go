@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// --- Data Erasure ---
+
+// /deletemydata wipes everything stored for a chat. Unlike deleting a debtor
+// it cannot be undone, so the confirmation word has to be typed in.
+
+const eraseConfirmWord = "УДАЛИТЬ"
+
+// eraseChatData deletes, in one transaction, the chat's ledger (the same
+// tables that get archived) together with its shared access, the chat's
+// membership in another ledger and the debtor and cosigner links that point
+// at the chat. The chat's archive file, if any, is removed as well.
+func eraseChatData(chatID int64) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := len(archiveTables) - 1; i >= 0; i-- {
+		table := archiveTables[i]
+		if _, err := tx.Exec("DELETE FROM "+table.Name+" WHERE "+table.Where, chatID); err != nil {
+			return fmt.Errorf("erase %s: %w", table.Name, err)
+		}
+		if table.Name == "debts" {
+			if err := clearDebtEvents(tx, chatID); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM ledger_members WHERE chat_id = ? OR ledger_chat_id = ?", chatID, chatID); err != nil {
+		return err
+	}
+	for _, query := range []string{
+		"DELETE FROM ledger_invites WHERE ledger_chat_id = ?",
+		"DELETE FROM debtor_links WHERE chat_id = ?",
+		"DELETE FROM cosigners WHERE chat_id = ?",
+		"DELETE FROM chat_activity WHERE chat_id = ?",
+		"DELETE FROM chats WHERE chat_id = ?",
+		"DELETE FROM outbox WHERE chat_id = ?",
+	} {
+		if _, err := tx.Exec(query, chatID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	forgetSession(chatID)
+	forgetDetailsMessage(chatID)
+	forgetChatActivity(chatID)
+	if config.Archive.Dir != "" {
+		if err := os.Remove(archiveFilePath(config.Archive, chatID)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func handleDeleteMyDataCommand(bot Sender, chatID int64) {
+	clearUserState(chatID)
+
+	var text strings.Builder
+	text.WriteString("⚠️ *Удаление всех данных*\n\n")
+	if ledger := ledgerChatID(chatID); ledger != chatID {
+		text.WriteString("Ты участвуешь в общем учёте, поэтому общие должники и долги останутся у его владельца — ты только выйдешь из него. ")
+		text.WriteString("Будут удалены настройки чата и связи с ним.\n\n")
+	} else {
+		var debtors, debts int
+		if err := DB.QueryRow("SELECT COUNT(*), (SELECT COUNT(*) FROM debts WHERE "+archiveDebtorFilter+") FROM debtors WHERE chat_id = ?", chatID, chatID).Scan(&debtors, &debts); err != nil {
+			log.Printf("Error counting chat data: %v", err)
+			sendSimpleMessage(bot, chatID, "Произошла ошибка при подсчёте данных.")
+			return
+		}
+		text.WriteString(fmt.Sprintf("Будут удалены должники (%d) и открытые долги (%d), история платежей, кредиты, корзина, настройки и связи с Telegram должников.\n\n", debtors, debts))
+		if members := len(ledgerChats(chatID)) - 1; members > 0 {
+			text.WriteString(fmt.Sprintf("Участники общего учёта (%d) тоже потеряют доступ к этим данным.\n\n", members))
+		}
+	}
+	text.WriteString(fmt.Sprintf("Восстановить данные будет нельзя. Чтобы подтвердить, отправь слово *%s*.", eraseConfirmWord))
+
+	setUserState(chatID, StateConfirmingDataErasure)
+	sendPrompt(bot, chatID, text.String())
+}
+
+func handleDataErasureInput(bot Sender, chatID int64, text string) {
+	if !strings.EqualFold(strings.TrimSpace(text), eraseConfirmWord) {
+		clearUserState(chatID)
+		sendSimpleMessage(bot, chatID, "Слово не совпало — данные не удалены.")
+		return
+	}
+
+	var members []int64
+	if ledgerChatID(chatID) == chatID {
+		members = ledgerChats(chatID)[1:]
+	}
+	if err := eraseChatData(chatID); err != nil {
+		log.Printf("Error erasing chat data: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при удалении данных. Попробуй ещё раз позже.")
+		return
+	}
+	log.Printf("Erased all data of chat %d", chatID)
+	for _, id := range members {
+		sendSimpleMessage(bot, id, "👥 Владелец общего учёта удалил все данные, общий учёт закрыт.")
+	}
+	sendSimpleMessage(bot, chatID, "🗑 Все данные удалены. Если захочешь вернуться, просто начни с /add.")
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// --- Event Webhooks ---
+
+// Outbound webhooks are disabled unless EVENT_WEBHOOK_URLS is set to a
+// comma-separated list of http(s) URLs. Every ledger change in any chat is
+// POSTed to each URL as a JSON event; receivers filter by chat_id. With
+// EVENT_WEBHOOK_SECRET set, requests carry an "X-Signature: sha256=<hex>"
+// HMAC of the body. Delivery is best effort: events are queued in memory,
+// retried a few times and dropped when the queue is full or the bot stops.
+
+const (
+	EventDebtAdded       = "debt_added"
+	EventDebtClosed      = "debt_closed"
+	EventPaymentRecorded = "payment_recorded"
+	EventDebtorDeleted   = "debtor_deleted"
+)
+
+const (
+	eventQueueSize    = 1000
+	eventSendAttempts = 3
+	eventSendTimeout  = 10 * time.Second
+)
+
+type eventWebhookSettings struct {
+	URLs   []string
+	Secret string
+}
+
+var eventQueue chan []byte
+
+type ledgerEvent struct {
+	Event   string        `json:"event"`
+	ChatID  int64         `json:"chat_id"`
+	Time    time.Time     `json:"time"`
+	Debtor  eventDebtor   `json:"debtor"`
+	Debt    *apiDebt      `json:"debt,omitempty"`
+	Payment *eventPayment `json:"payment,omitempty"`
+}
+
+type eventDebtor struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type eventPayment struct {
+	DebtID int    `json:"debt_id"`
+	Reason string `json:"reason"`
+	Amount Money  `json:"amount"`
+	Method string `json:"method"`
+}
+
+// loadEventWebhookConfig reads EVENT_WEBHOOK_URLS and EVENT_WEBHOOK_SECRET;
+// events are not sent while the list of URLs is empty.
+func loadEventWebhookConfig(env envSource) (eventWebhookSettings, error) {
+	var cfg eventWebhookSettings
+	for _, raw := range strings.Split(env.get("EVENT_WEBHOOK_URLS"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return cfg, fmt.Errorf("invalid EVENT_WEBHOOK_URLS entry %q: expected an http(s) URL", raw)
+		}
+		cfg.URLs = append(cfg.URLs, raw)
+	}
+	cfg.Secret = env.get("EVENT_WEBHOOK_SECRET")
+	return cfg, nil
+}
+
+func eventWebhooksEnabled() bool {
+	return eventQueue != nil
+}
+
+// startEventWebhooks starts the delivery worker if any URL is configured.
+func startEventWebhooks() {
+	if len(config.EventWebhooks.URLs) == 0 {
+		return
+	}
+	eventQueue = make(chan []byte, eventQueueSize)
+	go func() {
+		client := &http.Client{Timeout: eventSendTimeout}
+		for body := range eventQueue {
+			for _, target := range config.EventWebhooks.URLs {
+				deliverEvent(client, target, body)
+			}
+		}
+	}()
+	log.Printf("Sending ledger events to %d webhook URL(s)", len(config.EventWebhooks.URLs))
+}
+
+func deliverEvent(client *http.Client, target string, body []byte) {
+	for attempt := 1; ; attempt++ {
+		err := postEvent(client, target, body)
+		if err == nil {
+			return
+		}
+		if attempt == eventSendAttempts {
+			log.Printf("Error delivering event to %s, giving up: %v", target, err)
+			return
+		}
+		time.Sleep(time.Duration(attempt*attempt) * time.Second)
+	}
+}
+
+func postEvent(client *http.Client, target string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if config.EventWebhooks.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(config.EventWebhooks.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// emitEvent queues an event about the debtor; debt and payment are optional.
+func emitEvent(kind string, debtor Debtor, debt *Debt, payment *Payment) {
+	if !eventWebhooksEnabled() {
+		return
+	}
+	event := ledgerEvent{
+		Event:  kind,
+		ChatID: debtor.ChatID,
+		Time:   time.Now(),
+		Debtor: eventDebtor{ID: debtor.ID, Name: debtor.Name},
+	}
+	if debt != nil {
+		event.Debt = &apiDebt{ID: debt.ID, DebtorID: debt.DebtorID, Amount: debt.Amount, Reason: debt.Reason, Tag: debt.Tag}
+	}
+	if payment != nil {
+		event.Payment = &eventPayment{DebtID: payment.DebtID, Reason: payment.Reason, Amount: payment.Amount, Method: payment.Method}
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", kind, err)
+		return
+	}
+	select {
+	case eventQueue <- body:
+	default:
+		log.Printf("Event queue is full, dropping %s event", kind)
+	}
+}
+
+// emitDebtEvent looks up the debt's debtor and queues an event about the
+// debt, or about the payment if there is one.
+func emitDebtEvent(kind string, debt Debt, payment *Payment) {
+	if !eventWebhooksEnabled() {
+		return
+	}
+	debtor, err := getDebtorByID(debt.DebtorID)
+	if err != nil {
+		log.Printf("Error getting debtor for %s event: %v", kind, err)
+		return
+	}
+	if payment != nil {
+		emitEvent(kind, debtor, nil, payment)
+		return
+	}
+	emitEvent(kind, debtor, &debt, nil)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// --- Export Filters ---
+
+// exportFilter narrows /exportcsv to one debtor and/or a date range. Debts
+// are matched by when they were created, payments by when they were made;
+// debts created before creation times were tracked have no known date and
+// are left out of ranged exports.
+type exportFilter struct {
+	// Debtor limits the export to one debtor; ID 0 means all debtors.
+	Debtor Debtor
+	// From and To are inclusive calendar dates; zero values mean no range.
+	From, To time.Time
+}
+
+var dateInputFormats = []string{"02.01.2006", "02.01.06", "2.1.2006", "2.1.06", "02-01-2006", "02-01-06", "2-1-2006", "2-1-06"}
+
+// parseDateInput parses a date typed by the user: in the chat's date format,
+// with a full or two-digit year, or as 31.12.2024 or 31.12.24.
+func parseDateInput(settings ChatSettings, text string) (time.Time, bool) {
+	formats := append([]string{settings.DateFormat, strings.Replace(settings.DateFormat, "2006", "06", 1)}, dateInputFormats...)
+	for _, format := range formats {
+		if t, err := time.Parse(format, strings.TrimSpace(text)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (f exportFilter) hasRange() bool {
+	return !f.From.IsZero()
+}
+
+func (f exportFilter) isEmpty() bool {
+	return f.Debtor.ID == 0 && !f.hasRange()
+}
+
+// inRange reports whether the moment t falls within the filter's dates in the chat's timezone.
+func (f exportFilter) inRange(settings ChatSettings, t time.Time) bool {
+	if !f.hasRange() {
+		return true
+	}
+	local := t.In(chatLocation(settings))
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	return !day.Before(f.From) && !day.After(f.To)
+}
+
+// parseExportFilter reads "[имя] [с по]" from the command arguments. If they
+// can't be used, it returns a message for the user instead.
+func parseExportFilter(chatID int64, args string) (exportFilter, string) {
+	var filter exportFilter
+	settings := getChatSettings(chatID)
+	fields := strings.Fields(args)
+	if n := len(fields); n >= 2 {
+		from, okFrom := parseDateInput(settings, fields[n-2])
+		to, okTo := parseDateInput(settings, fields[n-1])
+		if okFrom && okTo {
+			if to.Before(from) {
+				return filter, "Начальная дата периода позже конечной."
+			}
+			filter.From, filter.To = from, to
+			fields = fields[:n-2]
+		}
+	}
+	if len(fields) > 0 {
+		if _, ok := parseDateInput(settings, fields[len(fields)-1]); ok {
+			return filter, fmt.Sprintf("Укажи обе даты периода, например: /exportcsv %s %s",
+				formatDate(settings, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)), formatDate(settings, time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)))
+		}
+		name := strings.Join(fields, " ")
+		debtor, err := getDebtorByName(name, chatID)
+		if err == sql.ErrNoRows {
+			return filter, fmt.Sprintf("Должник *%s* не найден.", escapeBold(name))
+		}
+		if err != nil {
+			log.Printf("Error getting debtor: %v", err)
+			return filter, "Произошла ошибка при поиске должника."
+		}
+		filter.Debtor = debtor
+	}
+	return filter, ""
+}
+
+// listFilteredPayments returns the payments matching the filter, oldest first.
+func listFilteredPayments(chatID int64, filter exportFilter) ([]Payment, error) {
+	query := `SELECT p.id, p.debtor_id, p.debt_id, d.name, p.reason, p.amount_cents, p.method, p.paid_at
+        FROM payments p JOIN debtors d ON d.id = p.debtor_id
+        WHERE d.chat_id = ?`
+	args := []interface{}{ledgerChatID(chatID)}
+	if filter.Debtor.ID != 0 {
+		query += " AND p.debtor_id = ?"
+		args = append(args, filter.Debtor.ID)
+	}
+	rows, err := DB.Query(query+" ORDER BY p.paid_at, p.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := getChatSettings(chatID)
+	var payments []Payment
+	for rows.Next() {
+		var p Payment
+		if err := rows.Scan(&p.ID, &p.DebtorID, &p.DebtID, &p.DebtorName, &p.Reason, &p.Amount, &p.Method, &p.PaidAt); err != nil {
+			return nil, err
+		}
+		if filter.inRange(settings, p.PaidAt) {
+			payments = append(payments, p)
+		}
+	}
+	return payments, rows.Err()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Fake Sender ---
+
+// fakeSender is a Sender that records what the handlers send instead of
+// talking to Telegram, so conversation flows and keyboards can be checked in
+// tests. Set Err to make every call fail; FileURLs maps the IDs of files
+// "sent by the user" to URLs the test serves them from.
+type fakeSender struct {
+	mu          sync.Mutex
+	Sent        []tgbotapi.Chattable
+	Requests    []tgbotapi.Chattable
+	APIRequests []string
+	FileURLs    map[string]string
+	Err         error
+	nextID      int
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{}
+}
+
+func (f *fakeSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return tgbotapi.Message{}, f.Err
+	}
+	f.Sent = append(f.Sent, c)
+	f.nextID++
+	return tgbotapi.Message{MessageID: f.nextID}, nil
+}
+
+func (f *fakeSender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	f.Requests = append(f.Requests, c)
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (f *fakeSender) MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	f.APIRequests = append(f.APIRequests, endpoint)
+	return &tgbotapi.APIResponse{Ok: true, Result: []byte(`""`)}, nil
+}
+
+func (f *fakeSender) UserName() string {
+	return "DebtTrackerTestBot"
+}
+
+func (f *fakeSender) GetFileDirectURL(fileID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return "", f.Err
+	}
+	url, ok := f.FileURLs[fileID]
+	if !ok {
+		return "", fmt.Errorf("unknown file %s", fileID)
+	}
+	return url, nil
+}
+
+// Texts returns the text of every message sent or edited so far, in order.
+func (f *fakeSender) Texts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var texts []string
+	for _, c := range f.Sent {
+		switch m := c.(type) {
+		case tgbotapi.MessageConfig:
+			texts = append(texts, m.Text)
+		case tgbotapi.EditMessageTextConfig:
+			texts = append(texts, m.Text)
+		}
+	}
+	return texts
+}
+
+// LastKeyboard returns the inline keyboard of the most recent message that had one.
+func (f *fakeSender) LastKeyboard() (tgbotapi.InlineKeyboardMarkup, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.Sent) - 1; i >= 0; i-- {
+		switch m := f.Sent[i].(type) {
+		case tgbotapi.MessageConfig:
+			if keyboard, ok := m.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup); ok {
+				return keyboard, true
+			}
+		case tgbotapi.EditMessageTextConfig:
+			if m.ReplyMarkup != nil {
+				return *m.ReplyMarkup, true
+			}
+		}
+	}
+	return tgbotapi.InlineKeyboardMarkup{}, false
+}
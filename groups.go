@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Debt Groups ---
+
+// A debt group links debts that came from the same receipt or event, so the
+// whole group can be reviewed, renamed or closed at once.
+
+type DebtGroup struct {
+	ID        int
+	ChatID    int64
+	Reason    string
+	CreatedAt time.Time
+}
+
+// groupDebt is a debt together with the name of the debtor who owes it.
+type groupDebt struct {
+	Debt
+	DebtorName string
+}
+
+func addDebtGroupTx(tx *sql.Tx, chatID int64, reason string) (int64, error) {
+	result, err := tx.Exec("INSERT INTO debt_groups (chat_id, reason, created_at) VALUES (?, ?, ?)", ledgerChatID(chatID), reason, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func getDebtGroup(groupID int) (DebtGroup, error) {
+	var group DebtGroup
+	err := DB.QueryRow("SELECT id, chat_id, reason, created_at FROM debt_groups WHERE id = ?", groupID).Scan(&group.ID, &group.ChatID, &group.Reason, &group.CreatedAt)
+	return group, err
+}
+
+func listGroupDebts(groupID int) ([]groupDebt, error) {
+	rows, err := DB.Query(`
+		SELECT d.id, d.debtor_id, d.amount_cents, d.reason, d.group_id, r.name
+		FROM debts d
+		JOIN debtors r ON r.id = d.debtor_id
+		WHERE d.group_id = ?
+		ORDER BY r.name`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var debts []groupDebt
+	for rows.Next() {
+		var debt groupDebt
+		if err := rows.Scan(&debt.ID, &debt.DebtorID, &debt.Amount, &debt.Reason, &debt.GroupID, &debt.DebtorName); err != nil {
+			return nil, err
+		}
+		debts = append(debts, debt)
+	}
+	return debts, rows.Err()
+}
+
+func closeDebtGroup(groupID int) error {
+	var debts []groupDebt
+	if eventWebhooksEnabled() {
+		var err error
+		if debts, err = listGroupDebts(groupID); err != nil {
+			return err
+		}
+	}
+	if _, err := DB.Exec("DELETE FROM debts WHERE group_id = ?", groupID); err != nil {
+		return err
+	}
+	for _, debt := range debts {
+		emitDebtEvent(EventDebtClosed, debt.Debt, nil)
+	}
+	return nil
+}
+
+// renameDebtGroup updates the group reason together with the reason of every debt in it.
+func renameDebtGroup(groupID int, reason string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE debt_groups SET reason = ? WHERE id = ?", reason, groupID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE debts SET reason = ? WHERE group_id = ?", reason, groupID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// --- Debt Group Flow ---
+
+// chatDebtGroup parses the group ID from callback data and makes sure the group belongs to the chat.
+func chatDebtGroup(chatID int64, data, prefix string) (DebtGroup, bool) {
+	groupID, err := strconv.Atoi(strings.TrimPrefix(data, prefix))
+	if err != nil {
+		log.Printf("Invalid debt group ID in callback: %v", err)
+		return DebtGroup{}, false
+	}
+	group, err := getDebtGroup(groupID)
+	if err != nil || group.ChatID != ledgerChatID(chatID) {
+		log.Printf("Error getting debt group %d: %v", groupID, err)
+		return DebtGroup{}, false
+	}
+	return group, true
+}
+
+func showDebtGroup(bot Sender, chatID int64, messageID int, group DebtGroup) {
+	debts, err := listGroupDebts(group.ID)
+	if err != nil {
+		log.Printf("Error listing group debts: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при получении долгов группы.")
+		return
+	}
+	if len(debts) == 0 {
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Все долги за *%s* уже закрыты.", escapeBold(group.Reason)), tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+
+	settings := getChatSettings(chatID)
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🧾 *%s* (%s)\n\n", escapeBold(group.Reason), formatDate(settings, group.CreatedAt.In(chatLocation(settings)))))
+	var total Money
+	for _, debt := range debts {
+		text.WriteString(fmt.Sprintf("- *%s* должен *%s*\n", escapeBold(debt.DebtorName), formatAmount(settings, debt.Amount)))
+		total += debt.Amount
+	}
+	text.WriteString(fmt.Sprintf("\n*Осталось: %s*", formatAmount(settings, total)))
+
+	screen := navScreen{Kind: navDebtGroup, ID: group.ID}
+	enterNavScreen(chatID, screen)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton("✅ Закрыть всю группу", fmt.Sprintf("group_close:%d", group.ID)),
+			callbackButton("✏️ Изменить причину", fmt.Sprintf("group_reason:%d", group.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(backButton(screen)),
+	)
+	editMessageWithKeyboard(bot, chatID, messageID, text.String(), keyboard)
+}
+
+func handleDebtGroupCallback(bot Sender, chatID int64, messageID int, data string) {
+	switch {
+	case strings.HasPrefix(data, "group_show:"):
+		if group, ok := chatDebtGroup(chatID, data, "group_show:"); ok {
+			showDebtGroup(bot, chatID, messageID, group)
+		}
+
+	case strings.HasPrefix(data, "group_close:"):
+		group, ok := chatDebtGroup(chatID, data, "group_close:")
+		if !ok {
+			return
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				callbackButton("✅ Да, закрыть все", fmt.Sprintf("group_confirm_close:%d", group.ID)),
+				callbackButton("❌ Отмена", "cancel_operation"),
+			),
+		)
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Закрыть все долги за *%s*?", escapeBold(group.Reason)), keyboard)
+
+	case strings.HasPrefix(data, "group_confirm_close:"):
+		group, ok := chatDebtGroup(chatID, data, "group_confirm_close:")
+		if !ok {
+			return
+		}
+		if err := closeDebtGroup(group.ID); err != nil {
+			log.Printf("Error closing debt group: %v", err)
+			sendSimpleMessage(bot, chatID, "Произошла ошибка при закрытии долгов группы.")
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Все долги за *%s* закрыты.", escapeBold(group.Reason)), tgbotapi.InlineKeyboardMarkup{})
+		if debtor, ok := lookupCurrentDebtor(chatID); ok && debtor.ID != 0 {
+			showDebtorDetails(bot, chatID, debtor.ID)
+		}
+		clearUserState(chatID)
+
+	case strings.HasPrefix(data, "group_reason:"):
+		group, ok := chatDebtGroup(chatID, data, "group_reason:")
+		if !ok {
+			return
+		}
+		setSelectedDebt(chatID, Debt{GroupID: sql.NullInt64{Int64: int64(group.ID), Valid: true}})
+		setUserState(chatID, StateEditingGroupReason)
+		editPrompt(bot, chatID, messageID, fmt.Sprintf("Введи новую причину для всех долгов за *%s*:", escapeBold(group.Reason)))
+	}
+}
+
+func handleGroupReason(bot Sender, chatID int64, text string) {
+	defer clearUserState(chatID)
+	groupID := selectedDebt(chatID).GroupID
+	if !groupID.Valid {
+		sendSimpleMessage(bot, chatID, "Группа долгов не выбрана.")
+		return
+	}
+	if err := renameDebtGroup(int(groupID.Int64), text); err != nil {
+		log.Printf("Error renaming debt group: %v", err)
+		sendSimpleMessage(bot, chatID, "Не удалось обновить причину долгов.")
+		return
+	}
+	sendSimpleMessage(bot, chatID, "Причина обновлена для всех долгов группы.")
+	if debtor, ok := lookupCurrentDebtor(chatID); ok && debtor.ID != 0 {
+		showDebtorDetails(bot, chatID, debtor.ID)
+	}
+}
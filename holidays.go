@@ -0,0 +1,91 @@
+package main
+
+import (
+	"time"
+)
+
+// --- Holiday Calendars ---
+
+type holidayCalendar struct {
+	Name string
+	// Holidays lists fixed public holidays as "MM-DD".
+	Holidays []string
+	Weekends bool
+}
+
+const (
+	HolidayCalendarNone     = "none"
+	HolidayCalendarWeekends = "weekends"
+	defaultHolidayCalendar  = "RU"
+)
+
+var holidayCalendarOrder = []string{"RU", "BY", "KZ", HolidayCalendarWeekends, HolidayCalendarNone}
+
+var holidayCalendars = map[string]holidayCalendar{
+	"RU": {
+		Name:     "🇷🇺 Россия",
+		Holidays: []string{"01-01", "01-02", "01-03", "01-04", "01-05", "01-06", "01-07", "01-08", "02-23", "03-08", "05-01", "05-09", "06-12", "11-04"},
+		Weekends: true,
+	},
+	"BY": {
+		Name:     "🇧🇾 Беларусь",
+		Holidays: []string{"01-01", "01-02", "01-07", "03-08", "05-01", "05-09", "07-03", "11-07", "12-25"},
+		Weekends: true,
+	},
+	"KZ": {
+		Name:     "🇰🇿 Казахстан",
+		Holidays: []string{"01-01", "01-02", "01-07", "03-08", "03-21", "03-22", "03-23", "05-01", "05-07", "05-09", "07-06", "08-30", "10-25", "12-16"},
+		Weekends: true,
+	},
+	HolidayCalendarWeekends: {
+		Name:     "Только выходные",
+		Weekends: true,
+	},
+	HolidayCalendarNone: {
+		Name: "Без переноса",
+	},
+}
+
+func isHolidayCalendar(code string) bool {
+	_, ok := holidayCalendars[code]
+	return ok
+}
+
+// isBusinessDay reports whether notifications may be sent on the given day.
+func isBusinessDay(calendarCode string, t time.Time) bool {
+	calendar, ok := holidayCalendars[calendarCode]
+	if !ok {
+		calendar = holidayCalendars[defaultHolidayCalendar]
+	}
+	if calendar.Weekends && (t.Weekday() == time.Saturday || t.Weekday() == time.Sunday) {
+		return false
+	}
+	day := t.Format("01-02")
+	for _, holiday := range calendar.Holidays {
+		if holiday == day {
+			return false
+		}
+	}
+	return true
+}
+
+func nextBusinessDay(calendarCode string, t time.Time) time.Time {
+	for !isBusinessDay(calendarCode, t) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+func holidayRuleText(calendarCode string) string {
+	calendar, ok := holidayCalendars[calendarCode]
+	if !ok {
+		calendar = holidayCalendars[defaultHolidayCalendar]
+	}
+	switch {
+	case calendar.Weekends && len(calendar.Holidays) > 0:
+		return "уведомления в выходные и праздники переносятся на следующий рабочий день"
+	case calendar.Weekends:
+		return "уведомления в выходные переносятся на понедельник"
+	}
+	return "уведомления отправляются в любой день"
+}
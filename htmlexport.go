@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- HTML Export ---
+
+// The HTML export is a single self-contained page meant for printing or
+// archiving: styles are embedded and the charts are inlined as SVG images.
+
+const (
+	// htmlChartBars limits the bar charts to the largest entries.
+	htmlChartBars  = 10
+	htmlChartWidth = 640
+	htmlBarHeight  = 24
+)
+
+type htmlDebtRow struct {
+	Reason string
+	Tag    string
+	Amount string
+}
+
+type htmlDebtor struct {
+	Name          string
+	Total         string
+	PaymentDate   string
+	PaymentAmount string
+	Notes         string
+	Debts         []htmlDebtRow
+	Paid          []htmlChartEntry
+	total         Money
+}
+
+type htmlChartEntry struct {
+	Label string
+	Value string
+	value float64
+}
+
+type htmlExport struct {
+	GeneratedAt  string
+	Total        string
+	DebtorCount  int
+	DebtCount    int
+	DebtorsChart template.URL
+	TagsChart    template.URL
+	Debtors      []htmlDebtor
+}
+
+var htmlExportTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>DebtTracker — долги на {{.GeneratedAt}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, Arial, sans-serif; color: #222; max-width: 800px; margin: 2em auto; padding: 0 1em; }
+h1 { font-size: 1.6em; margin-bottom: 0.2em; }
+h2 { font-size: 1.25em; border-bottom: 2px solid #4a76a8; padding-bottom: 0.2em; margin-top: 2em; }
+.meta { color: #777; margin-top: 0; }
+.summary { display: flex; gap: 1em; margin: 1.5em 0; }
+.summary div { flex: 1; background: #f3f6fa; border-radius: 6px; padding: 0.8em; }
+.summary b { display: block; font-size: 1.4em; }
+table { width: 100%; border-collapse: collapse; margin: 0.5em 0; }
+th, td { text-align: left; padding: 0.35em 0.5em; border-bottom: 1px solid #e3e3e3; }
+th { background: #f3f6fa; }
+td.num, th.num { text-align: right; white-space: nowrap; }
+tfoot td { font-weight: bold; border-bottom: none; }
+.tag { color: #4a76a8; }
+.notes { color: #555; font-style: italic; }
+.debtor { page-break-inside: avoid; }
+img { max-width: 100%; }
+@media print { body { margin: 0; } h2 { page-break-after: avoid; } }
+</style>
+</head>
+<body>
+<h1>Долги</h1>
+<p class="meta">Выгрузка от {{.GeneratedAt}}</p>
+<div class="summary">
+<div>Всего должны<b>{{.Total}}</b></div>
+<div>Должников<b>{{.DebtorCount}}</b></div>
+<div>Открытых долгов<b>{{.DebtCount}}</b></div>
+</div>
+{{if .DebtorsChart}}<h2>Крупнейшие должники</h2>
+<img src="{{.DebtorsChart}}" alt="Крупнейшие должники">{{end}}
+{{if .TagsChart}}<h2>По категориям</h2>
+<img src="{{.TagsChart}}" alt="Долги по категориям">{{end}}
+{{range .Debtors}}<div class="debtor">
+<h2>{{.Name}}</h2>
+{{if .PaymentDate}}<p>Дата платежа: {{.PaymentDate}}{{if .PaymentAmount}}, сумма: {{.PaymentAmount}}{{end}}</p>{{end}}
+{{if .Notes}}<p class="notes">{{.Notes}}</p>{{end}}
+{{if .Debts}}<table>
+<thead><tr><th>Причина</th><th>Тег</th><th class="num">Сумма</th></tr></thead>
+<tbody>{{range .Debts}}<tr><td>{{.Reason}}</td><td class="tag">{{if .Tag}}#{{.Tag}}{{end}}</td><td class="num">{{.Amount}}</td></tr>
+{{end}}</tbody>
+<tfoot><tr><td colspan="2">Итого</td><td class="num">{{.Total}}</td></tr></tfoot>
+</table>{{else}}<p>Открытых долгов нет.</p>{{end}}
+{{if .Paid}}<p>Получено: {{range $i, $p := .Paid}}{{if $i}}, {{end}}{{$p.Label}} — {{$p.Value}}{{end}}</p>{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+// svgBarChart renders horizontal bars as an SVG data URL, so the page stays a single file.
+func svgBarChart(entries []htmlChartEntry) template.URL {
+	if len(entries) == 0 {
+		return ""
+	}
+	if len(entries) > htmlChartBars {
+		entries = entries[:htmlChartBars]
+	}
+	var max float64
+	for _, e := range entries {
+		if e.value > max {
+			max = e.value
+		}
+	}
+	const labelWidth, valueWidth = 160, 120
+	barSpace := float64(htmlChartWidth - labelWidth - valueWidth)
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="Arial, sans-serif" font-size="13">`,
+		htmlChartWidth, len(entries)*htmlBarHeight+4)
+	for i, e := range entries {
+		y := i*htmlBarHeight + 2
+		width := 1.0
+		if max > 0 {
+			width = e.value / max * barSpace
+		}
+		fmt.Fprintf(&svg, `<text x="%d" y="%d" text-anchor="end">%s</text>`, labelWidth-8, y+16, xmlEscape(e.Label))
+		fmt.Fprintf(&svg, `<rect x="%d" y="%d" width="%.1f" height="%d" rx="3" fill="#4a76a8"/>`, labelWidth, y+3, width, htmlBarHeight-6)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%d" fill="#555">%s</text>`, float64(labelWidth)+width+6, y+16, xmlEscape(e.Value))
+	}
+	svg.WriteString(`</svg>`)
+	return template.URL("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg.String())))
+}
+
+func buildHTMLExport(chatID int64) (htmlExport, error) {
+	settings := getChatSettings(chatID)
+	export := htmlExport{GeneratedAt: formatDateTime(settings, time.Now())}
+
+	debtors, err := listDebtors(chatID)
+	if err != nil {
+		return export, err
+	}
+	if len(debtors) == 0 {
+		return export, fmt.Errorf("no debtors found for chat %d", chatID)
+	}
+
+	var total Money
+	var debtorBars []htmlChartEntry
+	for _, debtor := range debtors {
+		debts, err := listDebts(debtor.ID)
+		if err != nil {
+			return export, err
+		}
+		paid, err := sumDebtorPaymentsByMethod(debtor.ID)
+		if err != nil {
+			return export, err
+		}
+
+		item := htmlDebtor{Name: debtor.Name, Notes: debtor.Notes}
+		if debtor.PaymentDate.Valid {
+			item.PaymentDate = formatDate(settings, debtor.PaymentDate.Time)
+		}
+		if debtor.PaymentAmount.Valid {
+			item.PaymentAmount = formatAmount(settings, debtor.PaymentAmount.V)
+		}
+		for _, debt := range debts {
+			item.Debts = append(item.Debts, htmlDebtRow{Reason: debt.Reason, Tag: debt.Tag, Amount: formatAmount(settings, debt.Amount)})
+			item.total += debt.Amount
+		}
+		for _, method := range paymentMethods {
+			if paid[method] > 0 {
+				item.Paid = append(item.Paid, htmlChartEntry{Label: paymentMethodNames[method], Value: formatAmount(settings, paid[method])})
+			}
+		}
+		item.Total = formatAmount(settings, item.total)
+		if item.total > 0 {
+			debtorBars = append(debtorBars, htmlChartEntry{Label: debtor.Name, Value: item.Total, value: item.total.Float()})
+		}
+
+		export.Debtors = append(export.Debtors, item)
+		export.DebtCount += len(debts)
+		total += item.total
+	}
+	export.DebtorCount = len(debtors)
+	export.Total = formatAmount(settings, total)
+
+	sort.SliceStable(export.Debtors, func(i, j int) bool { return export.Debtors[i].total > export.Debtors[j].total })
+	sort.SliceStable(debtorBars, func(i, j int) bool { return debtorBars[i].value > debtorBars[j].value })
+	export.DebtorsChart = svgBarChart(debtorBars)
+
+	tagTotals, err := chatTagTotals(chatID)
+	if err != nil {
+		return export, err
+	}
+	var tagBars []htmlChartEntry
+	for _, t := range tagTotals {
+		label := "#" + t.Tag
+		if t.Tag == "" {
+			label = "без тега"
+		}
+		tagBars = append(tagBars, htmlChartEntry{Label: label, Value: formatAmount(settings, t.Amount), value: t.Amount.Float()})
+	}
+	sort.SliceStable(tagBars, func(i, j int) bool { return tagBars[i].value > tagBars[j].value })
+	// A single category says nothing the total doesn't.
+	if len(tagBars) > 1 {
+		export.TagsChart = svgBarChart(tagBars)
+	}
+	return export, nil
+}
+
+func generateHTML(chatID int64) (string, error) {
+	export, err := buildHTMLExport(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	tmpFile, err := os.CreateTemp("", "debts_*.html")
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+
+	if err := htmlExportTemplate.Execute(tmpFile, export); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+	return tmpFile.Name(), nil
+}
+
+func handleExportHTMLCommand(bot Sender, chatID int64) {
+	clearUserState(chatID)
+
+	stopAction := keepChatAction(bot, chatID, tgbotapi.ChatUploadDocument)
+	defer stopAction()
+	status := startProgress(bot, chatID, "⏳ Готовлю HTML…")
+
+	filePath, err := generateHTML(chatID)
+	if err != nil {
+		log.Printf("Error generating HTML export: %v", err)
+		if strings.Contains(err.Error(), "no debtors found") {
+			status.set("Нет данных для выгрузки. Сначала добавьте должников.")
+		} else {
+			status.set("Произошла ошибка при создании HTML файла.")
+		}
+		return
+	}
+	defer func() {
+		if err := os.Remove(filePath); err != nil {
+			log.Printf("Error deleting temp file: %v", err)
+		}
+	}()
+
+	status.set("📤 Отправляю файл…")
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(filePath))
+	doc.Caption = "Открой файл в браузере, чтобы посмотреть или распечатать."
+	if _, err := sendChattable(bot, chatID, doc); err != nil {
+		log.Printf("Error sending HTML export: %v", err)
+		status.set("Произошла ошибка при отправке HTML файла.")
+		return
+	}
+	status.set("✅ HTML готов.")
+}
@@ -0,0 +1,201 @@
+package main
+
+import "fmt"
+
+// --- Languages ---
+
+// The bot speaks Russian; a chat can switch its menus to English in
+// /settings. Texts are translated through englishTexts, keyed by the Russian
+// original, so a text without a translation is simply shown in Russian.
+// /start, /help, the command menu and the /settings screens with their
+// prompts are translated so far.
+
+const (
+	LanguageRussian = "ru"
+	LanguageEnglish = "en"
+)
+
+var languageOrder = []string{LanguageRussian, LanguageEnglish}
+
+var languageNames = map[string]string{
+	LanguageRussian: "🇷🇺 Русский",
+	LanguageEnglish: "🇬🇧 English",
+}
+
+// tr returns text in the chat's language.
+func tr(settings ChatSettings, text string) string {
+	if settings.Language == LanguageEnglish {
+		if translated, ok := englishTexts[text]; ok {
+			return translated
+		}
+	}
+	return text
+}
+
+// trf is fmt.Sprintf with the format in the chat's language.
+func trf(settings ChatSettings, format string, args ...interface{}) string {
+	return fmt.Sprintf(tr(settings, format), args...)
+}
+
+const startText = "Привет! Я бот DebtTracker. Я помогу тебе вести учет долгов.\n\n" +
+	"Основные команды:\n" +
+	"/add - Добавить долг\n" +
+	"/debts - Посмотреть список должников и долги\n" +
+	"/total - Сколько всего тебе должны\n" +
+	"/history - История платежей\n" +
+	"/loan - Оформить кредит с графиком платежей\n" +
+	"/stats - Долги по категориям\n" +
+	"/top - Топ должников\n" +
+	"/report - Итоги года\n" +
+	"/exportcsv - Выгрузить данные в CSV\n" +
+	"/exporthtml - Выгрузить страницу для печати\n" +
+	"/trash - Удалённые должники\n" +
+	"/share - Общий учёт с другими людьми\n" +
+	"/remind - Напомнить должнику о долге\n" +
+	"/settings - Настройки\n" +
+	"/cancel - Отменить текущее действие\n" +
+	"/help - Помощь и список команд"
+
+var englishTexts = map[string]string{
+	startText: "Hi! I'm DebtTracker. I'll help you keep track of debts.\n\n" +
+		"Main commands:\n" +
+		"/add - Add a debt\n" +
+		"/debts - Debtors and their debts\n" +
+		"/total - How much you are owed in total\n" +
+		"/history - Payment history\n" +
+		"/loan - Set up a loan with a payment schedule\n" +
+		"/stats - Debts by category\n" +
+		"/top - Top debtors\n" +
+		"/report - Year in review\n" +
+		"/exportcsv - Export data to CSV\n" +
+		"/exporthtml - Export a printable page\n" +
+		"/trash - Deleted debtors\n" +
+		"/share - Keep debts together with others\n" +
+		"/remind - Remind a debtor about a debt\n" +
+		"/settings - Settings\n" +
+		"/cancel - Cancel the current action\n" +
+		"/help - Help and the list of commands",
+	"Привет! Не удалось загрузить изображение, но я DebtTracker и я помогу тебе вести учет долгов.": "Hi! The picture failed to load, but I'm DebtTracker and I'll help you keep track of debts.",
+	"**Команды бота DebtTracker:**\n\n": "**DebtTracker commands:**\n\n",
+
+	// /settings
+	"*Настройки*\n\n":                       "*Settings*\n\n",
+	"Язык: *%s*\n":                          "Language: *%s*\n",
+	"Валюта: *%s*\n":                        "Currency: *%s*\n",
+	"Знаков после запятой: *%d*\n":          "Decimal places: *%d*\n",
+	"Пример: %s\n\n":                        "Example: %s\n\n",
+	"Календарь уведомлений: *%s* — %s\n\n":  "Notification calendar: *%s* — %s\n\n",
+	"Формат даты: *%s*\n":                   "Date format: *%s*\n",
+	"Часовой пояс: *%s*\n":                  "Time zone: *%s*\n",
+	"Напоминания о платежах: *%s*\n":        "Payment reminders: *%s*\n",
+	"Сводка за месяц: *%s*\n":               "Monthly digest: *%s*\n",
+	"Автовыгрузка: *%s*\n":                  "Scheduled export: *%s*\n",
+	"Сортировка должников: *%s*\n":          "Debtor order: *%s*\n",
+	"Порядок долгов: *%s*\n":                "Debt order: *%s*\n",
+	"Распределение платежей: *%s*\n":        "Payment allocation: *%s*\n",
+	"QR для оплаты: *%s*\n":                 "Payment QR: *%s*\n",
+	"Максимальная сумма долга: *%s*":        "Maximum debt: *%s*",
+	"🌐 Язык":                                "🌐 Language",
+	"💱 Валюта":                              "💱 Currency",
+	"🔢 Знаки после запятой":                 "🔢 Decimal places",
+	"🔣 Формат чисел":                        "🔣 Number format",
+	"📅 Календарь уведомлений":               "📅 Notification calendar",
+	"📆 Формат даты":                         "📆 Date format",
+	"🕒 Часовой пояс":                        "🕒 Time zone",
+	"🔔 Напоминания":                         "🔔 Reminders",
+	"↕️ Сортировка":                         "↕️ Sorting",
+	"⏳ Порядок долгов":                      "⏳ Debt order",
+	"⚖️ Распределение платежей":             "⚖️ Payment allocation",
+	"📤 Автовыгрузка":                        "📤 Scheduled export",
+	"📷 QR для оплаты":                       "📷 Payment QR",
+	"🚧 Максимальная сумма":                  "🚧 Maximum debt",
+	"🗓 Сводка за месяц":                     "🗓 Monthly digest",
+	"На каком языке показывать меню?":       "Which language should the menus use?",
+	"Не удалось обновить язык.":             "Could not update the language.",
+	"Время сервера":                         "Server time",
+	"без ограничения":                       "no limit",
+	"включена":                              "on",
+	"выключена":                             "off",
+	"выключены":                             "off",
+	"в день платежа":                        "on the payment date",
+	"за %d дн. до платежа":                  "%d day(s) before the payment",
+	"по понедельникам в %02d:00, %s":        "Mondays at %02d:00, %s",
+	"1-го числа в %02d:00, %s":              "on the 1st at %02d:00, %s",
+	"настроен":                              "set up",
+	"не настроен":                           "not set up",
+	"По имени":                              "By name",
+	"По сумме долга":                        "By amount owed",
+	"По дате платежа":                       "By payment date",
+	"Сначала старые":                        "Oldest first",
+	"Сначала новые":                         "Newest first",
+	"Сначала старые долги":                  "Oldest debts first",
+	"Сначала крупные долги":                 "Largest debts first",
+	"Пропорционально суммам":                "In proportion to amounts",
+	"🇷🇺 Россия":                             "🇷🇺 Russia",
+	"🇧🇾 Беларусь":                           "🇧🇾 Belarus",
+	"🇰🇿 Казахстан":                          "🇰🇿 Kazakhstan",
+	"Только выходные":                       "Weekends only",
+	"Без переноса":                          "No rescheduling",
+	"уведомления отправляются в любой день": "notifications are sent on any day",
+	"уведомления в выходные переносятся на понедельник":                        "weekend notifications move to Monday",
+	"уведомления в выходные и праздники переносятся на следующий рабочий день": "notifications on weekends and holidays move to the next business day",
+	"❌ Отмена": "❌ Cancel",
+	"« Назад":  "« Back",
+	// Named in the English /help of /remind.
+	"🔗 Telegram должника": "🔗 Debtor's Telegram",
+
+	// /settings screens
+	"Выбери валюту:":   "Choose the currency:",
+	"✍️ Другой символ": "✍️ Other symbol",
+	"Введи символ валюты (не длиннее %d символов):":                                                  "Enter the currency symbol (up to %d characters):",
+	"Символ валюты должен содержать от 1 до %d символов и не включать символы разметки (* _ [ ] `).": "The currency symbol must be 1 to %d characters long and must not contain markup characters (* _ [ ] `).",
+	"Сколько знаков после запятой показывать?":                                                       "How many decimal places should be shown?",
+	"Как записывать суммы?":                                                                          "How should amounts be written?",
+	"По какому календарю переносить уведомления с выходных и праздников на следующий рабочий день?":  "Which calendar should be used to move notifications from weekends and holidays to the next business day?",
+	"Сейчас: *%s*.\n\nВведи максимальную сумму одного долга или 0, чтобы снять ограничение:":         "Now: *%s*.\n\nEnter the maximum amount of a single debt, or 0 to remove the limit:",
+	"Введи максимальную сумму одного долга (положительное число) или 0, чтобы снять ограничение.":    "Enter the maximum amount of a single debt (a positive number), or 0 to remove the limit.",
+	"Выбери формат даты:":  "Choose the date format:",
+	"Выбери часовой пояс:": "Choose the time zone:",
+	"✍️ Другой":            "✍️ Other",
+	"Введи часовой пояс: смещение от UTC, например *+3* или *UTC-04:30*, или название зоны, например *Asia/Tbilisi*:":                   "Enter the time zone: an offset from UTC such as *+3* or *UTC-04:30*, or a zone name such as *Asia/Tbilisi*:",
+	"Не удалось распознать часовой пояс. Введи смещение от UTC, например *+3*, или название зоны, например *Asia/Tbilisi*.":             "Could not recognize the time zone. Enter an offset from UTC such as *+3*, or a zone name such as *Asia/Tbilisi*.",
+	"Когда напоминать о дате платежа должника?":                                                                                         "When should I remind you of a debtor's payment date?",
+	"Как сортировать список должников в /debts?":                                                                                        "How should the /debts list be sorted?",
+	"В каком порядке показывать долги должника?":                                                                                        "In which order should a debtor's debts be shown?",
+	"Как распределять платёж должника между его долгами, если он не совпадает с конкретными долгами?":                                   "How should a debtor's payment be split between their debts when it does not match particular debts?",
+	"*Автовыгрузка*\n\nБот сам пришлёт файл с выгрузкой раз в неделю (в понедельник) или раз в месяц (1-го числа) в выбранный час.\n\n": "*Scheduled export*\n\nThe bot will send an export file once a week (on Monday) or once a month (on the 1st) at the chosen hour.\n\n",
+	"Сейчас: *%s*": "Now: *%s*",
+	"Выкл":         "Off",
+	"Раз в неделю": "Weekly",
+	"Раз в месяц":  "Monthly",
+	paymentQRSettingsHelp: "📷 *Payment QR*\n\n" +
+		"The debt menu gets a button with a QR code for the debt amount: the debtor scans it in their banking app.\n\n" +
+		"The template is a payment or bank link, or a transfer string (such as ST00012). Placeholders: " +
+		"`{amount}` — the amount (1500.00), `{cents}` — the amount in cents, `{account}` — the payment details, `{reason}` — the reason of the debt.\n\n",
+	"Шаблон: *не задан*\n":   "Template: *not set*\n",
+	"Шаблон: `%s`\n":         "Template: `%s`\n",
+	"Реквизиты: *не заданы*": "Payment details: *not set*",
+	"Реквизиты: `%s`":        "Payment details: `%s`",
+	"✍️ Шаблон":              "✍️ Template",
+	"✍️ Реквизиты":           "✍️ Payment details",
+	"🗑 Очистить":             "🗑 Clear",
+	"Введи шаблон, например:\n`https://example.com/pay?phone={account}&sum={amount}`\n\nВ шаблоне должна быть сумма: `{amount}` или `{cents}`.": "Enter the template, for example:\n`https://example.com/pay?phone={account}&sum={amount}`\n\nThe template must contain the amount: `{amount}` or `{cents}`.",
+	"Введи реквизиты для подстановки `{account}`: номер телефона, счёта или карты:":                                                             "Enter the payment details for `{account}`: a phone, account or card number:",
+	"Шаблон должен быть не длиннее %d символов и не содержать обратных кавычек.":                                                                "The template must be at most %d characters long and must not contain backquotes.",
+	"В шаблоне нет суммы. Добавь `{amount}` или `{cents}`.":                                                                                     "The template has no amount. Add `{amount}` or `{cents}`.",
+	"Реквизиты должны быть не длиннее %d символов и не содержать обратных кавычек.":                                                             "The payment details must be at most %d characters long and must not contain backquotes.",
+	"Не удалось обновить валюту.":                                                                                                               "Could not update the currency.",
+	"Не удалось обновить количество знаков после запятой.":                                                                                      "Could not update the decimal places.",
+	"Не удалось обновить формат чисел.":                                                                                                         "Could not update the number format.",
+	"Не удалось обновить календарь.":                                                                                                            "Could not update the calendar.",
+	"Не удалось обновить настройку сводки.":                                                                                                     "Could not update the digest setting.",
+	"Не удалось обновить максимальную сумму.":                                                                                                   "Could not update the maximum amount.",
+	"Не удалось обновить формат даты.":                                                                                                          "Could not update the date format.",
+	"Не удалось обновить часовой пояс.":                                                                                                         "Could not update the time zone.",
+	"Не удалось обновить напоминания.":                                                                                                          "Could not update the reminders.",
+	"Не удалось обновить сортировку.":                                                                                                           "Could not update the sorting.",
+	"Не удалось обновить порядок долгов.":                                                                                                       "Could not update the debt order.",
+	"Не удалось обновить распределение платежей.":                                                                                               "Could not update the payment allocation.",
+	"Не удалось обновить автовыгрузку.":                                                                                                         "Could not update the scheduled export.",
+	"Не удалось обновить настройки QR.":                                                                                                         "Could not update the QR settings.",
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Installment Plans ---
+
+// An installment plan splits a debt into monthly payments. Nothing is marked
+// paid explicitly: whatever has been paid off the debt since the plan was made
+// covers the installments in order, so every payment path keeps it current.
+
+type Installment struct {
+	ID         int
+	DebtID     int
+	Number     int
+	DueDate    time.Time
+	Amount     Money
+	RemindedAt sql.NullTime
+	// Paid is the part of Amount already covered by payments.
+	Paid Money
+}
+
+const (
+	minInstallments = 2
+	maxInstallments = 60
+	// installmentPreviewRows is how many upcoming installments the debtor card lists per debt.
+	installmentPreviewRows = 3
+)
+
+func (i Installment) Settled() bool {
+	return i.Paid >= i.Amount
+}
+
+// installmentDates returns count monthly due dates starting at first.
+func installmentDates(first time.Time, count int) []time.Time {
+	dates := make([]time.Time, count)
+	for i := range dates {
+		dates[i] = addMonths(first, i)
+	}
+	return dates
+}
+
+// addInstallmentPlan replaces the debt's plan with equal monthly installments
+// that add up to the debt's current amount.
+func addInstallmentPlan(debt Debt, count int, first time.Time) ([]Installment, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM installments WHERE debt_id = ?", debt.ID); err != nil {
+		return nil, err
+	}
+	amounts := splitEqually(debt.Amount, count)
+	installments := make([]Installment, 0, count)
+	for i, due := range installmentDates(first, count) {
+		installment := Installment{DebtID: debt.ID, Number: i + 1, DueDate: due, Amount: amounts[i]}
+		result, err := tx.Exec("INSERT INTO installments (debt_id, number, due_date, amount_cents) VALUES (?, ?, ?, ?)",
+			debt.ID, installment.Number, due, installment.Amount)
+		if err != nil {
+			return nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		installment.ID = int(id)
+		installments = append(installments, installment)
+	}
+	return installments, tx.Commit()
+}
+
+func deleteInstallmentPlan(debtID int) error {
+	_, err := DB.Exec("DELETE FROM installments WHERE debt_id = ?", debtID)
+	return err
+}
+
+// listInstallments returns the debt's plan with Paid filled in from the
+// debt's outstanding amount.
+func listInstallments(debt Debt) ([]Installment, error) {
+	rows, err := DB.Query("SELECT id, debt_id, number, due_date, amount_cents, reminded_at FROM installments WHERE debt_id = ? ORDER BY number", debt.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var installments []Installment
+	for rows.Next() {
+		var installment Installment
+		if err := rows.Scan(&installment.ID, &installment.DebtID, &installment.Number, &installment.DueDate, &installment.Amount, &installment.RemindedAt); err != nil {
+			return nil, err
+		}
+		installments = append(installments, installment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	applyInstallmentPayments(installments, debt.Amount)
+	return installments, nil
+}
+
+// applyInstallmentPayments spreads what has been paid off the plan's total
+// over the installments, the earliest first.
+func applyInstallmentPayments(installments []Installment, outstanding Money) {
+	var total Money
+	for _, installment := range installments {
+		total += installment.Amount
+	}
+	paid := max(0, total-outstanding)
+	for i := range installments {
+		installments[i].Paid = min(paid, installments[i].Amount)
+		paid -= installments[i].Paid
+	}
+}
+
+// remainingInstallments drops the installments that are already paid.
+func remainingInstallments(installments []Installment) []Installment {
+	for i, installment := range installments {
+		if !installment.Settled() {
+			return installments[i:]
+		}
+	}
+	return nil
+}
+
+// installmentDueText shows an installment's date and what is left to pay on it.
+func installmentDueText(settings ChatSettings, installment Installment, today time.Time) string {
+	text := fmt.Sprintf("%d. %s — %s", installment.Number, formatDate(settings, installment.DueDate), formatAmount(settings, installment.Amount-installment.Paid))
+	if installment.Paid > 0 {
+		text += fmt.Sprintf(" (из %s)", formatNumber(settings, installment.Amount))
+	}
+	if dueDay(installment.DueDate).Before(today) {
+		text += " ⚠️"
+	}
+	return text
+}
+
+// installmentCardText is the plan summary shown under a debt in the debtor card.
+func installmentCardText(settings ChatSettings, installments []Installment, today time.Time) string {
+	remaining := remainingInstallments(installments)
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("   📅 Рассрочка: оплачено %d из %d\n", len(installments)-len(remaining), len(installments)))
+	for i, installment := range remaining {
+		if i == installmentPreviewRows {
+			text.WriteString(fmt.Sprintf("      … ещё %d\n", len(remaining)-i))
+			break
+		}
+		text.WriteString("      " + installmentDueText(settings, installment, today) + "\n")
+	}
+	return text.String()
+}
+
+// addMonths moves t by months calendar months, keeping the day of the month
+// where it exists: 31.01 plus one month is 28.02 (29.02), not 03.03.
+func addMonths(t time.Time, months int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	return firstOfMonth.AddDate(0, 0, min(t.Day(), lastDay)-1)
+}
+
+func dueDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func chatToday(settings ChatSettings) time.Time {
+	return dueDay(time.Now().In(chatLocation(settings)))
+}
+
+func installmentPlanView(chatID int64, debt Debt, installments []Installment) (string, tgbotapi.InlineKeyboardMarkup) {
+	settings := getChatSettings(chatID)
+	today := chatToday(settings)
+	remaining := remainingInstallments(installments)
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("📅 *Рассрочка: %s*\n\n", escapeBold(debt.Reason)))
+	text.WriteString(fmt.Sprintf("Остаток долга: *%s*, оплачено взносов: %d из %d\n\n", formatAmount(settings, debt.Amount), len(installments)-len(remaining), len(installments)))
+	for _, installment := range installments {
+		if installment.Settled() {
+			text.WriteString(fmt.Sprintf("✅ %d. %s — %s\n", installment.Number, formatDate(settings, installment.DueDate), formatAmount(settings, installment.Amount)))
+		} else {
+			text.WriteString(installmentDueText(settings, installment, today) + "\n")
+		}
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton("🔁 Новый график", fmt.Sprintf("installments_new:%d", debt.ID)),
+			callbackButton("🗑 Удалить рассрочку", fmt.Sprintf("installments_delete:%d", debt.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton("👤 К должнику", fmt.Sprintf("select_debtor:%d", debt.DebtorID)),
+		),
+	)
+	return text.String(), keyboard
+}
+
+// startInstallmentPlan asks for the number of installments for the selected debt.
+func startInstallmentPlan(bot Sender, chatID int64, messageID int, debt Debt) {
+	if _, err := getLoanByDebtID(debt.ID); err == nil {
+		editMessageWithKeyboard(bot, chatID, messageID, "У кредита уже есть свой график платежей — он в карточке кредита.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	setSelectedDebt(chatID, debt)
+	setUserState(chatID, StateEnteringInstallmentCount)
+	settings := getChatSettings(chatID)
+	editPrompt(bot, chatID, messageID, fmt.Sprintf("На сколько платежей разбить долг *%s* за *%s*? Введи число от %d до %d.",
+		formatAmount(settings, debt.Amount), escapeBold(debt.Reason), minInstallments, maxInstallments))
+}
+
+func handleInstallmentsCallback(bot Sender, chatID int64, messageID int, data string) {
+	switch {
+	case strings.HasPrefix(data, "installments:"):
+		debt, ok := callbackDebt(chatID, strings.TrimPrefix(data, "installments:"))
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
+			return
+		}
+		installments, err := listInstallments(debt)
+		if err != nil {
+			log.Printf("Error listing installments: %v", err)
+			sendSimpleMessage(bot, chatID, "Произошла ошибка при получении рассрочки.")
+			return
+		}
+		if len(installments) == 0 {
+			startInstallmentPlan(bot, chatID, messageID, debt)
+			return
+		}
+		clearUserState(chatID)
+		text, keyboard := installmentPlanView(chatID, debt, installments)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case strings.HasPrefix(data, "installments_new:"):
+		debt, ok := callbackDebt(chatID, strings.TrimPrefix(data, "installments_new:"))
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
+			return
+		}
+		startInstallmentPlan(bot, chatID, messageID, debt)
+
+	case strings.HasPrefix(data, "installments_delete:"):
+		debt, ok := callbackDebt(chatID, strings.TrimPrefix(data, "installments_delete:"))
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
+			return
+		}
+		if err := deleteInstallmentPlan(debt.ID); err != nil {
+			log.Printf("Error deleting installment plan: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось удалить рассрочку.")
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Рассрочка по долгу *%s* удалена.", escapeBold(debt.Reason)), tgbotapi.InlineKeyboardMarkup{})
+		showDebtorDetails(bot, chatID, debt.DebtorID)
+
+	case data == "installments_confirm":
+		session := getSession(chatID)
+		if session.State != StateConfirmingInstallments {
+			editMessageWithKeyboard(bot, chatID, messageID, "Эта операция уже завершена.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		clearUserState(chatID)
+		// The amount may have changed while the plan was being set up.
+		debt, err := getDebtByID(session.Debt.ID)
+		if err != nil {
+			log.Printf("Error getting debt for installments: %v", err)
+			editMessageWithKeyboard(bot, chatID, messageID, "Долг не найден.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		if _, err := addInstallmentPlan(debt, session.InstallmentCount, session.InstallmentStart); err != nil {
+			log.Printf("Error adding installment plan: %v", err)
+			editMessageWithKeyboard(bot, chatID, messageID, "Произошла ошибка при оформлении рассрочки.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("✅ Рассрочка по долгу *%s* оформлена, платежей — %d.", escapeBold(debt.Reason), session.InstallmentCount), tgbotapi.InlineKeyboardMarkup{})
+		if debtor, err := getDebtorByID(debt.DebtorID); err == nil {
+			notifyCoOwners(bot, chatID, fmt.Sprintf("Оформлена рассрочка: *%s* за *%s*, платежей — %d.", escapeBold(debtor.Name), escapeBold(debt.Reason), session.InstallmentCount))
+		}
+		showDebtorDetails(bot, chatID, debt.DebtorID)
+	}
+}
+
+func handleInstallmentInput(bot Sender, chatID int64, state int, text string) {
+	switch state {
+	case StateEnteringInstallmentCount:
+		count, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil || count < minInstallments || count > maxInstallments {
+			sendPrompt(bot, chatID, fmt.Sprintf("Пожалуйста, введи количество платежей — целое число от %d до %d.", minInstallments, maxInstallments))
+			return
+		}
+		setInstallmentDraft(chatID, count, time.Time{})
+		setUserState(chatID, StateEnteringInstallmentStart)
+		sendPrompt(bot, chatID, fmt.Sprintf("Когда первый платёж? Введи дату в формате %s — остальные будут раз в месяц.", dateInputHint(getChatSettings(chatID))))
+
+	case StateEnteringInstallmentStart:
+		settings := getChatSettings(chatID)
+		first, ok := parseDateInput(settings, text)
+		if !ok {
+			sendPrompt(bot, chatID, "Неверный формат даты. Пожалуйста, введите дату в формате "+dateInputHint(settings))
+			return
+		}
+		if first.Before(chatToday(settings)) {
+			sendPrompt(bot, chatID, "Первый платёж не может быть в прошлом. Введи другую дату.")
+			return
+		}
+		session := getSession(chatID)
+		debt, err := getDebtByID(session.Debt.ID)
+		if err != nil {
+			log.Printf("Error getting debt for installments: %v", err)
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
+			clearUserState(chatID)
+			return
+		}
+		setInstallmentDraft(chatID, session.InstallmentCount, first)
+		setUserState(chatID, StateConfirmingInstallments)
+
+		var preview strings.Builder
+		preview.WriteString(fmt.Sprintf("📅 График рассрочки для долга *%s* за *%s*:\n\n", formatAmount(settings, debt.Amount), escapeBold(debt.Reason)))
+		amounts := splitEqually(debt.Amount, session.InstallmentCount)
+		for i, due := range installmentDates(first, session.InstallmentCount) {
+			preview.WriteString(fmt.Sprintf("%d. %s — %s\n", i+1, formatDate(settings, due), formatAmount(settings, amounts[i])))
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			callbackButton("✅ Оформить", "installments_confirm"),
+			callbackButton("❌ Отмена", "cancel_operation"),
+		))
+		sendWithKeyboard(bot, chatID, preview.String(), keyboard)
+	}
+}
+
+// notifyUpcomingInstallments reminds owners about installments due within
+// the chat's reminder lead time. Each installment is announced once.
+func notifyUpcomingInstallments(bot Sender) {
+	rows, err := DB.Query(`SELECT d.id, d.debtor_id, d.amount_cents, d.reason, r.name, r.chat_id FROM debts d
+        JOIN debtors r ON r.id = d.debtor_id
+        WHERE r.reminder_mode != ? AND d.id IN (SELECT debt_id FROM installments WHERE reminded_at IS NULL)`, ReminderModeOff)
+	if err != nil {
+		log.Printf("Error listing debts for installment reminders: %v", err)
+		return
+	}
+	type candidate struct {
+		debt   Debt
+		debtor Debtor
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.debt.ID, &c.debt.DebtorID, &c.debt.Amount, &c.debt.Reason, &c.debtor.Name, &c.debtor.ChatID); err != nil {
+			log.Printf("Error scanning debt for installment reminders: %v", err)
+			continue
+		}
+		c.debtor.ID = c.debt.DebtorID
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+
+	for _, c := range candidates {
+		settings := getChatSettings(c.debtor.ChatID)
+		if settings.ReminderDays == reminderDaysOff {
+			continue
+		}
+		installments, err := listInstallments(c.debt)
+		if err != nil {
+			log.Printf("Error listing installments for reminder: %v", err)
+			continue
+		}
+		now := time.Now().In(chatLocation(settings))
+		today := dueDay(now)
+		for _, installment := range installments {
+			if installment.RemindedAt.Valid {
+				continue
+			}
+			due := dueDay(installment.DueDate)
+			if installment.Settled() || today.After(due) {
+				// Paid already, or the date passed before a reminder could go out; don't nag.
+				markInstallmentReminded(installment.ID)
+				continue
+			}
+			// Same lead time and business-day rule as payment date reminders.
+			remindOn := nextBusinessDay(settings.HolidayCalendar, due.AddDate(0, 0, -settings.ReminderDays))
+			if remindOn.After(due) {
+				remindOn = due
+			}
+			if today.Before(remindOn) || now.Hour() < reminderHour {
+				continue
+			}
+			when := "сегодня"
+			if days := int(due.Sub(today).Hours() / 24); days == 1 {
+				when = "завтра"
+			} else if days > 1 {
+				when = fmt.Sprintf("через %d дн.", days)
+			}
+			text := fmt.Sprintf("🔔 *%s* %s (%s) должен внести платёж %d из %d по рассрочке за *%s*: *%s*\n\nОстаток долга: *%s*",
+				escapeBold(c.debtor.Name), when, formatDate(settings, due), installment.Number, len(installments), escapeBold(c.debt.Reason),
+				formatAmount(settings, installment.Amount-installment.Paid), formatAmount(settings, c.debt.Amount))
+			keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+				callbackButton("Открыть должника", fmt.Sprintf("select_debtor:%d", c.debtor.ID)),
+			))
+			sendToLedger(bot, c.debtor.ChatID, text, keyboard)
+			markInstallmentReminded(installment.ID)
+		}
+	}
+}
+
+func markInstallmentReminded(installmentID int) {
+	if _, err := DB.Exec("UPDATE installments SET reminded_at = ? WHERE id = ?", time.Now(), installmentID); err != nil {
+		log.Printf("Error marking installment reminded: %v", err)
+	}
+}
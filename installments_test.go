@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInstallmentDates(t *testing.T) {
+	tests := []struct {
+		first string
+		want  []string
+	}{
+		{"2025-01-15", []string{"2025-01-15", "2025-02-15", "2025-03-15", "2025-04-15"}},
+		{"2025-01-29", []string{"2025-01-29", "2025-02-28", "2025-03-29", "2025-04-29"}},
+		{"2024-01-30", []string{"2024-01-30", "2024-02-29", "2024-03-30", "2024-04-30"}},
+		{"2025-01-31", []string{"2025-01-31", "2025-02-28", "2025-03-31", "2025-04-30"}},
+		{"2025-11-30", []string{"2025-11-30", "2025-12-30", "2026-01-30", "2026-02-28"}},
+		{"2025-12-31", []string{"2025-12-31", "2026-01-31", "2026-02-28", "2026-03-31"}},
+	}
+	for _, tt := range tests {
+		first, _ := time.Parse(time.DateOnly, tt.first)
+		dates := installmentDates(first, len(tt.want))
+		for i, date := range dates {
+			if got := date.Format(time.DateOnly); got != tt.want[i] {
+				t.Errorf("installmentDates(%s)[%d] = %s, want %s", tt.first, i, got, tt.want[i])
+			}
+		}
+	}
+}
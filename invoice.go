@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Invoices ---
+
+// With PAYMENT_PROVIDER_TOKEN set, a debt can be turned into a Telegram
+// Payments invoice link. The owner forwards the link to the debtor, and a
+// successful payment is recorded as a transfer for the full amount, which
+// closes the debt. The payload pins the amount, so an invoice is refused
+// once the debt has changed.
+
+const invoicePayloadPrefix = "debt:"
+
+// invoiceCurrencies maps the currency presets to ISO 4217 codes; all of them
+// have two decimal digits in Telegram Payments.
+var invoiceCurrencies = map[string]string{
+	"₽":  "RUB",
+	"$":  "USD",
+	"€":  "EUR",
+	"₸":  "KZT",
+	"₴":  "UAH",
+	"Br": "BYN",
+	"£":  "GBP",
+}
+
+func invoicePayload(debt Debt) string {
+	return fmt.Sprintf("%s%d:%d", invoicePayloadPrefix, debt.ID, debt.Amount)
+}
+
+// parseInvoicePayload returns the debt an invoice was issued for and the amount in cents.
+func parseInvoicePayload(payload string) (int, int64, bool) {
+	parts := strings.Split(strings.TrimPrefix(payload, invoicePayloadPrefix), ":")
+	if !strings.HasPrefix(payload, invoicePayloadPrefix) || len(parts) != 2 {
+		return 0, 0, false
+	}
+	debtID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	cents, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return debtID, cents, true
+}
+
+// createInvoiceLink calls createInvoiceLink directly, since the library
+// predates it.
+func createInvoiceLink(bot Sender, debtor Debtor, debt Debt, currency string) (string, error) {
+	params := tgbotapi.Params{}
+	params["title"] = "Долг: " + debt.Reason
+	params["description"] = fmt.Sprintf("Возврат долга %s за «%s»", debtor.Name, debt.Reason)
+	params["payload"] = invoicePayload(debt)
+	params["provider_token"] = config.PaymentProviderToken
+	params["currency"] = currency
+	if err := params.AddInterface("prices", []tgbotapi.LabeledPrice{{Label: debt.Reason, Amount: int(debt.Amount)}}); err != nil {
+		return "", err
+	}
+	resp, err := bot.MakeRequest("createInvoiceLink", params)
+	if err != nil {
+		return "", err
+	}
+	var link string
+	err = json.Unmarshal(resp.Result, &link)
+	return link, err
+}
+
+func handleInvoiceCallback(bot Sender, chatID int64, messageID int, data string) {
+	debtID, err := strconv.Atoi(strings.TrimPrefix(data, "invoice:"))
+	if err != nil {
+		log.Printf("Invalid debt ID in invoice callback: %v", err)
+		return
+	}
+	debt, err := getDebtByID(debtID)
+	if err != nil {
+		editMessageWithKeyboard(bot, chatID, messageID, "Этот долг уже закрыт.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	debtor, ok := callbackDebtor(chatID, strconv.Itoa(debt.DebtorID))
+	if !ok {
+		return
+	}
+	clearUserState(chatID)
+
+	settings := getChatSettings(chatID)
+	currency, ok := invoiceCurrencies[settings.CurrencySymbol]
+	if !ok {
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Счёт можно выставить только в одной из валют: %s. Сменить валюту можно в /settings.", strings.Join(currencyPresets, " ")), tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	link, err := createInvoiceLink(bot, debtor, debt, currency)
+	if err != nil {
+		log.Printf("Error creating invoice link: %v", err)
+		editMessageWithKeyboard(bot, chatID, messageID, "Не удалось выставить счёт. Попробуй позже.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+
+	editMessageWithKeyboard(bot, chatID, messageID, "Счёт готов. Перешли сообщение ниже должнику: после оплаты долг закроется автоматически.", tgbotapi.InlineKeyboardMarkup{})
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonURL("💳 Оплатить "+formatAmount(settings, debt.Amount), link),
+	))
+	sendWithKeyboard(bot, chatID, fmt.Sprintf("🧾 Счёт для *%s*: *%s* за *%s*. Оплатить можно прямо в Telegram.", escapeBold(debtor.Name), formatAmount(settings, debt.Amount), escapeBold(debt.Reason)), keyboard)
+}
+
+// invoiceDebt returns the debt an invoice is for if it is still open with the invoiced amount.
+func invoiceDebt(payload string) (Debt, bool) {
+	debtID, cents, ok := parseInvoicePayload(payload)
+	if !ok {
+		return Debt{}, false
+	}
+	debt, err := getDebtByID(debtID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error getting invoiced debt: %v", err)
+		}
+		return Debt{}, false
+	}
+	return debt, debt.Amount == Money(cents)
+}
+
+func handlePreCheckoutQuery(bot Sender, query *tgbotapi.PreCheckoutQuery) {
+	answer := tgbotapi.PreCheckoutConfig{PreCheckoutQueryID: query.ID, OK: true}
+	if _, ok := invoiceDebt(query.InvoicePayload); !ok {
+		answer.OK = false
+		answer.ErrorMessage = "Этот счёт больше не действует: долг уже изменился или закрыт."
+	}
+	if _, err := bot.Request(answer); err != nil {
+		log.Printf("Error answering pre-checkout query: %v", err)
+	}
+}
+
+func handleSuccessfulPayment(bot Sender, chatID int64, payment *tgbotapi.SuccessfulPayment) {
+	debt, ok := invoiceDebt(payment.InvoicePayload)
+	if !ok {
+		// Telegram has already charged the payer, so the owner has to sort it out by hand.
+		log.Printf("Successful payment %s for an unknown or changed debt: %s", payment.TelegramPaymentChargeID, payment.InvoicePayload)
+		sendSimpleMessage(bot, chatID, "Платёж получен, но долг уже изменился. Свяжись с тем, кто выставил счёт.")
+		return
+	}
+	debtor, err := getDebtorByID(debt.DebtorID)
+	if err != nil {
+		log.Printf("Error getting debtor for invoice payment: %v", err)
+		return
+	}
+	if _, err := recordDebtPayment(debt, debt.Amount, PaymentMethodTransfer); err != nil {
+		log.Printf("Error recording invoice payment: %v", err)
+		sendToLedger(bot, debtor.ChatID, fmt.Sprintf("⚠️ *%s* оплатил счёт за *%s*, но записать платёж не удалось. Закрой долг вручную.", escapeBold(debtor.Name), escapeBold(debt.Reason)), tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	sendSimpleMessage(bot, chatID, "Спасибо! Платёж получен.")
+	sendToLedger(bot, debtor.ChatID, fmt.Sprintf("💳 *%s* оплатил счёт: *%s* за *%s*. Долг закрыт.", escapeBold(debtor.Name), formatChatAmount(debtor.ChatID, debt.Amount), escapeBold(debt.Reason)), tgbotapi.InlineKeyboardMarkup{})
+}
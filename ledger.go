@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Shared Ledgers ---
+
+// A chat's data is stored under its ledger's chat_id: its own, or the owner's
+// once it has joined a shared ledger through the owner's invite link. Data
+// access resolves the ledger with ledgerChatID; sessions and messages stay
+// per chat. Changes made from one chat are announced to the others.
+
+const ledgerStartArg = "ledger_"
+
+type LedgerMember struct {
+	ChatID   int64
+	Name     string
+	JoinedAt time.Time
+}
+
+// ledgerChatID returns the chat_id the chat's data is stored under.
+func ledgerChatID(chatID int64) int64 {
+	var ledger int64
+	err := DB.QueryRow("SELECT ledger_chat_id FROM ledger_members WHERE chat_id = ?", chatID).Scan(&ledger)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error getting ledger of chat %d: %v", chatID, err)
+		}
+		return chatID
+	}
+	return ledger
+}
+
+func listLedgerMembers(ledger int64) ([]LedgerMember, error) {
+	rows, err := DB.Query("SELECT chat_id, name, joined_at FROM ledger_members WHERE ledger_chat_id = ? ORDER BY joined_at", ledger)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []LedgerMember
+	for rows.Next() {
+		var m LedgerMember
+		if err := rows.Scan(&m.ChatID, &m.Name, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// ledgerChats returns the owner and the members of a ledger.
+func ledgerChats(ledger int64) []int64 {
+	chats := []int64{ledger}
+	members, err := listLedgerMembers(ledger)
+	if err != nil {
+		log.Printf("Error listing ledger members: %v", err)
+		return chats
+	}
+	for _, m := range members {
+		chats = append(chats, m.ChatID)
+	}
+	return chats
+}
+
+// notifyCoOwners tells the other chats of chatID's ledger about a change made from chatID.
+func notifyCoOwners(bot Sender, chatID int64, text string) {
+	for _, id := range ledgerChats(ledgerChatID(chatID)) {
+		if id != chatID {
+			sendSimpleMessage(bot, id, "👥 "+text)
+		}
+	}
+}
+
+// sendToLedger sends a message to every chat of the ledger. Nothing is sent
+// for a chat that has joined another ledger, since its own data is hidden.
+func sendToLedger(bot Sender, ledger int64, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
+	if ledgerChatID(ledger) != ledger {
+		return
+	}
+	for _, id := range ledgerChats(ledger) {
+		sendWithKeyboard(bot, id, text, keyboard)
+	}
+}
+
+// ledgerInviteToken returns the ledger's invite token, creating a new one if
+// there is none yet or reset is set.
+func ledgerInviteToken(ledger int64, reset bool) (string, error) {
+	if !reset {
+		var token string
+		err := DB.QueryRow("SELECT token FROM ledger_invites WHERE ledger_chat_id = ?", ledger).Scan(&token)
+		if err != sql.ErrNoRows {
+			return token, err
+		}
+	}
+	tokenBytes := make([]byte, 8)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+	_, err := DB.Exec(`INSERT INTO ledger_invites (ledger_chat_id, token) VALUES (?, ?)
+        ON CONFLICT(ledger_chat_id) DO UPDATE SET token = excluded.token`, ledger, token)
+	return token, err
+}
+
+func ledgerByInviteToken(token string) (int64, error) {
+	var ledger int64
+	err := DB.QueryRow("SELECT ledger_chat_id FROM ledger_invites WHERE token = ?", token).Scan(&ledger)
+	return ledger, err
+}
+
+func joinLedger(chatID, ledger int64, name string) error {
+	_, err := DB.Exec(`INSERT INTO ledger_members (chat_id, ledger_chat_id, name, joined_at) VALUES (?, ?, ?, ?)
+        ON CONFLICT(chat_id) DO UPDATE SET ledger_chat_id = excluded.ledger_chat_id, name = excluded.name, joined_at = excluded.joined_at`,
+		chatID, ledger, name, time.Now())
+	return err
+}
+
+func leaveLedger(chatID int64) error {
+	_, err := DB.Exec("DELETE FROM ledger_members WHERE chat_id = ?", chatID)
+	return err
+}
+
+func ledgerMemberName(chatID int64) string {
+	var name string
+	if err := DB.QueryRow("SELECT name FROM ledger_members WHERE chat_id = ?", chatID).Scan(&name); err != nil {
+		return "Участник"
+	}
+	return name
+}
+
+// chatDisplayName names a chat for other ledger members: the group title or the user's name.
+func chatDisplayName(chat *tgbotapi.Chat) string {
+	if chat.Title != "" {
+		return chat.Title
+	}
+	name := strings.TrimSpace(chat.FirstName + " " + chat.LastName)
+	if name == "" && chat.UserName != "" {
+		name = "@" + chat.UserName
+	}
+	if name == "" {
+		name = "Участник"
+	}
+	return name
+}
+
+// --- Shared Ledger Handlers ---
+
+func handleShareCommand(bot Sender, chatID int64) {
+	clearUserState(chatID)
+	text, keyboard := shareView(bot, chatID)
+	sendWithKeyboard(bot, chatID, text, keyboard)
+}
+
+func shareView(bot Sender, chatID int64) (string, tgbotapi.InlineKeyboardMarkup) {
+	if ledgerChatID(chatID) != chatID {
+		text := "👥 *Общий учёт*\n\nТы ведёшь общий учёт: должники и долги общие со всеми участниками, а об изменениях приходят уведомления.\n\n" +
+			"Если выйти, снова будут видны только твои собственные записи."
+		return text, tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(callbackButton("🚪 Выйти из общего учёта", "ledger_leave")))
+	}
+
+	token, err := ledgerInviteToken(chatID, false)
+	if err != nil {
+		log.Printf("Error getting ledger invite: %v", err)
+		return "Не удалось создать ссылку-приглашение.", tgbotapi.InlineKeyboardMarkup{}
+	}
+	members, err := listLedgerMembers(chatID)
+	if err != nil {
+		log.Printf("Error listing ledger members: %v", err)
+		return "Произошла ошибка при получении участников.", tgbotapi.InlineKeyboardMarkup{}
+	}
+
+	settings := getChatSettings(chatID)
+	var text strings.Builder
+	text.WriteString("👥 *Общий учёт*\n\nПерешли ссылку тем, с кем хочешь вести долги вместе. Участники видят и меняют тех же должников, а об изменениях всем приходят уведомления.\n\n")
+	text.WriteString(fmt.Sprintf("`https://t.me/%s?start=%s%s`\n\n", bot.UserName(), ledgerStartArg, token))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(members) == 0 {
+		text.WriteString("Пока никто не присоединился.")
+	} else {
+		text.WriteString("Участники:\n")
+		for _, m := range members {
+			text.WriteString(fmt.Sprintf("- %s (с %s)\n", escapeMarkdown(m.Name), formatDate(settings, m.JoinedAt.In(chatLocation(settings)))))
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton("❌ Отключить "+m.Name, fmt.Sprintf("ledger_remove:%d", m.ChatID))))
+		}
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton("🔄 Новая ссылка", "ledger_reset")))
+	return text.String(), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func handleLedgerStart(bot Sender, chatID int64, token string) {
+	clearUserState(chatID)
+	ledger, err := ledgerByInviteToken(token)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error getting ledger by invite: %v", err)
+		}
+		sendSimpleMessage(bot, chatID, "Ссылка недействительна или устарела. Попроси новую.")
+		return
+	}
+	if ledger == chatID {
+		sendSimpleMessage(bot, chatID, "Это ссылка на твой собственный учёт. Перешли её тому, с кем хочешь вести долги вместе.")
+		return
+	}
+	if ledgerChatID(chatID) == ledger {
+		sendSimpleMessage(bot, chatID, "Ты уже ведёшь этот учёт.")
+		return
+	}
+	if members, err := listLedgerMembers(chatID); err != nil || len(members) > 0 {
+		sendSimpleMessage(bot, chatID, "К твоему учёту подключены другие участники. Чтобы присоединиться к чужому, сначала отключи их в /share.")
+		return
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		callbackButton("✅ Присоединиться", "ledger_join:"+token),
+		callbackButton("❌ Отмена", "cancel_operation"),
+	))
+	sendWithKeyboard(bot, chatID, "Тебя приглашают вести общий учёт долгов.\n\n"+
+		"Ты будешь видеть и менять тех же должников, что и пригласивший. Твои собственные записи скроются, пока ты не выйдешь из общего учёта.", keyboard)
+}
+
+// handleLedgerCallback handles the ledger_ buttons; name is used when the chat joins a ledger.
+func handleLedgerCallback(bot Sender, chatID int64, messageID int, data, name string) {
+	switch {
+	case strings.HasPrefix(data, "ledger_join:"):
+		ledger, err := ledgerByInviteToken(strings.TrimPrefix(data, "ledger_join:"))
+		if err != nil || ledger == chatID || ledgerChatID(ledger) != ledger {
+			editMessageWithKeyboard(bot, chatID, messageID, "Ссылка недействительна или устарела. Попроси новую.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		if members, err := listLedgerMembers(chatID); err != nil || len(members) > 0 {
+			editMessageWithKeyboard(bot, chatID, messageID, "К твоему учёту подключены другие участники. Чтобы присоединиться к чужому, сначала отключи их в /share.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		if err := joinLedger(chatID, ledger, name); err != nil {
+			log.Printf("Error joining ledger: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось присоединиться к общему учёту.")
+			return
+		}
+		clearUserState(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, "✅ Готово! Теперь у вас общий учёт. Посмотреть должников: /debts", tgbotapi.InlineKeyboardMarkup{})
+		notifyCoOwners(bot, chatID, fmt.Sprintf("К общему учёту присоединился участник: %s.", escapeMarkdown(name)))
+		return
+
+	case data == "ledger_leave":
+		name := ledgerMemberName(chatID)
+		ledger := ledgerChatID(chatID)
+		if err := leaveLedger(chatID); err != nil {
+			log.Printf("Error leaving ledger: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось выйти из общего учёта.")
+			return
+		}
+		clearUserState(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, "Ты вышел из общего учёта. Теперь видны только твои собственные записи.", tgbotapi.InlineKeyboardMarkup{})
+		for _, id := range ledgerChats(ledger) {
+			sendSimpleMessage(bot, id, fmt.Sprintf("👥 Участник %s вышел из общего учёта.", escapeMarkdown(name)))
+		}
+		return
+
+	case strings.HasPrefix(data, "ledger_remove:"):
+		memberID, err := strconv.ParseInt(strings.TrimPrefix(data, "ledger_remove:"), 10, 64)
+		if err != nil {
+			log.Printf("Invalid ledger member in callback: %s", data)
+			return
+		}
+		if ledgerChatID(memberID) != chatID {
+			sendSimpleMessage(bot, chatID, "Этот участник уже отключён.")
+		} else if err := leaveLedger(memberID); err != nil {
+			log.Printf("Error removing ledger member: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось отключить участника.")
+			return
+		} else {
+			clearUserState(memberID)
+			sendSimpleMessage(bot, memberID, "👥 Владелец общего учёта отключил тебя. Теперь видны только твои собственные записи.")
+		}
+
+	case data == "ledger_reset":
+		if ledgerChatID(chatID) != chatID {
+			return
+		}
+		if _, err := ledgerInviteToken(chatID, true); err != nil {
+			log.Printf("Error resetting ledger invite: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось создать новую ссылку.")
+			return
+		}
+	}
+	text, keyboard := shareView(bot, chatID)
+	editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+}
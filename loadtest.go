@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// --- Load Test Harness ---
+
+// runLoadTest seeds a throwaway database with synthetic chats and measures the
+// storage-heavy operations (debtor lists, exports, history, scheduler jobs).
+// It is started with `-loadtest` and never touches the real database.
+func runLoadTest(chats, debts, samples int) error {
+	dir, err := os.MkdirTemp("", "debtbot-loadtest-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	initDB(filepath.Join(dir, "loadtest.db"))
+	defer DB.Close()
+
+	log.Printf("Seeding %d chats with %d debts...", chats, debts)
+	start := time.Now()
+	chatIDs, err := seedLoadTestData(chats, debts)
+	if err != nil {
+		return err
+	}
+	log.Printf("Seeded in %s", time.Since(start).Round(time.Millisecond))
+
+	if samples > len(chatIDs) {
+		samples = len(chatIDs)
+	}
+	rng := rand.New(rand.NewSource(1))
+	sample := make([]int64, samples)
+	for i := range sample {
+		sample[i] = chatIDs[rng.Intn(len(chatIDs))]
+	}
+
+	results := []loadTestResult{
+		measure("debtor list (/debts)", sample, func(chatID int64) error {
+			debtors, err := listDebtors(chatID)
+			if err != nil {
+				return err
+			}
+			for _, debtor := range debtors {
+				if _, err := listDebts(debtor.ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+		measure("CSV export", sample, func(chatID int64) error {
+			path, err := generateCSV(chatID, exportFilter{}, nil)
+			if err != nil {
+				return err
+			}
+			return os.Remove(path)
+		}),
+		measure("payment history", sample, func(chatID int64) error {
+			if _, err := listPayments(chatID, "", paymentHistoryLimit); err != nil {
+				return err
+			}
+			_, err := sumPaymentsByMethod(chatID)
+			return err
+		}),
+		measure("scheduler pass", sample[:1], func(int64) error {
+			// Seeded payment dates lie in the future, so the job only runs its queries and sends nothing.
+			notifyOverdueCosigners(nil)
+			notifyUpcomingPayments(nil)
+			notifyBirthdays(nil)
+			return nil
+		}),
+	}
+
+	fmt.Printf("\n%-24s %8s %10s %10s %10s\n", "operation", "runs", "p50", "p95", "max")
+	for _, r := range results {
+		if r.err != nil {
+			return fmt.Errorf("%s: %w", r.name, r.err)
+		}
+		fmt.Printf("%-24s %8d %10s %10s %10s\n", r.name, len(r.durations), r.percentile(0.50), r.percentile(0.95), r.percentile(1))
+	}
+	return nil
+}
+
+type loadTestResult struct {
+	name      string
+	durations []time.Duration
+	err       error
+}
+
+func (r loadTestResult) percentile(p float64) time.Duration {
+	if len(r.durations) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.durations)-1) * p)
+	return r.durations[i].Round(time.Microsecond)
+}
+
+func measure(name string, chatIDs []int64, op func(chatID int64) error) loadTestResult {
+	result := loadTestResult{name: name}
+	for _, chatID := range chatIDs {
+		start := time.Now()
+		if err := op(chatID); err != nil {
+			result.err = err
+			return result
+		}
+		result.durations = append(result.durations, time.Since(start))
+	}
+	sort.Slice(result.durations, func(i, j int) bool { return result.durations[i] < result.durations[j] })
+	return result
+}
+
+func seedLoadTestData(chats, debts int) ([]int64, error) {
+	const debtorsPerChat = 5
+	rng := rand.New(rand.NewSource(42))
+	reasons := []string{"обед", "такси", "кино", "аренда", "продукты", "подарок"}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	insertDebtor, err := tx.Prepare("INSERT INTO debtors (name, chat_id, payment_date) VALUES (?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	insertDebt, err := tx.Prepare("INSERT INTO debts (debtor_id, amount_cents, reason) VALUES (?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	insertPayment, err := tx.Prepare("INSERT INTO payments (debtor_id, debt_id, reason, amount_cents, method, paid_at) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	insertCosigner, err := tx.Prepare("INSERT INTO cosigners (debtor_id, chat_id, invite_token, status, threshold_days) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+
+	chatIDs := make([]int64, 0, chats)
+	var debtorIDs []int64
+	future := time.Now().AddDate(1, 0, 0)
+	for c := 0; c < chats; c++ {
+		chatID := int64(100000 + c)
+		chatIDs = append(chatIDs, chatID)
+		for d := 0; d < debtorsPerChat; d++ {
+			result, err := insertDebtor.Exec(fmt.Sprintf("Должник %d", d), chatID, future)
+			if err != nil {
+				return nil, err
+			}
+			debtorID, err := result.LastInsertId()
+			if err != nil {
+				return nil, err
+			}
+			debtorIDs = append(debtorIDs, debtorID)
+			if rng.Intn(10) == 0 {
+				if _, err := insertCosigner.Exec(debtorID, chatID+1, fmt.Sprintf("load%d", debtorID), CosignerActive, defaultCosignDays); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for i := 0; i < debts; i++ {
+		debtorID := debtorIDs[rng.Intn(len(debtorIDs))]
+		reason := reasons[rng.Intn(len(reasons))]
+		amount := Money(rng.Intn(100000))
+		result, err := insertDebt.Exec(debtorID, amount, reason)
+		if err != nil {
+			return nil, err
+		}
+		if rng.Intn(4) == 0 {
+			debtID, err := result.LastInsertId()
+			if err != nil {
+				return nil, err
+			}
+			method := paymentMethods[rng.Intn(len(paymentMethods))]
+			if _, err := insertPayment.Exec(debtorID, debtID, reason, amount/2, method, time.Now()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return chatIDs, tx.Commit()
+}
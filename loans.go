@@ -0,0 +1,546 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Loans ---
+
+// A loan is a debt with interest and a fixed term. Its debt row always holds
+// the outstanding principal; payments are split into interest (accrued daily
+// since the previous payment) and principal.
+
+type Loan struct {
+	ID         int
+	DebtID     int
+	DebtorID   int
+	Principal  Money
+	AnnualRate float64
+	TermMonths int
+	StartDate  time.Time
+	ClosedAt   sql.NullTime
+}
+
+type loanInstallment struct {
+	Number    int
+	Date      time.Time
+	Payment   Money
+	Principal Money
+	Interest  Money
+	Balance   Money
+}
+
+type loanPayment struct {
+	Amount    Money
+	Principal Money
+	Interest  Money
+	PaidAt    time.Time
+}
+
+const (
+	maxLoanRate       = 1000
+	maxLoanTermMonths = 600
+	// loanPreviewRows is how many upcoming installments the loan view lists.
+	loanPreviewRows = 3
+)
+
+// annuityPayment is the fixed monthly payment that repays principal with interest in the given number of months.
+func annuityPayment(principal Money, annualRate float64, months int) Money {
+	rate := annualRate / 100 / 12
+	if rate == 0 {
+		return principal.Times(1 / float64(months))
+	}
+	return principal.Times(rate / (1 - math.Pow(1+rate, -float64(months))))
+}
+
+// amortizationSchedule splits an annuity loan into monthly installments, the
+// first due elapsed+1 months after start. The last installment absorbs
+// rounding so the balance ends at exactly zero.
+func amortizationSchedule(principal Money, annualRate float64, months int, start time.Time, elapsed int) []loanInstallment {
+	rate := annualRate / 100 / 12
+	payment := annuityPayment(principal, annualRate, months)
+	balance := principal
+	schedule := make([]loanInstallment, 0, months)
+	for i := 1; i <= months; i++ {
+		interest := balance.Times(rate)
+		principalPart := payment - interest
+		if i == months || principalPart > balance {
+			principalPart = balance
+		}
+		balance -= principalPart
+		schedule = append(schedule, loanInstallment{
+			Number:    i,
+			Date:      addMonths(start, elapsed+i),
+			Payment:   principalPart + interest,
+			Principal: principalPart,
+			Interest:  interest,
+			Balance:   balance,
+		})
+	}
+	return schedule
+}
+
+func addLoan(debtor Debtor, principal Money, annualRate float64, termMonths int, startDate time.Time) (Loan, error) {
+	loan := Loan{DebtorID: debtor.ID, Principal: principal, AnnualRate: annualRate, TermMonths: termMonths, StartDate: startDate}
+	tx, err := DB.Begin()
+	if err != nil {
+		return loan, err
+	}
+	defer tx.Rollback()
+
+	reason := fmt.Sprintf("Кредит под %s%% на %d мес.", strconv.FormatFloat(annualRate, 'f', -1, 64), termMonths)
+	result, err := tx.Exec("INSERT INTO debts (debtor_id, amount_cents, reason, created_at) VALUES (?, ?, ?, ?)", debtor.ID, principal, reason, time.Now())
+	if err != nil {
+		return loan, err
+	}
+	debtID, err := result.LastInsertId()
+	if err != nil {
+		return loan, err
+	}
+	loan.DebtID = int(debtID)
+
+	result, err = tx.Exec("INSERT INTO loans (debt_id, debtor_id, principal_cents, annual_rate, term_months, start_date) VALUES (?, ?, ?, ?, ?, ?)",
+		loan.DebtID, debtor.ID, principal, annualRate, termMonths, startDate)
+	if err != nil {
+		return loan, err
+	}
+	loanID, err := result.LastInsertId()
+	if err != nil {
+		return loan, err
+	}
+	loan.ID = int(loanID)
+	if err := tx.Commit(); err != nil {
+		return loan, err
+	}
+	emitEvent(EventDebtAdded, debtor, &Debt{ID: loan.DebtID, DebtorID: debtor.ID, Amount: principal, Reason: reason}, nil)
+	return loan, nil
+}
+
+const loanColumns = "id, debt_id, debtor_id, principal_cents, annual_rate, term_months, start_date, closed_at"
+
+func scanLoan(row *sql.Row) (Loan, error) {
+	var loan Loan
+	err := row.Scan(&loan.ID, &loan.DebtID, &loan.DebtorID, &loan.Principal, &loan.AnnualRate, &loan.TermMonths, &loan.StartDate, &loan.ClosedAt)
+	return loan, err
+}
+
+func getLoan(loanID int) (Loan, error) {
+	return scanLoan(DB.QueryRow("SELECT "+loanColumns+" FROM loans WHERE id = ?", loanID))
+}
+
+func getLoanByDebtID(debtID int) (Loan, error) {
+	return scanLoan(DB.QueryRow("SELECT "+loanColumns+" FROM loans WHERE debt_id = ?", debtID))
+}
+
+func listLoanPayments(loanID int) ([]loanPayment, error) {
+	rows, err := DB.Query("SELECT amount_cents, principal_cents, interest_cents, paid_at FROM loan_payments WHERE loan_id = ? ORDER BY paid_at", loanID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []loanPayment
+	for rows.Next() {
+		var p loanPayment
+		if err := rows.Scan(&p.Amount, &p.Principal, &p.Interest, &p.PaidAt); err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
+
+// accruedInterest is the interest on the outstanding principal since the last payment (or the loan start).
+func accruedInterest(loan Loan, outstanding Money, payments []loanPayment, now time.Time) Money {
+	since := loan.StartDate
+	if len(payments) > 0 {
+		since = payments[len(payments)-1].PaidAt
+	}
+	days := math.Floor(now.Sub(since).Hours() / 24)
+	if days <= 0 {
+		return 0
+	}
+	return outstanding.Times(loan.AnnualRate / 100 * days / 365)
+}
+
+// splitLoanPayment applies a payment to accrued interest first and the rest to principal.
+func splitLoanPayment(amount, interestDue, outstanding Money) (principal, interest Money) {
+	interest = min(amount, interestDue)
+	principal = min(amount-interest, outstanding)
+	return principal, interest
+}
+
+// recordLoanPayment books a payment against a loan in one transaction: it
+// stores the interest/principal split, reduces the outstanding principal, adds
+// the payment to the history and closes the loan once the principal is repaid.
+func recordLoanPayment(loan Loan, debt Debt, amount Money, method string) (loanPayment, Money, error) {
+	payments, err := listLoanPayments(loan.ID)
+	if err != nil {
+		return loanPayment{}, debt.Amount, err
+	}
+	now := time.Now()
+	principal, interest := splitLoanPayment(amount, accruedInterest(loan, debt.Amount, payments, now), debt.Amount)
+	payment := loanPayment{Amount: amount, Principal: principal, Interest: interest, PaidAt: now}
+	remaining := debt.Amount - principal
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return payment, debt.Amount, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO loan_payments (loan_id, amount_cents, principal_cents, interest_cents, paid_at) VALUES (?, ?, ?, ?, ?)",
+		loan.ID, amount, principal, interest, now); err != nil {
+		return payment, debt.Amount, err
+	}
+	if _, err := tx.Exec("INSERT INTO payments (debtor_id, debt_id, reason, amount_cents, method, paid_at) VALUES (?, ?, ?, ?, ?, ?)",
+		debt.DebtorID, debt.ID, debt.Reason, amount, method, now); err != nil {
+		return payment, debt.Amount, err
+	}
+	if remaining <= 0 {
+		remaining = 0
+		if _, err := tx.Exec("DELETE FROM debts WHERE id = ?", debt.ID); err != nil {
+			return payment, debt.Amount, err
+		}
+		if _, err := tx.Exec("UPDATE loans SET closed_at = ? WHERE id = ?", now, loan.ID); err != nil {
+			return payment, debt.Amount, err
+		}
+	} else if _, err := tx.Exec("UPDATE debts SET amount_cents = ? WHERE id = ?", remaining, debt.ID); err != nil {
+		return payment, debt.Amount, err
+	}
+	if err := tx.Commit(); err != nil {
+		return payment, debt.Amount, err
+	}
+	emitDebtEvent(EventPaymentRecorded, debt, &Payment{DebtorID: debt.DebtorID, DebtID: debt.ID, Reason: debt.Reason, Amount: amount, Method: method, PaidAt: now})
+	if remaining == 0 {
+		emitDebtEvent(EventDebtClosed, debt, nil)
+	}
+	return payment, remaining, nil
+}
+
+// remainingSchedule re-plans the outstanding principal over the months left in the term.
+func remainingSchedule(loan Loan, outstanding Money, now time.Time) []loanInstallment {
+	elapsed := 0
+	for !addMonths(loan.StartDate, elapsed+1).After(now) {
+		elapsed++
+	}
+	months := loan.TermMonths - elapsed
+	if months < 1 {
+		months = 1
+	}
+	return amortizationSchedule(outstanding, loan.AnnualRate, months, loan.StartDate, elapsed)
+}
+
+// --- Loan Flow ---
+
+func handleLoanCommand(bot Sender, chatID int64) {
+	clearUserState(chatID)
+	setUserState(chatID, StateAddingLoanDebtor)
+	sendPrompt(bot, chatID, "🏦 Новый кредит.\n\nКому выдан кредит? Введи имя должника:")
+}
+
+func handleLoanInput(bot Sender, chatID int64, state int, text string) {
+	switch state {
+	case StateAddingLoanDebtor:
+		debtor, err := getDebtorByName(text, chatID)
+		if err == sql.ErrNoRows {
+			debtor, err = addDebtor(Debtor{Name: text, ChatID: chatID})
+		}
+		if err != nil {
+			log.Printf("Error getting debtor for loan: %v", err)
+			sendSimpleMessage(bot, chatID, "Произошла ошибка при поиске должника.")
+			clearUserState(chatID)
+			return
+		}
+		setCurrentDebtor(chatID, debtor)
+		setUserState(chatID, StateAddingLoanPrincipal)
+		sendPrompt(bot, chatID, fmt.Sprintf("Какую сумму получил *%s*?", escapeBold(debtor.Name)))
+
+	case StateAddingLoanPrincipal:
+		principal, err := parseAmount(getChatSettings(chatID), text)
+		if err != nil || principal <= 0 {
+			sendPrompt(bot, chatID, "Пожалуйста, введи корректную сумму кредита (положительное число).")
+			return
+		}
+		if settings := getChatSettings(chatID); exceedsMaxDebt(settings, principal) {
+			sendPrompt(bot, chatID, fmt.Sprintf("Сумма больше установленного максимума *%s*. Введи другую сумму или измени лимит в /settings.", formatAmount(settings, settings.MaxDebt)))
+			return
+		}
+		setLoanDraft(chatID, Loan{Principal: principal})
+		setUserState(chatID, StateAddingLoanRate)
+		sendPrompt(bot, chatID, "Какая процентная ставка, % годовых? Для беспроцентного займа введи 0.")
+
+	case StateAddingLoanRate:
+		// A rate is a plain decimal: "7,125" is not a thousands-separated number here.
+		rate, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "%")), ",", ".", 1), 64)
+		if err != nil || math.IsNaN(rate) || rate < 0 || rate > maxLoanRate {
+			sendPrompt(bot, chatID, fmt.Sprintf("Пожалуйста, введи ставку числом от 0 до %d.", maxLoanRate))
+			return
+		}
+		draft := getSession(chatID).LoanDraft
+		draft.AnnualRate = rate
+		setLoanDraft(chatID, draft)
+		setUserState(chatID, StateAddingLoanTerm)
+		sendPrompt(bot, chatID, "На сколько месяцев выдан кредит?")
+
+	case StateAddingLoanTerm:
+		months, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil || months < 1 || months > maxLoanTermMonths {
+			sendPrompt(bot, chatID, fmt.Sprintf("Пожалуйста, введи срок в месяцах — целое число от 1 до %d.", maxLoanTermMonths))
+			return
+		}
+		session := getSession(chatID)
+		defer clearUserState(chatID)
+		loan, err := addLoan(session.Debtor, session.LoanDraft.Principal, session.LoanDraft.AnnualRate, months, time.Now())
+		if err != nil {
+			log.Printf("Error adding loan: %v", err)
+			sendSimpleMessage(bot, chatID, "Произошла ошибка при добавлении кредита.")
+			return
+		}
+		text, keyboard := loanView(chatID, loan)
+		sendWithKeyboard(bot, chatID, "✅ Кредит добавлен!\n\n"+text, keyboard)
+	}
+}
+
+func loanView(chatID int64, loan Loan) (string, tgbotapi.InlineKeyboardMarkup) {
+	settings := getChatSettings(chatID)
+	debtor, err := getDebtorByID(loan.DebtorID)
+	if err != nil {
+		log.Printf("Error getting debtor for loan: %v", err)
+	}
+	payments, err := listLoanPayments(loan.ID)
+	if err != nil {
+		log.Printf("Error listing loan payments: %v", err)
+	}
+	var outstanding Money
+	if !loan.ClosedAt.Valid {
+		if debt, err := getDebtByID(loan.DebtID); err == nil {
+			outstanding = debt.Amount
+		} else {
+			log.Printf("Error getting loan debt: %v", err)
+		}
+	}
+
+	var paidPrincipal, paidInterest Money
+	for _, p := range payments {
+		paidPrincipal += p.Principal
+		paidInterest += p.Interest
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🏦 *Кредит: %s*\n\n", escapeBold(debtor.Name)))
+	text.WriteString(fmt.Sprintf("Сумма: *%s* под %s%% годовых на %d мес. с %s\n", formatAmount(settings, loan.Principal),
+		formatRate(settings, loan.AnnualRate), loan.TermMonths, formatDate(settings, loan.StartDate.In(chatLocation(settings)))))
+	text.WriteString(fmt.Sprintf("Ежемесячный платёж: *%s*\n", formatAmount(settings, annuityPayment(loan.Principal, loan.AnnualRate, loan.TermMonths))))
+	text.WriteString(fmt.Sprintf("Выплачено: *%s* (основной долг %s, проценты %s)\n",
+		formatAmount(settings, paidPrincipal+paidInterest), formatAmount(settings, paidPrincipal), formatAmount(settings, paidInterest)))
+
+	if loan.ClosedAt.Valid {
+		text.WriteString(fmt.Sprintf("\n✅ Кредит погашен %s.", formatDate(settings, loan.ClosedAt.Time.In(chatLocation(settings)))))
+		return text.String(), tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			callbackButton("📄 График и платежи (CSV)", fmt.Sprintf("loan_export:%d", loan.ID)),
+		))
+	}
+
+	now := time.Now()
+	text.WriteString(fmt.Sprintf("Остаток основного долга: *%s*\n", formatAmount(settings, outstanding)))
+	text.WriteString(fmt.Sprintf("Проценты на сегодня: *%s*\n", formatAmount(settings, accruedInterest(loan, outstanding, payments, now))))
+
+	schedule := remainingSchedule(loan, outstanding, now)
+	text.WriteString("\n*Ближайшие платежи по графику:*\n")
+	for i, installment := range schedule {
+		if i == loanPreviewRows {
+			break
+		}
+		text.WriteString(fmt.Sprintf("%s — %s (основной %s, проценты %s)\n", formatDate(settings, installment.Date.In(chatLocation(settings))),
+			formatAmount(settings, installment.Payment), formatNumber(settings, installment.Principal), formatNumber(settings, installment.Interest)))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton("💵 Внести платёж", fmt.Sprintf("loan_pay:%d", loan.ID)),
+			callbackButton("📄 График (CSV)", fmt.Sprintf("loan_export:%d", loan.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton("👤 К должнику", fmt.Sprintf("select_debtor:%d", loan.DebtorID)),
+		),
+	)
+	return text.String(), keyboard
+}
+
+// chatLoan parses the loan ID from callback data and makes sure the loan belongs to the chat.
+func chatLoan(chatID int64, data, prefix string) (Loan, bool) {
+	loanID, err := strconv.Atoi(strings.TrimPrefix(data, prefix))
+	if err != nil {
+		log.Printf("Invalid loan ID in callback: %v", err)
+		return Loan{}, false
+	}
+	loan, err := getLoan(loanID)
+	if err != nil {
+		log.Printf("Error getting loan %d: %v", loanID, err)
+		return Loan{}, false
+	}
+	debtor, err := getDebtorByID(loan.DebtorID)
+	if err != nil || debtor.ChatID != ledgerChatID(chatID) {
+		log.Printf("Loan %d does not belong to chat %d: %v", loanID, chatID, err)
+		return Loan{}, false
+	}
+	return loan, true
+}
+
+func handleLoanCallback(bot Sender, chatID int64, messageID int, data string) {
+	switch {
+	case strings.HasPrefix(data, "loan_show:"):
+		if loan, ok := chatLoan(chatID, data, "loan_show:"); ok {
+			text, keyboard := loanView(chatID, loan)
+			editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+		}
+
+	case strings.HasPrefix(data, "loan_pay:"):
+		loan, ok := chatLoan(chatID, data, "loan_pay:")
+		if !ok || loan.ClosedAt.Valid {
+			return
+		}
+		debt, err := getDebtByID(loan.DebtID)
+		if err != nil {
+			log.Printf("Error getting loan debt: %v", err)
+			sendSimpleMessage(bot, chatID, "Произошла ошибка при получении кредита.")
+			return
+		}
+		payments, err := listLoanPayments(loan.ID)
+		if err != nil {
+			log.Printf("Error listing loan payments: %v", err)
+			sendSimpleMessage(bot, chatID, "Произошла ошибка при получении кредита.")
+			return
+		}
+		if debtor, err := getDebtorByID(loan.DebtorID); err == nil {
+			setCurrentDebtor(chatID, debtor)
+		}
+		setSelectedDebt(chatID, debt)
+		setUserState(chatID, StateEnteringLoanPayment)
+		settings := getChatSettings(chatID)
+		interest := accruedInterest(loan, debt.Amount, payments, time.Now())
+		editPrompt(bot, chatID, messageID, fmt.Sprintf("Какую сумму внёс должник?\n\nДля полного погашения сегодня нужно *%s* (проценты %s).",
+			formatAmount(settings, debt.Amount+interest), formatAmount(settings, interest)))
+
+	case strings.HasPrefix(data, "loan_export:"):
+		loan, ok := chatLoan(chatID, data, "loan_export:")
+		if !ok {
+			return
+		}
+		sendLoanCSV(bot, chatID, loan)
+	}
+}
+
+func handleLoanPaymentAmount(bot Sender, chatID int64, text string) {
+	amount, err := parseAmount(getChatSettings(chatID), text)
+	if err != nil || amount <= 0 {
+		sendPrompt(bot, chatID, "Пожалуйста, введи корректную сумму платежа (положительное число).")
+		return
+	}
+	debt := selectedDebt(chatID)
+	loan, err := getLoanByDebtID(debt.ID)
+	if err != nil {
+		log.Printf("Error getting loan for payment: %v", err)
+		sendSimpleMessage(bot, chatID, "Кредит не найден.")
+		clearUserState(chatID)
+		return
+	}
+	payments, err := listLoanPayments(loan.ID)
+	if err != nil {
+		log.Printf("Error listing loan payments: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при получении кредита.")
+		clearUserState(chatID)
+		return
+	}
+	if payoff := debt.Amount + accruedInterest(loan, debt.Amount, payments, time.Now()); amount > payoff {
+		sendPrompt(bot, chatID, fmt.Sprintf("Платёж не может быть больше суммы полного погашения *%s*.", formatChatAmount(chatID, payoff)))
+		return
+	}
+	askPaymentMethod(bot, chatID, amount)
+}
+
+// loanPaymentText describes how a loan payment was split.
+func loanPaymentText(chatID int64, payment loanPayment, remaining Money) string {
+	settings := getChatSettings(chatID)
+	text := fmt.Sprintf("Платёж *%s* по кредиту: основной долг %s, проценты %s.", formatAmount(settings, payment.Amount),
+		formatAmount(settings, payment.Principal), formatAmount(settings, payment.Interest))
+	if remaining == 0 {
+		return text + "\n\n✅ Кредит полностью погашен."
+	}
+	return text + fmt.Sprintf("\nОстаток основного долга: *%s*", formatAmount(settings, remaining))
+}
+
+// --- Loan Export ---
+
+func generateLoanCSV(chatID int64, loan Loan) (string, error) {
+	payments, err := listLoanPayments(loan.ID)
+	if err != nil {
+		return "", err
+	}
+
+	tmpFile, err := os.CreateTemp("", "loan_*.csv")
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+
+	writer := csv.NewWriter(tmpFile)
+	defer writer.Flush()
+
+	settings := getChatSettings(chatID)
+	currency := settings.CurrencySymbol
+	rows := [][]string{
+		{"Principal (" + currency + ")", "Annual Rate (%)", "Term (months)", "Start Date"},
+		{formatNumber(settings, loan.Principal), formatRate(settings, loan.AnnualRate), strconv.Itoa(loan.TermMonths), formatDate(settings, loan.StartDate)},
+		{},
+		{"#", "Due Date", "Payment (" + currency + ")", "Principal (" + currency + ")", "Interest (" + currency + ")", "Balance (" + currency + ")"},
+	}
+	for _, installment := range amortizationSchedule(loan.Principal, loan.AnnualRate, loan.TermMonths, loan.StartDate, 0) {
+		rows = append(rows, []string{strconv.Itoa(installment.Number), formatDate(settings, installment.Date),
+			formatNumber(settings, installment.Payment), formatNumber(settings, installment.Principal),
+			formatNumber(settings, installment.Interest), formatNumber(settings, installment.Balance)})
+	}
+	rows = append(rows, []string{}, []string{"Paid At", "Amount (" + currency + ")", "Principal (" + currency + ")", "Interest (" + currency + ")"})
+	for _, p := range payments {
+		rows = append(rows, []string{formatDateTime(settings, p.PaidAt), formatNumber(settings, p.Amount),
+			formatNumber(settings, p.Principal), formatNumber(settings, p.Interest)})
+	}
+
+	if err := writer.WriteAll(rows); err != nil {
+		return "", err
+	}
+	return tmpFile.Name(), nil
+}
+
+func sendLoanCSV(bot Sender, chatID int64, loan Loan) {
+	sendChatAction(bot, chatID, tgbotapi.ChatUploadDocument)
+	filePath, err := generateLoanCSV(chatID, loan)
+	if err != nil {
+		log.Printf("Error generating loan CSV: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при создании CSV файла.")
+		return
+	}
+	defer func() {
+		if err := os.Remove(filePath); err != nil {
+			log.Printf("Error deleting temp file: %v", err)
+		}
+	}()
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(filePath))
+	doc.Caption = "График платежей и история по кредиту"
+	if _, err := sendChattable(bot, chatID, doc); err != nil {
+		log.Printf("Error sending loan CSV: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при отправке CSV файла.")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAmortizationScheduleDates(t *testing.T) {
+	start, _ := time.Parse(time.DateOnly, "2025-01-31")
+	want := []string{"2025-02-28", "2025-03-31", "2025-04-30", "2025-05-31"}
+	schedule := amortizationSchedule(400000, 12, len(want), start, 0)
+	for i, installment := range schedule {
+		if got := installment.Date.Format(time.DateOnly); got != want[i] {
+			t.Errorf("installment %d due %s, want %s", installment.Number, got, want[i])
+		}
+	}
+	if last := schedule[len(schedule)-1]; last.Balance != 0 {
+		t.Errorf("balance after the last installment = %d, want 0", last.Balance)
+	}
+}
+
+func TestRemainingScheduleDates(t *testing.T) {
+	start, _ := time.Parse(time.DateOnly, "2025-01-31")
+	loan := Loan{Principal: 400000, AnnualRate: 12, TermMonths: 4, StartDate: start}
+	now, _ := time.Parse(time.DateOnly, "2025-03-01")
+	schedule := remainingSchedule(loan, 300000, now)
+	want := []string{"2025-03-31", "2025-04-30", "2025-05-31"}
+	if len(schedule) != len(want) {
+		t.Fatalf("remainingSchedule has %d installments, want %d", len(schedule), len(want))
+	}
+	for i, installment := range schedule {
+		if got := installment.Date.Format(time.DateOnly); got != want[i] {
+			t.Errorf("installment %d due %s, want %s", installment.Number, got, want[i])
+		}
+	}
+}
@@ -3,15 +3,17 @@ package main
 import (
 	"database/sql"
 	"encoding/csv"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	_ "time/tzdata"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/joho/godotenv"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -20,8 +22,13 @@ import (
 type Debt struct {
 	ID       int
 	DebtorID int
-	Amount   float64
+	Amount   Money
 	Reason   string
+	Tag      string
+	GroupID  sql.NullInt64
+	LoanID   sql.NullInt64
+	// CreatedAt is unknown for debts added before it was tracked.
+	CreatedAt sql.NullTime
 }
 
 type Debtor struct {
@@ -29,7 +36,8 @@ type Debtor struct {
 	Name          string
 	ChatID        int64
 	PaymentDate   sql.NullTime
-	PaymentAmount sql.NullFloat64
+	PaymentAmount sql.Null[Money]
+	Notes         string
 }
 
 // --- Global Variables ---
@@ -53,81 +61,135 @@ const (
 	StateSettingPaymentAmount
 	StateEditingPaymentDate
 	StateEditingPaymentAmount
+	StateSettingCurrencySymbol
+	StateChoosingPaymentMethod
+	StateChoosingDebtorMatch
+	StateAddingSplitReason
+	StateAddingSplitAmount
+	StateChoosingSplitMode
+	StateEnteringSplitShares
+	StateEditingGroupReason
+	StateConfirmingLargeAmount
+	StateSettingMaxDebt
+	StateAddingLoanDebtor
+	StateAddingLoanPrincipal
+	StateAddingLoanRate
+	StateAddingLoanTerm
+	StateEnteringLoanPayment
+	StateSettingBirthday
+	StateEditingDebtorNotes
+	StateEditingDebtTag
+	StateRenamingDebtor
+	StateEnteringDebtorPayment
+	StateChoosingAllocation
+	StateSettingTimezone
+	StateSettingPaymentTemplate
+	StateSettingPaymentAccount
+	StateConfirmingDataErasure
+	StateRestoringFromFile
+	StateConfirmingRestore
+	StateEnteringInstallmentCount
+	StateEnteringInstallmentStart
+	StateConfirmingInstallments
+	StateConfirmingVoiceDebt
+	StateEnteringBroadcast
+	StateConfirmingBroadcast
 )
 
-var userStates = make(map[int64]int)
-var currentDebtors = make(map[int64]Debtor)
-var selectedDebts = make(map[int64]Debt)
+const maxDebtorMatches = 8
+
+// maxDebtorNotesLength keeps notes short enough to fit in the debtor details message.
+const maxDebtorNotesLength = 1000
 
 // --- Helper Functions ---
 
-func sendWithKeyboard(bot *tgbotapi.BotAPI, chatID int64, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
+// sendWithKeyboard returns the sent message, or a zero Message when sending failed.
+func sendWithKeyboard(bot Sender, chatID int64, text string, keyboard tgbotapi.InlineKeyboardMarkup) tgbotapi.Message {
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "Markdown"
 	if keyboard.InlineKeyboard != nil {
 		msg.ReplyMarkup = keyboard
 	}
-	_, err := bot.Send(msg)
+	sent, err := sendChattable(bot, chatID, msg)
 	if err != nil {
 		log.Printf("Error sending message: %v", err)
+		queueUndelivered(msg, err)
 	}
+	return sent
 }
 
-func sendSimpleMessage(bot *tgbotapi.BotAPI, chatID int64, text string) {
+func sendSimpleMessage(bot Sender, chatID int64, text string) {
 	sendWithKeyboard(bot, chatID, text, tgbotapi.InlineKeyboardMarkup{})
 }
 
-func editMessageWithKeyboard(bot *tgbotapi.BotAPI, chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
+func editMessageWithKeyboard(bot Sender, chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
+	if err := tryEditMessage(bot, chatID, messageID, text, keyboard); err != nil {
+		log.Printf("Error editing message: %v", err)
+	}
+}
+
+// tryEditMessage edits a message for callers that fall back to sending a new
+// one. Telegram rejects edits that change nothing; those count as done.
+func tryEditMessage(bot Sender, chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
 	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
 	editMsg.ParseMode = "Markdown"
 	if keyboard.InlineKeyboard != nil {
 		editMsg.ReplyMarkup = &keyboard
 	}
-	_, err := bot.Send(editMsg)
-	if err != nil {
-		log.Printf("Error editing message: %v", err)
+	_, err := sendChattable(bot, chatID, editMsg)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
 	}
+	return err
 }
 
-func clearUserState(chatID int64) {
-	delete(userStates, chatID)
-	delete(currentDebtors, chatID)
-	delete(selectedDebts, chatID)
+func cancelKeyboard(settings ChatSettings) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		callbackButton(tr(settings, "❌ Отмена"), "cancel_operation"),
+	))
 }
 
-// --- Database Initialization ---
+// sendPrompt asks the user for input and offers a button to abort the current flow.
+func sendPrompt(bot Sender, chatID int64, text string) {
+	sendWithKeyboard(bot, chatID, text, cancelKeyboard(getChatSettings(chatID)))
+}
 
-func initDB() {
-	var err error
-	DB, err = sql.Open("sqlite3", "./debt_tracker.db")
-	if err != nil {
-		log.Fatal(err)
+func editPrompt(bot Sender, chatID int64, messageID int, text string) {
+	editMessageWithKeyboard(bot, chatID, messageID, text, cancelKeyboard(getChatSettings(chatID)))
+}
+
+func markSelected(label string, selected bool) string {
+	if selected {
+		return "• " + label
 	}
+	return label
+}
+
+// --- Database Initialization ---
+
+const (
+	// dbMaxOpenConns covers the update workers, the scheduler and the API;
+	// SQLite has a single writer anyway, the rest only read.
+	dbMaxOpenConns = 16
+	dbMaxIdleConns = 4
+)
 
-	createDebtorsTable := `
-        CREATE TABLE IF NOT EXISTS debtors (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            name TEXT NOT NULL,
-            chat_id INTEGER NOT NULL,
-            payment_date DATETIME,
-            payment_amount REAL,
-            UNIQUE(name, chat_id)
-        );`
-	_, err = DB.Exec(createDebtorsTable)
+// initDB opens the database with the pragmas below on every connection:
+//   - WAL lets readers run while a write is in progress;
+//   - busy_timeout makes concurrent writers wait for the lock instead of
+//     failing with SQLITE_BUSY;
+//   - foreign_keys enforces the schema's references, so deleting a debtor
+//     cascades to its debts, payments and loans.
+func initDB(path string) {
+	var err error
+	DB, err = sql.Open("sqlite3", path+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000&_foreign_keys=on")
 	if err != nil {
 		log.Fatal(err)
 	}
+	DB.SetMaxOpenConns(dbMaxOpenConns)
+	DB.SetMaxIdleConns(dbMaxIdleConns)
 
-	createDebtsTable := `
-        CREATE TABLE IF NOT EXISTS debts (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            debtor_id INTEGER NOT NULL,
-            amount REAL NOT NULL,
-            reason TEXT NOT NULL,
-            FOREIGN KEY (debtor_id) REFERENCES debtors (id) ON DELETE CASCADE
-        );`
-	_, err = DB.Exec(createDebtsTable)
-	if err != nil {
+	if err := runMigrations(); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -135,6 +197,7 @@ func initDB() {
 // --- Database Interaction Functions ---
 
 func addDebtor(debtor Debtor) (Debtor, error) {
+	debtor.ChatID = ledgerChatID(debtor.ChatID)
 	result, err := DB.Exec("INSERT INTO debtors (name, chat_id) VALUES (?, ?)", debtor.Name, debtor.ChatID)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
@@ -152,23 +215,30 @@ func addDebtor(debtor Debtor) (Debtor, error) {
 
 func getDebtorByName(name string, chatID int64) (Debtor, error) {
 	var debtor Debtor
-	err := DB.QueryRow("SELECT id, name, chat_id, payment_date, payment_amount FROM debtors WHERE name = ? AND chat_id = ?", name, chatID).Scan(&debtor.ID, &debtor.Name, &debtor.ChatID, &debtor.PaymentDate, &debtor.PaymentAmount)
+	err := DB.QueryRow("SELECT id, name, chat_id, payment_date, payment_amount_cents, notes FROM debtors WHERE name = ? AND chat_id = ?", name, ledgerChatID(chatID)).Scan(&debtor.ID, &debtor.Name, &debtor.ChatID, &debtor.PaymentDate, &debtor.PaymentAmount, &debtor.Notes)
 	return debtor, err
 }
 
 func getDebtorByID(id int) (Debtor, error) {
 	var debtor Debtor
-	err := DB.QueryRow("SELECT id, name, chat_id, payment_date, payment_amount FROM debtors WHERE id = ?", id).Scan(&debtor.ID, &debtor.Name, &debtor.ChatID, &debtor.PaymentDate, &debtor.PaymentAmount)
+	err := DB.QueryRow("SELECT id, name, chat_id, payment_date, payment_amount_cents, notes FROM debtors WHERE id = ?", id).Scan(&debtor.ID, &debtor.Name, &debtor.ChatID, &debtor.PaymentDate, &debtor.PaymentAmount, &debtor.Notes)
 	return debtor, err
 }
 
 func addDebt(debt Debt) error {
-	_, err := DB.Exec("INSERT INTO debts (debtor_id, amount, reason) VALUES (?, ?, ?)", debt.DebtorID, debt.Amount, debt.Reason)
-	return err
+	result, err := DB.Exec("INSERT INTO debts (debtor_id, amount_cents, reason, tag, created_at) VALUES (?, ?, ?, ?, ?)", debt.DebtorID, debt.Amount, debt.Reason, debt.Tag, time.Now())
+	if err != nil {
+		return err
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		debt.ID = int(id)
+	}
+	emitDebtEvent(EventDebtAdded, debt, nil)
+	return nil
 }
 
 func listDebtors(chatID int64) ([]Debtor, error) {
-	rows, err := DB.Query("SELECT id, name, payment_date, payment_amount FROM debtors WHERE chat_id = ?", chatID)
+	rows, err := DB.Query("SELECT id, name, payment_date, payment_amount_cents, notes FROM debtors WHERE chat_id = ?", ledgerChatID(chatID))
 	if err != nil {
 		return nil, err
 	}
@@ -177,7 +247,7 @@ func listDebtors(chatID int64) ([]Debtor, error) {
 	var debtors []Debtor
 	for rows.Next() {
 		var debtor Debtor
-		if err := rows.Scan(&debtor.ID, &debtor.Name, &debtor.PaymentDate, &debtor.PaymentAmount); err != nil {
+		if err := rows.Scan(&debtor.ID, &debtor.Name, &debtor.PaymentDate, &debtor.PaymentAmount, &debtor.Notes); err != nil {
 			return nil, err
 		}
 		debtors = append(debtors, debtor)
@@ -186,7 +256,7 @@ func listDebtors(chatID int64) ([]Debtor, error) {
 }
 
 func listDebts(debtorID int) ([]Debt, error) {
-	rows, err := DB.Query("SELECT id, amount, reason FROM debts WHERE debtor_id = ?", debtorID)
+	rows, err := DB.Query("SELECT d.id, d.amount_cents, d.reason, d.tag, d.group_id, l.id, d.created_at FROM debts d LEFT JOIN loans l ON l.debt_id = d.id WHERE d.debtor_id = ?", debtorID)
 	if err != nil {
 		return nil, err
 	}
@@ -195,7 +265,7 @@ func listDebts(debtorID int) ([]Debt, error) {
 	var debts []Debt
 	for rows.Next() {
 		var debt Debt
-		if err := rows.Scan(&debt.ID, &debt.Amount, &debt.Reason); err != nil {
+		if err := rows.Scan(&debt.ID, &debt.Amount, &debt.Reason, &debt.Tag, &debt.GroupID, &debt.LoanID, &debt.CreatedAt); err != nil {
 			return nil, err
 		}
 		debts = append(debts, debt)
@@ -203,14 +273,31 @@ func listDebts(debtorID int) ([]Debt, error) {
 	return debts, rows.Err()
 }
 
+// sortDebtsByAge orders debts by creation time; debts of unknown age count as the oldest.
+func sortDebtsByAge(debts []Debt, order string) {
+	sort.SliceStable(debts, func(i, j int) bool {
+		a, b := debts[i], debts[j]
+		if order == DebtSortNewest {
+			a, b = b, a
+		}
+		if a.CreatedAt.Valid != b.CreatedAt.Valid {
+			return !a.CreatedAt.Valid
+		}
+		if !a.CreatedAt.Time.Equal(b.CreatedAt.Time) {
+			return a.CreatedAt.Time.Before(b.CreatedAt.Time)
+		}
+		return a.ID < b.ID
+	})
+}
+
 func getDebtByID(debtID int) (Debt, error) {
 	var debt Debt
-	err := DB.QueryRow("SELECT id, debtor_id, amount, reason FROM debts WHERE id = ?", debtID).Scan(&debt.ID, &debt.DebtorID, &debt.Amount, &debt.Reason)
+	err := DB.QueryRow("SELECT id, debtor_id, amount_cents, reason, tag, group_id, created_at FROM debts WHERE id = ?", debtID).Scan(&debt.ID, &debt.DebtorID, &debt.Amount, &debt.Reason, &debt.Tag, &debt.GroupID, &debt.CreatedAt)
 	return debt, err
 }
 
-func updateDebtAmount(debtID int, newAmount float64) error {
-	_, err := DB.Exec("UPDATE debts SET amount = ? WHERE id = ?", newAmount, debtID)
+func updateDebtAmount(debtID int, newAmount Money) error {
+	_, err := DB.Exec("UPDATE debts SET amount_cents = ? WHERE id = ?", newAmount, debtID)
 	return err
 }
 
@@ -220,22 +307,42 @@ func updateDebtReason(debtID int, newReason string) error {
 }
 
 func closeDebt(debtID int) error {
-	_, err := DB.Exec("DELETE FROM debts WHERE id = ?", debtID)
+	var debt Debt
+	if eventWebhooksEnabled() {
+		debt, _ = getDebtByID(debtID)
+	}
+	if _, err := DB.Exec("DELETE FROM debts WHERE id = ?", debtID); err != nil {
+		return err
+	}
+	if _, err := DB.Exec("UPDATE loans SET closed_at = ? WHERE debt_id = ? AND closed_at IS NULL", time.Now(), debtID); err != nil {
+		return err
+	}
+	if debt.ID != 0 {
+		emitDebtEvent(EventDebtClosed, debt, nil)
+	}
+	return nil
+}
+
+func updateDebtorPaymentDate(debtorID int, paymentDate time.Time) error {
+	_, err := DB.Exec("UPDATE debtors SET payment_date = ? WHERE id = ?", paymentDate, debtorID)
 	return err
 }
 
-func deleteDebtor(debtorID int) error {
-	_, err := DB.Exec("DELETE FROM debtors WHERE id = ?", debtorID)
+func updateDebtorPaymentAmount(debtorID int, paymentAmount Money) error {
+	_, err := DB.Exec("UPDATE debtors SET payment_amount_cents = ? WHERE id = ?", paymentAmount, debtorID)
 	return err
 }
 
-func updateDebtorPaymentDate(debtorID int, paymentDate time.Time) error {
-	_, err := DB.Exec("UPDATE debtors SET payment_date = ? WHERE id = ?", paymentDate, debtorID)
+func updateDebtorNotes(debtorID int, notes string) error {
+	_, err := DB.Exec("UPDATE debtors SET notes = ? WHERE id = ?", notes, debtorID)
 	return err
 }
 
-func updateDebtorPaymentAmount(debtorID int, paymentAmount float64) error {
-	_, err := DB.Exec("UPDATE debtors SET payment_amount = ? WHERE id = ?", paymentAmount, debtorID)
+func renameDebtor(debtorID int, name string) error {
+	_, err := DB.Exec("UPDATE debtors SET name = ? WHERE id = ?", name, debtorID)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return fmt.Errorf("debtor already exists")
+	}
 	return err
 }
 
@@ -245,12 +352,14 @@ func clearDebtorPaymentDate(debtorID int) error {
 }
 
 func clearDebtorPaymentAmount(debtorID int) error {
-	_, err := DB.Exec("UPDATE debtors SET payment_amount = NULL WHERE id = ?", debtorID)
+	_, err := DB.Exec("UPDATE debtors SET payment_amount_cents = NULL WHERE id = ?", debtorID)
 	return err
 }
 
 // --- CSV Export ---
-func generateCSV(chatID int64) (string, error) {
+// generateCSV writes the chat's debts, narrowed by filter, to a temp file.
+// progress, if set, is called after each debtor.
+func generateCSV(chatID int64, filter exportFilter, progress func(done, total int)) (string, error) {
 	debtors, err := listDebtors(chatID)
 	if err != nil {
 		return "", err
@@ -259,6 +368,24 @@ func generateCSV(chatID int64) (string, error) {
 	if len(debtors) == 0 {
 		return "", fmt.Errorf("no debtors found for chat %d", chatID)
 	}
+	if filter.Debtor.ID != 0 {
+		debtors = []Debtor{filter.Debtor}
+	}
+
+	// A ranged export lists the debts created and the payments made in the period.
+	var payments []Payment
+	paidInRange := make(map[int]map[string]Money)
+	if filter.hasRange() {
+		if payments, err = listFilteredPayments(chatID, filter); err != nil {
+			return "", err
+		}
+		for _, p := range payments {
+			if paidInRange[p.DebtorID] == nil {
+				paidInRange[p.DebtorID] = make(map[string]Money)
+			}
+			paidInRange[p.DebtorID][p.Method] += p.Amount
+		}
+	}
 
 	tmpFile, err := os.CreateTemp("", "debts_*.csv")
 	if err != nil {
@@ -269,41 +396,80 @@ func generateCSV(chatID int64) (string, error) {
 	writer := csv.NewWriter(tmpFile)
 	defer writer.Flush()
 
-	header := []string{"Debtor Name", "Total Debt", "Payment Date", "Payment Amount", "Debt Reason", "Debt Amount"}
+	settings := getChatSettings(chatID)
+	currency := settings.CurrencySymbol
+	header := []string{"Debtor Name", "Total Debt (" + currency + ")", "Payment Date", "Payment Amount (" + currency + ")", "Debt Reason", "Debt Amount (" + currency + ")",
+		"Paid Cash (" + currency + ")", "Paid Transfer (" + currency + ")", "Paid Other (" + currency + ")", "Notes", "Debt Tag", "Debt Created"}
 	if err := writer.Write(header); err != nil {
 		return "", err
 	}
 
-	for _, debtor := range debtors {
+	rowsWritten := 0
+	for i, debtor := range debtors {
+		if progress != nil {
+			progress(i, len(debtors))
+		}
+
 		debts, err := listDebts(debtor.ID)
 		if err != nil {
 			return "", err
 		}
+		if filter.hasRange() {
+			var inRange []Debt
+			for _, debt := range debts {
+				if debt.CreatedAt.Valid && filter.inRange(settings, debt.CreatedAt.Time) {
+					inRange = append(inRange, debt)
+				}
+			}
+			debts = inRange
+			if len(debts) == 0 && paidInRange[debtor.ID] == nil {
+				continue
+			}
+		}
+		rowsWritten++
 
-		var totalDebt float64
+		var totalDebt Money
 		for _, debt := range debts {
 			totalDebt += debt.Amount
 		}
 
 		paymentDateStr := ""
 		if debtor.PaymentDate.Valid {
-			paymentDateStr = debtor.PaymentDate.Time.Format("02.01.2006")
+			paymentDateStr = formatDate(settings, debtor.PaymentDate.Time)
 		}
 		paymentAmountStr := ""
 		if debtor.PaymentAmount.Valid {
-			paymentAmountStr = fmt.Sprintf("%.2f", debtor.PaymentAmount.Float64)
+			paymentAmountStr = formatNumber(settings, debtor.PaymentAmount.V)
+		}
+
+		paid := paidInRange[debtor.ID]
+		if !filter.hasRange() {
+			if paid, err = sumDebtorPaymentsByMethod(debtor.ID); err != nil {
+				return "", err
+			}
+		}
+		paidColumns := []string{
+			formatNumber(settings, paid[PaymentMethodCash]),
+			formatNumber(settings, paid[PaymentMethodTransfer]),
+			formatNumber(settings, paid[PaymentMethodOther]),
 		}
 
 		if len(debts) > 0 {
 			for _, debt := range debts {
 				row := []string{
 					debtor.Name,
-					fmt.Sprintf("%.2f", totalDebt),
+					formatNumber(settings, totalDebt),
 					paymentDateStr,
 					paymentAmountStr,
 					debt.Reason,
-					fmt.Sprintf("%.2f", debt.Amount),
+					formatNumber(settings, debt.Amount),
+				}
+				row = append(row, paidColumns...)
+				created := ""
+				if debt.CreatedAt.Valid {
+					created = formatDate(settings, debt.CreatedAt.Time.In(chatLocation(settings)))
 				}
+				row = append(row, debtor.Notes, debt.Tag, created)
 				if err := writer.Write(row); err != nil {
 					return "", err
 				}
@@ -311,75 +477,175 @@ func generateCSV(chatID int64) (string, error) {
 		} else {
 			row := []string{
 				debtor.Name,
-				fmt.Sprintf("%.2f", totalDebt),
+				formatNumber(settings, totalDebt),
 				paymentDateStr,
 				paymentAmountStr,
 				"",
-				"0.00",
+				formatNumber(settings, 0),
 			}
+			row = append(row, paidColumns...)
+			row = append(row, debtor.Notes, "", "")
 			if err := writer.Write(row); err != nil {
 				return "", err
 			}
 		}
 	}
 
+	if rowsWritten == 0 {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("nothing to export for chat %d", chatID)
+	}
+
+	if filter.hasRange() && len(payments) > 0 {
+		rows := [][]string{{}, {"Payment Date", "Debtor Name", "Debt Reason", "Amount (" + currency + ")", "Method"}}
+		for _, p := range payments {
+			rows = append(rows, []string{formatDate(settings, p.PaidAt.In(chatLocation(settings))), p.DebtorName, p.Reason, formatNumber(settings, p.Amount), p.Method})
+		}
+		if err := writer.WriteAll(rows); err != nil {
+			return "", err
+		}
+	}
+
+	tagTotals, err := chatTagTotals(chatID)
+	if err != nil {
+		return "", err
+	}
+	if len(tagTotals) > 0 && filter.isEmpty() {
+		rows := [][]string{{}, {"Debt Tag", "Debts", "Total Debt (" + currency + ")"}}
+		for _, total := range tagTotals {
+			tag := total.Tag
+			if tag == "" {
+				tag = "(none)"
+			}
+			rows = append(rows, []string{tag, strconv.Itoa(total.Count), formatNumber(settings, total.Amount)})
+		}
+		if err := writer.WriteAll(rows); err != nil {
+			return "", err
+		}
+	}
+
 	return tmpFile.Name(), nil
 
 }
 
 // --- Command Handlers ---
 
-func handleStartCommand(bot *tgbotapi.BotAPI, chatID int64) {
+func handleStartCommand(bot Sender, chatID int64) {
 	clearUserState(chatID)
+	settings := getChatSettings(chatID)
 
-	// Define the path to your image file
-	imagePath := "botBanner.jpeg" //REPLACE
-
-	// 1. Send the photo
-	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(imagePath))
-	//   photo.Caption = "Welcome to DebtTracker!" // Optional caption
-	_, err := bot.Send(photo)
-	if err != nil {
-		log.Printf("Error sending photo: %v", err)
-		// Fallback to text-only, if the image fails.  Don't return; send the text.
-		// You might want to send a message saying the image failed to load.
-		sendSimpleMessage(bot, chatID, "Привет! Не удалось загрузить изображение, но я DebtTracker и я помогу тебе вести учет долгов.")
+	// 1. Send the banner, if one is configured
+	if config.BannerPath != "" {
+		photo := tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(config.BannerPath))
+		_, err := sendChattable(bot, chatID, photo)
+		if err != nil {
+			log.Printf("Error sending photo: %v", err)
+			// Fallback to text-only, if the image fails.  Don't return; send the text.
+			sendSimpleMessage(bot, chatID, tr(settings, "Привет! Не удалось загрузить изображение, но я DebtTracker и я помогу тебе вести учет долгов."))
+		}
 	}
 
 	// 2. Send the text message (separately, for guaranteed delivery)
-	text := "Привет! Я бот DebtTracker. Я помогу тебе вести учет долгов.\n\n" +
-		"Основные команды:\n" +
-		"/add - Добавить долг\n" +
-		"/debts - Посмотреть список должников и долги\n" +
-		"/exportcsv - Выгрузить данные в CSV\n" +
-		"/help - Помощь и список команд"
+	text := tr(settings, startText)
 	sendSimpleMessage(bot, chatID, text) // Use the existing function
 }
 
-func handleAddCommand(bot *tgbotapi.BotAPI, chatID int64) {
+func handleAddCommand(bot Sender, chatID int64, args string) {
+	clearUserState(chatID)
+	if args = strings.TrimSpace(args); args != "" {
+		if name, amount, reason, ok := parseQuickAdd(getChatSettings(chatID), args); ok {
+			quickAdd(bot, chatID, name, amount, reason)
+			return
+		}
+		sendSimpleMessage(bot, chatID, "Не получилось разобрать команду. Формат: `/add Иван 500 за обед`. Давай добавим по шагам.")
+	}
+	setUserState(chatID, StateAddingDebtorName)
+	sendPrompt(bot, chatID, "Введи имя должника (или несколько имён через запятую, чтобы разделить сумму):")
+}
+
+func handleDebtsCommand(bot Sender, chatID int64, args string) {
 	clearUserState(chatID)
-	userStates[chatID] = StateAddingDebtorName
-	sendSimpleMessage(bot, chatID, "Введи имя должника:")
+
+	tag := ""
+	if args = strings.TrimSpace(args); args != "" {
+		var ok bool
+		if tag, ok = normalizeTag(args); !ok {
+			sendSimpleMessage(bot, chatID, "Укажи тег одним словом, например: /debts еда")
+			return
+		}
+	}
+	text, keyboard, ok := debtorListView(chatID, tag)
+	if !ok {
+		sendSimpleMessage(bot, chatID, text)
+		return
+	}
+	enterNavScreen(chatID, navScreen{Kind: navDebtorList, Tag: tag})
+	sendWithKeyboard(bot, chatID, text, keyboard)
 }
 
-func handleDebtsCommand(bot *tgbotapi.BotAPI, chatID int64) {
+// chatTotalDebt sums the chat's open debts and counts them and the debtors who owe anything.
+func chatTotalDebt(chatID int64) (total Money, debts, debtors int, err error) {
+	err = DB.QueryRow(`
+		SELECT COALESCE(SUM(d.amount_cents), 0), COUNT(d.id), COUNT(DISTINCT d.debtor_id)
+		FROM debts d
+		JOIN debtors r ON r.id = d.debtor_id
+		WHERE r.chat_id = ?`, ledgerChatID(chatID)).Scan(&total, &debts, &debtors)
+	return total, debts, debtors, err
+}
+
+func handleTotalCommand(bot Sender, chatID int64) {
 	clearUserState(chatID)
 
+	total, debts, debtors, err := chatTotalDebt(chatID)
+	if err != nil {
+		log.Printf("Error summing debts: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при подсчёте суммы долгов.")
+		return
+	}
+	if debts == 0 {
+		sendSimpleMessage(bot, chatID, "Открытых долгов нет.")
+		return
+	}
+	sendSimpleMessage(bot, chatID, fmt.Sprintf("💰 *Всего тебе должны: %s*\n\nДолжников: %d, открытых долгов: %d.", formatChatAmount(chatID, total), debtors, debts))
+}
+
+// debtorListView builds the /debts list, limited to debts with the given tag
+// if it is not empty. ok is false when there is nothing to list.
+func debtorListView(chatID int64, tag string) (string, tgbotapi.InlineKeyboardMarkup, bool) {
 	debtors, err := listDebtors(chatID)
 	if err != nil {
 		log.Printf("Error listing debtors: %v", err)
-		sendSimpleMessage(bot, chatID, "Произошла ошибка при получении списка должников.")
-		return
+		return "Произошла ошибка при получении списка должников.", tgbotapi.InlineKeyboardMarkup{}, false
 	}
 
 	if len(debtors) == 0 {
-		sendSimpleMessage(bot, chatID, "У тебя пока нет должников.  Используй /add, чтобы добавить.")
-		return
+		return "У тебя пока нет должников.  Используй /add, чтобы добавить.", tgbotapi.InlineKeyboardMarkup{}, false
 	}
 
-	var keyboardButtons [][]tgbotapi.InlineKeyboardButton
+	debtsByDebtor := make(map[int][]Debt, len(debtors))
+	totals := make(map[int]Money, len(debtors))
+	var shown []Debtor
 	for _, debtor := range debtors {
 		debts, _ := listDebts(debtor.ID)
+		debts = filterDebtsByTag(debts, tag)
+		if tag != "" && len(debts) == 0 {
+			continue
+		}
+		shown = append(shown, debtor)
+		debtsByDebtor[debtor.ID] = debts
+		for _, debt := range debts {
+			totals[debtor.ID] += debt.Amount
+		}
+	}
+	if len(shown) == 0 {
+		return fmt.Sprintf("Долгов с тегом #%s нет.", tag), tgbotapi.InlineKeyboardMarkup{}, false
+	}
+	debtors = shown
+	sortDebtors(debtors, getChatSettings(chatID).DebtorSort, totals)
+
+	var keyboardButtons [][]tgbotapi.InlineKeyboardButton
+	for _, debtor := range debtors {
+		debts := debtsByDebtor[debtor.ID]
 		debtPlural := "долга"
 		if len(debts)%10 == 1 && len(debts)%100 != 11 {
 			debtPlural = "долг"
@@ -391,44 +657,120 @@ func handleDebtsCommand(bot *tgbotapi.BotAPI, chatID int64) {
 
 		buttonText := fmt.Sprintf("%s (%d %s)", debtor.Name, len(debts), debtPlural)
 		callbackData := fmt.Sprintf("select_debtor:%d", debtor.ID)
-		keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(buttonText, callbackData)))
+		keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(callbackButton(buttonText, callbackData)))
 	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(keyboardButtons...)
-	sendWithKeyboard(bot, chatID, "*Твои должники:*", keyboard)
+	if tags, err := listChatTags(chatID); err != nil {
+		log.Printf("Error listing tags: %v", err)
+	} else if len(tags) > 0 {
+		if len(tags) > maxTagButtons-1 {
+			tags = tags[:maxTagButtons-1]
+		}
+		row := []tgbotapi.InlineKeyboardButton{callbackButton(markSelected("Все", tag == ""), "debts_tag:")}
+		for _, t := range tags {
+			row = append(row, callbackButton(markSelected("#"+t, tag == t), "debts_tag:"+t))
+			if len(row) == 4 {
+				keyboardButtons = append(keyboardButtons, row)
+				row = nil
+			}
+		}
+		if len(row) > 0 {
+			keyboardButtons = append(keyboardButtons, row)
+		}
+	}
+
+	var total Money
+	for _, amount := range totals {
+		total += amount
+	}
+	settings := getChatSettings(chatID)
+	title := fmt.Sprintf("*Всего тебе должны: %s*\n\n*Твои должники:*", formatAmount(settings, total))
+	if tag != "" {
+		title = fmt.Sprintf("*Всего по #%s: %s*\n\n*Твои должники* (#%s):", tag, formatAmount(settings, total), tag)
+	}
+	return title, tgbotapi.NewInlineKeyboardMarkup(keyboardButtons...), true
 }
 
-func handleHelpCommand(bot *tgbotapi.BotAPI, chatID int64) {
+// sortDebtors orders the /debts list according to the chat's preference.
+func sortDebtors(debtors []Debtor, sortOrder string, totals map[int]Money) {
+	byName := func(i, j int) bool { return strings.ToLower(debtors[i].Name) < strings.ToLower(debtors[j].Name) }
+	switch sortOrder {
+	case DebtorSortAmount:
+		sort.SliceStable(debtors, func(i, j int) bool {
+			if totals[debtors[i].ID] != totals[debtors[j].ID] {
+				return totals[debtors[i].ID] > totals[debtors[j].ID]
+			}
+			return byName(i, j)
+		})
+	case DebtorSortDate:
+		// Debtors without a payment date go last.
+		sort.SliceStable(debtors, func(i, j int) bool {
+			a, b := debtors[i].PaymentDate, debtors[j].PaymentDate
+			if a.Valid != b.Valid {
+				return a.Valid
+			}
+			if a.Valid && !a.Time.Equal(b.Time) {
+				return a.Time.Before(b.Time)
+			}
+			return byName(i, j)
+		})
+	default:
+		sort.SliceStable(debtors, byName)
+	}
+}
+
+func handleCancelCommand(bot Sender, chatID int64) {
+	if getUserState(chatID) == StateIdle {
+		sendSimpleMessage(bot, chatID, "Сейчас нечего отменять.")
+		return
+	}
+	clearUserState(chatID)
+	sendSimpleMessage(bot, chatID, "Операция отменена.")
+}
+
+func handleHelpCommand(bot Sender, chatID int64) {
 	clearUserState(chatID)
-	text := "**Команды бота DebtTracker:**\n\n" +
-		"/add - Добавить новый долг. Бот спросит имя должника, причину и сумму.\n" +
-		"/debts - Показать список всех твоих должников.  Можно выбрать должника, чтобы увидеть детализацию долгов, закрыть или отредактировать долги.\n" +
-		"/exportcsv - Выгрузить данные в CSV файл.\n" +
-		"/help - Показать это сообщение со списком команд."
-	sendSimpleMessage(bot, chatID, text)
+	sendSimpleMessage(bot, chatID, helpText(getChatSettings(chatID)))
 }
 
-func handleExportCSVCommand(bot *tgbotapi.BotAPI, chatID int64) {
+func handleExportCSVCommand(bot Sender, chatID int64, args string) {
 	clearUserState(chatID)
-	filePath, err := generateCSV(chatID)
+
+	filter, problem := parseExportFilter(chatID, args)
+	if problem != "" {
+		sendSimpleMessage(bot, chatID, problem)
+		return
+	}
+
+	stopAction := keepChatAction(bot, chatID, tgbotapi.ChatUploadDocument)
+	defer stopAction()
+	status := startProgress(bot, chatID, "⏳ Готовлю CSV…")
+
+	filePath, err := generateCSV(chatID, filter, func(done, total int) {
+		status.update(fmt.Sprintf("⏳ Готовлю CSV… обработано должников: %d из %d", done, total))
+	})
 	if err != nil {
 		log.Printf("Error generating CSV: %v", err)
 		if strings.Contains(err.Error(), "no debtors found") {
-			sendSimpleMessage(bot, chatID, "Нет данных для выгрузки. Сначала добавьте должников.")
+			status.set("Нет данных для выгрузки. Сначала добавьте должников.")
+		} else if strings.Contains(err.Error(), "nothing to export") {
+			status.set("Под выбранные условия ничего не попало.")
 		} else {
-			sendSimpleMessage(bot, chatID, "Произошла ошибка при создании CSV файла.")
+			status.set("Произошла ошибка при создании CSV файла.")
 		}
 
 		return
 	}
 
+	status.set("📤 Отправляю файл…")
 	doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(filePath))
-	_, err = bot.Send(doc)
+	_, err = sendChattable(bot, chatID, doc)
 	if err != nil {
 		log.Printf("Error sending CSV: %v", err)
-		sendSimpleMessage(bot, chatID, "Произошла ошибка при отправке CSV файла.")
+		status.set("Произошла ошибка при отправке CSV файла.")
 		return
 	}
+	status.set("✅ CSV готов.")
 
 	err = os.Remove(filePath)
 	if err != nil {
@@ -439,13 +781,24 @@ func handleExportCSVCommand(bot *tgbotapi.BotAPI, chatID int64) {
 
 // --- Message Handler ---
 
-func handleMessage(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+func handleMessage(bot Sender, update tgbotapi.Update) {
 	chatID := update.Message.Chat.ID
 	text := update.Message.Text
-	state := userStates[chatID]
+
+	if stateExpired(chatID) {
+		clearUserState(chatID)
+		sendSimpleMessage(bot, chatID, "Сессия истекла — прошло слишком много времени с последнего шага. Начни заново, например с /add или /debts.")
+		return
+	}
+	state := getUserState(chatID)
 
 	switch state {
 	case StateAddingDebtorName:
+		if names := parseSplitNames(text); names != nil {
+			startSplitAdd(bot, chatID, names)
+			return
+		}
+
 		debtor, err := getDebtorByName(text, chatID)
 		if err != nil && err != sql.ErrNoRows {
 			log.Printf("Error getting debtor: %v", err)
@@ -454,186 +807,227 @@ func handleMessage(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
 			return
 		}
 
-		if err == sql.ErrNoRows {
-			newDebtor := Debtor{Name: text, ChatID: chatID}
-			newDebtor, err = addDebtor(newDebtor)
-			if err != nil {
-				if strings.Contains(err.Error(), "debtor already exists") {
-					sendSimpleMessage(bot, chatID, fmt.Sprintf("Должник с именем *%s* уже существует в вашем списке. Пожалуйста введите другое имя", text))
-					return
-				}
-				log.Printf("Error adding debtor: %v", err)
-				sendSimpleMessage(bot, chatID, "Произошла ошибка при добавлении должника.")
-				clearUserState(chatID)
-				return
-			}
-			currentDebtors[chatID] = newDebtor
-		} else {
-			currentDebtors[chatID] = debtor
+		if err == nil {
+			askDebtReason(bot, chatID, debtor)
+			return
 		}
 
-		userStates[chatID] = StateAddingDebtReason
-		sendSimpleMessage(bot, chatID, fmt.Sprintf("Какова причина долга для *%s*?", currentDebtors[chatID].Name))
+		matches, err := findSimilarDebtors(chatID, text)
+		if err != nil {
+			log.Printf("Error searching debtors: %v", err)
+		}
+		if len(matches) > 0 {
+			offerDebtorMatches(bot, chatID, text, matches)
+			return
+		}
+		createDebtorAndAskReason(bot, chatID, text)
 
 	case StateAddingDebtReason:
-		selectedDebts[chatID] = Debt{DebtorID: currentDebtors[chatID].ID, Reason: text}
-		userStates[chatID] = StateAddingDebtAmount
-		sendSimpleMessage(bot, chatID, fmt.Sprintf("Сколько *%s* должен за *%s*?", currentDebtors[chatID].Name, text))
+		handleDebtReason(bot, chatID, text)
 
 	case StateAddingDebtAmount:
-		amount, err := strconv.ParseFloat(text, 64)
+		amount, err := parseAmount(getChatSettings(chatID), text)
 		if err != nil || amount <= 0 {
-			sendSimpleMessage(bot, chatID, "Пожалуйста, введи корректную сумму долга (положительное число).")
+			sendPrompt(bot, chatID, "Пожалуйста, введи корректную сумму долга: положительное число, например 500, 1 200,50, 1.5k или 300+450.")
 			return
 		}
-
-		debt := Debt{DebtorID: currentDebtors[chatID].ID, Amount: amount, Reason: selectedDebts[chatID].Reason}
-		if err := addDebt(debt); err != nil {
-			log.Printf("Error adding debt: %v", err)
-			sendSimpleMessage(bot, chatID, "Произошла ошибка при добавлении долга.")
-		} else {
-			sendSimpleMessage(bot, chatID, fmt.Sprintf("✅ Долг добавлен! *%s* должен *%.2f ₽* за *%s*.", currentDebtors[chatID].Name, amount, debt.Reason))
+		if checkAmount(bot, chatID, amount) {
+			finishAddDebt(bot, chatID, amount)
 		}
-		clearUserState(chatID)
+
+	case StateAddingSplitReason:
+		handleSplitReason(bot, chatID, text)
+
+	case StateAddingSplitAmount:
+		handleSplitAmount(bot, chatID, text)
+
+	case StateEnteringSplitShares:
+		handleSplitShares(bot, chatID, text)
 
 	case StateEditingAmount:
-		amount, err := strconv.ParseFloat(text, 64)
+		amount, err := parseAmount(getChatSettings(chatID), text)
 		if err != nil || amount <= 0 {
-			sendSimpleMessage(bot, chatID, "Пожалуйста, введи корректную сумму (положительное число).")
+			sendPrompt(bot, chatID, "Пожалуйста, введи корректную сумму (положительное число).")
 			return
 		}
-		if err := updateDebtAmount(selectedDebts[chatID].ID, amount); err != nil {
-			log.Printf("Error updating debt amount: %v", err)
-			sendSimpleMessage(bot, chatID, "Не удалось обновить сумму долга.")
-		} else {
-			sendSimpleMessage(bot, chatID, "Сумма долга успешно обновлена.")
-			showDebtorDetails(bot, chatID, currentDebtors[chatID].ID)
+		if checkAmount(bot, chatID, amount) {
+			finishEditAmount(bot, chatID, amount)
 		}
-		clearUserState(chatID)
 
 	case StateEditingReason:
-		if err := updateDebtReason(selectedDebts[chatID].ID, text); err != nil {
+		reason, tag := splitDebtTag(text)
+		if err := updateDebtReason(selectedDebt(chatID).ID, reason); err != nil {
 			log.Printf("Error updating debt reason: %v", err)
 			sendSimpleMessage(bot, chatID, "Не удалось обновить причину долга.")
 		} else {
+			if tag != "" {
+				if err := updateDebtTag(selectedDebt(chatID).ID, tag); err != nil {
+					log.Printf("Error updating debt tag: %v", err)
+				}
+			}
 			sendSimpleMessage(bot, chatID, "Причина долга успешно обновлена.")
-			showDebtorDetails(bot, chatID, currentDebtors[chatID].ID)
+			showDebtorDetails(bot, chatID, currentDebtor(chatID).ID)
 		}
 		clearUserState(chatID)
 
+	case StateEditingGroupReason:
+		handleGroupReason(bot, chatID, text)
+
 	case StateSubtractingFromDebt:
-		amountToSubtract, err := strconv.ParseFloat(text, 64)
+		amountToSubtract, err := parseAmount(getChatSettings(chatID), text)
 		if err != nil || amountToSubtract <= 0 {
-			sendSimpleMessage(bot, chatID, "Пожалуйста, введи корректную сумму для вычитания (положительное число).")
+			sendPrompt(bot, chatID, "Пожалуйста, введи корректную сумму для вычитания (положительное число).")
 			return
 		}
 
-		debt := selectedDebts[chatID]
+		debt := selectedDebt(chatID)
 		if amountToSubtract > debt.Amount {
-			sendSimpleMessage(bot, chatID, "Сумма для вычитания не может быть больше суммы долга.")
+			sendPrompt(bot, chatID, "Сумма для вычитания не может быть больше суммы долга.")
 			return
 		}
 
-		newAmount := debt.Amount - amountToSubtract
-		if err := updateDebtAmount(debt.ID, newAmount); err != nil {
-			log.Printf("Error subtracting from debt: %v", err)
-			sendSimpleMessage(bot, chatID, "Не удалось вычесть сумму из долга.")
-		} else {
-			if newAmount == 0 {
-				closeDebt(debt.ID)
-				sendSimpleMessage(bot, chatID, fmt.Sprintf("✅ Долг в размере *%.2f ₽* за *%s* полностью погашен и закрыт.", debt.Amount, debt.Reason))
-
-			} else {
-				sendSimpleMessage(bot, chatID, fmt.Sprintf("Сумма *%.2f ₽* вычтена из долга.  Остаток долга: *%.2f ₽*", amountToSubtract, newAmount))
-
-			}
-			showDebtorDetails(bot, chatID, debt.DebtorID)
-		}
-		clearUserState(chatID)
+		askPaymentMethod(bot, chatID, amountToSubtract)
 
 	case StateSettingPaymentDate:
-		var t time.Time
-		var err error
-		formats := []string{"02.01.2006", "02.01.06", "2.1.2006", "2.1.06", "02-01-2006", "02-01-06", "2-1-2006", "2-1-06"}
-		for _, format := range formats {
-			t, err = time.Parse(format, text)
-			if err == nil {
-				break
-			}
-		}
-
-		if err != nil {
-			sendSimpleMessage(bot, chatID, "Неверный формат даты. Пожалуйста, введите дату в формате ДД.ММ.ГГГГ или ДД.ММ.ГГ, например, 31.12.2024 или 31.12.24")
+		settings := getChatSettings(chatID)
+		t, ok := parseDateInput(settings, text)
+		if !ok {
+			sendPrompt(bot, chatID, "Неверный формат даты. Пожалуйста, введите дату в формате "+dateInputHint(settings))
 			return
 		}
-		currentDebtor := currentDebtors[chatID]
-		err = updateDebtorPaymentDate(currentDebtor.ID, t)
-
-		if err != nil {
+		currentDebtor := currentDebtor(chatID)
+		if err := updateDebtorPaymentDate(currentDebtor.ID, t); err != nil {
 			log.Printf("Error updating payment date: %v", err)
 			sendSimpleMessage(bot, chatID, "Не удалось обновить дату платежа.")
 		} else {
-			sendSimpleMessage(bot, chatID, fmt.Sprintf("Дата платежа для %s установлена на %s", currentDebtor.Name, t.Format("02.01.2006")))
+			sendSimpleMessage(bot, chatID, fmt.Sprintf("Дата платежа для %s установлена на %s", escapeMarkdown(currentDebtor.Name), formatChatDate(chatID, t)))
 			showDebtorDetails(bot, chatID, currentDebtor.ID)
 		}
 		clearUserState(chatID)
 
 	case StateSettingPaymentAmount:
-		amount, err := strconv.ParseFloat(text, 64)
+		amount, err := parseAmount(getChatSettings(chatID), text)
 		if err != nil || amount <= 0 {
-			sendSimpleMessage(bot, chatID, "Пожалуйста, введите корректную сумму платежа (положительное число).")
+			sendPrompt(bot, chatID, "Пожалуйста, введите корректную сумму платежа (положительное число).")
 			return
 		}
-		currentDebtor := currentDebtors[chatID]
+		currentDebtor := currentDebtor(chatID)
 
 		if err := updateDebtorPaymentAmount(currentDebtor.ID, amount); err != nil {
 			log.Printf("Error setting payment amount: %v", err)
 			sendSimpleMessage(bot, chatID, "Не удалось установить сумму платежа.")
 		} else {
-			sendSimpleMessage(bot, chatID, fmt.Sprintf("Сумма платежа для *%s* установлена на *%.2f ₽*", currentDebtor.Name, amount))
+			sendSimpleMessage(bot, chatID, fmt.Sprintf("Сумма платежа для *%s* установлена на *%s*", escapeBold(currentDebtor.Name), formatChatAmount(chatID, amount)))
 		}
 		clearUserState(chatID)
 		showDebtorDetails(bot, chatID, currentDebtor.ID)
 
 	case StateEditingPaymentDate:
-		var t time.Time
-		var err error
-		formats := []string{"02.01.2006", "02.01.06", "2.1.2006", "2.1.06", "02-01-2006", "02-01-06", "2-1-2006", "2-1-06"}
-		for _, format := range formats {
-			t, err = time.Parse(format, text)
-			if err == nil {
-				break
-			}
-		}
-
-		if err != nil {
-			sendSimpleMessage(bot, chatID, "Неверный формат даты. Пожалуйста, введите дату в формате ДД.ММ.ГГГГ или ДД.ММ.ГГ")
+		settings := getChatSettings(chatID)
+		t, ok := parseDateInput(settings, text)
+		if !ok {
+			sendPrompt(bot, chatID, "Неверный формат даты. Пожалуйста, введите дату в формате "+dateInputHint(settings))
 			return
 		}
 
-		if err := updateDebtorPaymentDate(currentDebtors[chatID].ID, t); err != nil {
+		if err := updateDebtorPaymentDate(currentDebtor(chatID).ID, t); err != nil {
 			log.Printf("Error updating payment date: %v", err)
 			sendSimpleMessage(bot, chatID, "Не удалось обновить дату платежа.")
 		} else {
-			sendSimpleMessage(bot, chatID, fmt.Sprintf("Дата платежа обновлена на %s", t.Format("02.01.2006")))
-			showDebtorDetails(bot, chatID, currentDebtors[chatID].ID)
+			sendSimpleMessage(bot, chatID, fmt.Sprintf("Дата платежа обновлена на %s", formatChatDate(chatID, t)))
+			showDebtorDetails(bot, chatID, currentDebtor(chatID).ID)
 		}
 		clearUserState(chatID)
 
+	case StateSettingCurrencySymbol:
+		handleCurrencySymbolInput(bot, chatID, text)
+
+	case StateSettingTimezone:
+		handleTimezoneInput(bot, chatID, text)
+
+	case StateSettingPaymentTemplate, StateSettingPaymentAccount:
+		handlePaymentQRSettingInput(bot, chatID, state, text)
+
+	case StateSettingMaxDebt:
+		handleMaxDebtInput(bot, chatID, text)
+
+	case StateConfirmingDataErasure:
+		handleDataErasureInput(bot, chatID, text)
+
+	case StateAddingLoanDebtor, StateAddingLoanPrincipal, StateAddingLoanRate, StateAddingLoanTerm:
+		handleLoanInput(bot, chatID, state, text)
+
+	case StateEnteringLoanPayment:
+		handleLoanPaymentAmount(bot, chatID, text)
+
+	case StateEnteringInstallmentCount, StateEnteringInstallmentStart:
+		handleInstallmentInput(bot, chatID, state, text)
+
+	case StateSettingBirthday:
+		handleBirthdayInput(bot, chatID, text)
+
+	case StateEditingDebtTag:
+		handleDebtTagInput(bot, chatID, text)
+
+	case StateEnteringDebtorPayment:
+		handleDebtorPaymentInput(bot, chatID, text)
+
+	case StateRenamingDebtor:
+		name := strings.TrimSpace(text)
+		if name == "" || strings.ContainsAny(name, ",;") {
+			sendPrompt(bot, chatID, "Введи новое имя без запятых и точек с запятой.")
+			return
+		}
+		debtor := currentDebtor(chatID)
+		if name == debtor.Name {
+			clearUserState(chatID)
+			sendSimpleMessage(bot, chatID, "Имя не изменилось.")
+			showDebtorDetails(bot, chatID, debtor.ID)
+			return
+		}
+		if err := renameDebtor(debtor.ID, name); err != nil {
+			if strings.Contains(err.Error(), "debtor already exists") {
+				sendPrompt(bot, chatID, fmt.Sprintf("Должник с именем *%s* уже существует в вашем списке. Пожалуйста введите другое имя", escapeBold(name)))
+				return
+			}
+			log.Printf("Error renaming debtor: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось переименовать должника.")
+			clearUserState(chatID)
+			return
+		}
+		clearUserState(chatID)
+		sendSimpleMessage(bot, chatID, fmt.Sprintf("*%s* теперь *%s*.", escapeBold(debtor.Name), escapeBold(name)))
+		showDebtorDetails(bot, chatID, debtor.ID)
+
+	case StateEditingDebtorNotes:
+		if len([]rune(text)) > maxDebtorNotesLength {
+			sendPrompt(bot, chatID, fmt.Sprintf("Заметка слишком длинная, максимум %d символов.", maxDebtorNotesLength))
+			return
+		}
+		debtor := currentDebtor(chatID)
+		clearUserState(chatID)
+		if err := updateDebtorNotes(debtor.ID, text); err != nil {
+			log.Printf("Error updating notes: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось сохранить заметку.")
+			return
+		}
+		sendSimpleMessage(bot, chatID, "Заметка сохранена.")
+		showDebtorDetails(bot, chatID, debtor.ID)
+
 	case StateEditingPaymentAmount:
-		amount, err := strconv.ParseFloat(text, 64)
+		amount, err := parseAmount(getChatSettings(chatID), text)
 		if err != nil || amount <= 0 {
-			sendSimpleMessage(bot, chatID, "Пожалуйста, введите корректную сумму платежа (положительное число).")
+			sendPrompt(bot, chatID, "Пожалуйста, введите корректную сумму платежа (положительное число).")
 			return
 		}
-		if err := updateDebtorPaymentAmount(currentDebtors[chatID].ID, amount); err != nil {
+		if err := updateDebtorPaymentAmount(currentDebtor(chatID).ID, amount); err != nil {
 			log.Printf("Error updating payment amount: %v", err)
 			sendSimpleMessage(bot, chatID, "Не удалось обновить сумму платежа.")
 		} else {
 			sendSimpleMessage(bot, chatID, "Сумма платежа успешно обновлена.")
 		}
 		clearUserState(chatID)
-		showDebtorDetails(bot, chatID, currentDebtors[chatID].ID)
+		showDebtorDetails(bot, chatID, currentDebtor(chatID).ID)
 
 	default:
 		sendSimpleMessage(bot, chatID, "Чтобы добавить долг, используй команду /add.  Чтобы посмотреть долги, используй /debts.")
@@ -641,198 +1035,525 @@ func handleMessage(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
 	}
 }
 
+func finishAddDebt(bot Sender, chatID int64, amount Money) {
+	debt := Debt{DebtorID: currentDebtor(chatID).ID, Amount: amount, Reason: selectedDebt(chatID).Reason, Tag: selectedDebt(chatID).Tag}
+	if err := addDebt(debt); err != nil {
+		log.Printf("Error adding debt: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при добавлении долга.")
+	} else {
+		recordReasonUse(chatID, debt.Reason+formatDebtTag(debt.Tag))
+		addBatchDebt(chatID, debt)
+		sendWithKeyboard(bot, chatID, fmt.Sprintf("✅ Долг добавлен! *%s* должен *%s* за *%s*%s.", escapeBold(currentDebtor(chatID).Name), formatChatAmount(chatID, amount), escapeBold(debt.Reason), formatDebtTag(debt.Tag)), batchKeyboard(debt.DebtorID))
+		notifyCoOwners(bot, chatID, fmt.Sprintf("Новый долг: *%s* должен *%s* за *%s*.", escapeBold(currentDebtor(chatID).Name), formatChatAmount(chatID, amount), escapeBold(debt.Reason)))
+		return
+	}
+	clearUserState(chatID)
+}
+
+func finishEditAmount(bot Sender, chatID int64, amount Money) {
+	if err := updateDebtAmount(selectedDebt(chatID).ID, amount); err != nil {
+		log.Printf("Error updating debt amount: %v", err)
+		sendSimpleMessage(bot, chatID, "Не удалось обновить сумму долга.")
+	} else {
+		sendSimpleMessage(bot, chatID, "Сумма долга успешно обновлена.")
+		showDebtorDetails(bot, chatID, currentDebtor(chatID).ID)
+	}
+	clearUserState(chatID)
+}
+
+func askDebtReason(bot Sender, chatID int64, debtor Debtor) {
+	setCurrentDebtor(chatID, debtor)
+	setUserState(chatID, StateAddingDebtReason)
+	sendReasonPrompt(bot, chatID, fmt.Sprintf("Какова причина долга для *%s*?", escapeBold(debtor.Name)))
+}
+
+func handleDebtReason(bot Sender, chatID int64, text string) {
+	reason, tag := splitDebtTag(text)
+	setSelectedDebt(chatID, Debt{DebtorID: currentDebtor(chatID).ID, Reason: reason, Tag: tag})
+	setUserState(chatID, StateAddingDebtAmount)
+	sendPrompt(bot, chatID, fmt.Sprintf("Сколько *%s* должен за *%s*?", escapeBold(currentDebtor(chatID).Name), escapeBold(reason)))
+}
+
+func createDebtorAndAskReason(bot Sender, chatID int64, name string) {
+	newDebtor, err := addDebtor(Debtor{Name: name, ChatID: chatID})
+	if err != nil {
+		if strings.Contains(err.Error(), "debtor already exists") {
+			setUserState(chatID, StateAddingDebtorName)
+			sendPrompt(bot, chatID, fmt.Sprintf("Должник с именем *%s* уже существует в вашем списке. Пожалуйста введите другое имя", escapeBold(name)))
+			return
+		}
+		log.Printf("Error adding debtor: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при добавлении должника.")
+		clearUserState(chatID)
+		return
+	}
+	askDebtReason(bot, chatID, newDebtor)
+}
+
+// offerDebtorMatches lets the user pick between similarly named debtors instead of guessing.
+func offerDebtorMatches(bot Sender, chatID int64, name string, matches []Debtor) {
+	if len(matches) > maxDebtorMatches {
+		matches = matches[:maxDebtorMatches]
+	}
+	setPendingName(chatID, name)
+	setUserState(chatID, StateChoosingDebtorMatch)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, debtor := range matches {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(debtor.Name, fmt.Sprintf("pick_debtor:%d", debtor.ID))))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(callbackButton(fmt.Sprintf("➕ Создать нового «%s»", name), "pick_new_debtor")),
+		tgbotapi.NewInlineKeyboardRow(callbackButton("❌ Отмена", "cancel_operation")),
+	)
+	text := fmt.Sprintf("Нашлись похожие должники для *%s*. Кого ты имеешь в виду?", escapeBold(name))
+	if len(matches) == 1 {
+		text = fmt.Sprintf("В списке уже есть *%s*. Это тот же человек?", escapeBold(matches[0].Name))
+		rows[0] = tgbotapi.NewInlineKeyboardRow(callbackButton(fmt.Sprintf("✅ Да, это %s", matches[0].Name), fmt.Sprintf("pick_debtor:%d", matches[0].ID)))
+		rows[1] = tgbotapi.NewInlineKeyboardRow(callbackButton(fmt.Sprintf("➕ Нет, создать «%s»", name), "pick_new_debtor"))
+	}
+	sendWithKeyboard(bot, chatID, text, tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
 // --- Callback Query Handler ---
 
-func handleCallbackQuery(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+func handleCallbackQuery(bot Sender, update tgbotapi.Update) {
 	chatID := update.CallbackQuery.Message.Chat.ID
 	messageID := update.CallbackQuery.Message.MessageID
-	data := update.CallbackQuery.Data
+	data, ok := decodeCallbackData(update.CallbackQuery.Data)
+	if !ok {
+		sendOutdatedButton(bot, chatID, update.CallbackQuery.Data)
+		return
+	}
 
 	switch {
 	case strings.HasPrefix(data, "select_debtor:"):
-		debtorIDStr := strings.TrimPrefix(data, "select_debtor:")
-		debtorID, err := strconv.Atoi(debtorIDStr)
-		if err != nil {
-			log.Printf("Invalid debtor ID in callback: %v", err)
-			return
-		}
-
-		debtor, err := getDebtorByID(debtorID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				sendSimpleMessage(bot, chatID, "Должник не найден.")
-			} else {
-				log.Printf("Error getting debtor for details: %v", err)
-				sendSimpleMessage(bot, chatID, "Произошла ошибка при получении информации о должнике.")
-			}
+		debtor, ok := callbackDebtor(chatID, strings.TrimPrefix(data, "select_debtor:"))
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Должник не найден.")
 			clearUserState(chatID)
 			return
 		}
-		currentDebtors[chatID] = debtor
+		setCurrentDebtor(chatID, debtor)
 		clearUserState(chatID)
-		showDebtorDetails(bot, chatID, debtorID)
+		openDebtorDetails(bot, chatID, debtor.ID)
 
 	case strings.HasPrefix(data, "close_debt:"):
-		debtIDStr := strings.TrimPrefix(data, "close_debt:")
-		debtID, err := strconv.Atoi(debtIDStr)
-		if err != nil {
-			log.Printf("Invalid debt ID in callback: %v", err)
-			return
-		}
-		debt, err := getDebtByID(debtID)
-		if err != nil {
-			log.Printf("Error getting debt for closing: %v", err)
+		debt, ok := callbackDebt(chatID, strings.TrimPrefix(data, "close_debt:"))
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
 			return
 		}
-		selectedDebts[chatID] = debt
-		userStates[chatID] = StateConfirmingCloseDebt
+		setSelectedDebt(chatID, debt)
+		setUserState(chatID, StateConfirmingCloseDebt)
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("✅ Да, закрыть", fmt.Sprintf("confirm_close:%d", debtID)),
-				tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "cancel_operation"),
+				callbackButton("✅ Да, закрыть", fmt.Sprintf("confirm_close:%d", debt.ID)),
+				callbackButton("❌ Отмена", "cancel_operation"),
 			),
 		)
-		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Вы уверены, что хотите закрыть долг *%.2f ₽* за *%s*?", debt.Amount, debt.Reason), keyboard)
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Вы уверены, что хотите закрыть долг *%s* за *%s*?", formatChatAmount(chatID, debt.Amount), escapeBold(debt.Reason)), keyboard)
 
 	case strings.HasPrefix(data, "confirm_close:"):
-		debtIDStr := strings.TrimPrefix(data, "confirm_close:")
-		debtID, _ := strconv.Atoi(debtIDStr)
-		if err := closeDebt(debtID); err != nil {
+		debt, ok := callbackDebt(chatID, strings.TrimPrefix(data, "confirm_close:"))
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
+			clearUserState(chatID)
+			return
+		}
+		if err := closeDebt(debt.ID); err != nil {
 			log.Printf("Error closing debt in callback: %v", err)
 			sendSimpleMessage(bot, chatID, "Произошла ошибка при закрытии долга.")
 		} else {
-			editMessageWithKeyboard(bot, chatID, messageID, "Долг закрыт.", tgbotapi.InlineKeyboardMarkup{})
+			sendWithKeyboard(bot, chatID, fmt.Sprintf("✅ Долг *%s* за *%s* закрыт.", formatChatAmount(chatID, debt.Amount), escapeBold(debt.Reason)), receiptKeyboard(debt.DebtorID, debt.Amount, time.Now()))
+			notifyCoOwners(bot, chatID, fmt.Sprintf("Закрыт долг *%s* за *%s*.", escapeBold(currentDebtor(chatID).Name), escapeBold(debt.Reason)))
 		}
-		showDebtorDetails(bot, chatID, currentDebtors[chatID].ID)
+		showDebtorDetails(bot, chatID, currentDebtor(chatID).ID)
 		clearUserState(chatID)
 
+	case strings.HasPrefix(data, "pick_debtor:"):
+		if getUserState(chatID) != StateChoosingDebtorMatch {
+			editMessageWithKeyboard(bot, chatID, messageID, "Этот выбор уже неактуален.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		debtorID, err := strconv.Atoi(strings.TrimPrefix(data, "pick_debtor:"))
+		if err != nil {
+			log.Printf("Invalid debtor ID in callback: %v", err)
+			return
+		}
+		debtor, err := getDebtorByID(debtorID)
+		if err != nil || debtor.ChatID != ledgerChatID(chatID) {
+			log.Printf("Error getting picked debtor %d: %v", debtorID, err)
+			sendSimpleMessage(bot, chatID, "Должник не найден.")
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Выбран должник *%s*.", escapeBold(debtor.Name)), tgbotapi.InlineKeyboardMarkup{})
+		if amount, reason, ok := pendingQuickAdd(chatID); ok {
+			quickAddTo(bot, chatID, debtor, amount, reason)
+			return
+		}
+		askDebtReason(bot, chatID, debtor)
+
+	case data == "pick_new_debtor":
+		name := pendingName(chatID)
+		if getUserState(chatID) != StateChoosingDebtorMatch || name == "" {
+			editMessageWithKeyboard(bot, chatID, messageID, "Этот выбор уже неактуален.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Создаю нового должника *%s*.", escapeBold(name)), tgbotapi.InlineKeyboardMarkup{})
+		if amount, reason, ok := pendingQuickAdd(chatID); ok {
+			quickAddToNew(bot, chatID, name, amount, reason)
+			return
+		}
+		createDebtorAndAskReason(bot, chatID, name)
+
+	case data == "split_equal", data == "split_custom":
+		handleSplitCallback(bot, chatID, messageID, data)
+
+	case data == "amount_confirm", data == "amount_retry":
+		handleAmountConfirmCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "group_"):
+		handleDebtGroupCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "loan_"):
+		handleLoanCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "installments"):
+		handleInstallmentsCallback(bot, chatID, messageID, data)
+
+	case data == "voice_confirm":
+		handleVoiceConfirm(bot, chatID, messageID)
+
+	case data == "broadcast_confirm":
+		handleBroadcastConfirm(bot, chatID, messageID)
+
 	case data == "cancel_operation":
 		editMessageWithKeyboard(bot, chatID, messageID, "Операция отменена.", tgbotapi.InlineKeyboardMarkup{})
+		debtor, ok := lookupCurrentDebtor(chatID)
 		clearUserState(chatID)
-		if _, ok := currentDebtors[chatID]; ok {
-			showDebtorDetails(bot, chatID, currentDebtors[chatID].ID)
+		if ok && debtor.ID != 0 {
+			showDebtorDetails(bot, chatID, debtor.ID)
 		}
 
 	case strings.HasPrefix(data, "edit_debt:"):
-		debtIDStr := strings.TrimPrefix(data, "edit_debt:")
-		debtID, err := strconv.Atoi(debtIDStr)
-		if err != nil {
-			log.Printf("Invalid debt ID in callback: %v", err)
-			return
-		}
-		debt, err := getDebtByID(debtID)
-		if err != nil {
-			log.Printf("Error getting debt for editing: %v", err)
+		debt, ok := callbackDebt(chatID, strings.TrimPrefix(data, "edit_debt:"))
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
 			return
 		}
-		selectedDebts[chatID] = debt
-		userStates[chatID] = StateEditingChooseWhatToEdit
-
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("Изменить сумму", fmt.Sprintf("edit_amount:%d", debtID)),
-				tgbotapi.NewInlineKeyboardButtonData("Изменить причину", fmt.Sprintf("edit_reason:%d", debtID)),
-				tgbotapi.NewInlineKeyboardButtonData("Вычесть из долга", fmt.Sprintf("subtract_from_debt:%d", debtID)),
-			),
-		)
-		editMessageWithKeyboard(bot, chatID, messageID, "Что ты хочешь изменить?", keyboard)
+		showDebtMenu(bot, chatID, messageID, debt)
 
 	case strings.HasPrefix(data, "edit_amount:"):
-		debtIDStr := strings.TrimPrefix(data, "edit_amount:")
-		debtID, _ := strconv.Atoi(debtIDStr)
-		selectedDebts[chatID] = Debt{ID: debtID}
-		userStates[chatID] = StateEditingAmount
-		editMessageWithKeyboard(bot, chatID, messageID, "Введи новую сумму:", tgbotapi.InlineKeyboardMarkup{})
+		debt, ok := callbackDebt(chatID, strings.TrimPrefix(data, "edit_amount:"))
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
+			return
+		}
+		setSelectedDebt(chatID, Debt{ID: debt.ID})
+		setUserState(chatID, StateEditingAmount)
+		editPrompt(bot, chatID, messageID, "Введи новую сумму:")
 
 	case strings.HasPrefix(data, "edit_reason:"):
-		debtIDStr := strings.TrimPrefix(data, "edit_reason:")
-		debtID, _ := strconv.Atoi(debtIDStr)
-		selectedDebts[chatID] = Debt{ID: debtID}
-		userStates[chatID] = StateEditingReason
-		editMessageWithKeyboard(bot, chatID, messageID, "Введи новую причину:", tgbotapi.InlineKeyboardMarkup{})
-
-	case strings.HasPrefix(data, "subtract_from_debt:"):
-		debtIDStr := strings.TrimPrefix(data, "subtract_from_debt:")
-		debtID, err := strconv.Atoi(debtIDStr)
-		if err != nil {
-			log.Printf("Invalid debt ID in callback: %v", err)
+		debt, ok := callbackDebt(chatID, strings.TrimPrefix(data, "edit_reason:"))
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
 			return
 		}
-		debt, err := getDebtByID(debtID)
-		if err != nil {
-			log.Printf("Error getting debt for subtraction: %v", err)
+		setSelectedDebt(chatID, Debt{ID: debt.ID})
+		setUserState(chatID, StateEditingReason)
+		editPrompt(bot, chatID, messageID, "Введи новую причину:")
+
+	case strings.HasPrefix(data, "subtract_from_debt:"):
+		debt, ok := callbackDebt(chatID, strings.TrimPrefix(data, "subtract_from_debt:"))
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
 			return
 		}
-		selectedDebts[chatID] = debt
-		userStates[chatID] = StateSubtractingFromDebt
-		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Какую сумму вычесть из долга *%.2f ₽*?", debt.Amount), tgbotapi.InlineKeyboardMarkup{})
+		setSelectedDebt(chatID, debt)
+		setUserState(chatID, StateSubtractingFromDebt)
+		editPrompt(bot, chatID, messageID, fmt.Sprintf("Какую сумму вычесть из долга *%s*?", formatChatAmount(chatID, debt.Amount)))
 
 	case data == "add_debt_to_existing":
-		userStates[chatID] = StateAddingDebtReason
-		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Какова причина долга для *%s*?", currentDebtors[chatID].Name), tgbotapi.InlineKeyboardMarkup{})
+		setUserState(chatID, StateAddingDebtReason)
+		editReasonPrompt(bot, chatID, messageID, fmt.Sprintf("Какова причина долга для *%s*?", escapeBold(currentDebtor(chatID).Name)))
 
-	case data == "delete_debtor":
-		userStates[chatID] = StateConfirmingDeleteDebtor
+	case strings.HasPrefix(data, "delete_debtor:"):
+		debtor, ok := callbackDebtor(chatID, strings.TrimPrefix(data, "delete_debtor:"))
+		if !ok {
+			editMessageWithKeyboard(bot, chatID, messageID, "Должник не найден.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		setCurrentDebtor(chatID, debtor)
+		setUserState(chatID, StateConfirmingDeleteDebtor)
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("✅ Да, удалить", "confirm_delete_debtor"),
-			tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", "cancel_operation"),
+			callbackButton("✅ Да, удалить", fmt.Sprintf("confirm_delete_debtor:%d", debtor.ID)),
+			callbackButton("❌ Отмена", "cancel_operation"),
 		),
 		)
 
-		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Вы уверены, что хотите удалить должника *%s*?  *Все долги этого должника будут удалены!*", currentDebtors[chatID].Name), keyboard)
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Удалить должника *%s* со всеми долгами? Его можно будет восстановить из /trash в течение 30 дней.", escapeBold(debtor.Name)), keyboard)
 
-	case data == "confirm_delete_debtor":
-		debtorID := currentDebtors[chatID].ID
-		if err := deleteDebtor(debtorID); err != nil {
+	case strings.HasPrefix(data, "confirm_delete_debtor:"):
+		debtor, ok := callbackDebtor(chatID, strings.TrimPrefix(data, "confirm_delete_debtor:"))
+		if !ok {
+			editMessageWithKeyboard(bot, chatID, messageID, "Должник не найден: возможно, его уже удалили.", tgbotapi.InlineKeyboardMarkup{})
+			clearUserState(chatID)
+			return
+		}
+		if err := trashDebtor(debtor); err == sql.ErrNoRows {
+			editMessageWithKeyboard(bot, chatID, messageID, "Должник не найден: возможно, его уже удалили.", tgbotapi.InlineKeyboardMarkup{})
+		} else if err != nil {
 			log.Printf("Error deleting debtor: %v", err)
 			sendSimpleMessage(bot, chatID, "Произошла ошибка при удалении должника.")
 
 		} else {
-			editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Должник *%s* и все его долги удалены.", currentDebtors[chatID].Name), tgbotapi.InlineKeyboardMarkup{})
+			editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Должник *%s* и все его долги перемещены в корзину. Восстановить их можно в течение 30 дней: /trash", escapeBold(debtor.Name)), tgbotapi.InlineKeyboardMarkup{})
+			releaseDetailsMessage(chatID, messageID)
+			notifyCoOwners(bot, chatID, fmt.Sprintf("Должник *%s* удалён в корзину.", escapeBold(debtor.Name)))
 		}
 		clearUserState(chatID)
 
 	case data == "set_payment_date":
-		userStates[chatID] = StateSettingPaymentDate
-		editMessageWithKeyboard(bot, chatID, messageID, "Введите дату платежа (ДД.ММ.ГГГГ или ДД.ММ.ГГ):", tgbotapi.InlineKeyboardMarkup{})
+		setUserState(chatID, StateSettingPaymentDate)
+		editPrompt(bot, chatID, messageID, fmt.Sprintf("Введите дату платежа (%s):", dateInputHint(getChatSettings(chatID))))
+
+	case data == "set_birthday":
+		setUserState(chatID, StateSettingBirthday)
+		editPrompt(bot, chatID, messageID, fmt.Sprintf("Когда день рождения у *%s*? Введи %s:", escapeBold(currentDebtor(chatID).Name), birthdayInputHint(getChatSettings(chatID))))
+
+	case data == "clear_birthday":
+		debtor := currentDebtor(chatID)
+		if err := clearDebtorBirthday(debtor.ID); err != nil {
+			log.Printf("Error clearing birthday: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось удалить день рождения.")
+		} else {
+			editMessageWithKeyboard(bot, chatID, messageID, "День рождения удалён.", tgbotapi.InlineKeyboardMarkup{})
+			showDebtorDetails(bot, chatID, debtor.ID)
+		}
+
+	case data == "rename_debtor":
+		setUserState(chatID, StateRenamingDebtor)
+		editPrompt(bot, chatID, messageID, fmt.Sprintf("Введи новое имя для *%s*:", escapeBold(currentDebtor(chatID).Name)))
+
+	case data == "reminder_mode":
+		debtor := currentDebtor(chatID)
+		current, err := getDebtorReminderMode(debtor.ID)
+		if err != nil {
+			log.Printf("Error getting reminder mode: %v", err)
+		}
+		screen := navScreen{Kind: navReminders, ID: debtor.ID}
+		enterNavScreen(chatID, screen)
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, mode := range reminderModeOrder {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(markSelected(reminderModeNames[mode], mode == current), "set_reminder_mode:"+mode)))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(backButton(screen)))
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Как напоминать о платеже *%s*?", escapeBold(debtor.Name)), tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case strings.HasPrefix(data, "set_reminder_mode:"):
+		mode := strings.TrimPrefix(data, "set_reminder_mode:")
+		if _, ok := reminderModeNames[mode]; !ok {
+			log.Printf("Invalid reminder mode in callback: %s", data)
+			return
+		}
+		debtor := currentDebtor(chatID)
+		if err := updateDebtorReminderMode(debtor.ID, mode); err != nil {
+			log.Printf("Error updating reminder mode: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось обновить напоминания.")
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Напоминания: *%s*.", reminderModeNames[mode]), tgbotapi.InlineKeyboardMarkup{})
+		showDebtorDetails(bot, chatID, debtor.ID)
+
+	case data == "edit_notes":
+		setUserState(chatID, StateEditingDebtorNotes)
+		editPrompt(bot, chatID, messageID, fmt.Sprintf("Введи заметку для *%s* (телефон, условия договорённости и т.п.):", escapeBold(currentDebtor(chatID).Name)))
+
+	case data == "clear_notes":
+		debtor := currentDebtor(chatID)
+		if err := updateDebtorNotes(debtor.ID, ""); err != nil {
+			log.Printf("Error clearing notes: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось удалить заметку.")
+		} else {
+			editMessageWithKeyboard(bot, chatID, messageID, "Заметка удалена.", tgbotapi.InlineKeyboardMarkup{})
+			showDebtorDetails(bot, chatID, debtor.ID)
+		}
+
+	case strings.HasPrefix(data, "batch_more:"), data == "batch_done":
+		handleBatchCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "recent_reason:"):
+		handleRecentReasonCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "edit_tag:"), strings.HasPrefix(data, "set_tag:"):
+		handleDebtTagCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "debts_tag:"):
+		showNavScreen(bot, chatID, messageID, navScreen{Kind: navDebtorList, Tag: strings.TrimPrefix(data, "debts_tag:")})
+
+	case strings.HasPrefix(data, "nav_back:"):
+		handleNavBackCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "debtor_payment:"):
+		handleDebtorPaymentCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "alloc:"), strings.HasPrefix(data, "alloc_pay:"):
+		handleAllocationCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "statement:"):
+		handleStatementCallback(bot, chatID, data)
+
+	case strings.HasPrefix(data, "invoice:"):
+		handleInvoiceCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "payqr:"):
+		handlePaymentQRCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "ledger_"):
+		handleLedgerCallback(bot, chatID, messageID, data, chatDisplayName(update.CallbackQuery.Message.Chat))
+
+	case strings.HasPrefix(data, "trash_restore:"):
+		handleTrashCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "close_all"):
+		handleCloseAllCallback(bot, chatID, messageID, data)
+
+	case data == "restore_confirm":
+		handleRestoreConfirm(bot, chatID, messageID)
+
+	case strings.HasPrefix(data, "receipt:"):
+		handleReceiptCallback(bot, chatID, data)
+
+	case strings.HasPrefix(data, "forgive_debt:"):
+		handleForgiveCallback(bot, chatID, messageID, data)
 
 	case data == "set_payment_amount":
-		userStates[chatID] = StateSettingPaymentAmount
-		editMessageWithKeyboard(bot, chatID, messageID, "Введите сумму платежа:", tgbotapi.InlineKeyboardMarkup{})
+		setUserState(chatID, StateSettingPaymentAmount)
+		editPrompt(bot, chatID, messageID, "Введите сумму платежа:")
 
 	case data == "clear_payment_date":
-		if err := clearDebtorPaymentDate(currentDebtors[chatID].ID); err != nil {
+		if err := clearDebtorPaymentDate(currentDebtor(chatID).ID); err != nil {
 			log.Printf("Error clearing payment date: %v", err)
 			sendSimpleMessage(bot, chatID, "Не удалось очистить дату платежа.")
 		} else {
 			editMessageWithKeyboard(bot, chatID, messageID, "Дата платежа очищена.", tgbotapi.InlineKeyboardMarkup{})
-			showDebtorDetails(bot, chatID, currentDebtors[chatID].ID)
+			showDebtorDetails(bot, chatID, currentDebtor(chatID).ID)
 		}
 		clearUserState(chatID)
 
 	case data == "clear_payment_amount":
-		if err := clearDebtorPaymentAmount(currentDebtors[chatID].ID); err != nil {
+		if err := clearDebtorPaymentAmount(currentDebtor(chatID).ID); err != nil {
 			log.Printf("Error clearing payment amount: %v", err)
 			sendSimpleMessage(bot, chatID, "Не удалось очистить сумму платежа.")
 		} else {
 			editMessageWithKeyboard(bot, chatID, messageID, "Сумма платежа очищена.", tgbotapi.InlineKeyboardMarkup{})
-			showDebtorDetails(bot, chatID, currentDebtors[chatID].ID)
+			showDebtorDetails(bot, chatID, currentDebtor(chatID).ID)
 		}
 		clearUserState(chatID)
 
 	case data == "edit_payment_date":
-		userStates[chatID] = StateEditingPaymentDate
-		editMessageWithKeyboard(bot, chatID, messageID, "Введите новую дату платежа (ДД.ММ.ГГГГ или ДД.ММ.ГГ):", tgbotapi.InlineKeyboardMarkup{})
+		setUserState(chatID, StateEditingPaymentDate)
+		editPrompt(bot, chatID, messageID, fmt.Sprintf("Введите новую дату платежа (%s):", dateInputHint(getChatSettings(chatID))))
 
 	case data == "edit_payment_amount":
-		userStates[chatID] = StateEditingPaymentAmount
-		editMessageWithKeyboard(bot, chatID, messageID, "Введите новую сумму платежа:", tgbotapi.InlineKeyboardMarkup{})
+		setUserState(chatID, StateEditingPaymentAmount)
+		editPrompt(bot, chatID, messageID, "Введите новую сумму платежа:")
+
+	case strings.HasPrefix(data, "settings_"), strings.HasPrefix(data, "set_language:"), strings.HasPrefix(data, "set_currency"), strings.HasPrefix(data, "set_decimals:"), strings.HasPrefix(data, "set_numfmt:"), strings.HasPrefix(data, "set_holidays:"),
+		strings.HasPrefix(data, "set_datefmt:"), strings.HasPrefix(data, "set_tz"), strings.HasPrefix(data, "set_remind:"), strings.HasPrefix(data, "set_sort:"), strings.HasPrefix(data, "set_debtsort:"),
+		strings.HasPrefix(data, "set_alloc:"), strings.HasPrefix(data, "set_export"), strings.HasPrefix(data, "set_payqr"):
+		handleSettingsCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "payment_method:"):
+		handlePaymentMethodCallback(bot, chatID, messageID, strings.TrimPrefix(data, "payment_method:"))
+
+	case strings.HasPrefix(data, "debtor_page:"):
+		handleDebtorPageCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "top:"):
+		handleTopCallback(bot, chatID, messageID, strings.TrimPrefix(data, "top:"))
+
+	case strings.HasPrefix(data, "history:"):
+		handleHistoryCallback(bot, chatID, messageID, strings.TrimPrefix(data, "history:"))
+
+	case strings.HasPrefix(data, "cosigner_"):
+		handleCosignerCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "cosign_"):
+		handleCosignerResponse(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "debtor_link_"):
+		handleDebtorLinkCallback(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "link_"):
+		handleDebtorLinkResponse(bot, chatID, messageID, data)
+
+	case strings.HasPrefix(data, "remind:"):
+		handleRemindCallback(bot, chatID, data)
+
+	default:
+		sendOutdatedButton(bot, chatID, update.CallbackQuery.Data)
+	}
+}
+
+// showDebtMenu turns messageID into the menu of what can be done with one debt.
+func showDebtMenu(bot Sender, chatID int64, messageID int, debt Debt) {
+	debtID := debt.ID
+	setSelectedDebt(chatID, debt)
+	setUserState(chatID, StateEditingChooseWhatToEdit)
+	screen := navScreen{Kind: navDebt, ID: debtID}
+	enterNavScreen(chatID, screen)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton("Изменить сумму", fmt.Sprintf("edit_amount:%d", debtID)),
+			callbackButton("Изменить причину", fmt.Sprintf("edit_reason:%d", debtID)),
+			callbackButton("Вычесть из долга", fmt.Sprintf("subtract_from_debt:%d", debtID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton("🏷 Тег", fmt.Sprintf("edit_tag:%d", debtID)),
+			callbackButton("📅 Рассрочка", fmt.Sprintf("installments:%d", debtID)),
+		),
+	)
+	if getChatSettings(chatID).PaymentTemplate != "" {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+			callbackButton("📷 QR для оплаты", fmt.Sprintf("payqr:%d", debtID)),
+		))
+	}
+	if config.PaymentProviderToken != "" {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+			callbackButton("🧾 Выставить счёт", fmt.Sprintf("invoice:%d", debtID)),
+		))
 	}
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(backButton(screen)))
+	editMessageWithKeyboard(bot, chatID, messageID, "Что ты хочешь изменить?", keyboard)
 }
 
 // --- Show Debtor Details ---
 
-func showDebtorDetails(bot *tgbotapi.BotAPI, chatID int64, debtorID int) {
+// debtDetailsPageSize keeps the debtor card and its keyboard a manageable size.
+const debtDetailsPageSize = 10
+
+// showDebtorDetails refreshes the debtor card after a change. The card last
+// shown in the chat is edited in place; a new one is sent only when that card
+// belongs to another debtor or can no longer be edited.
+func showDebtorDetails(bot Sender, chatID int64, debtorID int) {
+	if card, ok := getDetailsMessage(chatID); ok && card.DebtorID == debtorID {
+		showDebtorDetailsPage(bot, chatID, card.MessageID, debtorID, card.Page)
+		return
+	}
+	showDebtorDetailsPage(bot, chatID, 0, debtorID, 0)
+}
+
+// openDebtorDetails always sends a fresh card, for when the user picks a debtor.
+func openDebtorDetails(bot Sender, chatID int64, debtorID int) {
+	showDebtorDetailsPage(bot, chatID, 0, debtorID, 0)
+}
+
+// showDebtorDetailsPage shows the debtor card with one page of the debts. It
+// edits messageID in place when set and sends a new message otherwise.
+func showDebtorDetailsPage(bot Sender, chatID int64, messageID int, debtorID int, page int) {
 	debtor, err := getDebtorByID(debtorID)
 	if err != nil {
 		log.Printf("Error getting debtor details: %v", err)
@@ -844,7 +1565,8 @@ func showDebtorDetails(bot *tgbotapi.BotAPI, chatID int64, debtorID int) {
 
 		return
 	}
-	currentDebtors[chatID] = debtor
+	setCurrentDebtor(chatID, debtor)
+	settings := getChatSettings(chatID)
 
 	debts, err := listDebts(debtorID)
 	if err != nil {
@@ -853,103 +1575,368 @@ func showDebtorDetails(bot *tgbotapi.BotAPI, chatID int64, debtorID int) {
 		return
 	}
 
-	var totalDebt float64
-	var debtsText strings.Builder
-	debtsText.WriteString(fmt.Sprintf("*Долги %s:*\n\n", debtor.Name))
-	var keyboardButtons [][]tgbotapi.InlineKeyboardButton
+	sortDebtsByAge(debts, settings.DebtSort)
 
+	var totalDebt Money
 	for _, debt := range debts {
-		debtsText.WriteString(fmt.Sprintf("- *%.2f ₽* за *%s*\n", debt.Amount, debt.Reason))
 		totalDebt += debt.Amount
+	}
+	pages := (len(debts) + debtDetailsPageSize - 1) / debtDetailsPageSize
+	page = max(0, min(page, pages-1))
+	start, end := page*debtDetailsPageSize, min((page+1)*debtDetailsPageSize, len(debts))
+
+	var debtsText strings.Builder
+	debtsText.WriteString(fmt.Sprintf("*Долги %s:*\n\n", escapeBold(debtor.Name)))
+	var keyboardButtons [][]tgbotapi.InlineKeyboardButton
+
+	now := time.Now()
+	for _, debt := range debts[start:end] {
+		marker := ""
+		if debt.GroupID.Valid {
+			marker = " 🧾"
+		}
+		age := ""
+		if text := debtAgeText(settings, debt, now); text != "" {
+			age = " (" + text + ")"
+		}
+		debtsText.WriteString(fmt.Sprintf("- *%s* за *%s*%s%s%s\n", formatAmount(settings, debt.Amount), escapeBold(debt.Reason), age, formatDebtTag(debt.Tag), marker))
+		if installments, err := listInstallments(debt); err != nil {
+			log.Printf("Error listing installments: %v", err)
+		} else if len(installments) > 0 {
+			debtsText.WriteString(installmentCardText(settings, installments, chatToday(settings)))
+		}
+		row := tgbotapi.NewInlineKeyboardRow(
+			callbackButton("✏️ Редактировать", fmt.Sprintf("edit_debt:%d", debt.ID)),
+			callbackButton("✅ Закрыть", fmt.Sprintf("close_debt:%d", debt.ID)),
+		)
+		if debt.LoanID.Valid {
+			// Loan amounts follow the amortization schedule, so they are paid from the loan view instead of edited.
+			row[0] = callbackButton("🏦 Кредит", fmt.Sprintf("loan_show:%d", debt.LoanID.Int64))
+		}
+		if debt.GroupID.Valid {
+			row = append(row, callbackButton("🧾 Вся группа", fmt.Sprintf("group_show:%d", debt.GroupID.Int64)))
+		}
+		keyboardButtons = append(keyboardButtons, row)
+	}
+	if pages > 1 {
+		debtsText.WriteString(fmt.Sprintf("\nДолги %d–%d из %d\n", start+1, end, len(debts)))
+		var navRow []tgbotapi.InlineKeyboardButton
+		if page > 0 {
+			navRow = append(navRow, callbackButton("◀️ Предыдущие", fmt.Sprintf("debtor_page:%d:%d", debtor.ID, page-1)))
+		}
+		if page < pages-1 {
+			navRow = append(navRow, callbackButton("Следующие ▶️", fmt.Sprintf("debtor_page:%d:%d", debtor.ID, page+1)))
+		}
+		keyboardButtons = append(keyboardButtons, navRow)
+	}
+
+	debtsText.WriteString(fmt.Sprintf("\n*Общая сумма долга: %s*", formatAmount(settings, totalDebt)))
+	if len(debts) > 1 {
 		keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("✏️ Редактировать", fmt.Sprintf("edit_debt:%d", debt.ID)),
-			tgbotapi.NewInlineKeyboardButtonData("✅ Закрыть", fmt.Sprintf("close_debt:%d", debt.ID)),
+			callbackButton("💸 Принять платёж", fmt.Sprintf("debtor_payment:%d", debtor.ID)),
+			callbackButton("✅ Закрыть все долги", fmt.Sprintf("close_all:%d", debtor.ID)),
 		))
 	}
 
-	debtsText.WriteString(fmt.Sprintf("\n*Общая сумма долга: %.2f ₽*", totalDebt))
-
 	if debtor.PaymentDate.Valid {
-		debtsText.WriteString(fmt.Sprintf("\n\n*Дата платежа:* %s", debtor.PaymentDate.Time.Format("02.01.2006")))
+		debtsText.WriteString(fmt.Sprintf("\n\n*Дата платежа:* %s", formatDate(settings, debtor.PaymentDate.Time)))
 		keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Изменить дату", "edit_payment_date"),
-			tgbotapi.NewInlineKeyboardButtonData("Очистить дату", "clear_payment_date"),
+			callbackButton("Изменить дату", "edit_payment_date"),
+			callbackButton("Очистить дату", "clear_payment_date"),
 		))
+		if mode, err := getDebtorReminderMode(debtor.ID); err != nil {
+			log.Printf("Error getting reminder mode: %v", err)
+		} else {
+			debtsText.WriteString(fmt.Sprintf("\n*Напоминания:* %s", reminderModeNames[mode]))
+			keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
+				callbackButton("🔔 Напоминания", "reminder_mode"),
+			))
+		}
 	} else {
 		keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Указать дату платежа", "set_payment_date"),
+			callbackButton("Указать дату платежа", "set_payment_date"),
 		))
 	}
 
 	if debtor.PaymentAmount.Valid {
-		debtsText.WriteString(fmt.Sprintf("\n*Сумма платежа:* %.2f ₽", debtor.PaymentAmount.Float64))
+		debtsText.WriteString(fmt.Sprintf("\n*Сумма платежа:* %s", formatAmount(settings, debtor.PaymentAmount.V)))
 		keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Изменить сумму", "edit_payment_amount"),
-			tgbotapi.NewInlineKeyboardButtonData("Очистить сумму", "clear_payment_amount"),
+			callbackButton("Изменить сумму", "edit_payment_amount"),
+			callbackButton("Очистить сумму", "clear_payment_amount"),
 		))
 	} else {
 		keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Указать сумму платежа", "set_payment_amount"),
+			callbackButton("Указать сумму платежа", "set_payment_amount"),
 		))
 	}
 
+	if birthday, err := getDebtorBirthday(debtor.ID); err != nil {
+		log.Printf("Error getting birthday: %v", err)
+	} else if birthday.Valid {
+		debtsText.WriteString(fmt.Sprintf("\n*День рождения:* %s", formatBirthday(settings, birthday.String)))
+		keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
+			callbackButton("🎂 Изменить день рождения", "set_birthday"),
+			callbackButton("Удалить", "clear_birthday"),
+		))
+	} else {
+		keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
+			callbackButton("🎂 Указать день рождения", "set_birthday"),
+		))
+	}
+
+	if debtor.Notes != "" {
+		debtsText.WriteString(fmt.Sprintf("\n*Заметка:* %s", escapeMarkdown(debtor.Notes)))
+		keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
+			callbackButton("📝 Изменить заметку", "edit_notes"),
+			callbackButton("Удалить", "clear_notes"),
+		))
+	} else {
+		keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
+			callbackButton("📝 Добавить заметку", "edit_notes"),
+		))
+	}
+
+	if cosigner, err := getCosigner(debtor.ID); err == nil {
+		debtsText.WriteString(fmt.Sprintf("\n*Поручитель:* %s", cosignerStatusText(cosigner)))
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error getting cosigner: %v", err)
+	}
+	linkRow := tgbotapi.NewInlineKeyboardRow(
+		callbackButton("👥 Поручитель", "cosigner_menu"),
+		callbackButton(tr(settings, "🔗 Telegram должника"), "debtor_link_menu"),
+	)
+	if link, err := getDebtorLink(debtor.ID); err == nil {
+		debtsText.WriteString(fmt.Sprintf("\n*Telegram:* %s", debtorLinkStatusText(settings, link)))
+		if link.ChatID.Valid {
+			linkRow = append(linkRow, callbackButton("🔔 Напомнить", fmt.Sprintf("remind:%d", debtor.ID)))
+		}
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error getting debtor link: %v", err)
+	}
+	keyboardButtons = append(keyboardButtons, linkRow)
+
+	keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
+		callbackButton("✏️ Переименовать", "rename_debtor"),
+		callbackButton("📤 Поделиться", fmt.Sprintf("statement:%d", debtor.ID)),
+	))
+
 	keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("➕ Добавить долг", "add_debt_to_existing"),
-		tgbotapi.NewInlineKeyboardButtonData("🗑️ Удалить должника", "delete_debtor"),
+		callbackButton("➕ Добавить долг", "add_debt_to_existing"),
+		callbackButton("🗑️ Удалить должника", fmt.Sprintf("delete_debtor:%d", debtor.ID)),
 	))
 
+	screen := navScreen{Kind: navDebtor, ID: debtor.ID, Page: page}
+	enterNavScreen(chatID, screen)
+	keyboardButtons = append(keyboardButtons, tgbotapi.NewInlineKeyboardRow(backButton(screen)))
+
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(keyboardButtons...)
-	sendWithKeyboard(bot, chatID, debtsText.String(), keyboard)
+	if messageID != 0 {
+		err := tryEditMessage(bot, chatID, messageID, debtsText.String(), keyboard)
+		if err == nil {
+			setDetailsMessage(chatID, detailsMessage{MessageID: messageID, DebtorID: debtor.ID, Page: page})
+			return
+		}
+		log.Printf("Error editing debtor details, sending a new message: %v", err)
+	}
+	if sent := sendWithKeyboard(bot, chatID, debtsText.String(), keyboard); sent.MessageID != 0 {
+		setDetailsMessage(chatID, detailsMessage{MessageID: sent.MessageID, DebtorID: debtor.ID, Page: page})
+	}
+}
+
+func handleDebtorPageCallback(bot Sender, chatID int64, messageID int, data string) {
+	idText, pageText, found := strings.Cut(strings.TrimPrefix(data, "debtor_page:"), ":")
+	page, err := strconv.Atoi(pageText)
+	if !found || err != nil {
+		log.Printf("Invalid debtor page callback: %s", data)
+		return
+	}
+	debtor, ok := callbackDebtor(chatID, idText)
+	if !ok {
+		sendSimpleMessage(bot, chatID, "Должник не найден.")
+		return
+	}
+	showDebtorDetailsPage(bot, chatID, messageID, debtor.ID, page)
+}
+
+// --- Update Routing ---
+
+func handleUpdate(bot Sender, update tgbotapi.Update) {
+	if chatID := updateChatID(update); chatID != 0 {
+		if !updateAllowed(update, chatID) {
+			denyAccess(bot, update, chatID)
+			return
+		}
+		touchChatActivity(bot, chatID)
+	}
+	if update.PreCheckoutQuery != nil {
+		handlePreCheckoutQuery(bot, update.PreCheckoutQuery)
+	} else if update.Message != nil && update.Message.SuccessfulPayment != nil {
+		handleSuccessfulPayment(bot, update.Message.Chat.ID, update.Message.SuccessfulPayment)
+	} else if update.Message != nil {
+		if update.Message.IsCommand() {
+			switch update.Message.Command() {
+			case "start":
+				if payload := update.Message.CommandArguments(); strings.HasPrefix(payload, cosignerStartArg) {
+					handleCosignerStart(bot, update.Message.Chat.ID, strings.TrimPrefix(payload, cosignerStartArg))
+				} else if strings.HasPrefix(payload, debtorLinkStartArg) {
+					handleDebtorStart(bot, update.Message.Chat.ID, strings.TrimPrefix(payload, debtorLinkStartArg))
+				} else if strings.HasPrefix(payload, ledgerStartArg) {
+					handleLedgerStart(bot, update.Message.Chat.ID, strings.TrimPrefix(payload, ledgerStartArg))
+				} else {
+					handleStartCommand(bot, update.Message.Chat.ID)
+				}
+			case "add":
+				handleAddCommand(bot, update.Message.Chat.ID, update.Message.CommandArguments())
+			case "debts":
+				handleDebtsCommand(bot, update.Message.Chat.ID, update.Message.CommandArguments())
+			case "total":
+				handleTotalCommand(bot, update.Message.Chat.ID)
+			case "summary":
+				handleSummaryCommand(bot, update.Message.Chat.ID)
+			case "help":
+				handleHelpCommand(bot, update.Message.Chat.ID)
+			case "exportcsv":
+				handleExportCSVCommand(bot, update.Message.Chat.ID, update.Message.CommandArguments())
+			case "exporthtml":
+				handleExportHTMLCommand(bot, update.Message.Chat.ID)
+			case "settings":
+				handleSettingsCommand(bot, update.Message.Chat.ID)
+			case "cancel":
+				handleCancelCommand(bot, update.Message.Chat.ID)
+			case "history":
+				handleHistoryCommand(bot, update.Message.Chat.ID)
+			case "loan":
+				handleLoanCommand(bot, update.Message.Chat.ID)
+			case "stats":
+				handleStatsCommand(bot, update.Message.Chat.ID, update.Message.CommandArguments())
+			case "top":
+				handleTopCommand(bot, update.Message.Chat.ID)
+			case "report":
+				handleReportCommand(bot, update.Message.Chat.ID, update.Message.CommandArguments())
+			case "trash":
+				handleTrashCommand(bot, update.Message.Chat.ID)
+			case "share":
+				handleShareCommand(bot, update.Message.Chat.ID)
+			case "remind":
+				handleRemindCommand(bot, update.Message.Chat.ID, update.Message.CommandArguments())
+			case "deletemydata":
+				handleDeleteMyDataCommand(bot, update.Message.Chat.ID)
+			case "restore":
+				handleRestoreCommand(bot, update.Message.Chat.ID)
+			case "status":
+				handleStatusCommand(bot, update.Message.Chat.ID)
+			case "broadcast":
+				handleBroadcastCommand(bot, update.Message.Chat.ID)
+			default:
+				sendSimpleMessage(bot, update.Message.Chat.ID, "Неизвестная команда. Используй /help для списка команд.")
+				clearUserState(update.Message.Chat.ID)
+			}
+		} else if getUserState(update.Message.Chat.ID) == StateEnteringBroadcast {
+			handleBroadcastMessage(bot, update.Message.Chat.ID, update.Message.MessageID)
+		} else if update.Message.Document != nil && getUserState(update.Message.Chat.ID) == StateRestoringFromFile {
+			handleRestoreDocument(bot, update.Message.Chat.ID, update.Message.Document)
+		} else if update.Message.Voice != nil {
+			handleVoiceMessage(bot, update.Message.Chat.ID, update.Message.Voice, update.Message.Chat.IsPrivate())
+		} else {
+			handleMessage(bot, update)
+		}
+	} else if update.CallbackQuery != nil {
+		handleCallbackQuery(bot, update)
+	}
 }
 
 // --- Main Function ---
 
 func main() {
-	err := godotenv.Load()
+	loadTest := flag.Bool("loadtest", false, "seed a temporary database with synthetic data, benchmark storage operations and exit")
+	loadTestChats := flag.Int("loadtest-chats", 1000, "number of synthetic chats for -loadtest")
+	loadTestDebts := flag.Int("loadtest-debts", 20000, "number of synthetic debts for -loadtest")
+	loadTestSamples := flag.Int("loadtest-samples", 200, "number of chats sampled per measured operation")
+	envFile := flag.String("env-file", defaultEnvFile, "file with environment variables to load; missing is fine unless set explicitly")
+	dbPath := flag.String("db", "", "database file, overrides DB_PATH")
+	flag.Parse()
+
+	if *loadTest {
+		if err := runLoadTest(*loadTestChats, *loadTestDebts, *loadTestSamples); err != nil {
+			log.Fatalf("Load test failed: %v", err)
+		}
+		return
+	}
+
+	envFileSet := false
+	flag.Visit(func(f *flag.Flag) { envFileSet = envFileSet || f.Name == "env-file" })
+	if err := loadEnvFile(*envFile, envFileSet); err != nil {
+		log.Fatal(err)
+	}
+	cfg, err := loadConfig(os.LookupEnv)
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if *dbPath != "" {
+		cfg.DBPath = *dbPath
 	}
+	config = cfg
 
-	bot, err := tgbotapi.NewBotAPI(os.Getenv("TELEGRAM_API_TOKEN"))
+	bot, err := tgbotapi.NewBotAPI(config.TelegramToken)
 	if err != nil {
 		log.Panic(err)
 	}
 
 	bot.Debug = false
+	sender := telegramSender{bot}
+
+	if len(config.AllowedChats) > 0 {
+		log.Printf("Private mode: the bot only answers %d allowed chats", len(config.AllowedChats))
+	}
 
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
-	initDB()
+	// log.Fatal only once run has returned: its deferred shutdown closes the
+	// database cleanly, checkpointing the WAL.
+	if err := run(bot, sender); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves updates until receiving them fails, then stops the background
+// jobs and closes the database.
+func run(bot *tgbotapi.BotAPI, sender telegramSender) error {
+	initDB(config.DBPath)
 	defer DB.Close()
 
+	registerBotCommands(sender)
+	stopScheduler := startScheduler(sender)
+	defer stopScheduler()
+	stopOutbox := startOutbox(sender)
+	defer stopOutbox()
+	startEventWebhooks()
+
+	if config.HealthListen != "" {
+		startHealthServer(config.HealthListen)
+	}
+
+	if config.API.Listen != "" {
+		startAPIServer(config.API)
+	}
+
+	dispatcher := startUpdateWorkers(sender, updateWorkerCount)
+
+	if config.Webhook.URL != "" {
+		return fmt.Errorf("serving webhook: %w", serveWebhook(sender, dispatcher, config.Webhook))
+	}
+
+	// A webhook left over from an earlier run in webhook mode makes every
+	// getUpdates call fail with 409 Conflict.
+	if _, err := sender.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return fmt.Errorf("deleting webhook before polling: %w", err)
+	}
+
 	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	u.Timeout = int(config.PollTimeout.Seconds())
 
 	updates := bot.GetUpdatesChan(u)
-
 	for update := range updates {
-		if update.Message != nil {
-			if update.Message.IsCommand() {
-				switch update.Message.Command() {
-				case "start":
-					handleStartCommand(bot, update.Message.Chat.ID)
-				case "add":
-					handleAddCommand(bot, update.Message.Chat.ID)
-				case "debts":
-					handleDebtsCommand(bot, update.Message.Chat.ID)
-				case "help":
-					handleHelpCommand(bot, update.Message.Chat.ID)
-				case "exportcsv":
-					handleExportCSVCommand(bot, update.Message.Chat.ID)
-				default:
-					sendSimpleMessage(bot, update.Message.Chat.ID, "Неизвестная команда. Используй /help для списка команд.")
-					clearUserState(update.Message.Chat.ID)
-				}
-			} else {
-				handleMessage(bot, update)
-			}
-		} else if update.CallbackQuery != nil {
-			handleCallbackQuery(bot, update)
-		}
+		dispatcher.dispatch(update)
 	}
+	return nil
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// sendText delivers a text message from a private chat, as Telegram would.
+func sendText(bot Sender, chatID int64, text string) {
+	msg := &tgbotapi.Message{
+		MessageID: 1,
+		Text:      text,
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		From:      &tgbotapi.User{ID: chatID},
+	}
+	if text[0] == '/' {
+		msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(text)}}
+	}
+	handleUpdate(bot, tgbotapi.Update{Message: msg})
+}
+
+func lastText(t *testing.T, bot *fakeSender) string {
+	t.Helper()
+	texts := bot.Texts()
+	if len(texts) == 0 {
+		t.Fatal("nothing was sent")
+	}
+	return texts[len(texts)-1]
+}
+
+func keyboardData(bot *fakeSender) []string {
+	keyboard, _ := bot.LastKeyboard()
+	var data []string
+	for _, row := range keyboard.InlineKeyboard {
+		for _, button := range row {
+			if button.CallbackData != nil {
+				data = append(data, *button.CallbackData)
+			}
+		}
+	}
+	return data
+}
+
+func TestAddDebtFlow(t *testing.T) {
+	initDB(filepath.Join(t.TempDir(), "debts.db"))
+	defer DB.Close()
+	const chatID = 42
+	bot := newFakeSender()
+
+	steps := []struct {
+		input    string
+		text     string
+		keyboard []string
+	}{
+		{"/add", "Введи имя должника (или несколько имён через запятую, чтобы разделить сумму):", []string{"v1|cancel_operation"}},
+		{"Вася", "Какова причина долга для *Вася*?", []string{"v1|cancel_operation"}},
+		{"кофе", "Сколько *Вася* должен за *кофе*?", []string{"v1|cancel_operation"}},
+		{"150", "✅ Долг добавлен! *Вася* должен *150.00 ₽* за *кофе*.", []string{"v1|batch_more:1", "v1|batch_done"}},
+	}
+	for _, step := range steps {
+		sendText(bot, chatID, step.input)
+		if got := lastText(t, bot); got != step.text {
+			t.Fatalf("after %q got %q, want %q", step.input, got, step.text)
+		}
+		if got := keyboardData(bot); !slices.Equal(got, step.keyboard) {
+			t.Fatalf("after %q got keyboard %q, want %q", step.input, got, step.keyboard)
+		}
+	}
+
+	debtor, err := getDebtorByName("Вася", chatID)
+	if err != nil {
+		t.Fatalf("debtor was not saved: %v", err)
+	}
+	debts, err := listDebts(debtor.ID)
+	if err != nil || len(debts) != 1 || debts[0].Amount != 15000 || debts[0].Reason != "кофе" {
+		t.Fatalf("got debts %+v (%v), want one debt of 150.00 for кофе", debts, err)
+	}
+	if state := getUserState(chatID); state != StateIdle {
+		t.Errorf("state after the flow is %d, want idle", state)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Markdown Escaping ---
+
+// Messages are sent with Telegram's legacy Markdown, so names, reasons, tags
+// and notes typed by users must be escaped before they are put into a
+// message. Outside formatting a backslash escapes * _ ` and [. Inside an
+// entity such as *bold* backslashes are shown as is and only the closing
+// character is special, so there the entity is closed around it instead.
+
+// escapeMarkdown escapes user text placed outside any formatting.
+func escapeMarkdown(text string) string {
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdown, text)
+}
+
+// escapeBold escapes user text placed between asterisks: "*%s*".
+func escapeBold(text string) string {
+	return escapeInEntity("*", text)
+}
+
+// escapeCode escapes user text placed between backquotes: "`%s`".
+func escapeCode(text string) string {
+	return escapeInEntity("`", text)
+}
+
+// escapeInEntity turns "a*b" into "a*\**b", so that "*a*\**b*" renders as a
+// bold "a", a plain "*" and a bold "b". Empty entities are dropped by Telegram.
+func escapeInEntity(delimiter, text string) string {
+	return strings.ReplaceAll(text, delimiter, delimiter+`\`+delimiter+delimiter)
+}
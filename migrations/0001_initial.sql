@@ -0,0 +1,47 @@
+-- Baseline schema. Tables use IF NOT EXISTS so databases created before
+-- versioned migrations existed are adopted as-is.
+
+CREATE TABLE IF NOT EXISTS debtors (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    chat_id INTEGER NOT NULL,
+    payment_date DATETIME,
+    payment_amount REAL,
+    UNIQUE(name, chat_id)
+);
+
+CREATE TABLE IF NOT EXISTS debts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    debtor_id INTEGER NOT NULL,
+    amount REAL NOT NULL,
+    reason TEXT NOT NULL,
+    FOREIGN KEY (debtor_id) REFERENCES debtors (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS chat_settings (
+    chat_id INTEGER PRIMARY KEY,
+    currency_symbol TEXT NOT NULL DEFAULT '₽',
+    currency_decimals INTEGER NOT NULL DEFAULT 2,
+    holiday_calendar TEXT NOT NULL DEFAULT 'RU'
+);
+
+CREATE TABLE IF NOT EXISTS cosigners (
+    debtor_id INTEGER PRIMARY KEY,
+    chat_id INTEGER,
+    invite_token TEXT NOT NULL UNIQUE,
+    status TEXT NOT NULL,
+    threshold_days INTEGER NOT NULL,
+    notified_for DATETIME,
+    FOREIGN KEY (debtor_id) REFERENCES debtors (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS payments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    debtor_id INTEGER NOT NULL,
+    debt_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    amount REAL NOT NULL,
+    method TEXT NOT NULL,
+    paid_at DATETIME NOT NULL,
+    FOREIGN KEY (debtor_id) REFERENCES debtors (id) ON DELETE CASCADE
+);
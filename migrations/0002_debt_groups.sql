@@ -0,0 +1,13 @@
+-- Debts created together (e.g. a split receipt) share a group so they can be
+-- viewed and closed as one.
+
+CREATE TABLE debt_groups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+ALTER TABLE debts ADD COLUMN group_id INTEGER REFERENCES debt_groups (id) ON DELETE SET NULL;
+
+CREATE INDEX idx_debts_group_id ON debts (group_id);
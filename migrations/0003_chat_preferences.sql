@@ -0,0 +1,9 @@
+-- Per-chat display and reminder preferences edited through /settings.
+
+ALTER TABLE chat_settings ADD COLUMN date_format TEXT NOT NULL DEFAULT '02.01.2006';
+ALTER TABLE chat_settings ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE chat_settings ADD COLUMN reminder_days INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE chat_settings ADD COLUMN debtor_sort TEXT NOT NULL DEFAULT 'name';
+
+-- The payment date the owner was last reminded about, so each date is announced once.
+ALTER TABLE debtors ADD COLUMN reminded_for DATETIME;
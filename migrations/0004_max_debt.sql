@@ -0,0 +1,3 @@
+-- Optional per-chat ceiling for a single debt amount; 0 means no limit.
+
+ALTER TABLE chat_settings ADD COLUMN max_debt REAL NOT NULL DEFAULT 0;
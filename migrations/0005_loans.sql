@@ -0,0 +1,27 @@
+-- Formal loans with interest. The outstanding principal lives in the linked
+-- debt row, so loans show up in totals, lists and exports like any debt.
+
+CREATE TABLE loans (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    debt_id INTEGER NOT NULL UNIQUE,
+    debtor_id INTEGER NOT NULL,
+    principal REAL NOT NULL,
+    annual_rate REAL NOT NULL,
+    term_months INTEGER NOT NULL,
+    start_date DATETIME NOT NULL,
+    closed_at DATETIME,
+    FOREIGN KEY (debtor_id) REFERENCES debtors (id) ON DELETE CASCADE
+);
+
+-- Split of every payment made against a loan.
+CREATE TABLE loan_payments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    loan_id INTEGER NOT NULL,
+    amount REAL NOT NULL,
+    principal_part REAL NOT NULL,
+    interest_part REAL NOT NULL,
+    paid_at DATETIME NOT NULL,
+    FOREIGN KEY (loan_id) REFERENCES loans (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_loan_payments_loan_id ON loan_payments (loan_id);
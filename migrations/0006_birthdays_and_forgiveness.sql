@@ -0,0 +1,14 @@
+-- Optional debtor birthdays ("MM-DD") for the birthday nudge, and a log of
+-- forgiven debts so they can be told apart from repayments.
+
+ALTER TABLE debtors ADD COLUMN birthday TEXT;
+ALTER TABLE debtors ADD COLUMN birthday_nudged_year INTEGER;
+
+CREATE TABLE forgiven_debts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    debtor_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    amount REAL NOT NULL,
+    forgiven_at DATETIME NOT NULL,
+    FOREIGN KEY (debtor_id) REFERENCES debtors (id) ON DELETE CASCADE
+);
@@ -0,0 +1,40 @@
+-- Debts are deleted once closed, so their history is kept in debt_events,
+-- filled by triggers. Amounts are signed: the running sum per debtor is the
+-- outstanding balance at any point in time.
+--   created  - the amount a debt was created with
+--   adjusted - a change of the amount (payments, corrections)
+--   closed   - minus whatever was left when the debt was deleted
+
+CREATE TABLE debt_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    debt_id INTEGER NOT NULL,
+    debtor_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    amount REAL NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_debt_events_debtor_id ON debt_events (debtor_id);
+
+-- Debts that existed before this migration count towards balances but not
+-- towards the amount lent in any particular year.
+INSERT INTO debt_events (debt_id, debtor_id, kind, amount, created_at)
+SELECT id, debtor_id, 'created', amount, '1970-01-01 00:00:00' FROM debts;
+
+CREATE TRIGGER debt_events_created AFTER INSERT ON debts
+BEGIN
+    INSERT INTO debt_events (debt_id, debtor_id, kind, amount, created_at)
+    VALUES (NEW.id, NEW.debtor_id, 'created', NEW.amount, CURRENT_TIMESTAMP);
+END;
+
+CREATE TRIGGER debt_events_adjusted AFTER UPDATE OF amount ON debts WHEN NEW.amount != OLD.amount
+BEGIN
+    INSERT INTO debt_events (debt_id, debtor_id, kind, amount, created_at)
+    VALUES (NEW.id, NEW.debtor_id, 'adjusted', NEW.amount - OLD.amount, CURRENT_TIMESTAMP);
+END;
+
+CREATE TRIGGER debt_events_closed AFTER DELETE ON debts WHEN OLD.amount != 0
+BEGIN
+    INSERT INTO debt_events (debt_id, debtor_id, kind, amount, created_at)
+    VALUES (OLD.id, OLD.debtor_id, 'closed', -OLD.amount, CURRENT_TIMESTAMP);
+END;
@@ -0,0 +1 @@
+ALTER TABLE debtors ADD COLUMN notes TEXT NOT NULL DEFAULT '';
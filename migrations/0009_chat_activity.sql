@@ -0,0 +1,13 @@
+-- last_seen drives archiving of inactive chats; archived_at is set while the
+-- chat's data lives in an archive file instead of the database.
+CREATE TABLE chat_activity (
+    chat_id INTEGER PRIMARY KEY,
+    last_seen DATETIME NOT NULL,
+    archived_at DATETIME
+);
+
+-- Existing chats count as active from now on.
+INSERT OR IGNORE INTO chat_activity (chat_id, last_seen)
+SELECT chat_id, CURRENT_TIMESTAMP FROM debtors
+UNION
+SELECT chat_id, CURRENT_TIMESTAMP FROM chat_settings;
@@ -0,0 +1 @@
+ALTER TABLE debts ADD COLUMN tag TEXT NOT NULL DEFAULT '';
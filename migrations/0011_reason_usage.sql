@@ -0,0 +1,20 @@
+-- How often each chat uses a debt reason, to offer the common ones as
+-- buttons. last_used is a Unix timestamp. Reasons include the tag as a
+-- hashtag ("обед #еда") so a tap restores both.
+CREATE TABLE reason_usage (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    uses INTEGER NOT NULL,
+    last_used INTEGER NOT NULL,
+    UNIQUE(chat_id, reason)
+);
+
+INSERT INTO reason_usage (chat_id, reason, uses, last_used)
+SELECT r.chat_id,
+       d.reason || CASE WHEN d.tag != '' THEN ' #' || d.tag ELSE '' END,
+       COUNT(*),
+       CAST(strftime('%s', 'now') AS INTEGER)
+FROM debts d
+JOIN debtors r ON r.id = d.debtor_id
+GROUP BY 1, 2;
@@ -0,0 +1,4 @@
+-- Monthly digest opt-out and the last month ("2006-01") a digest was sent for.
+
+ALTER TABLE chat_settings ADD COLUMN monthly_digest INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE chat_settings ADD COLUMN digest_sent_for TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- How a payment recorded for a debtor as a whole is split across their debts.
+
+ALTER TABLE chat_settings ADD COLUMN allocation_strategy TEXT NOT NULL DEFAULT 'oldest';
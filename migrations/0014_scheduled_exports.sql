@@ -0,0 +1,7 @@
+-- Automatic exports: export_schedule is '' (off), 'weekly' or 'monthly';
+-- export_sent_for is the last period ("2006-W01" or "2006-01") exported.
+
+ALTER TABLE chat_settings ADD COLUMN export_schedule TEXT NOT NULL DEFAULT '';
+ALTER TABLE chat_settings ADD COLUMN export_hour INTEGER NOT NULL DEFAULT 9;
+ALTER TABLE chat_settings ADD COLUMN export_format TEXT NOT NULL DEFAULT 'csv';
+ALTER TABLE chat_settings ADD COLUMN export_sent_for TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- Per-debtor reminder mode ('' follows the chat setting) and the last day an
+-- overdue reminder was sent.
+
+ALTER TABLE debtors ADD COLUMN reminder_mode TEXT NOT NULL DEFAULT '';
+ALTER TABLE debtors ADD COLUMN overdue_reminded_on DATETIME;
@@ -0,0 +1,14 @@
+-- Deleted debtors are kept for a while so they can be restored. data holds
+-- the debtor's rows from every table it owns, as JSON keyed by table name.
+
+CREATE TABLE trash (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    debtor_name TEXT NOT NULL,
+    debt_count INTEGER NOT NULL,
+    debt_total REAL NOT NULL,
+    data TEXT NOT NULL,
+    deleted_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_trash_chat_id ON trash (chat_id);
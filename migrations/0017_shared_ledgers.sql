@@ -0,0 +1,17 @@
+-- Shared ledgers: a chat that joins another chat's ledger reads and writes
+-- the owner's data (everything keyed by the owner's chat_id) until it leaves.
+
+CREATE TABLE ledger_members (
+    chat_id INTEGER PRIMARY KEY,
+    ledger_chat_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    joined_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_ledger_members_ledger_chat_id ON ledger_members (ledger_chat_id);
+
+-- One invite link per ledger; resetting it replaces the token.
+CREATE TABLE ledger_invites (
+    ledger_chat_id INTEGER PRIMARY KEY,
+    token TEXT NOT NULL UNIQUE
+);
@@ -0,0 +1,6 @@
+-- Payment QR codes: payment_template is a link or bank transfer string with
+-- {amount}, {cents}, {account} and {reason} placeholders; payment_account
+-- fills {account}. An empty template turns the QR button off.
+
+ALTER TABLE chat_settings ADD COLUMN payment_template TEXT NOT NULL DEFAULT '';
+ALTER TABLE chat_settings ADD COLUMN payment_account TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+-- When each open debt was created. Existing debts take the time from their
+-- 'created' event; debts from before debt_events stay NULL (unknown).
+
+ALTER TABLE debts ADD COLUMN created_at DATETIME;
+
+UPDATE debts SET created_at = (
+    SELECT MIN(e.created_at) FROM debt_events e
+    WHERE e.debt_id = debts.id AND e.kind = 'created' AND e.created_at > '1970-01-02'
+);
+
+-- Order of debts in debtor details: 'oldest' or 'newest' first.
+ALTER TABLE chat_settings ADD COLUMN debt_sort TEXT NOT NULL DEFAULT 'oldest';
@@ -0,0 +1,19 @@
+-- A debtor can link their own Telegram chat through an invite link, so the
+-- owner can send them reminders; every reminder sent is logged.
+
+CREATE TABLE debtor_links (
+    debtor_id INTEGER PRIMARY KEY,
+    chat_id INTEGER,
+    invite_token TEXT NOT NULL UNIQUE,
+    linked_at DATETIME,
+    FOREIGN KEY (debtor_id) REFERENCES debtors (id) ON DELETE CASCADE
+);
+
+CREATE TABLE debtor_nudges (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    debtor_id INTEGER NOT NULL,
+    sent_at DATETIME NOT NULL,
+    FOREIGN KEY (debtor_id) REFERENCES debtors (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_debtor_nudges_debtor_id ON debtor_nudges (debtor_id);
@@ -0,0 +1,70 @@
+-- Money is stored as integer minor units (kopecks, cents) instead of REAL,
+-- so repeated payments and corrections can no longer leave balances like
+-- 0.0000001 behind. Every money column is replaced by a *_cents column; the
+-- new names also let archive and trash restores recognise rows saved in the
+-- old format.
+
+DROP TRIGGER debt_events_created;
+DROP TRIGGER debt_events_adjusted;
+DROP TRIGGER debt_events_closed;
+
+ALTER TABLE debtors ADD COLUMN payment_amount_cents INTEGER;
+UPDATE debtors SET payment_amount_cents = CAST(ROUND(payment_amount * 100) AS INTEGER) WHERE payment_amount IS NOT NULL;
+ALTER TABLE debtors DROP COLUMN payment_amount;
+
+ALTER TABLE debts ADD COLUMN amount_cents INTEGER NOT NULL DEFAULT 0;
+UPDATE debts SET amount_cents = CAST(ROUND(amount * 100) AS INTEGER);
+ALTER TABLE debts DROP COLUMN amount;
+
+ALTER TABLE payments ADD COLUMN amount_cents INTEGER NOT NULL DEFAULT 0;
+UPDATE payments SET amount_cents = CAST(ROUND(amount * 100) AS INTEGER);
+ALTER TABLE payments DROP COLUMN amount;
+
+ALTER TABLE loans ADD COLUMN principal_cents INTEGER NOT NULL DEFAULT 0;
+UPDATE loans SET principal_cents = CAST(ROUND(principal * 100) AS INTEGER);
+ALTER TABLE loans DROP COLUMN principal;
+
+ALTER TABLE loan_payments ADD COLUMN amount_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE loan_payments ADD COLUMN principal_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE loan_payments ADD COLUMN interest_cents INTEGER NOT NULL DEFAULT 0;
+UPDATE loan_payments SET
+    amount_cents = CAST(ROUND(amount * 100) AS INTEGER),
+    principal_cents = CAST(ROUND(principal_part * 100) AS INTEGER),
+    interest_cents = CAST(ROUND(interest_part * 100) AS INTEGER);
+ALTER TABLE loan_payments DROP COLUMN amount;
+ALTER TABLE loan_payments DROP COLUMN principal_part;
+ALTER TABLE loan_payments DROP COLUMN interest_part;
+
+ALTER TABLE forgiven_debts ADD COLUMN amount_cents INTEGER NOT NULL DEFAULT 0;
+UPDATE forgiven_debts SET amount_cents = CAST(ROUND(amount * 100) AS INTEGER);
+ALTER TABLE forgiven_debts DROP COLUMN amount;
+
+ALTER TABLE debt_events ADD COLUMN amount_cents INTEGER NOT NULL DEFAULT 0;
+UPDATE debt_events SET amount_cents = CAST(ROUND(amount * 100) AS INTEGER);
+ALTER TABLE debt_events DROP COLUMN amount;
+
+ALTER TABLE chat_settings ADD COLUMN max_debt_cents INTEGER NOT NULL DEFAULT 0;
+UPDATE chat_settings SET max_debt_cents = CAST(ROUND(max_debt * 100) AS INTEGER);
+ALTER TABLE chat_settings DROP COLUMN max_debt;
+
+ALTER TABLE trash ADD COLUMN debt_total_cents INTEGER NOT NULL DEFAULT 0;
+UPDATE trash SET debt_total_cents = CAST(ROUND(debt_total * 100) AS INTEGER);
+ALTER TABLE trash DROP COLUMN debt_total;
+
+CREATE TRIGGER debt_events_created AFTER INSERT ON debts
+BEGIN
+    INSERT INTO debt_events (debt_id, debtor_id, kind, amount_cents, created_at)
+    VALUES (NEW.id, NEW.debtor_id, 'created', NEW.amount_cents, CURRENT_TIMESTAMP);
+END;
+
+CREATE TRIGGER debt_events_adjusted AFTER UPDATE OF amount_cents ON debts WHEN NEW.amount_cents != OLD.amount_cents
+BEGIN
+    INSERT INTO debt_events (debt_id, debtor_id, kind, amount_cents, created_at)
+    VALUES (NEW.id, NEW.debtor_id, 'adjusted', NEW.amount_cents - OLD.amount_cents, CURRENT_TIMESTAMP);
+END;
+
+CREATE TRIGGER debt_events_closed AFTER DELETE ON debts WHEN OLD.amount_cents != 0
+BEGIN
+    INSERT INTO debt_events (debt_id, debtor_id, kind, amount_cents, created_at)
+    VALUES (OLD.id, OLD.debtor_id, 'closed', -OLD.amount_cents, CURRENT_TIMESTAMP);
+END;
@@ -0,0 +1,14 @@
+-- Foreign keys are enforced from now on. Until now they were not, so deleting
+-- a debtor or a loan could leave rows behind; remove them first.
+
+DELETE FROM debts WHERE debtor_id NOT IN (SELECT id FROM debtors);
+DELETE FROM debt_events WHERE debtor_id NOT IN (SELECT id FROM debtors);
+DELETE FROM payments WHERE debtor_id NOT IN (SELECT id FROM debtors);
+DELETE FROM forgiven_debts WHERE debtor_id NOT IN (SELECT id FROM debtors);
+DELETE FROM cosigners WHERE debtor_id NOT IN (SELECT id FROM debtors);
+DELETE FROM debtor_links WHERE debtor_id NOT IN (SELECT id FROM debtors);
+DELETE FROM debtor_nudges WHERE debtor_id NOT IN (SELECT id FROM debtors);
+DELETE FROM loans WHERE debtor_id NOT IN (SELECT id FROM debtors);
+DELETE FROM loan_payments WHERE loan_id NOT IN (SELECT id FROM loans);
+
+UPDATE debts SET group_id = NULL WHERE group_id NOT IN (SELECT id FROM debt_groups);
@@ -0,0 +1,12 @@
+-- Messages that could not be delivered because Telegram was unreachable. The
+-- outbox dispatcher sends them, oldest first, once it is reachable again.
+
+CREATE TABLE outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_outbox_chat_id ON outbox (chat_id);
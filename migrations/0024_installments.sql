@@ -0,0 +1,14 @@
+-- Installment plans: a debt split into dated payments. Which installments are
+-- paid follows from how much of the debt is left, oldest first.
+
+CREATE TABLE installments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    debt_id INTEGER NOT NULL,
+    number INTEGER NOT NULL,
+    due_date DATETIME NOT NULL,
+    amount_cents INTEGER NOT NULL,
+    reminded_at DATETIME,
+    FOREIGN KEY (debt_id) REFERENCES debts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_installments_debt_id ON installments (debt_id);
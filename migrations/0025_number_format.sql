@@ -0,0 +1,4 @@
+-- How amounts are written in the chat: thousand separators and the decimal
+-- mark. 'plain' keeps the original 1234.56.
+
+ALTER TABLE chat_settings ADD COLUMN number_format TEXT NOT NULL DEFAULT 'plain';
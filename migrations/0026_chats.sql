@@ -0,0 +1,15 @@
+-- Every chat that has used the bot, so owners can reach all of them with
+-- /broadcast. blocked_at is set when a broadcast finds the bot blocked or
+-- removed from the chat, and cleared once the chat writes again.
+CREATE TABLE chats (
+    chat_id INTEGER PRIMARY KEY,
+    first_seen DATETIME NOT NULL,
+    blocked_at DATETIME
+);
+
+INSERT OR IGNORE INTO chats (chat_id, first_seen)
+SELECT chat_id, CURRENT_TIMESTAMP FROM chat_activity
+UNION
+SELECT chat_id, CURRENT_TIMESTAMP FROM debtors
+UNION
+SELECT chat_id, CURRENT_TIMESTAMP FROM chat_settings;
@@ -0,0 +1,3 @@
+-- The language of the chat's menus: 'ru' or 'en'.
+
+ALTER TABLE chat_settings ADD COLUMN language TEXT NOT NULL DEFAULT 'ru';
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Back Navigation ---
+
+// Inline screens opened from one another (the /debts list, a debtor card, the
+// menu of one debt and its submenus) get a "⬅️ Назад" button that turns the
+// message back into the screen it was opened from. The screens passed through
+// are kept as a stack in the session, so going back restores the tag filter
+// of the list and the page of the card. The stack outlives clearUserState.
+
+// Screen kinds; the debtor list is the root of every stack.
+const (
+	navDebtorList = "list"
+	navDebtor     = "debtor"
+	navDebt       = "debt"
+	navDebtTags   = "tags"
+	navReminders  = "remind"
+	navDebtGroup  = "group"
+)
+
+// navScreen identifies a screen: ID is the debtor, debt or group it shows.
+type navScreen struct {
+	Kind string
+	ID   int
+	Tag  string
+	Page int
+}
+
+// enterNavScreen records that screen is shown now. A screen of a kind already
+// on the stack replaces it together with everything opened from it.
+func enterNavScreen(chatID int64, screen navScreen) {
+	updateSession(chatID, func(s *Session) {
+		if screen.Kind == navDebtorList {
+			s.Nav = nil
+		}
+		for i, prev := range s.Nav {
+			if prev.Kind == screen.Kind {
+				s.Nav = s.Nav[:i]
+				break
+			}
+		}
+		s.Nav = append(s.Nav, screen)
+	})
+}
+
+// leaveNavScreen drops from and whatever was opened from it and returns the
+// screen it was opened from. ok is false when from is not on the stack, for
+// example after a restart or when it was opened from a fresh message.
+func leaveNavScreen(chatID int64, from navScreen) (navScreen, bool) {
+	var prev navScreen
+	var ok bool
+	updateSession(chatID, func(s *Session) {
+		for i := len(s.Nav) - 1; i > 0; i-- {
+			if s.Nav[i].Kind == from.Kind && s.Nav[i].ID == from.ID {
+				s.Nav = s.Nav[:i]
+				prev, ok = s.Nav[i-1], true
+				return
+			}
+		}
+	})
+	return prev, ok
+}
+
+func backButton(screen navScreen) tgbotapi.InlineKeyboardButton {
+	return callbackButton("⬅️ Назад", fmt.Sprintf("nav_back:%s:%d", screen.Kind, screen.ID))
+}
+
+// navParent is where Back leads when from is not on the stack: the screen it
+// is usually opened from.
+func navParent(chatID int64, from navScreen) (navScreen, bool) {
+	switch from.Kind {
+	case navDebtor:
+		return navScreen{Kind: navDebtorList}, true
+	case navDebt:
+		debt, ok := callbackDebt(chatID, strconv.Itoa(from.ID))
+		return navScreen{Kind: navDebtor, ID: debt.DebtorID}, ok
+	case navDebtTags:
+		return navScreen{Kind: navDebt, ID: from.ID}, true
+	case navReminders:
+		return navScreen{Kind: navDebtor, ID: from.ID}, true
+	case navDebtGroup:
+		debtor, ok := lookupCurrentDebtor(chatID)
+		return navScreen{Kind: navDebtor, ID: debtor.ID}, ok && debtor.ID != 0
+	}
+	return navScreen{}, false
+}
+
+func handleNavBackCallback(bot Sender, chatID int64, messageID int, data string) {
+	kind, idText, _ := strings.Cut(strings.TrimPrefix(data, "nav_back:"), ":")
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		log.Printf("Invalid back callback: %s", data)
+		return
+	}
+	from := navScreen{Kind: kind, ID: id}
+	to, ok := leaveNavScreen(chatID, from)
+	if !ok {
+		to, ok = navParent(chatID, from)
+	}
+	// Going back abandons whatever input the screen was waiting for.
+	clearUserState(chatID)
+	if !ok {
+		editMessageWithKeyboard(bot, chatID, messageID, "Этот экран уже неактуален. Используй /debts, чтобы открыть список должников.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	showNavScreen(bot, chatID, messageID, to)
+}
+
+// showNavScreen shows one of the screens Back can lead to in place of messageID.
+func showNavScreen(bot Sender, chatID int64, messageID int, screen navScreen) {
+	switch screen.Kind {
+	case navDebtorList:
+		text, keyboard, ok := debtorListView(chatID, screen.Tag)
+		if !ok {
+			keyboard = tgbotapi.InlineKeyboardMarkup{}
+		} else {
+			enterNavScreen(chatID, screen)
+		}
+		releaseDetailsMessage(chatID, messageID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case navDebtor:
+		if _, ok := chatDebtor(chatID, screen.ID); !ok {
+			editMessageWithKeyboard(bot, chatID, messageID, "Должник не найден.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		showDebtorDetailsPage(bot, chatID, messageID, screen.ID, screen.Page)
+
+	case navDebt:
+		debt, ok := callbackDebt(chatID, strconv.Itoa(screen.ID))
+		if !ok {
+			editMessageWithKeyboard(bot, chatID, messageID, "Долг не найден.", tgbotapi.InlineKeyboardMarkup{})
+			return
+		}
+		if debtor, ok := chatDebtor(chatID, debt.DebtorID); ok {
+			setCurrentDebtor(chatID, debtor)
+		}
+		showDebtMenu(bot, chatID, messageID, debt)
+
+	default:
+		log.Printf("Cannot go back to screen %q", screen.Kind)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Outbox ---
+
+// A text message that still fails after withRetry gave up because Telegram
+// could not be reached (network errors, 5xx, 429) is stored in the outbox
+// instead of being lost. The dispatcher retries the oldest message every
+// outboxInterval and, once it goes through, sends the rest in order. Messages
+// older than outboxMaxAge are dropped: a reminder days late does more harm
+// than good. Inline keyboards are not kept: their buttons act on conversation
+// state that has expired or changed by the time the message is delivered.
+
+const (
+	outboxInterval  = time.Minute
+	outboxBatchSize = 50
+	outboxMaxAge    = 48 * time.Hour
+)
+
+type outboxMessage struct {
+	ID        int
+	ChatID    int64
+	Text      string
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// queueUndelivered stores msg in the outbox if sendErr means Telegram was unreachable.
+func queueUndelivered(msg tgbotapi.MessageConfig, sendErr error) {
+	if !transientSendError(sendErr) {
+		return
+	}
+	if _, err := DB.Exec("INSERT INTO outbox (chat_id, text, created_at) VALUES (?, ?, ?)",
+		msg.ChatID, msg.Text, time.Now()); err != nil {
+		log.Printf("Error queueing undelivered message: %v", err)
+		return
+	}
+	log.Printf("Queued undelivered message to chat %d in the outbox", msg.ChatID)
+}
+
+func listOutbox(limit int) ([]outboxMessage, error) {
+	rows, err := DB.Query("SELECT id, chat_id, text, attempts, created_at FROM outbox ORDER BY id LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []outboxMessage
+	for rows.Next() {
+		var m outboxMessage
+		if err := rows.Scan(&m.ID, &m.ChatID, &m.Text, &m.Attempts, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func deleteOutboxMessage(id int) error {
+	_, err := DB.Exec("DELETE FROM outbox WHERE id = ?", id)
+	return err
+}
+
+// outboxChattable rebuilds the message, noting when it was originally sent.
+func outboxChattable(m outboxMessage) tgbotapi.MessageConfig {
+	note := fmt.Sprintf("⏳ Сообщение от %s, доставлено с задержкой:\n\n", formatDateTime(getChatSettings(m.ChatID), m.CreatedAt))
+	msg := tgbotapi.NewMessage(m.ChatID, note+m.Text)
+	msg.ParseMode = "Markdown"
+	return msg
+}
+
+// flushOutbox sends queued messages in order and stops at the first one that
+// fails for a transient reason, since Telegram is evidently still unreachable.
+func flushOutbox(bot Sender) {
+	messages, err := listOutbox(outboxBatchSize)
+	if err != nil {
+		log.Printf("Error listing outbox: %v", err)
+		return
+	}
+	for _, m := range messages {
+		if time.Since(m.CreatedAt) > outboxMaxAge {
+			log.Printf("Dropping outbox message %d to chat %d after %d attempts: too old", m.ID, m.ChatID, m.Attempts)
+		} else {
+			waitForSendSlot(m.ChatID)
+			_, err := bot.Send(outboxChattable(m))
+			if err != nil && transientSendError(err) {
+				if _, err := DB.Exec("UPDATE outbox SET attempts = attempts + 1 WHERE id = ?", m.ID); err != nil {
+					log.Printf("Error updating outbox message: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				log.Printf("Dropping outbox message %d to chat %d: %v", m.ID, m.ChatID, err)
+			}
+		}
+		if err := deleteOutboxMessage(m.ID); err != nil {
+			log.Printf("Error deleting outbox message: %v", err)
+			return
+		}
+	}
+}
+
+// startOutbox runs the outbox dispatcher until the returned stop function is
+// called. stop waits for a flush in progress to finish.
+func startOutbox(bot Sender) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(outboxInterval)
+		defer ticker.Stop()
+		for {
+			flushOutbox(bot)
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
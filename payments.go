@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Payments ---
+
+type Payment struct {
+	ID         int
+	DebtorID   int
+	DebtID     int
+	DebtorName string
+	Reason     string
+	Amount     Money
+	Method     string
+	PaidAt     time.Time
+}
+
+const (
+	PaymentMethodCash     = "cash"
+	PaymentMethodTransfer = "transfer"
+	PaymentMethodOther    = "other"
+	paymentHistoryLimit   = 20
+)
+
+var paymentMethods = []string{PaymentMethodCash, PaymentMethodTransfer, PaymentMethodOther}
+
+var paymentMethodNames = map[string]string{
+	PaymentMethodCash:     "💵 Наличные",
+	PaymentMethodTransfer: "💳 Перевод",
+	PaymentMethodOther:    "🔹 Другое",
+}
+
+func isPaymentMethod(method string) bool {
+	_, ok := paymentMethodNames[method]
+	return ok
+}
+
+func addPayment(payment Payment) error {
+	_, err := DB.Exec("INSERT INTO payments (debtor_id, debt_id, reason, amount_cents, method, paid_at) VALUES (?, ?, ?, ?, ?, ?)",
+		payment.DebtorID, payment.DebtID, payment.Reason, payment.Amount, payment.Method, payment.PaidAt)
+	if err == nil {
+		emitDebtEvent(EventPaymentRecorded, Debt{ID: payment.DebtID, DebtorID: payment.DebtorID, Reason: payment.Reason}, &payment)
+	}
+	return err
+}
+
+// listPayments returns the most recent payments of a chat, optionally limited to one method.
+func listPayments(chatID int64, method string, limit int) ([]Payment, error) {
+	query := `SELECT p.id, p.debtor_id, p.debt_id, d.name, p.reason, p.amount_cents, p.method, p.paid_at
+        FROM payments p JOIN debtors d ON d.id = p.debtor_id
+        WHERE d.chat_id = ?`
+	args := []interface{}{ledgerChatID(chatID)}
+	if method != "" {
+		query += " AND p.method = ?"
+		args = append(args, method)
+	}
+	query += " ORDER BY p.paid_at DESC, p.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []Payment
+	for rows.Next() {
+		var p Payment
+		if err := rows.Scan(&p.ID, &p.DebtorID, &p.DebtID, &p.DebtorName, &p.Reason, &p.Amount, &p.Method, &p.PaidAt); err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
+
+func sumPaymentsByMethod(chatID int64) (map[string]Money, error) {
+	rows, err := DB.Query(`SELECT p.method, SUM(p.amount_cents)
+        FROM payments p JOIN debtors d ON d.id = p.debtor_id
+        WHERE d.chat_id = ? GROUP BY p.method`, ledgerChatID(chatID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[string]Money)
+	for rows.Next() {
+		var method string
+		var total Money
+		if err := rows.Scan(&method, &total); err != nil {
+			return nil, err
+		}
+		totals[method] = total
+	}
+	return totals, rows.Err()
+}
+
+func sumDebtorPaymentsByMethod(debtorID int) (map[string]Money, error) {
+	rows, err := DB.Query("SELECT method, SUM(amount_cents) FROM payments WHERE debtor_id = ? GROUP BY method", debtorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[string]Money)
+	for rows.Next() {
+		var method string
+		var total Money
+		if err := rows.Scan(&method, &total); err != nil {
+			return nil, err
+		}
+		totals[method] = total
+	}
+	return totals, rows.Err()
+}
+
+// recordDebtPayment subtracts a repayment from the debt, logs it and closes
+// the debt once nothing is left. It returns the remaining amount.
+func recordDebtPayment(debt Debt, amount Money, method string) (Money, error) {
+	if loan, err := getLoanByDebtID(debt.ID); err == nil {
+		_, remaining, err := recordLoanPayment(loan, debt, amount, method)
+		return remaining, err
+	} else if err != sql.ErrNoRows {
+		return debt.Amount, err
+	}
+	newAmount := debt.Amount - amount
+	if err := updateDebtAmount(debt.ID, newAmount); err != nil {
+		return debt.Amount, err
+	}
+	payment := Payment{DebtorID: debt.DebtorID, DebtID: debt.ID, Reason: debt.Reason, Amount: amount, Method: method, PaidAt: time.Now()}
+	if err := addPayment(payment); err != nil {
+		log.Printf("Error recording payment: %v", err)
+	}
+	if newAmount == 0 {
+		if err := closeDebt(debt.ID); err != nil {
+			return newAmount, err
+		}
+	}
+	return newAmount, nil
+}
+
+// --- Repayment Flow ---
+
+func askPaymentMethod(bot Sender, chatID int64, amount Money) {
+	setPendingPayment(chatID, amount)
+	setUserState(chatID, StateChoosingPaymentMethod)
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, method := range paymentMethods {
+		row = append(row, callbackButton(paymentMethodNames[method], "payment_method:"+method))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row, tgbotapi.NewInlineKeyboardRow(
+		callbackButton("❌ Отмена", "cancel_operation"),
+	))
+	sendWithKeyboard(bot, chatID, fmt.Sprintf("Как был получен платёж *%s*?", formatChatAmount(chatID, amount)), keyboard)
+}
+
+func handlePaymentMethodCallback(bot Sender, chatID int64, messageID int, method string) {
+	amount, ok := pendingPayment(chatID)
+	if !ok || getUserState(chatID) != StateChoosingPaymentMethod || !isPaymentMethod(method) {
+		editMessageWithKeyboard(bot, chatID, messageID, "Эта операция уже завершена.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	debt := selectedDebt(chatID)
+	defer clearUserState(chatID)
+
+	if loan, err := getLoanByDebtID(debt.ID); err == nil {
+		payment, remaining, err := recordLoanPayment(loan, debt, amount, method)
+		if err != nil {
+			log.Printf("Error recording loan payment: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось записать платёж по кредиту.")
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Способ оплаты: %s", paymentMethodNames[method]), tgbotapi.InlineKeyboardMarkup{})
+		sendSimpleMessage(bot, chatID, loanPaymentText(chatID, payment, remaining))
+		notifyCoOwners(bot, chatID, fmt.Sprintf("Платёж по кредиту *%s*: *%s*.", escapeBold(currentDebtor(chatID).Name), formatChatAmount(chatID, amount)))
+		showDebtorDetails(bot, chatID, debt.DebtorID)
+		return
+	}
+
+	newAmount, err := recordDebtPayment(debt, amount, method)
+	if err != nil {
+		log.Printf("Error subtracting from debt: %v", err)
+		sendSimpleMessage(bot, chatID, "Не удалось вычесть сумму из долга.")
+		return
+	}
+
+	editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Способ оплаты: %s", paymentMethodNames[method]), tgbotapi.InlineKeyboardMarkup{})
+	if newAmount == 0 {
+		sendWithKeyboard(bot, chatID, fmt.Sprintf("✅ Долг в размере *%s* за *%s* полностью погашен и закрыт.", formatChatAmount(chatID, debt.Amount), escapeBold(debt.Reason)),
+			receiptKeyboard(debt.DebtorID, debt.Amount, time.Now()))
+	} else {
+		sendSimpleMessage(bot, chatID, fmt.Sprintf("Сумма *%s* вычтена из долга.  Остаток долга: *%s*", formatChatAmount(chatID, amount), formatChatAmount(chatID, newAmount)))
+	}
+	notifyCoOwners(bot, chatID, fmt.Sprintf("Платёж от *%s*: *%s* за *%s*.", escapeBold(currentDebtor(chatID).Name), formatChatAmount(chatID, amount), escapeBold(debt.Reason)))
+	showDebtorDetails(bot, chatID, debt.DebtorID)
+}
+
+// --- History ---
+
+func handleHistoryCommand(bot Sender, chatID int64) {
+	clearUserState(chatID)
+	text, keyboard := paymentHistory(chatID, "")
+	sendWithKeyboard(bot, chatID, text, keyboard)
+}
+
+func paymentHistory(chatID int64, method string) (string, tgbotapi.InlineKeyboardMarkup) {
+	settings := getChatSettings(chatID)
+	filterRow := []tgbotapi.InlineKeyboardButton{callbackButton(markSelected("Все", method == ""), "history:all")}
+	for _, m := range paymentMethods {
+		filterRow = append(filterRow, callbackButton(markSelected(paymentMethodNames[m], method == m), "history:"+m))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(filterRow)
+
+	payments, err := listPayments(chatID, method, paymentHistoryLimit)
+	if err != nil {
+		log.Printf("Error listing payments: %v", err)
+		return "Произошла ошибка при получении истории платежей.", keyboard
+	}
+	totals, err := sumPaymentsByMethod(chatID)
+	if err != nil {
+		log.Printf("Error summing payments: %v", err)
+		return "Произошла ошибка при получении истории платежей.", keyboard
+	}
+
+	var text strings.Builder
+	text.WriteString("*История платежей*")
+	if method != "" {
+		text.WriteString(fmt.Sprintf(" (%s)", paymentMethodNames[method]))
+	}
+	text.WriteString("\n\n")
+	if len(payments) == 0 {
+		text.WriteString("Платежей пока нет.\n")
+	}
+	for _, p := range payments {
+		text.WriteString(fmt.Sprintf("%s — *%s*: %s за %s, %s\n", formatDate(settings, p.PaidAt.In(chatLocation(settings))), escapeBold(p.DebtorName), formatAmount(settings, p.Amount), escapeMarkdown(p.Reason), paymentMethodNames[p.Method]))
+	}
+
+	text.WriteString("\n*Итого по способам:*\n")
+	for _, m := range paymentMethods {
+		text.WriteString(fmt.Sprintf("%s: %s\n", paymentMethodNames[m], formatAmount(settings, totals[m])))
+	}
+	return text.String(), keyboard
+}
+
+func handleHistoryCallback(bot Sender, chatID int64, messageID int, filter string) {
+	method := filter
+	if filter == "all" {
+		method = ""
+	} else if !isPaymentMethod(method) {
+		log.Printf("Invalid history filter in callback: %s", filter)
+		return
+	}
+	text, keyboard := paymentHistory(chatID, method)
+	editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Payment QR Codes ---
+
+// A chat can store a payment template: an SBP or bank link, or a bank
+// transfer string such as ST00012, with placeholders for the amount. The
+// debt menu then offers a QR code with the debt amount filled in, for the
+// debtor to scan with a banking app.
+
+const (
+	maxPaymentTemplateLength = 500
+	maxPaymentAccountLength  = 200
+	paymentQRScale           = 8
+)
+
+func paymentQRStatusText(settings ChatSettings) string {
+	if settings.PaymentTemplate == "" {
+		return tr(settings, "не настроен")
+	}
+	return tr(settings, "настроен")
+}
+
+// fillPaymentTemplate substitutes {amount} (1500.00), {cents} (150000),
+// {account} and {reason} in the chat's template. In a link template the
+// account and reason are query-escaped, so that spaces and & or # in them
+// keep the link valid.
+func fillPaymentTemplate(settings ChatSettings, amount Money, reason string) string {
+	account := settings.PaymentAccount
+	if isLinkTemplate(settings.PaymentTemplate) {
+		account, reason = url.QueryEscape(account), url.QueryEscape(reason)
+	}
+	return strings.NewReplacer(
+		"{amount}", formatNumber(ChatSettings{CurrencyDecimals: 2, NumberFormat: NumberFormatPlain}, amount),
+		"{cents}", strconv.FormatInt(int64(amount), 10),
+		"{account}", account,
+		"{reason}", reason,
+	).Replace(settings.PaymentTemplate)
+}
+
+func isLinkTemplate(template string) bool {
+	return strings.HasPrefix(template, "https://") || strings.HasPrefix(template, "http://")
+}
+
+func handlePaymentQRCallback(bot Sender, chatID int64, messageID int, data string) {
+	debtID, err := strconv.Atoi(strings.TrimPrefix(data, "payqr:"))
+	if err != nil {
+		log.Printf("Invalid debt ID in QR callback: %v", err)
+		return
+	}
+	debt, err := getDebtByID(debtID)
+	if err != nil {
+		editMessageWithKeyboard(bot, chatID, messageID, "Этот долг уже закрыт.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	debtor, ok := callbackDebtor(chatID, strconv.Itoa(debt.DebtorID))
+	if !ok {
+		return
+	}
+	clearUserState(chatID)
+
+	settings := getChatSettings(chatID)
+	if settings.PaymentTemplate == "" {
+		editMessageWithKeyboard(bot, chatID, messageID, "Шаблон для QR не настроен. Задай его в /settings.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	link := fillPaymentTemplate(settings, debt.Amount, debt.Reason)
+	image, err := qrPNG(link, paymentQRScale)
+	if err != nil {
+		log.Printf("Error generating payment QR: %v", err)
+		editMessageWithKeyboard(bot, chatID, messageID, "Не удалось построить QR: шаблон получился слишком длинным. Сократи его в /settings.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+
+	editMessageWithKeyboard(bot, chatID, messageID, "QR готов. Покажи его должнику или перешли: он отсканирует код в приложении банка.", tgbotapi.InlineKeyboardMarkup{})
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: "payment.png", Bytes: image})
+	photo.Caption = fmt.Sprintf("📷 Оплата долга *%s*: *%s* за *%s*", escapeBold(debtor.Name), formatAmount(settings, debt.Amount), escapeBold(debt.Reason))
+	photo.ParseMode = "Markdown"
+	if isLinkTemplate(link) {
+		// Telegram rejects the whole message when a button has an invalid URL.
+		if parsed, err := url.Parse(link); err != nil || parsed.Host == "" {
+			log.Printf("Payment link %q is not a valid URL, sending the QR without a button: %v", link, err)
+		} else {
+			photo.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonURL("🔗 Открыть ссылку", link),
+			))
+		}
+	}
+	if _, err := sendChattable(bot, chatID, photo); err != nil {
+		log.Printf("Error sending payment QR: %v", err)
+	}
+}
+
+// --- Payment QR Settings ---
+
+const paymentQRSettingsHelp = "📷 *QR для оплаты*\n\n" +
+	"В меню долга появится кнопка с QR-кодом на сумму долга: должник отсканирует его в приложении банка.\n\n" +
+	"Шаблон — ссылка СБП или банка либо строка перевода (например, ST00012). Подстановки: " +
+	"`{amount}` — сумма (1500.00), `{cents}` — сумма в копейках, `{account}` — реквизиты, `{reason}` — причина долга.\n\n"
+
+func paymentQRSettingsMenu(chatID int64) (string, tgbotapi.InlineKeyboardMarkup) {
+	settings := getChatSettings(chatID)
+	text := tr(settings, paymentQRSettingsHelp)
+	if settings.PaymentTemplate == "" {
+		text += tr(settings, "Шаблон: *не задан*\n")
+	} else {
+		text += trf(settings, "Шаблон: `%s`\n", escapeCode(settings.PaymentTemplate))
+	}
+	if settings.PaymentAccount == "" {
+		text += tr(settings, "Реквизиты: *не заданы*")
+	} else {
+		text += trf(settings, "Реквизиты: `%s`", escapeCode(settings.PaymentAccount))
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton(tr(settings, "✍️ Шаблон"), "set_payqr_template"),
+			callbackButton(tr(settings, "✍️ Реквизиты"), "set_payqr_account"),
+		),
+	}
+	if settings.PaymentTemplate != "" || settings.PaymentAccount != "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(tr(settings, "🗑 Очистить"), "set_payqr_clear")))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(tr(settings, "« Назад"), "settings_done")))
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func handlePaymentQRSettingsCallback(bot Sender, chatID int64, messageID int, data string) {
+	settings := getChatSettings(chatID)
+	switch data {
+	case "set_payqr_template":
+		setUserState(chatID, StateSettingPaymentTemplate)
+		editPrompt(bot, chatID, messageID, tr(settings, "Введи шаблон, например:\n`https://example.com/pay?phone={account}&sum={amount}`\n\nВ шаблоне должна быть сумма: `{amount}` или `{cents}`."))
+		return
+
+	case "set_payqr_account":
+		setUserState(chatID, StateSettingPaymentAccount)
+		editPrompt(bot, chatID, messageID, tr(settings, "Введи реквизиты для подстановки `{account}`: номер телефона, счёта или карты:"))
+		return
+
+	case "set_payqr_clear":
+		err := upsertChatSetting(chatID, "payment_template", "")
+		if err == nil {
+			err = upsertChatSetting(chatID, "payment_account", "")
+		}
+		if err != nil {
+			log.Printf("Error clearing payment QR settings: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить настройки QR."))
+			return
+		}
+	}
+	text, keyboard := paymentQRSettingsMenu(chatID)
+	editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+}
+
+func handlePaymentQRSettingInput(bot Sender, chatID int64, state int, text string) {
+	settings := getChatSettings(chatID)
+	value := strings.TrimSpace(text)
+	column := "payment_account"
+	if state == StateSettingPaymentTemplate {
+		column = "payment_template"
+		if value == "" || len(value) > maxPaymentTemplateLength || strings.Contains(value, "`") {
+			sendPrompt(bot, chatID, trf(settings, "Шаблон должен быть не длиннее %d символов и не содержать обратных кавычек.", maxPaymentTemplateLength))
+			return
+		}
+		if !strings.Contains(value, "{amount}") && !strings.Contains(value, "{cents}") {
+			sendPrompt(bot, chatID, tr(settings, "В шаблоне нет суммы. Добавь `{amount}` или `{cents}`."))
+			return
+		}
+	} else if value == "" || len(value) > maxPaymentAccountLength || strings.Contains(value, "`") {
+		sendPrompt(bot, chatID, trf(settings, "Реквизиты должны быть не длиннее %d символов и не содержать обратных кавычек.", maxPaymentAccountLength))
+		return
+	}
+
+	if err := upsertChatSetting(chatID, column, value); err != nil {
+		log.Printf("Error updating payment QR settings: %v", err)
+		sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить настройки QR."))
+		clearUserState(chatID)
+		return
+	}
+	clearUserState(chatID)
+	text, keyboard := paymentQRSettingsMenu(chatID)
+	sendWithKeyboard(bot, chatID, text, keyboard)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Progress Feedback ---
+
+const (
+	chatActionRefresh    = 4 * time.Second
+	progressEditInterval = 2 * time.Second
+)
+
+// sendChatAction is best-effort and deliberately bypasses the send limiter.
+func sendChatAction(bot Sender, chatID int64, action string) {
+	if _, err := bot.Request(tgbotapi.NewChatAction(chatID, action)); err != nil {
+		log.Printf("Error sending chat action: %v", err)
+	}
+}
+
+// keepChatAction shows a chat action (it expires after ~5s on Telegram's side)
+// until the returned stop function is called.
+func keepChatAction(bot Sender, chatID int64, action string) func() {
+	done := make(chan struct{})
+	sendChatAction(bot, chatID, action)
+	go func() {
+		ticker := time.NewTicker(chatActionRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				sendChatAction(bot, chatID, action)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// progressMessage is a status message that is edited in place while a long
+// operation runs, so users can see the bot is still working.
+type progressMessage struct {
+	bot       Sender
+	chatID    int64
+	messageID int
+	lastText  string
+	lastEdit  time.Time
+}
+
+func startProgress(bot Sender, chatID int64, text string) *progressMessage {
+	p := &progressMessage{bot: bot, chatID: chatID, lastText: text, lastEdit: time.Now()}
+	sent, err := sendChattable(bot, chatID, tgbotapi.NewMessage(chatID, text))
+	if err != nil {
+		log.Printf("Error sending progress message: %v", err)
+		return p
+	}
+	p.messageID = sent.MessageID
+	return p
+}
+
+// update edits the status message, at most once per progressEditInterval.
+func (p *progressMessage) update(text string) {
+	if time.Since(p.lastEdit) < progressEditInterval {
+		return
+	}
+	p.set(text)
+}
+
+// set edits the status message immediately.
+func (p *progressMessage) set(text string) {
+	if p.messageID == 0 || text == p.lastText {
+		return
+	}
+	if _, err := sendChattable(p.bot, p.chatID, tgbotapi.NewEditMessageText(p.chatID, p.messageID, text)); err != nil {
+		log.Printf("Error editing progress message: %v", err)
+	}
+	p.lastText = text
+	p.lastEdit = time.Now()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+// --- Quick Add ---
+
+// parseQuickAdd parses "/add" arguments like "Иван 500 за обед": everything
+// before the first number is the name, everything after it the reason.
+func parseQuickAdd(settings ChatSettings, args string) (name string, amount Money, reason string, ok bool) {
+	fields := strings.Fields(args)
+	for i := 1; i < len(fields); i++ {
+		value, err := parseAmount(settings, fields[i])
+		if err != nil || value <= 0 {
+			continue
+		}
+		name = strings.Join(fields[:i], " ")
+		reason = strings.Join(fields[i+1:], " ")
+		if lower := strings.ToLower(reason); strings.HasPrefix(lower, "за ") {
+			reason = strings.TrimSpace(reason[len("за "):])
+		}
+		return name, value, reason, reason != ""
+	}
+	return "", 0, "", false
+}
+
+// quickAdd adds a debt from a single "/add" message, creating the debtor if
+// needed. It feeds the regular dialog states, so amount checks and splitting
+// behave exactly as in the step-by-step flow.
+func quickAdd(bot Sender, chatID int64, name string, amount Money, reason string) {
+	if names := parseSplitNames(name); names != nil {
+		setSplitNames(chatID, names)
+		setSplitReason(chatID, reason)
+		setUserState(chatID, StateAddingSplitAmount)
+		if checkAmount(bot, chatID, amount) {
+			askSplitMode(bot, chatID, amount)
+		}
+		return
+	}
+
+	debtor, matches, err := findQuickAddDebtor(chatID, name)
+	if err != nil {
+		log.Printf("Error getting debtor for quick add: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при поиске должника.")
+		clearUserState(chatID)
+		return
+	}
+	if debtor.ID == 0 && len(matches) > 0 {
+		setPendingQuickAdd(chatID, amount, reason)
+		offerDebtorMatches(bot, chatID, name, matches)
+		return
+	}
+	if debtor.ID == 0 {
+		quickAddToNew(bot, chatID, name, amount, reason)
+		return
+	}
+	quickAddTo(bot, chatID, debtor, amount, reason)
+}
+
+func quickAddTo(bot Sender, chatID int64, debtor Debtor, amount Money, reason string) {
+	setPendingQuickAdd(chatID, 0, "")
+	setCurrentDebtor(chatID, debtor)
+	reason, tag := splitDebtTag(reason)
+	setSelectedDebt(chatID, Debt{DebtorID: debtor.ID, Reason: reason, Tag: tag})
+	setUserState(chatID, StateAddingDebtAmount)
+	if checkAmount(bot, chatID, amount) {
+		finishAddDebt(bot, chatID, amount)
+	}
+}
+
+func quickAddToNew(bot Sender, chatID int64, name string, amount Money, reason string) {
+	debtor, err := addDebtor(Debtor{Name: name, ChatID: chatID})
+	if err != nil {
+		log.Printf("Error adding debtor for quick add: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при добавлении должника.")
+		clearUserState(chatID)
+		return
+	}
+	quickAddTo(bot, chatID, debtor, amount, reason)
+}
+
+// findQuickAddDebtor returns the debtor with the given name, ignoring case.
+// Otherwise it returns the debtors with similar names for the user to choose from.
+func findQuickAddDebtor(chatID int64, name string) (Debtor, []Debtor, error) {
+	debtor, err := getDebtorByName(name, chatID)
+	if err != sql.ErrNoRows {
+		return debtor, nil, err
+	}
+	matches, err := findSimilarDebtors(chatID, name)
+	if err != nil {
+		return Debtor{}, nil, err
+	}
+	for _, match := range matches {
+		if strings.EqualFold(match.Name, name) {
+			return match, nil, nil
+		}
+	}
+	return Debtor{}, matches, nil
+}
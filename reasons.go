@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Recent Reasons ---
+
+// The reason prompt offers the chat's most frequent reasons among those used
+// recently, so common entries like "обед" take one tap.
+
+const (
+	recentReasonButtons = 4
+	recentReasonWindow  = 90 * 24 * time.Hour
+	// recentReasonLabelLength keeps long reasons from stretching the keyboard.
+	recentReasonLabelLength = 30
+)
+
+type recentReason struct {
+	ID     int
+	Reason string
+}
+
+func recordReasonUse(chatID int64, reason string) {
+	_, err := DB.Exec(`INSERT INTO reason_usage (chat_id, reason, uses, last_used) VALUES (?, ?, 1, ?)
+		ON CONFLICT(chat_id, reason) DO UPDATE SET uses = uses + 1, last_used = excluded.last_used`, ledgerChatID(chatID), reason, time.Now().Unix())
+	if err != nil {
+		log.Printf("Error recording reason use: %v", err)
+	}
+}
+
+func listRecentReasons(chatID int64) ([]recentReason, error) {
+	rows, err := DB.Query(`SELECT id, reason FROM reason_usage
+		WHERE chat_id = ? AND last_used >= ?
+		ORDER BY uses DESC, last_used DESC
+		LIMIT ?`, ledgerChatID(chatID), time.Now().Add(-recentReasonWindow).Unix(), recentReasonButtons)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reasons []recentReason
+	for rows.Next() {
+		var r recentReason
+		if err := rows.Scan(&r.ID, &r.Reason); err != nil {
+			return nil, err
+		}
+		reasons = append(reasons, r)
+	}
+	return reasons, rows.Err()
+}
+
+func getRecentReason(chatID int64, id int) (string, error) {
+	var reason string
+	err := DB.QueryRow("SELECT reason FROM reason_usage WHERE id = ? AND chat_id = ?", id, ledgerChatID(chatID)).Scan(&reason)
+	return reason, err
+}
+
+// reasonKeyboard is the cancel keyboard with the chat's recent reasons on top.
+func reasonKeyboard(chatID int64) tgbotapi.InlineKeyboardMarkup {
+	reasons, err := listRecentReasons(chatID)
+	if err != nil {
+		log.Printf("Error listing recent reasons: %v", err)
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, r := range reasons {
+		label := r.Reason
+		if runes := []rune(label); len(runes) > recentReasonLabelLength {
+			label = string(runes[:recentReasonLabelLength-1]) + "…"
+		}
+		row = append(row, callbackButton(label, fmt.Sprintf("recent_reason:%d", r.ID)))
+		if len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	rows = append(rows, cancelKeyboard(getChatSettings(chatID)).InlineKeyboard...)
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func sendReasonPrompt(bot Sender, chatID int64, text string) {
+	sendWithKeyboard(bot, chatID, text, reasonKeyboard(chatID))
+}
+
+func editReasonPrompt(bot Sender, chatID int64, messageID int, text string) {
+	editMessageWithKeyboard(bot, chatID, messageID, text, reasonKeyboard(chatID))
+}
+
+// handleRecentReasonCallback answers the reason prompt as if the reason had been typed.
+func handleRecentReasonCallback(bot Sender, chatID int64, messageID int, data string) {
+	id, err := strconv.Atoi(strings.TrimPrefix(data, "recent_reason:"))
+	if err != nil {
+		log.Printf("Invalid reason ID in callback: %v", err)
+		return
+	}
+	reason, err := getRecentReason(chatID, id)
+	if err != nil {
+		log.Printf("Error getting recent reason %d: %v", id, err)
+		return
+	}
+
+	switch getUserState(chatID) {
+	case StateAddingDebtReason:
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Причина: *%s*", escapeBold(reason)), tgbotapi.InlineKeyboardMarkup{})
+		handleDebtReason(bot, chatID, reason)
+	case StateAddingSplitReason:
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Причина: *%s*", escapeBold(reason)), tgbotapi.InlineKeyboardMarkup{})
+		handleSplitReason(bot, chatID, reason)
+	default:
+		editMessageWithKeyboard(bot, chatID, messageID, "Эта кнопка уже неактуальна.", tgbotapi.InlineKeyboardMarkup{})
+	}
+}
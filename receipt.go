@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Repayment Receipts ---
+
+// Closed debts are deleted, so the receipt button carries everything the
+// receipt needs: receipt:<debtor>:<cents>:<unix time of repayment>.
+
+func receiptKeyboard(debtorID int, amount Money, paidAt time.Time) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		callbackButton("🧾 Расписка", fmt.Sprintf("receipt:%d:%d:%d", debtorID, amount, paidAt.Unix())),
+	))
+}
+
+func receiptText(settings ChatSettings, debtor Debtor, amount Money, paidAt time.Time) string {
+	return fmt.Sprintf("🧾 *Расписка о возврате долга*\n\nПодтверждаю, что *%s* вернул(а) мне долг в размере *%s*.\n\nДата возврата: %s\nПретензий не имею.",
+		escapeBold(debtor.Name), formatAmount(settings, amount), formatDate(settings, paidAt.In(chatLocation(settings))))
+}
+
+func handleReceiptCallback(bot Sender, chatID int64, data string) {
+	parts := strings.Split(strings.TrimPrefix(data, "receipt:"), ":")
+	if len(parts) != 3 {
+		log.Printf("Invalid receipt callback: %s", data)
+		return
+	}
+	amount, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || amount <= 0 {
+		log.Printf("Invalid amount in receipt callback: %s", data)
+		return
+	}
+	unix, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		log.Printf("Invalid date in receipt callback: %s", data)
+		return
+	}
+	debtor, ok := callbackDebtor(chatID, parts[0])
+	if !ok {
+		sendSimpleMessage(bot, chatID, "Должник не найден.")
+		return
+	}
+	sendSimpleMessage(bot, chatID, "Перешли сообщение ниже должнику или скопируй его текст:")
+	sendSimpleMessage(bot, chatID, receiptText(getChatSettings(chatID), debtor, Money(amount), time.Unix(unix, 0)))
+}
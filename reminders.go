@@ -0,0 +1,192 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Payment Reminders ---
+
+// reminderHour is the local hour in the chat's timezone after which reminders are sent.
+const reminderHour = 9
+
+// Per-debtor reminder modes. The default follows the chat's reminder setting;
+// the overdue modes keep reminding after the payment date has passed.
+const (
+	ReminderModeDefault       = ""
+	ReminderModeOff           = "off"
+	ReminderModeOverdueDaily  = "overdue_daily"
+	ReminderModeOverdueWeekly = "overdue_weekly"
+)
+
+var reminderModeOrder = []string{ReminderModeDefault, ReminderModeOff, ReminderModeOverdueDaily, ReminderModeOverdueWeekly}
+
+var reminderModeNames = map[string]string{
+	ReminderModeDefault:       "Как в настройках",
+	ReminderModeOff:           "Не напоминать",
+	ReminderModeOverdueDaily:  "Каждый день после просрочки",
+	ReminderModeOverdueWeekly: "Раз в неделю после просрочки",
+}
+
+// overdueReminderDays is how often each overdue mode repeats.
+var overdueReminderDays = map[string]int{
+	ReminderModeOverdueDaily:  1,
+	ReminderModeOverdueWeekly: 7,
+}
+
+func getDebtorReminderMode(debtorID int) (string, error) {
+	var mode string
+	err := DB.QueryRow("SELECT reminder_mode FROM debtors WHERE id = ?", debtorID).Scan(&mode)
+	return mode, err
+}
+
+func updateDebtorReminderMode(debtorID int, mode string) error {
+	_, err := DB.Exec("UPDATE debtors SET reminder_mode = ? WHERE id = ?", mode, debtorID)
+	return err
+}
+
+// notifyUpcomingPayments reminds owners about debtors whose payment date is
+// within the chat's reminder lead time. Each payment date is announced once.
+func notifyUpcomingPayments(bot Sender) {
+	rows, err := DB.Query(`SELECT id, name, chat_id, payment_date, payment_amount_cents FROM debtors
+        WHERE payment_date IS NOT NULL AND (reminded_for IS NULL OR reminded_for != payment_date) AND reminder_mode != ?`, ReminderModeOff)
+	if err != nil {
+		log.Printf("Error listing debtors for reminders: %v", err)
+		return
+	}
+	var candidates []Debtor
+	for rows.Next() {
+		var debtor Debtor
+		if err := rows.Scan(&debtor.ID, &debtor.Name, &debtor.ChatID, &debtor.PaymentDate, &debtor.PaymentAmount); err != nil {
+			log.Printf("Error scanning debtor for reminders: %v", err)
+			continue
+		}
+		candidates = append(candidates, debtor)
+	}
+	rows.Close()
+
+	for _, debtor := range candidates {
+		settings := getChatSettings(debtor.ChatID)
+		if settings.ReminderDays == reminderDaysOff {
+			continue
+		}
+		now := time.Now().In(chatLocation(settings))
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		due := debtor.PaymentDate.Time
+		due = time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, time.UTC)
+
+		if today.After(due) {
+			// The date has passed without a reminder (e.g. it was set in the past); don't nag.
+			markDebtorReminded(debtor.ID, debtor.PaymentDate.Time)
+			continue
+		}
+		// Reminders falling on a weekend or holiday wait for the next business day, but never past the due date.
+		remindOn := nextBusinessDay(settings.HolidayCalendar, due.AddDate(0, 0, -settings.ReminderDays))
+		if remindOn.After(due) {
+			remindOn = due
+		}
+		if today.Before(remindOn) || now.Hour() < reminderHour {
+			continue
+		}
+
+		debts, err := listDebts(debtor.ID)
+		if err != nil {
+			log.Printf("Error listing debts for reminder: %v", err)
+			continue
+		}
+		var total Money
+		for _, debt := range debts {
+			total += debt.Amount
+		}
+		if total > 0 {
+			when := "сегодня"
+			if days := int(due.Sub(today).Hours() / 24); days == 1 {
+				when = "завтра"
+			} else if days > 1 {
+				when = fmt.Sprintf("через %d дн.", days)
+			}
+			text := fmt.Sprintf("🔔 *%s* %s (%s) должен вернуть долг.\n\nОбщая сумма долга: *%s*", escapeBold(debtor.Name), when, formatDate(settings, due), formatAmount(settings, total))
+			if debtor.PaymentAmount.Valid {
+				text += fmt.Sprintf("\nСумма платежа: *%s*", formatAmount(settings, debtor.PaymentAmount.V))
+			}
+			text += fmt.Sprintf("\n\n[Открыть карточку должника](%s)", debtorCardLink(bot, debtor.ID))
+			keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+				callbackButton("Открыть должника", fmt.Sprintf("select_debtor:%d", debtor.ID)),
+			))
+			sendToLedger(bot, debtor.ChatID, text, keyboard)
+		}
+		markDebtorReminded(debtor.ID, debtor.PaymentDate.Time)
+	}
+}
+
+// notifyOverdueDebtors repeats reminders for overdue debtors whose reminder
+// mode asks for it, for as long as they owe anything.
+func notifyOverdueDebtors(bot Sender) {
+	rows, err := DB.Query(`SELECT id, name, chat_id, payment_date, payment_amount_cents, reminder_mode, overdue_reminded_on FROM debtors
+        WHERE payment_date IS NOT NULL AND reminder_mode IN (?, ?)`, ReminderModeOverdueDaily, ReminderModeOverdueWeekly)
+	if err != nil {
+		log.Printf("Error listing debtors for overdue reminders: %v", err)
+		return
+	}
+	type candidate struct {
+		debtor       Debtor
+		mode         string
+		lastReminded sql.NullTime
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.debtor.ID, &c.debtor.Name, &c.debtor.ChatID, &c.debtor.PaymentDate, &c.debtor.PaymentAmount, &c.mode, &c.lastReminded); err != nil {
+			log.Printf("Error scanning debtor for overdue reminders: %v", err)
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+
+	for _, c := range candidates {
+		settings := getChatSettings(c.debtor.ChatID)
+		now := time.Now().In(chatLocation(settings))
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		due := c.debtor.PaymentDate.Time
+		due = time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, time.UTC)
+		if !today.After(due) || now.Hour() < reminderHour {
+			continue
+		}
+		if c.lastReminded.Valid && c.lastReminded.Time.After(due) && today.Before(c.lastReminded.Time.AddDate(0, 0, overdueReminderDays[c.mode])) {
+			continue
+		}
+
+		debts, err := listDebts(c.debtor.ID)
+		if err != nil {
+			log.Printf("Error listing debts for overdue reminder: %v", err)
+			continue
+		}
+		var total Money
+		for _, debt := range debts {
+			total += debt.Amount
+		}
+		if total > 0 {
+			days := int(today.Sub(due).Hours() / 24)
+			text := fmt.Sprintf("⏰ *%s* просрочил платёж на %d дн. (дата платежа %s).\n\nОбщая сумма долга: *%s*", escapeBold(c.debtor.Name), days, formatDate(settings, due), formatAmount(settings, total))
+			text += fmt.Sprintf("\n\n[Открыть карточку должника](%s)", debtorCardLink(bot, c.debtor.ID))
+			keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+				callbackButton("Открыть должника", fmt.Sprintf("select_debtor:%d", c.debtor.ID)),
+			))
+			sendToLedger(bot, c.debtor.ChatID, text, keyboard)
+		}
+		if _, err := DB.Exec("UPDATE debtors SET overdue_reminded_on = ? WHERE id = ?", today, c.debtor.ID); err != nil {
+			log.Printf("Error marking overdue reminder: %v", err)
+		}
+	}
+}
+
+func markDebtorReminded(debtorID int, paymentDate time.Time) {
+	if _, err := DB.Exec("UPDATE debtors SET reminded_for = ? WHERE id = ?", paymentDate, debtorID); err != nil {
+		log.Printf("Error marking debtor reminded: %v", err)
+	}
+}
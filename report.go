@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Annual Report ---
+
+// reportTopCounterparties is how many debtors the text summary lists.
+const reportTopCounterparties = 5
+
+// debtorPeriodTotals are one debtor's figures for a report period.
+type debtorPeriodTotals struct {
+	DebtorID    int
+	Name        string
+	Lent        Money
+	Repaid      Money
+	Interest    Money
+	Forgiven    Money
+	Outstanding Money
+	// Added and Closed count debts created and fully closed in the period.
+	Added  int
+	Closed int
+}
+
+type annualReport struct {
+	Year    int
+	Debtors []debtorPeriodTotals
+	Total   debtorPeriodTotals
+}
+
+func buildAnnualReport(chatID int64, year int) (annualReport, error) {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, chatLocation(getChatSettings(chatID)))
+	report, err := buildPeriodReport(chatID, start, start.AddDate(1, 0, 0))
+	report.Year = year
+	return report, err
+}
+
+// buildPeriodReport collects the figures for [start, end) from the debt_events
+// ledger, payments, loan payments and forgiven debts. Timestamps are stored in
+// mixed formats, so the period is checked in Go rather than in SQL.
+func buildPeriodReport(chatID int64, start, end time.Time) (annualReport, error) {
+	var report annualReport
+	inPeriod := func(t time.Time) bool { return !t.Before(start) && t.Before(end) }
+
+	// A debt is closed once its events add up to zero; lastEvent tells when.
+	type debtBalance struct {
+		debtorID  int
+		sum       Money
+		lastEvent time.Time
+	}
+	balances := make(map[int]*debtBalance)
+
+	totals := make(map[int]*debtorPeriodTotals)
+	rows, err := DB.Query("SELECT id, name FROM debtors WHERE chat_id = ?", ledgerChatID(chatID))
+	if err != nil {
+		return report, err
+	}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return report, err
+		}
+		totals[id] = &debtorPeriodTotals{DebtorID: id, Name: name}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	type entry struct {
+		debtID   int
+		debtorID int
+		kind     string
+		amount   Money
+		at       time.Time
+	}
+	queries := []string{
+		`SELECT e.debt_id, e.debtor_id, e.kind, e.amount_cents, e.created_at FROM debt_events e
+			JOIN debtors r ON r.id = e.debtor_id WHERE r.chat_id = ?`,
+		`SELECT 0, p.debtor_id, 'payment', p.amount_cents, p.paid_at FROM payments p
+			JOIN debtors r ON r.id = p.debtor_id WHERE r.chat_id = ?`,
+		`SELECT 0, l.debtor_id, 'interest', lp.interest_cents, lp.paid_at FROM loan_payments lp
+			JOIN loans l ON l.id = lp.loan_id
+			JOIN debtors r ON r.id = l.debtor_id WHERE r.chat_id = ?`,
+		`SELECT 0, f.debtor_id, 'forgiven', f.amount_cents, f.forgiven_at FROM forgiven_debts f
+			JOIN debtors r ON r.id = f.debtor_id WHERE r.chat_id = ?`,
+	}
+	for _, query := range queries {
+		rows, err := DB.Query(query, ledgerChatID(chatID))
+		if err != nil {
+			return report, err
+		}
+		var entries []entry
+		for rows.Next() {
+			var e entry
+			if err := rows.Scan(&e.debtID, &e.debtorID, &e.kind, &e.amount, &e.at); err != nil {
+				rows.Close()
+				return report, err
+			}
+			entries = append(entries, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return report, err
+		}
+
+		for _, e := range entries {
+			t, ok := totals[e.debtorID]
+			if !ok {
+				continue
+			}
+			switch e.kind {
+			case "payment":
+				if inPeriod(e.at) {
+					t.Repaid += e.amount
+				}
+			case "interest":
+				if inPeriod(e.at) {
+					t.Interest += e.amount
+				}
+			case "forgiven":
+				if inPeriod(e.at) {
+					t.Forgiven += e.amount
+				}
+			default:
+				if e.kind == "created" && inPeriod(e.at) {
+					t.Lent += e.amount
+					t.Added++
+				}
+				if e.at.Before(end) {
+					t.Outstanding += e.amount
+					b, ok := balances[e.debtID]
+					if !ok {
+						b = &debtBalance{debtorID: e.debtorID}
+						balances[e.debtID] = b
+					}
+					b.sum += e.amount
+					if e.at.After(b.lastEvent) {
+						b.lastEvent = e.at
+					}
+				}
+			}
+		}
+	}
+	for _, b := range balances {
+		if t, ok := totals[b.debtorID]; ok && b.sum == 0 && inPeriod(b.lastEvent) {
+			t.Closed++
+		}
+	}
+
+	for _, t := range totals {
+		if t.Lent == 0 && t.Repaid == 0 && t.Forgiven == 0 && t.Outstanding == 0 {
+			continue
+		}
+		report.Debtors = append(report.Debtors, *t)
+		report.Total.Lent += t.Lent
+		report.Total.Repaid += t.Repaid
+		report.Total.Interest += t.Interest
+		report.Total.Forgiven += t.Forgiven
+		report.Total.Outstanding += t.Outstanding
+		report.Total.Added += t.Added
+		report.Total.Closed += t.Closed
+	}
+	sort.Slice(report.Debtors, func(i, j int) bool {
+		a, b := report.Debtors[i], report.Debtors[j]
+		if a.Lent+a.Outstanding != b.Lent+b.Outstanding {
+			return a.Lent+a.Outstanding > b.Lent+b.Outstanding
+		}
+		return a.Name < b.Name
+	})
+	return report, nil
+}
+
+func annualReportText(settings ChatSettings, report annualReport) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("📊 *Итоги %d года*\n\n", report.Year))
+	if len(report.Debtors) == 0 {
+		text.WriteString("За этот год долгов не было.")
+		return text.String()
+	}
+	text.WriteString(fmt.Sprintf("Дано в долг: *%s*\n", formatAmount(settings, report.Total.Lent)))
+	text.WriteString(fmt.Sprintf("Возвращено: *%s*\n", formatAmount(settings, report.Total.Repaid)))
+	if report.Total.Interest > 0 {
+		text.WriteString(fmt.Sprintf("  в том числе проценты: %s\n", formatAmount(settings, report.Total.Interest)))
+	}
+	text.WriteString(fmt.Sprintf("Прощено: *%s*\n", formatAmount(settings, report.Total.Forgiven)))
+	text.WriteString(fmt.Sprintf("Остаток на конец года: *%s*\n", formatAmount(settings, report.Total.Outstanding)))
+
+	text.WriteString("\n*Главные должники:*\n")
+	for i, debtor := range report.Debtors {
+		if i == reportTopCounterparties {
+			break
+		}
+		text.WriteString(fmt.Sprintf("%d. *%s* — дано %s, остаток %s\n", i+1, escapeBold(debtor.Name), formatAmount(settings, debtor.Lent), formatAmount(settings, debtor.Outstanding)))
+	}
+	return text.String()
+}
+
+func generateReportXLSX(settings ChatSettings, report annualReport) (string, error) {
+	currency := " (" + settings.CurrencySymbol + ")"
+	summary := xlsxSheet{Name: "Итоги", Rows: [][]interface{}{
+		{"Показатель", "Сумма" + currency},
+		{"Дано в долг", report.Total.Lent},
+		{"Возвращено", report.Total.Repaid},
+		{"В том числе проценты", report.Total.Interest},
+		{"Прощено", report.Total.Forgiven},
+		{"Остаток на конец года", report.Total.Outstanding},
+	}}
+	debtors := xlsxSheet{Name: "Должники", Rows: [][]interface{}{
+		{"Должник", "Дано" + currency, "Возвращено" + currency, "Проценты" + currency, "Прощено" + currency, "Остаток" + currency},
+	}}
+	for _, d := range report.Debtors {
+		debtors.Rows = append(debtors.Rows, []interface{}{d.Name, d.Lent, d.Repaid, d.Interest, d.Forgiven, d.Outstanding})
+	}
+
+	tmpFile, err := os.CreateTemp("", fmt.Sprintf("report_%d_*.xlsx", report.Year))
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+	if err := writeXLSX(tmpFile, []xlsxSheet{summary, debtors}); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+	return tmpFile.Name(), nil
+}
+
+func handleReportCommand(bot Sender, chatID int64, args string) {
+	clearUserState(chatID)
+	settings := getChatSettings(chatID)
+	year := time.Now().In(chatLocation(settings)).Year()
+	if args = strings.TrimSpace(args); args != "" {
+		parsed, err := strconv.Atoi(args)
+		if err != nil || parsed < 1970 || parsed > year {
+			sendSimpleMessage(bot, chatID, fmt.Sprintf("Укажи год числом, например: /report %d", year-1))
+			return
+		}
+		year = parsed
+	}
+
+	report, err := buildAnnualReport(chatID, year)
+	if err != nil {
+		log.Printf("Error building annual report: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при подготовке отчёта.")
+		return
+	}
+	sendSimpleMessage(bot, chatID, annualReportText(settings, report))
+	if len(report.Debtors) == 0 {
+		return
+	}
+
+	sendChatAction(bot, chatID, tgbotapi.ChatUploadDocument)
+	filePath, err := generateReportXLSX(settings, report)
+	if err != nil {
+		log.Printf("Error generating report XLSX: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при создании файла отчёта.")
+		return
+	}
+	defer func() {
+		if err := os.Remove(filePath); err != nil {
+			log.Printf("Error deleting temp file: %v", err)
+		}
+	}()
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(filePath))
+	doc.Caption = fmt.Sprintf("Отчёт за %d год", year)
+	if _, err := sendChattable(bot, chatID, doc); err != nil {
+		log.Printf("Error sending report XLSX: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при отправке файла отчёта.")
+	}
+}
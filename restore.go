@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Restore From Export ---
+
+// /restore takes back a file exported with /exportcsv, or a JSON list of
+// debtors in the shape of the API with their debts, and adds what the ledger
+// is missing. Debts already present (same debtor, reason and amount) are
+// skipped, so restoring the same file twice changes nothing.
+
+const (
+	maxRestoreFileSize    = 5 << 20
+	fileDownloadTimeout   = 30 * time.Second
+	restorePreviewDebtors = 10
+)
+
+type restoreDebtor struct {
+	// ID is the existing debtor the debts are added to, 0 for a new one.
+	ID            int           `json:"-"`
+	Name          string        `json:"name"`
+	PaymentDate   *time.Time    `json:"payment_date,omitempty"`
+	PaymentAmount *Money        `json:"payment_amount,omitempty"`
+	Notes         string        `json:"notes,omitempty"`
+	Debts         []restoreDebt `json:"debts"`
+}
+
+type restoreDebt struct {
+	Amount    Money      `json:"amount"`
+	Reason    string     `json:"reason"`
+	Tag       string     `json:"tag,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// parseRestoreDate reads a date written in any of the formats a chat may use.
+func parseRestoreDate(settings ChatSettings, text string) (time.Time, bool) {
+	text = strings.TrimSpace(text)
+	for _, format := range append([]string{settings.DateFormat}, dateFormatPresets...) {
+		if t, err := time.Parse(format, text); err == nil {
+			return t, true
+		}
+	}
+	return parseDateInput(settings, text)
+}
+
+// parseRestoreCSV reads the debtor rows of a /exportcsv file. Columns are
+// found by their header, so files exported before a column was added still
+// load; the summary tables that follow the debtors are ignored.
+func parseRestoreCSV(settings ChatSettings, data []byte) ([]restoreDebtor, string) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, "Не удалось прочитать CSV файл."
+	}
+
+	columns := make(map[string]int)
+	for i, title := range records[0] {
+		name, _, _ := strings.Cut(title, " (")
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["Debtor Name"]; !ok {
+		return nil, "Это не похоже на выгрузку /exportcsv: нет столбца «Debtor Name»."
+	}
+
+	var debtors []restoreDebtor
+	byName := make(map[string]int)
+	for line, record := range records[1:] {
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if len(record) != len(records[0]) {
+			// The summary tables below the debtors are narrower.
+			break
+		}
+		name := value("Debtor Name")
+		if name == "" {
+			continue
+		}
+
+		i, ok := byName[name]
+		if !ok {
+			debtor := restoreDebtor{Name: name, Notes: value("Notes")}
+			if text := value("Payment Date"); text != "" {
+				t, ok := parseRestoreDate(settings, text)
+				if !ok {
+					return nil, fmt.Sprintf("Строка %d: не удалось разобрать дату платежа «%s».", line+2, escapeMarkdown(text))
+				}
+				debtor.PaymentDate = &t
+			}
+			if text := value("Payment Amount"); text != "" {
+				amount, err := parseChatAmount(settings, text)
+				if err != nil || amount <= 0 {
+					return nil, fmt.Sprintf("Строка %d: не удалось разобрать сумму платежа «%s».", line+2, escapeMarkdown(text))
+				}
+				debtor.PaymentAmount = &amount
+			}
+			i = len(debtors)
+			byName[name] = i
+			debtors = append(debtors, debtor)
+		}
+
+		amountText := value("Debt Amount")
+		if amountText == "" {
+			amountText = "0"
+		}
+		amount, err := parseChatAmount(settings, amountText)
+		if err != nil || amount < 0 {
+			return nil, fmt.Sprintf("Строка %d: не удалось разобрать сумму долга «%s».", line+2, escapeMarkdown(amountText))
+		}
+		if amount == 0 {
+			// A debtor without open debts.
+			continue
+		}
+		debt := restoreDebt{Amount: amount, Reason: value("Debt Reason"), Tag: value("Debt Tag")}
+		if text := value("Debt Created"); text != "" {
+			if t, ok := parseRestoreDate(settings, text); ok {
+				created := time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, chatLocation(settings))
+				debt.CreatedAt = &created
+			}
+		}
+		debtors[i].Debts = append(debtors[i].Debts, debt)
+	}
+	if len(debtors) == 0 {
+		return nil, "В файле нет должников."
+	}
+	return debtors, ""
+}
+
+// parseRestoreJSON accepts a list of debtors or an object with a "debtors" list.
+func parseRestoreJSON(data []byte) ([]restoreDebtor, string) {
+	var debtors []restoreDebtor
+	if err := json.Unmarshal(data, &debtors); err != nil {
+		var wrapped struct {
+			Debtors []restoreDebtor `json:"debtors"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			log.Printf("Error parsing restore JSON: %v", err)
+			return nil, "Не удалось прочитать JSON файл."
+		}
+		debtors = wrapped.Debtors
+	}
+
+	var valid []restoreDebtor
+	for _, debtor := range debtors {
+		debtor.Name = strings.TrimSpace(debtor.Name)
+		if debtor.Name == "" {
+			return nil, "В файле есть должник без имени."
+		}
+		if debtor.PaymentAmount != nil && *debtor.PaymentAmount <= 0 {
+			debtor.PaymentAmount = nil
+		}
+		var debts []restoreDebt
+		for _, debt := range debtor.Debts {
+			if debt.Amount < 0 {
+				return nil, fmt.Sprintf("У должника *%s* есть долг с отрицательной суммой.", escapeBold(debtor.Name))
+			}
+			if debt.Amount > 0 {
+				debts = append(debts, debt)
+			}
+		}
+		debtor.Debts = debts
+		valid = append(valid, debtor)
+	}
+	if len(valid) == 0 {
+		return nil, "В файле нет должников."
+	}
+	return valid, ""
+}
+
+// planRestore leaves out of the file what the ledger already has: debtors
+// are matched by name and debts by reason and amount. It returns what is left
+// to import and how many debts were skipped.
+func planRestore(chatID int64, imported []restoreDebtor) ([]restoreDebtor, int, error) {
+	existing, err := listDebtors(chatID)
+	if err != nil {
+		return nil, 0, err
+	}
+	byName := make(map[string]Debtor, len(existing))
+	for _, debtor := range existing {
+		byName[debtor.Name] = debtor
+	}
+
+	var plan []restoreDebtor
+	skipped := 0
+	for _, debtor := range imported {
+		present := make(map[string]int)
+		if current, ok := byName[debtor.Name]; ok {
+			debtor.ID = current.ID
+			debts, err := listDebts(current.ID)
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, debt := range debts {
+				present[fmt.Sprintf("%s|%d", debt.Reason, debt.Amount)]++
+			}
+		}
+		var missing []restoreDebt
+		for _, debt := range debtor.Debts {
+			key := fmt.Sprintf("%s|%d", debt.Reason, debt.Amount)
+			if present[key] > 0 {
+				present[key]--
+				skipped++
+				continue
+			}
+			missing = append(missing, debt)
+		}
+		debtor.Debts = missing
+		if debtor.ID == 0 || len(missing) > 0 {
+			plan = append(plan, debtor)
+		}
+	}
+	return plan, skipped, nil
+}
+
+// applyRestore imports the plan in one transaction. New debtors keep the
+// payment date, amount and notes from the file.
+func applyRestore(chatID int64, plan []restoreDebtor) error {
+	ledger := ledgerChatID(chatID)
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, debtor := range plan {
+		debtorID := debtor.ID
+		if debtorID == 0 {
+			var paymentAmount interface{}
+			if debtor.PaymentAmount != nil {
+				paymentAmount = *debtor.PaymentAmount
+			}
+			var paymentDate interface{}
+			if debtor.PaymentDate != nil {
+				paymentDate = *debtor.PaymentDate
+			}
+			if _, err := tx.Exec("INSERT OR IGNORE INTO debtors (name, chat_id, payment_date, payment_amount_cents, notes) VALUES (?, ?, ?, ?, ?)",
+				debtor.Name, ledger, paymentDate, paymentAmount, debtor.Notes); err != nil {
+				return fmt.Errorf("restore debtor %q: %w", debtor.Name, err)
+			}
+			if err := tx.QueryRow("SELECT id FROM debtors WHERE name = ? AND chat_id = ?", debtor.Name, ledger).Scan(&debtorID); err != nil {
+				return fmt.Errorf("restore debtor %q: %w", debtor.Name, err)
+			}
+		}
+		for _, debt := range debtor.Debts {
+			created := now
+			if debt.CreatedAt != nil {
+				created = *debt.CreatedAt
+			}
+			if _, err := tx.Exec("INSERT INTO debts (debtor_id, amount_cents, reason, tag, created_at) VALUES (?, ?, ?, ?, ?)",
+				debtorID, debt.Amount, debt.Reason, debt.Tag, created); err != nil {
+				return fmt.Errorf("restore debt of %q: %w", debtor.Name, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func restoreTotals(plan []restoreDebtor) (newDebtors, debts int, total Money) {
+	for _, debtor := range plan {
+		if debtor.ID == 0 {
+			newDebtors++
+		}
+		for _, debt := range debtor.Debts {
+			debts++
+			total += debt.Amount
+		}
+	}
+	return newDebtors, debts, total
+}
+
+func restorePreviewText(settings ChatSettings, imported, plan []restoreDebtor, skipped int) string {
+	fileDebts := 0
+	for _, debtor := range imported {
+		fileDebts += len(debtor.Debts)
+	}
+	newDebtors, debts, total := restoreTotals(plan)
+
+	var text strings.Builder
+	text.WriteString("📥 *Восстановление из файла*\n\n")
+	text.WriteString(fmt.Sprintf("В файле: должников — %d, долгов — %d.\n\n", len(imported), fileDebts))
+	text.WriteString("Будет добавлено:\n")
+	text.WriteString(fmt.Sprintf("- новых должников: %d\n", newDebtors))
+	text.WriteString(fmt.Sprintf("- долгов: %d на сумму *%s*\n", debts, formatAmount(settings, total)))
+	if skipped > 0 {
+		text.WriteString(fmt.Sprintf("\nУже есть и будут пропущены долгов: %d.\n", skipped))
+	}
+
+	text.WriteString("\n")
+	for i, debtor := range plan {
+		if i == restorePreviewDebtors {
+			text.WriteString(fmt.Sprintf("…и ещё %d\n", len(plan)-i))
+			break
+		}
+		var sum Money
+		for _, debt := range debtor.Debts {
+			sum += debt.Amount
+		}
+		marker := ""
+		if debtor.ID == 0 {
+			marker = " 🆕"
+		}
+		text.WriteString(fmt.Sprintf("- *%s*%s: %d, %s\n", escapeBold(debtor.Name), marker, len(debtor.Debts), formatAmount(settings, sum)))
+	}
+	return text.String()
+}
+
+func handleRestoreCommand(bot Sender, chatID int64) {
+	clearUserState(chatID)
+	setUserState(chatID, StateRestoringFromFile)
+	sendPrompt(bot, chatID, "Отправь файл, выгруженный через /exportcsv (или JSON со списком должников), — я покажу, что из него будет добавлено.")
+}
+
+// downloadFile fetches a file the user sent, refusing anything over limit bytes.
+func downloadFile(bot Sender, fileID string, limit int) ([]byte, error) {
+	url, err := bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: fileDownloadTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("file is too large")
+	}
+	return data, nil
+}
+
+func handleRestoreDocument(bot Sender, chatID int64, document *tgbotapi.Document) {
+	if document.FileSize > maxRestoreFileSize {
+		sendPrompt(bot, chatID, fmt.Sprintf("Файл слишком большой, максимум %d МБ.", maxRestoreFileSize>>20))
+		return
+	}
+	data, err := downloadFile(bot, document.FileID, maxRestoreFileSize)
+	if err != nil {
+		log.Printf("Error downloading restore file: %v", err)
+		sendPrompt(bot, chatID, "Не удалось скачать файл. Попробуй отправить его ещё раз.")
+		return
+	}
+
+	settings := getChatSettings(chatID)
+	var imported []restoreDebtor
+	var problem string
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		imported, problem = parseRestoreJSON(data)
+	} else {
+		imported, problem = parseRestoreCSV(settings, data)
+	}
+	if problem != "" {
+		sendPrompt(bot, chatID, problem+"\n\nОтправь другой файл или нажми «Отмена».")
+		return
+	}
+
+	plan, skipped, err := planRestore(chatID, imported)
+	if err != nil {
+		log.Printf("Error planning restore: %v", err)
+		clearUserState(chatID)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при сравнении файла с текущими данными.")
+		return
+	}
+	if len(plan) == 0 {
+		clearUserState(chatID)
+		sendSimpleMessage(bot, chatID, "Всё из этого файла уже есть — добавлять нечего.")
+		return
+	}
+
+	setRestore(chatID, plan)
+	setUserState(chatID, StateConfirmingRestore)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		callbackButton("✅ Импортировать", "restore_confirm"),
+		callbackButton("❌ Отмена", "cancel_operation"),
+	))
+	sendWithKeyboard(bot, chatID, restorePreviewText(settings, imported, plan, skipped), keyboard)
+}
+
+func handleRestoreConfirm(bot Sender, chatID int64, messageID int) {
+	session := getSession(chatID)
+	if session.State != StateConfirmingRestore || len(session.Restore) == 0 {
+		editMessageWithKeyboard(bot, chatID, messageID, "Эта операция уже завершена.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	clearUserState(chatID)
+
+	if err := applyRestore(chatID, session.Restore); err != nil {
+		log.Printf("Error restoring from file: %v", err)
+		editMessageWithKeyboard(bot, chatID, messageID, "Произошла ошибка при импорте, ничего не добавлено.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	newDebtors, debts, total := restoreTotals(session.Restore)
+	log.Printf("Restored %d debtors and %d debts from a file for chat %d", newDebtors, debts, chatID)
+	settings := getChatSettings(chatID)
+	editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("✅ Импорт завершён: новых должников — %d, долгов — %d на сумму *%s*. Посмотреть: /debts", newDebtors, debts, formatAmount(settings, total)), tgbotapi.InlineKeyboardMarkup{})
+	notifyCoOwners(bot, chatID, fmt.Sprintf("Импортированы данные из файла: долгов — %d на сумму *%s*.", debts, formatAmount(settings, total)))
+}
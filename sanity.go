@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Amount Sanity Checks ---
+
+const (
+	// An amount this many times above the chat's median needs confirmation,
+	// which catches misplaced decimal points ("50000" instead of "500.00").
+	sanityMedianFactor = 100
+	// The median is only trusted once the chat has this many amounts on record.
+	sanityMinSamples = 5
+)
+
+// chatMedianAmount returns the median of all debt and payment amounts in the chat.
+func chatMedianAmount(chatID int64) (Money, int, error) {
+	rows, err := DB.Query(`SELECT d.amount_cents FROM debts d JOIN debtors r ON r.id = d.debtor_id WHERE r.chat_id = ?
+        UNION ALL
+        SELECT p.amount_cents FROM payments p JOIN debtors r ON r.id = p.debtor_id WHERE r.chat_id = ?`, ledgerChatID(chatID), ledgerChatID(chatID))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	var amounts []Money
+	for rows.Next() {
+		var amount Money
+		if err := rows.Scan(&amount); err != nil {
+			return 0, 0, err
+		}
+		amounts = append(amounts, amount)
+	}
+	if err := rows.Err(); err != nil || len(amounts) == 0 {
+		return 0, 0, err
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i] < amounts[j] })
+	n := len(amounts)
+	if n%2 == 1 {
+		return amounts[n/2], n, nil
+	}
+	return (amounts[n/2-1] + amounts[n/2]) / 2, n, nil
+}
+
+func exceedsMaxDebt(settings ChatSettings, amount Money) bool {
+	return settings.MaxDebt > 0 && amount > settings.MaxDebt
+}
+
+// checkAmount validates an entered debt amount against the chat's maximum and
+// its history. It returns true when the caller may use the amount right away;
+// otherwise the user has been re-prompted or asked to confirm, and the flow
+// resumes in resumeAmountInput.
+func checkAmount(bot Sender, chatID int64, amount Money) bool {
+	settings := getChatSettings(chatID)
+	if exceedsMaxDebt(settings, amount) {
+		sendPrompt(bot, chatID, fmt.Sprintf("Сумма больше установленного максимума *%s*. Введи другую сумму или измени лимит в /settings.", formatAmount(settings, settings.MaxDebt)))
+		return false
+	}
+
+	median, samples, err := chatMedianAmount(chatID)
+	if err != nil {
+		log.Printf("Error calculating median amount: %v", err)
+		return true
+	}
+	if samples < sanityMinSamples || median <= 0 || amount < median*sanityMedianFactor {
+		return true
+	}
+
+	setPendingAmount(chatID, amount, getUserState(chatID))
+	setUserState(chatID, StateConfirmingLargeAmount)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton("✅ Да, всё верно", "amount_confirm"),
+			callbackButton("✏️ Ввести заново", "amount_retry"),
+		),
+		tgbotapi.NewInlineKeyboardRow(callbackButton("❌ Отмена", "cancel_operation")),
+	)
+	sendWithKeyboard(bot, chatID, fmt.Sprintf("⚠️ *%s* — это примерно в %.0f раз больше обычной суммы в этом чате (%s). Точно нет ошибки с запятой?",
+		formatAmount(settings, amount), float64(amount)/float64(median), formatAmount(settings, median)), keyboard)
+	return false
+}
+
+func handleAmountConfirmCallback(bot Sender, chatID int64, messageID int, data string) {
+	session := getSession(chatID)
+	if session.State != StateConfirmingLargeAmount {
+		editMessageWithKeyboard(bot, chatID, messageID, "Этот выбор уже неактуален.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	setUserState(chatID, session.PendingAmountState)
+
+	switch data {
+	case "amount_confirm":
+		editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("Сумма *%s* подтверждена.", formatChatAmount(chatID, session.PendingAmount)), tgbotapi.InlineKeyboardMarkup{})
+		resumeAmountInput(bot, chatID, session.PendingAmountState, session.PendingAmount)
+
+	case "amount_retry":
+		editPrompt(bot, chatID, messageID, "Введи сумму заново:")
+	}
+}
+
+// resumeAmountInput continues the flow that was interrupted by checkAmount.
+func resumeAmountInput(bot Sender, chatID int64, state int, amount Money) {
+	switch state {
+	case StateAddingDebtAmount:
+		finishAddDebt(bot, chatID, amount)
+	case StateEditingAmount:
+		finishEditAmount(bot, chatID, amount)
+	case StateAddingSplitAmount:
+		askSplitMode(bot, chatID, amount)
+	default:
+		log.Printf("Unexpected state %d after amount confirmation", state)
+		clearUserState(chatID)
+	}
+}
+
+// --- Max Debt Setting ---
+
+func handleMaxDebtInput(bot Sender, chatID int64, text string) {
+	settings := getChatSettings(chatID)
+	limit, err := parseAmount(settings, text)
+	if err != nil || limit < 0 {
+		sendPrompt(bot, chatID, tr(settings, "Введи максимальную сумму одного долга (положительное число) или 0, чтобы снять ограничение."))
+		return
+	}
+	clearUserState(chatID)
+	if err := updateChatMaxDebt(chatID, limit); err != nil {
+		log.Printf("Error updating max debt: %v", err)
+		sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить максимальную сумму."))
+		return
+	}
+	handleSettingsCommand(bot, chatID)
+}
@@ -0,0 +1,47 @@
+package main
+
+import "time"
+
+// --- Scheduler ---
+
+const schedulerInterval = time.Hour
+
+// startScheduler runs periodic background jobs until the returned stop
+// function is called. stop waits for a run in progress to finish.
+func startScheduler(bot Sender) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+		for {
+			runScheduledJobs(bot)
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func runScheduledJobs(bot Sender) {
+	recordSchedulerStarted()
+	defer recordSchedulerFinished()
+
+	notifyOverdueCosigners(bot)
+	notifyUpcomingPayments(bot)
+	notifyUpcomingInstallments(bot)
+	notifyOverdueDebtors(bot)
+	notifyBirthdays(bot)
+	runMonthlyDigests(bot)
+	runScheduledExports(bot)
+	runBackupIfDue(bot)
+	runArchiveIfDue()
+	purgeTrash()
+}
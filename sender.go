@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Sending Layer ---
+
+// Sender is the part of the Bot API the handlers use. In production it is a
+// telegramSender; fakeSender records the calls instead, for tests.
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+	// UserName is the bot's username, used to build t.me links.
+	UserName() string
+	// GetFileDirectURL returns the download URL of a file the user sent.
+	GetFileDirectURL(fileID string) (string, error)
+}
+
+type telegramSender struct {
+	*tgbotapi.BotAPI
+}
+
+func (s telegramSender) UserName() string {
+	return s.Self.UserName
+}
+
+// Telegram allows roughly one message per second per chat (with short bursts)
+// and about 30 messages per second overall.
+const (
+	perChatRate        = 1.0
+	perChatBurst       = 3.0
+	globalSendInterval = time.Second / 30
+	maxSendAttempts    = 5
+	initialSendBackoff = 500 * time.Millisecond
+	maxSendBackoff     = 30 * time.Second
+	// bucketSweepInterval is how often buckets of chats that have been quiet
+	// long enough to refill are dropped; a new bucket starts full anyway.
+	bucketSweepInterval = 10 * time.Minute
+)
+
+type chatBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var (
+	sendLimiterMu   sync.Mutex
+	chatBuckets     = make(map[int64]*chatBucket)
+	nextGlobalSend  time.Time
+	lastBucketSweep time.Time
+)
+
+// sweepChatBuckets drops the buckets that have refilled since their last
+// message. The caller holds sendLimiterMu.
+func sweepChatBuckets(now time.Time) {
+	for chatID, bucket := range chatBuckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*perChatRate >= perChatBurst {
+			delete(chatBuckets, chatID)
+		}
+	}
+	lastBucketSweep = now
+}
+
+// waitForSendSlot blocks until a message to chatID fits into both the per-chat
+// token bucket and the global rate limit.
+func waitForSendSlot(chatID int64) {
+	sendLimiterMu.Lock()
+	now := time.Now()
+	if now.Sub(lastBucketSweep) >= bucketSweepInterval {
+		sweepChatBuckets(now)
+	}
+
+	bucket, ok := chatBuckets[chatID]
+	if !ok {
+		bucket = &chatBucket{tokens: perChatBurst, last: now}
+		chatBuckets[chatID] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * perChatRate
+	if bucket.tokens > perChatBurst {
+		bucket.tokens = perChatBurst
+	}
+	bucket.last = now
+
+	slot := now
+	if bucket.tokens < 1 {
+		slot = now.Add(time.Duration((1 - bucket.tokens) / perChatRate * float64(time.Second)))
+	}
+	bucket.tokens--
+	if slot.Before(nextGlobalSend) {
+		slot = nextGlobalSend
+	}
+	nextGlobalSend = slot.Add(globalSendInterval)
+	sendLimiterMu.Unlock()
+
+	time.Sleep(time.Until(slot))
+}
+
+// withRetry runs a Telegram request, honoring retry_after on 429 responses and
+// backing off exponentially on transient (network or 5xx) failures.
+func withRetry(chatID int64, request func() error) error {
+	backoff := initialSendBackoff
+	var err error
+	for attempt := 1; attempt <= maxSendAttempts; attempt++ {
+		waitForSendSlot(chatID)
+		err = request()
+		if err == nil {
+			return nil
+		}
+
+		if !transientSendError(err) {
+			return err
+		}
+		wait := backoff
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			wait = time.Duration(apiErr.RetryAfter) * time.Second
+		}
+		if attempt == maxSendAttempts {
+			break
+		}
+		log.Printf("Telegram request to chat %d failed (attempt %d/%d), retrying in %s: %v", chatID, attempt, maxSendAttempts, wait, err)
+		time.Sleep(wait)
+		backoff *= 2
+		if backoff > maxSendBackoff {
+			backoff = maxSendBackoff
+		}
+	}
+	return err
+}
+
+// transientSendError reports whether a failed request may succeed later:
+// network errors, rate limiting and Telegram's own 5xx errors, including the
+// HTML error pages that come instead of a JSON response. Anything else,
+// such as a file that cannot be read or a request that cannot be encoded,
+// fails the same way on every attempt.
+func transientSendError(err error) bool {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.RetryAfter > 0 || apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= 500
+	}
+	var netErr net.Error
+	var urlErr *url.Error
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &netErr) || errors.As(err, &urlErr) || errors.As(err, &syntaxErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func sendChattable(bot Sender, chatID int64, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var message tgbotapi.Message
+	err := withRetry(chatID, func() error {
+		var err error
+		message, err = bot.Send(c)
+		return err
+	})
+	return message, err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestTransientSendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 3}}, true},
+		{"server error", &tgbotapi.Error{Code: 502, Message: "Bad Gateway"}, true},
+		{"bad request", &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}, false},
+		{"blocked", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, false},
+		{"network", &url.Error{Op: "Post", URL: "https://api.telegram.org", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{"timeout", &net.DNSError{IsTimeout: true}, true},
+		{"connection closed", fmt.Errorf("reading response: %w", io.ErrUnexpectedEOF), true},
+		{"error page", &json.SyntaxError{}, true},
+		{"unreadable file", &fs.PathError{Op: "open", Path: "/tmp/x.csv", Err: fs.ErrNotExist}, false},
+		{"encoding", &json.UnsupportedTypeError{}, false},
+		{"local", errors.New("can't build request"), false},
+	}
+	for _, tt := range tests {
+		if got := transientSendError(tt.err); got != tt.want {
+			t.Errorf("%s: transientSendError(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSweepChatBuckets(t *testing.T) {
+	now := time.Now()
+	sendLimiterMu.Lock()
+	defer sendLimiterMu.Unlock()
+	chatBuckets = map[int64]*chatBucket{
+		1: {tokens: perChatBurst - 1, last: now.Add(-time.Hour)},
+		2: {tokens: 0, last: now},
+		3: {tokens: -100, last: now.Add(-10 * time.Second)},
+	}
+	sweepChatBuckets(now)
+	if _, ok := chatBuckets[1]; ok {
+		t.Error("idle bucket was kept")
+	}
+	if _, ok := chatBuckets[2]; !ok {
+		t.Error("busy bucket was dropped")
+	}
+	if _, ok := chatBuckets[3]; !ok {
+		t.Error("bucket with queued messages was dropped")
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// --- Session State ---
+
+// Session holds the conversation state of a single chat. Updates are handled
+// concurrently, so sessions are only ever accessed through the functions below.
+type Session struct {
+	State             int
+	UpdatedAt         time.Time
+	Debtor            Debtor
+	HasDebtor         bool
+	Debt              Debt
+	PendingPayment    Money
+	HasPendingPayment bool
+	PendingName       string
+	SplitNames        []string
+	SplitReason       string
+	SplitTotal        Money
+	// PendingAmount waits for confirmation in StateConfirmingLargeAmount;
+	// PendingAmountState is the state to resume afterwards.
+	PendingAmount      Money
+	PendingAmountState int
+	LoanDraft          Loan
+	// BatchDebts are the debts added to Debtor since the current /add started.
+	BatchDebts []Debt
+	// Allocations are the ways offered to split PendingPayment across debts.
+	Allocations []allocationOption
+	// Restore is what /restore will import once the preview is confirmed.
+	Restore []restoreDebtor
+	// QuickAddAmount and QuickAddReason wait for the debtor to be picked
+	// when a one-line /add names someone similar to an existing debtor.
+	QuickAddAmount Money
+	QuickAddReason string
+	// InstallmentCount and InstallmentStart describe the plan being set up for Debt.
+	InstallmentCount int
+	InstallmentStart time.Time
+	// BroadcastMessageID is the owner's message that /broadcast will copy to every chat.
+	BroadcastMessageID int
+	// Nav is the stack of inline screens behind the Back buttons; see navigation.go.
+	Nav []navScreen
+}
+
+var (
+	sessionsMu sync.Mutex
+	sessions   = make(map[int64]*Session)
+)
+
+// updateSession runs fn on the chat's session, creating it if necessary.
+func updateSession(chatID int64, fn func(s *Session)) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := sessions[chatID]
+	if !ok {
+		s = &Session{}
+		sessions[chatID] = s
+	}
+	fn(s)
+}
+
+// getSession returns a copy of the chat's session.
+func getSession(chatID int64) Session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if s, ok := sessions[chatID]; ok {
+		return *s
+	}
+	return Session{}
+}
+
+func getUserState(chatID int64) int {
+	return getSession(chatID).State
+}
+
+func setUserState(chatID int64, state int) {
+	updateSession(chatID, func(s *Session) {
+		s.State = state
+		s.UpdatedAt = time.Now()
+	})
+}
+
+func stateExpired(chatID int64) bool {
+	s := getSession(chatID)
+	if s.State == StateIdle {
+		return false
+	}
+	return time.Since(s.UpdatedAt) > config.StateTTL
+}
+
+// clearUserState ends the current conversation step. The navigation stack is
+// kept, so Back still works on the screens shown before.
+func clearUserState(chatID int64) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if s, ok := sessions[chatID]; ok && len(s.Nav) > 0 {
+		sessions[chatID] = &Session{Nav: s.Nav}
+		return
+	}
+	delete(sessions, chatID)
+}
+
+// forgetSession drops the session together with the navigation stack.
+func forgetSession(chatID int64) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	delete(sessions, chatID)
+}
+
+func currentDebtor(chatID int64) Debtor {
+	return getSession(chatID).Debtor
+}
+
+func lookupCurrentDebtor(chatID int64) (Debtor, bool) {
+	s := getSession(chatID)
+	return s.Debtor, s.HasDebtor
+}
+
+func setCurrentDebtor(chatID int64, debtor Debtor) {
+	updateSession(chatID, func(s *Session) {
+		s.Debtor = debtor
+		s.HasDebtor = true
+	})
+}
+
+func selectedDebt(chatID int64) Debt {
+	return getSession(chatID).Debt
+}
+
+func setSelectedDebt(chatID int64, debt Debt) {
+	updateSession(chatID, func(s *Session) {
+		s.Debt = debt
+	})
+}
+
+func pendingPayment(chatID int64) (Money, bool) {
+	s := getSession(chatID)
+	return s.PendingPayment, s.HasPendingPayment
+}
+
+func setPendingPayment(chatID int64, amount Money) {
+	updateSession(chatID, func(s *Session) {
+		s.PendingPayment = amount
+		s.HasPendingPayment = true
+	})
+}
+
+func pendingName(chatID int64) string {
+	return getSession(chatID).PendingName
+}
+
+func setPendingName(chatID int64, name string) {
+	updateSession(chatID, func(s *Session) {
+		s.PendingName = name
+	})
+}
+
+func setSplitNames(chatID int64, names []string) {
+	updateSession(chatID, func(s *Session) {
+		s.SplitNames = names
+	})
+}
+
+func setSplitReason(chatID int64, reason string) {
+	updateSession(chatID, func(s *Session) {
+		s.SplitReason = reason
+	})
+}
+
+func setSplitTotal(chatID int64, total Money) {
+	updateSession(chatID, func(s *Session) {
+		s.SplitTotal = total
+	})
+}
+
+func setPendingAmount(chatID int64, amount Money, resumeState int) {
+	updateSession(chatID, func(s *Session) {
+		s.PendingAmount = amount
+		s.PendingAmountState = resumeState
+	})
+}
+
+// addBatchDebt records a debt added in the current batch and leaves the
+// conversation idle while keeping the debtor for "add another debt".
+func addBatchDebt(chatID int64, debt Debt) {
+	updateSession(chatID, func(s *Session) {
+		s.State = StateIdle
+		s.BatchDebts = append(s.BatchDebts, debt)
+	})
+}
+
+func setAllocations(chatID int64, options []allocationOption) {
+	updateSession(chatID, func(s *Session) {
+		s.Allocations = options
+	})
+}
+
+func setRestore(chatID int64, debtors []restoreDebtor) {
+	updateSession(chatID, func(s *Session) {
+		s.Restore = debtors
+	})
+}
+
+func setPendingQuickAdd(chatID int64, amount Money, reason string) {
+	updateSession(chatID, func(s *Session) {
+		s.QuickAddAmount = amount
+		s.QuickAddReason = reason
+	})
+}
+
+func setInstallmentDraft(chatID int64, count int, start time.Time) {
+	updateSession(chatID, func(s *Session) {
+		s.InstallmentCount = count
+		s.InstallmentStart = start
+	})
+}
+
+func setBroadcastMessage(chatID int64, messageID int) {
+	updateSession(chatID, func(s *Session) {
+		s.BroadcastMessageID = messageID
+	})
+}
+
+func pendingQuickAdd(chatID int64) (Money, string, bool) {
+	s := getSession(chatID)
+	return s.QuickAddAmount, s.QuickAddReason, s.QuickAddAmount > 0
+}
+
+func setLoanDraft(chatID int64, loan Loan) {
+	updateSession(chatID, func(s *Session) {
+		s.LoanDraft = loan
+	})
+}
+
+// detailsMessage is the debtor card last shown in a chat. It outlives the
+// session, so that the card can be refreshed in place once a flow started
+// from it is finished.
+type detailsMessage struct {
+	MessageID int
+	DebtorID  int
+	Page      int
+}
+
+var (
+	detailsMessagesMu sync.Mutex
+	detailsMessages   = make(map[int64]detailsMessage)
+)
+
+func getDetailsMessage(chatID int64) (detailsMessage, bool) {
+	detailsMessagesMu.Lock()
+	defer detailsMessagesMu.Unlock()
+	card, ok := detailsMessages[chatID]
+	return card, ok
+}
+
+func setDetailsMessage(chatID int64, card detailsMessage) {
+	detailsMessagesMu.Lock()
+	defer detailsMessagesMu.Unlock()
+	detailsMessages[chatID] = card
+}
+
+// releaseDetailsMessage stops refreshing messageID when it has been turned
+// into something worth keeping, such as a receipt.
+func releaseDetailsMessage(chatID int64, messageID int) {
+	detailsMessagesMu.Lock()
+	defer detailsMessagesMu.Unlock()
+	if card, ok := detailsMessages[chatID]; ok && card.MessageID == messageID {
+		delete(detailsMessages, chatID)
+	}
+}
+
+func forgetDetailsMessage(chatID int64) {
+	detailsMessagesMu.Lock()
+	defer detailsMessagesMu.Unlock()
+	delete(detailsMessages, chatID)
+}
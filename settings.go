@@ -0,0 +1,843 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Chat Settings ---
+
+type ChatSettings struct {
+	ChatID int64
+	// Language is the language of the menus; see i18n.go.
+	Language         string
+	CurrencySymbol   string
+	CurrencyDecimals int
+	// NumberFormat picks the thousand separator and decimal mark; see numberFormats.
+	NumberFormat    string
+	HolidayCalendar string
+	DateFormat      string
+	// Timezone is an IANA zone name; empty means the server's local time.
+	Timezone string
+	// ReminderDays is how many days before a payment date the owner is
+	// reminded; reminderDaysOff disables reminders.
+	ReminderDays int
+	DebtorSort   string
+	// DebtSort orders a debtor's debts by age.
+	DebtSort string
+	// MaxDebt caps a single debt amount; 0 means no limit.
+	MaxDebt       Money
+	MonthlyDigest bool
+	// AllocationStrategy splits debtor-level payments across debts.
+	AllocationStrategy string
+	// ExportSchedule turns on automatic exports; see autoexport.go.
+	ExportSchedule string
+	ExportHour     int
+	ExportFormat   string
+	// PaymentTemplate and PaymentAccount build payment QR codes; see payqr.go.
+	PaymentTemplate string
+	PaymentAccount  string
+}
+
+const (
+	defaultCurrencySymbol   = "₽"
+	defaultCurrencyDecimals = 2
+	maxCurrencySymbolLength = 5
+	defaultDateFormat       = "02.01.2006"
+	defaultReminderDays     = 1
+	reminderDaysOff         = -1
+)
+
+const (
+	NumberFormatPlain      = "plain"
+	NumberFormatSpaceComma = "space_comma"
+	NumberFormatCommaDot   = "comma_dot"
+	NumberFormatDotComma   = "dot_comma"
+)
+
+type numberSeparators struct {
+	Group   string
+	Decimal string
+}
+
+var numberFormatOrder = []string{NumberFormatPlain, NumberFormatSpaceComma, NumberFormatCommaDot, NumberFormatDotComma}
+
+// The space is a no-break one, so an amount never wraps across lines.
+var numberFormats = map[string]numberSeparators{
+	NumberFormatPlain:      {Group: "", Decimal: "."},
+	NumberFormatSpaceComma: {Group: "\u00a0", Decimal: ","},
+	NumberFormatCommaDot:   {Group: ",", Decimal: "."},
+	NumberFormatDotComma:   {Group: ".", Decimal: ","},
+}
+
+const (
+	DebtorSortName   = "name"
+	DebtorSortAmount = "amount"
+	DebtorSortDate   = "date"
+)
+
+const (
+	DebtSortOldest = "oldest"
+	DebtSortNewest = "newest"
+)
+
+const (
+	AllocationOldest       = "oldest"
+	AllocationLargest      = "largest"
+	AllocationProportional = "proportional"
+)
+
+var currencyPresets = []string{"₽", "$", "€", "₸", "₴", "Br", "£"}
+
+var dateFormatPresets = []string{"02.01.2006", "2006-01-02", "02/01/2006", "01/02/2006"}
+
+var timezonePresets = []string{"", "Europe/Kaliningrad", "Europe/Moscow", "Europe/Samara", "Asia/Yekaterinburg", "Asia/Omsk",
+	"Asia/Novosibirsk", "Asia/Krasnoyarsk", "Asia/Irkutsk", "Asia/Vladivostok", "Europe/Minsk", "Asia/Almaty", "UTC"}
+
+var reminderDaysPresets = []int{reminderDaysOff, 0, 1, 3, 7}
+
+var debtorSortOrder = []string{DebtorSortName, DebtorSortAmount, DebtorSortDate}
+
+var debtorSortNames = map[string]string{
+	DebtorSortName:   "По имени",
+	DebtorSortAmount: "По сумме долга",
+	DebtorSortDate:   "По дате платежа",
+}
+
+var debtSortOrder = []string{DebtSortOldest, DebtSortNewest}
+
+var debtSortNames = map[string]string{
+	DebtSortOldest: "Сначала старые",
+	DebtSortNewest: "Сначала новые",
+}
+
+var allocationStrategyOrder = []string{AllocationOldest, AllocationLargest, AllocationProportional}
+
+var allocationStrategyNames = map[string]string{
+	AllocationOldest:       "Сначала старые долги",
+	AllocationLargest:      "Сначала крупные долги",
+	AllocationProportional: "Пропорционально суммам",
+}
+
+func defaultChatSettings(chatID int64) ChatSettings {
+	return ChatSettings{
+		ChatID:             chatID,
+		Language:           LanguageRussian,
+		CurrencySymbol:     defaultCurrencySymbol,
+		CurrencyDecimals:   defaultCurrencyDecimals,
+		NumberFormat:       NumberFormatPlain,
+		HolidayCalendar:    defaultHolidayCalendar,
+		DateFormat:         config.DefaultDateFormat,
+		ReminderDays:       defaultReminderDays,
+		DebtorSort:         DebtorSortName,
+		DebtSort:           DebtSortOldest,
+		MonthlyDigest:      true,
+		AllocationStrategy: AllocationOldest,
+		ExportHour:         defaultExportHour,
+		ExportFormat:       ExportFormatCSV,
+	}
+}
+
+func getChatSettings(chatID int64) ChatSettings {
+	settings := defaultChatSettings(chatID)
+	err := DB.QueryRow("SELECT language, currency_symbol, currency_decimals, number_format, holiday_calendar, date_format, timezone, reminder_days, debtor_sort, debt_sort, max_debt_cents, monthly_digest, allocation_strategy, export_schedule, export_hour, export_format, payment_template, payment_account FROM chat_settings WHERE chat_id = ?", ledgerChatID(chatID)).
+		Scan(&settings.Language, &settings.CurrencySymbol, &settings.CurrencyDecimals, &settings.NumberFormat, &settings.HolidayCalendar, &settings.DateFormat, &settings.Timezone, &settings.ReminderDays, &settings.DebtorSort, &settings.DebtSort, &settings.MaxDebt, &settings.MonthlyDigest, &settings.AllocationStrategy, &settings.ExportSchedule, &settings.ExportHour, &settings.ExportFormat, &settings.PaymentTemplate, &settings.PaymentAccount)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error getting chat settings: %v", err)
+		return defaultChatSettings(chatID)
+	}
+	return settings
+}
+
+// upsertChatSetting stores a single chat_settings column. column must be a
+// constant from this file, never user input.
+func upsertChatSetting(chatID int64, column string, value interface{}) error {
+	// A new row starts with the configured date format rather than the
+	// column default, so that saving another setting does not change it.
+	chatID = ledgerChatID(chatID)
+	if _, err := DB.Exec("INSERT OR IGNORE INTO chat_settings (chat_id, date_format) VALUES (?, ?)", chatID, config.DefaultDateFormat); err != nil {
+		return err
+	}
+	_, err := DB.Exec(fmt.Sprintf("UPDATE chat_settings SET %s = ? WHERE chat_id = ?", column), value, chatID)
+	return err
+}
+
+func updateChatLanguage(chatID int64, language string) error {
+	return upsertChatSetting(chatID, "language", language)
+}
+
+func updateChatCurrencySymbol(chatID int64, symbol string) error {
+	return upsertChatSetting(chatID, "currency_symbol", symbol)
+}
+
+func updateChatCurrencyDecimals(chatID int64, decimals int) error {
+	return upsertChatSetting(chatID, "currency_decimals", decimals)
+}
+
+func updateChatNumberFormat(chatID int64, format string) error {
+	return upsertChatSetting(chatID, "number_format", format)
+}
+
+func updateChatHolidayCalendar(chatID int64, calendar string) error {
+	return upsertChatSetting(chatID, "holiday_calendar", calendar)
+}
+
+func updateChatDateFormat(chatID int64, format string) error {
+	return upsertChatSetting(chatID, "date_format", format)
+}
+
+func updateChatTimezone(chatID int64, timezone string) error {
+	return upsertChatSetting(chatID, "timezone", timezone)
+}
+
+func updateChatReminderDays(chatID int64, days int) error {
+	return upsertChatSetting(chatID, "reminder_days", days)
+}
+
+func updateChatDebtorSort(chatID int64, sortOrder string) error {
+	return upsertChatSetting(chatID, "debtor_sort", sortOrder)
+}
+
+func updateChatDebtSort(chatID int64, sortOrder string) error {
+	return upsertChatSetting(chatID, "debt_sort", sortOrder)
+}
+
+func updateChatMaxDebt(chatID int64, limit Money) error {
+	return upsertChatSetting(chatID, "max_debt_cents", limit)
+}
+
+func updateChatAllocationStrategy(chatID int64, strategy string) error {
+	return upsertChatSetting(chatID, "allocation_strategy", strategy)
+}
+
+func updateChatMonthlyDigest(chatID int64, enabled bool) error {
+	return upsertChatSetting(chatID, "monthly_digest", enabled)
+}
+
+// --- Amount Formatting ---
+
+// numberSeparatorsFor returns the chat's separators, the plain ones for an unknown format.
+func numberSeparatorsFor(settings ChatSettings) numberSeparators {
+	if separators, ok := numberFormats[settings.NumberFormat]; ok {
+		return separators
+	}
+	return numberFormats[NumberFormatPlain]
+}
+
+// groupDigits inserts separator between groups of three digits.
+func groupDigits(digits, separator string) string {
+	if separator == "" || len(digits) <= 3 {
+		return digits
+	}
+	var grouped strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteString(separator)
+		}
+		grouped.WriteRune(digit)
+	}
+	return grouped.String()
+}
+
+// formatNumber renders an amount with the chat's number of decimals (0-2) and
+// separators, rounding half away from zero. Every amount shown to users or
+// written to a CSV file goes through it.
+func formatNumber(settings ChatSettings, amount Money) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	unit := Money(1)
+	for i := settings.CurrencyDecimals; i < 2; i++ {
+		unit *= 10
+	}
+	amount = (amount + unit/2) / unit * unit
+	if amount == 0 {
+		sign = ""
+	}
+	separators := numberSeparatorsFor(settings)
+	whole, cents := groupDigits(strconv.FormatInt(int64(amount/100), 10), separators.Group), amount%100
+	switch settings.CurrencyDecimals {
+	case 0:
+		return sign + whole
+	case 1:
+		return fmt.Sprintf("%s%s%s%d", sign, whole, separators.Decimal, cents/10)
+	default:
+		return fmt.Sprintf("%s%s%s%02d", sign, whole, separators.Decimal, cents)
+	}
+}
+
+// formatRate renders a percentage such as a loan rate with the chat's decimal mark.
+func formatRate(settings ChatSettings, rate float64) string {
+	return strings.Replace(strconv.FormatFloat(rate, 'f', -1, 64), ".", numberSeparatorsFor(settings).Decimal, 1)
+}
+
+// parseChatAmount reads an amount written by formatNumber for the chat, such
+// as one in an exported file, where "1,234" may be a thousand or a decimal.
+func parseChatAmount(settings ChatSettings, text string) (Money, error) {
+	separators := numberSeparatorsFor(settings)
+	if separators.Group != "" {
+		text = strings.ReplaceAll(text, separators.Group, "")
+	}
+	return parseAmount(settings, strings.ReplaceAll(text, separators.Decimal, "."))
+}
+
+func formatAmount(settings ChatSettings, amount Money) string {
+	return fmt.Sprintf("%s %s", formatNumber(settings, amount), settings.CurrencySymbol)
+}
+
+func formatChatAmount(chatID int64, amount Money) string {
+	return formatAmount(getChatSettings(chatID), amount)
+}
+
+// --- Date Formatting ---
+
+// chatLocation returns the chat's timezone, falling back to the server's.
+func chatLocation(settings ChatSettings) *time.Location {
+	if settings.Timezone == "" {
+		return time.Local
+	}
+	if offset, ok := parseUTCOffset(settings.Timezone); ok {
+		return time.FixedZone(settings.Timezone, offset)
+	}
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		log.Printf("Error loading timezone %q: %v", settings.Timezone, err)
+		return time.Local
+	}
+	return loc
+}
+
+// formatDate renders a calendar date such as a payment date. These are stored
+// without a zone, so no timezone conversion is applied.
+func formatDate(settings ChatSettings, t time.Time) string {
+	return t.Format(settings.DateFormat)
+}
+
+// formatDateTime renders a moment in time in the chat's timezone.
+func formatDateTime(settings ChatSettings, t time.Time) string {
+	return t.In(chatLocation(settings)).Format(settings.DateFormat + " 15:04")
+}
+
+func formatChatDate(chatID int64, t time.Time) string {
+	return formatDate(getChatSettings(chatID), t)
+}
+
+// dayMonthFormat is the chat's date format without the year, for birthdays.
+func dayMonthFormat(settings ChatSettings) string {
+	return strings.Trim(strings.Replace(settings.DateFormat, "2006", "", 1), ".-/")
+}
+
+// dateInputHint describes the chat's date format in prompts, e.g. "ДД.ММ.ГГГГ, например 31.12.2024".
+func dateInputHint(settings ChatSettings) string {
+	layout := strings.NewReplacer("2006", "ГГГГ", "02", "ДД", "01", "ММ").Replace(settings.DateFormat)
+	return fmt.Sprintf("%s, например %s", layout, formatDate(settings, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)))
+}
+
+// formatDays renders a number of days with the right Russian plural form.
+func formatDays(n int) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return fmt.Sprintf("%d день", n)
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return fmt.Sprintf("%d дня", n)
+	}
+	return fmt.Sprintf("%d дней", n)
+}
+
+// debtAgeText renders when a debt was created and how old it is, e.g.
+// "с 12.03.2025, 45 дней"; it is empty if the creation time is unknown.
+func debtAgeText(settings ChatSettings, debt Debt, now time.Time) string {
+	if !debt.CreatedAt.Valid {
+		return ""
+	}
+	loc := chatLocation(settings)
+	created := debt.CreatedAt.Time.In(loc)
+	now = now.In(loc)
+	days := int(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).
+		Sub(time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, time.UTC)).Hours() / 24)
+	if days <= 0 {
+		return fmt.Sprintf("с %s, сегодня", formatDate(settings, created))
+	}
+	return fmt.Sprintf("с %s, %s", formatDate(settings, created), formatDays(days))
+}
+
+func timezoneName(timezone string) string {
+	if timezone == "" {
+		return "Время сервера"
+	}
+	// Underscores in zone names would break Markdown.
+	return strings.ReplaceAll(timezone, "_", " ")
+}
+
+// parseUTCOffset parses a fixed offset such as "UTC+3", "GMT-04:30" or "+5"
+// into seconds east of UTC.
+func parseUTCOffset(text string) (int, bool) {
+	text = strings.ToUpper(strings.TrimSpace(text))
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "UTC"), "GMT")
+	if len(text) < 2 || (text[0] != '+' && text[0] != '-') {
+		return 0, false
+	}
+	sign := 1
+	if text[0] == '-' {
+		sign = -1
+	}
+	hoursText, minutesText, hasMinutes := strings.Cut(text[1:], ":")
+	hours, err := strconv.Atoi(hoursText)
+	if err != nil || hours > 14 {
+		return 0, false
+	}
+	minutes := 0
+	if hasMinutes {
+		if minutes, err = strconv.Atoi(minutesText); err != nil || minutes < 0 || minutes >= 60 {
+			return 0, false
+		}
+	}
+	return sign * (hours*3600 + minutes*60), true
+}
+
+// parseTimezone accepts an IANA zone name or a UTC offset and returns the
+// value to store; offsets are normalized to "UTC+03:00".
+func parseTimezone(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if offset, ok := parseUTCOffset(text); ok {
+		sign := "+"
+		if offset < 0 {
+			sign, offset = "-", -offset
+		}
+		return fmt.Sprintf("UTC%s%02d:%02d", sign, offset/3600, offset%3600/60), true
+	}
+	if text == "" || strings.EqualFold(text, "Local") || strings.ContainsAny(text, "*[]`") {
+		return "", false
+	}
+	if _, err := time.LoadLocation(text); err != nil {
+		return "", false
+	}
+	return text, true
+}
+
+func maxDebtText(settings ChatSettings) string {
+	if settings.MaxDebt <= 0 {
+		return tr(settings, "без ограничения")
+	}
+	return formatAmount(settings, settings.MaxDebt)
+}
+
+func enabledText(enabled bool) string {
+	if enabled {
+		return "включена"
+	}
+	return "выключена"
+}
+
+func reminderDaysText(settings ChatSettings, days int) string {
+	switch days {
+	case reminderDaysOff:
+		return tr(settings, "выключены")
+	case 0:
+		return tr(settings, "в день платежа")
+	}
+	return trf(settings, "за %d дн. до платежа", days)
+}
+
+// --- Settings Handlers ---
+
+func handleSettingsCommand(bot Sender, chatID int64) {
+	clearUserState(chatID)
+	text, keyboard := settingsMenu(chatID)
+	sendWithKeyboard(bot, chatID, text, keyboard)
+}
+
+func settingsMenu(chatID int64) (string, tgbotapi.InlineKeyboardMarkup) {
+	settings := getChatSettings(chatID)
+	text := tr(settings, "*Настройки*\n\n") +
+		trf(settings, "Язык: *%s*\n", languageNames[settings.Language]) +
+		trf(settings, "Валюта: *%s*\n", settings.CurrencySymbol) +
+		trf(settings, "Знаков после запятой: *%d*\n", settings.CurrencyDecimals) +
+		trf(settings, "Пример: %s\n\n", formatAmount(settings, 123450)) +
+		trf(settings, "Календарь уведомлений: *%s* — %s\n\n", tr(settings, holidayCalendars[settings.HolidayCalendar].Name), tr(settings, holidayRuleText(settings.HolidayCalendar))) +
+		trf(settings, "Формат даты: *%s*\n", formatDate(settings, time.Now().In(chatLocation(settings)))) +
+		trf(settings, "Часовой пояс: *%s*\n", tr(settings, timezoneName(settings.Timezone))) +
+		trf(settings, "Напоминания о платежах: *%s*\n", reminderDaysText(settings, settings.ReminderDays)) +
+		trf(settings, "Сводка за месяц: *%s*\n", tr(settings, enabledText(settings.MonthlyDigest))) +
+		trf(settings, "Автовыгрузка: *%s*\n", exportScheduleText(settings)) +
+		trf(settings, "Сортировка должников: *%s*\n", tr(settings, debtorSortNames[settings.DebtorSort])) +
+		trf(settings, "Порядок долгов: *%s*\n", tr(settings, debtSortNames[settings.DebtSort])) +
+		trf(settings, "Распределение платежей: *%s*\n", tr(settings, allocationStrategyNames[settings.AllocationStrategy])) +
+		trf(settings, "QR для оплаты: *%s*\n", paymentQRStatusText(settings)) +
+		trf(settings, "Максимальная сумма долга: *%s*", maxDebtText(settings))
+
+	button := func(text, data string) tgbotapi.InlineKeyboardButton {
+		return callbackButton(tr(settings, text), data)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			button("🌐 Язык", "settings_language"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("💱 Валюта", "settings_currency"),
+			button("🔢 Знаки после запятой", "settings_decimals"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("🔣 Формат чисел", "settings_numfmt"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("📅 Календарь уведомлений", "settings_holidays"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("📆 Формат даты", "settings_dateformat"),
+			button("🕒 Часовой пояс", "settings_timezone"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("🔔 Напоминания", "settings_reminders"),
+			button("↕️ Сортировка", "settings_sort"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("⏳ Порядок долгов", "settings_debtsort"),
+			button("⚖️ Распределение платежей", "settings_allocation"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("📤 Автовыгрузка", "settings_export"),
+			button("📷 QR для оплаты", "settings_payqr"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("🚧 Максимальная сумма", "settings_maxdebt"),
+			button("🗓 Сводка за месяц", "settings_digest"),
+		),
+	)
+	return text, keyboard
+}
+
+func handleSettingsCallback(bot Sender, chatID int64, messageID int, data string) {
+	settings := getChatSettings(chatID)
+	switch {
+	case data == "settings_language":
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, language := range languageOrder {
+			label := markSelected(languageNames[language], language == settings.Language)
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(label, "set_language:"+language)))
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, tr(settings, "На каком языке показывать меню?"), tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case strings.HasPrefix(data, "set_language:"):
+		language := strings.TrimPrefix(data, "set_language:")
+		if _, ok := languageNames[language]; !ok {
+			log.Printf("Invalid language in callback: %s", data)
+			return
+		}
+		if err := updateChatLanguage(chatID, language); err != nil {
+			log.Printf("Error updating language: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить язык."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case data == "settings_currency":
+		var row []tgbotapi.InlineKeyboardButton
+		for _, symbol := range currencyPresets {
+			row = append(row, callbackButton(symbol, "set_currency:"+symbol))
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			row,
+			tgbotapi.NewInlineKeyboardRow(callbackButton(tr(settings, "✍️ Другой символ"), "set_currency_custom")),
+		)
+		editMessageWithKeyboard(bot, chatID, messageID, tr(settings, "Выбери валюту:"), keyboard)
+
+	case data == "set_currency_custom":
+		setUserState(chatID, StateSettingCurrencySymbol)
+		editPrompt(bot, chatID, messageID, trf(settings, "Введи символ валюты (не длиннее %d символов):", maxCurrencySymbolLength))
+
+	case strings.HasPrefix(data, "set_currency:"):
+		symbol := strings.TrimPrefix(data, "set_currency:")
+		if !slices.Contains(currencyPresets, symbol) {
+			log.Printf("Invalid currency symbol in callback: %s", data)
+			return
+		}
+		if err := updateChatCurrencySymbol(chatID, symbol); err != nil {
+			log.Printf("Error updating currency symbol: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить валюту."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case data == "settings_decimals":
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				callbackButton("0", "set_decimals:0"),
+				callbackButton("1", "set_decimals:1"),
+				callbackButton("2", "set_decimals:2"),
+			),
+		)
+		editMessageWithKeyboard(bot, chatID, messageID, tr(settings, "Сколько знаков после запятой показывать?"), keyboard)
+
+	case data == "settings_numfmt":
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, format := range numberFormatOrder {
+			sample := settings
+			sample.NumberFormat = format
+			label := markSelected(formatNumber(sample, 123456789), format == settings.NumberFormat)
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(label, "set_numfmt:"+format)))
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, tr(settings, "Как записывать суммы?"), tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case strings.HasPrefix(data, "set_numfmt:"):
+		format := strings.TrimPrefix(data, "set_numfmt:")
+		if _, ok := numberFormats[format]; !ok {
+			log.Printf("Invalid number format in callback: %s", data)
+			return
+		}
+		if err := updateChatNumberFormat(chatID, format); err != nil {
+			log.Printf("Error updating number format: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить формат чисел."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case data == "settings_holidays":
+		current := settings.HolidayCalendar
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, code := range holidayCalendarOrder {
+			label := markSelected(tr(settings, holidayCalendars[code].Name), code == current)
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(label, "set_holidays:"+code)))
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, tr(settings, "По какому календарю переносить уведомления с выходных и праздников на следующий рабочий день?"), tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case strings.HasPrefix(data, "set_holidays:"):
+		calendar := strings.TrimPrefix(data, "set_holidays:")
+		if !isHolidayCalendar(calendar) {
+			log.Printf("Invalid holiday calendar in callback: %s", data)
+			return
+		}
+		if err := updateChatHolidayCalendar(chatID, calendar); err != nil {
+			log.Printf("Error updating holiday calendar: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить календарь."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case strings.HasPrefix(data, "set_decimals:"):
+		decimals, err := strconv.Atoi(strings.TrimPrefix(data, "set_decimals:"))
+		if err != nil || decimals < 0 || decimals > 2 {
+			log.Printf("Invalid decimals in callback: %s", data)
+			return
+		}
+		if err := updateChatCurrencyDecimals(chatID, decimals); err != nil {
+			log.Printf("Error updating currency decimals: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить количество знаков после запятой."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case data == "settings_digest":
+		if err := updateChatMonthlyDigest(chatID, !settings.MonthlyDigest); err != nil {
+			log.Printf("Error updating monthly digest: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить настройку сводки."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case data == "settings_maxdebt":
+		setUserState(chatID, StateSettingMaxDebt)
+		editPrompt(bot, chatID, messageID, trf(settings, "Сейчас: *%s*.\n\nВведи максимальную сумму одного долга или 0, чтобы снять ограничение:", maxDebtText(settings)))
+
+	case data == "settings_dateformat":
+		now := time.Now().In(chatLocation(settings))
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for i, format := range dateFormatPresets {
+			label := markSelected(now.Format(format), format == settings.DateFormat)
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(label, fmt.Sprintf("set_datefmt:%d", i))))
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, tr(settings, "Выбери формат даты:"), tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case strings.HasPrefix(data, "set_datefmt:"):
+		i, err := strconv.Atoi(strings.TrimPrefix(data, "set_datefmt:"))
+		if err != nil || i < 0 || i >= len(dateFormatPresets) {
+			log.Printf("Invalid date format in callback: %s", data)
+			return
+		}
+		if err := updateChatDateFormat(chatID, dateFormatPresets[i]); err != nil {
+			log.Printf("Error updating date format: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить формат даты."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case data == "settings_timezone":
+		current := settings.Timezone
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, timezone := range timezonePresets {
+			label := markSelected(tr(settings, timezoneName(timezone)), timezone == current)
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(label, "set_tz:"+timezone)))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(tr(settings, "✍️ Другой"), "set_tz_custom")))
+		editMessageWithKeyboard(bot, chatID, messageID, tr(settings, "Выбери часовой пояс:"), tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case data == "set_tz_custom":
+		setUserState(chatID, StateSettingTimezone)
+		editPrompt(bot, chatID, messageID, tr(settings, "Введи часовой пояс: смещение от UTC, например *+3* или *UTC-04:30*, или название зоны, например *Asia/Tbilisi*:"))
+
+	case strings.HasPrefix(data, "set_tz:"):
+		timezone := strings.TrimPrefix(data, "set_tz:")
+		if _, err := time.LoadLocation(timezone); err != nil {
+			log.Printf("Invalid timezone in callback: %s", data)
+			return
+		}
+		if err := updateChatTimezone(chatID, timezone); err != nil {
+			log.Printf("Error updating timezone: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить часовой пояс."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case data == "settings_reminders":
+		current := settings.ReminderDays
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, days := range reminderDaysPresets {
+			label := markSelected(reminderDaysText(settings, days), days == current)
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(label, fmt.Sprintf("set_remind:%d", days))))
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, tr(settings, "Когда напоминать о дате платежа должника?"), tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case strings.HasPrefix(data, "set_remind:"):
+		days, err := strconv.Atoi(strings.TrimPrefix(data, "set_remind:"))
+		if err != nil || days < reminderDaysOff {
+			log.Printf("Invalid reminder days in callback: %s", data)
+			return
+		}
+		if err := updateChatReminderDays(chatID, days); err != nil {
+			log.Printf("Error updating reminder days: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить напоминания."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case data == "settings_sort":
+		current := settings.DebtorSort
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, sortOrder := range debtorSortOrder {
+			label := markSelected(tr(settings, debtorSortNames[sortOrder]), sortOrder == current)
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(label, "set_sort:"+sortOrder)))
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, tr(settings, "Как сортировать список должников в /debts?"), tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case strings.HasPrefix(data, "set_sort:"):
+		sortOrder := strings.TrimPrefix(data, "set_sort:")
+		if _, ok := debtorSortNames[sortOrder]; !ok {
+			log.Printf("Invalid sort order in callback: %s", data)
+			return
+		}
+		if err := updateChatDebtorSort(chatID, sortOrder); err != nil {
+			log.Printf("Error updating debtor sort order: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить сортировку."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case data == "settings_debtsort":
+		current := settings.DebtSort
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, sortOrder := range debtSortOrder {
+			label := markSelected(tr(settings, debtSortNames[sortOrder]), sortOrder == current)
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(label, "set_debtsort:"+sortOrder)))
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, tr(settings, "В каком порядке показывать долги должника?"), tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case strings.HasPrefix(data, "set_debtsort:"):
+		sortOrder := strings.TrimPrefix(data, "set_debtsort:")
+		if _, ok := debtSortNames[sortOrder]; !ok {
+			log.Printf("Invalid debt sort order in callback: %s", data)
+			return
+		}
+		if err := updateChatDebtSort(chatID, sortOrder); err != nil {
+			log.Printf("Error updating debt sort order: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить порядок долгов."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case data == "settings_export", strings.HasPrefix(data, "set_export"):
+		handleExportSettingsCallback(bot, chatID, messageID, data)
+
+	case data == "settings_payqr", strings.HasPrefix(data, "set_payqr"):
+		handlePaymentQRSettingsCallback(bot, chatID, messageID, data)
+
+	case data == "settings_done":
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+
+	case data == "settings_allocation":
+		current := settings.AllocationStrategy
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for _, strategy := range allocationStrategyOrder {
+			label := markSelected(tr(settings, allocationStrategyNames[strategy]), strategy == current)
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(callbackButton(label, "set_alloc:"+strategy)))
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, tr(settings, "Как распределять платёж должника между его долгами, если он не совпадает с конкретными долгами?"), tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case strings.HasPrefix(data, "set_alloc:"):
+		strategy := strings.TrimPrefix(data, "set_alloc:")
+		if _, ok := allocationStrategyNames[strategy]; !ok {
+			log.Printf("Invalid allocation strategy in callback: %s", data)
+			return
+		}
+		if err := updateChatAllocationStrategy(chatID, strategy); err != nil {
+			log.Printf("Error updating allocation strategy: %v", err)
+			sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить распределение платежей."))
+			return
+		}
+		text, keyboard := settingsMenu(chatID)
+		editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+	}
+}
+
+func handleTimezoneInput(bot Sender, chatID int64, text string) {
+	settings := getChatSettings(chatID)
+	timezone, ok := parseTimezone(text)
+	if !ok {
+		sendPrompt(bot, chatID, tr(settings, "Не удалось распознать часовой пояс. Введи смещение от UTC, например *+3*, или название зоны, например *Asia/Tbilisi*."))
+		return
+	}
+	if err := updateChatTimezone(chatID, timezone); err != nil {
+		log.Printf("Error updating timezone: %v", err)
+		sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить часовой пояс."))
+		clearUserState(chatID)
+		return
+	}
+	clearUserState(chatID)
+	handleSettingsCommand(bot, chatID)
+}
+
+func handleCurrencySymbolInput(bot Sender, chatID int64, text string) {
+	settings := getChatSettings(chatID)
+	symbol := strings.TrimSpace(text)
+	if symbol == "" || len([]rune(symbol)) > maxCurrencySymbolLength || strings.ContainsAny(symbol, "*_[]`") {
+		sendPrompt(bot, chatID, trf(settings, "Символ валюты должен содержать от 1 до %d символов и не включать символы разметки (* _ [ ] `).", maxCurrencySymbolLength))
+		return
+	}
+	if err := updateChatCurrencySymbol(chatID, symbol); err != nil {
+		log.Printf("Error updating currency symbol: %v", err)
+		sendSimpleMessage(bot, chatID, tr(settings, "Не удалось обновить валюту."))
+		clearUserState(chatID)
+		return
+	}
+	clearUserState(chatID)
+	handleSettingsCommand(bot, chatID)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Split Debts ---
+
+// parseSplitNames splits "Ваня, Петя, Коля" into distinct names. It returns
+// nil unless at least two names were given.
+func parseSplitNames(text string) []string {
+	if !strings.ContainsAny(text, ",;") {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, part := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' }) {
+		name := strings.TrimSpace(part)
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	if len(names) < 2 {
+		return nil
+	}
+	return names
+}
+
+// splitEqually divides total into n shares that differ by at most one cent and add up exactly.
+func splitEqually(total Money, n int) []Money {
+	base, remainder := total/Money(n), total%Money(n)
+	shares := make([]Money, n)
+	for i := range shares {
+		shares[i] = base
+		if Money(i) < remainder {
+			shares[i]++
+		}
+	}
+	return shares
+}
+
+func parseSplitShares(settings ChatSettings, text string, count int, total Money) ([]Money, error) {
+	// Commas are decimal separators here ("150,50"), so shares are split on whitespace and semicolons only.
+	fields := strings.FieldsFunc(text, func(r rune) bool { return unicode.IsSpace(r) || r == ';' })
+	if len(fields) != count {
+		return nil, fmt.Errorf("expected %d shares, got %d", count, len(fields))
+	}
+	shares := make([]Money, count)
+	var sum Money
+	for i, field := range fields {
+		share, err := parseAmount(settings, field)
+		if err != nil || share <= 0 {
+			return nil, fmt.Errorf("invalid share %q", field)
+		}
+		shares[i] = share
+		sum += share
+	}
+	if sum != total {
+		return nil, fmt.Errorf("shares add up to %.2f instead of %.2f", sum.Float(), total.Float())
+	}
+	return shares, nil
+}
+
+// addSplitDebts creates (or reuses) a debtor per name and adds one debt per
+// person, all in a single transaction. The debts are linked into one group.
+func addSplitDebts(chatID int64, names []string, reason string, shares []Money) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	chatID = ledgerChatID(chatID)
+	reason, tag := splitDebtTag(reason)
+	groupID, err := addDebtGroupTx(tx, chatID, reason)
+	if err != nil {
+		return err
+	}
+
+	var added []Debt
+	for i, name := range names {
+		var debtorID int64
+		err := tx.QueryRow("SELECT id FROM debtors WHERE name = ? AND chat_id = ?", name, chatID).Scan(&debtorID)
+		if err == sql.ErrNoRows {
+			result, err := tx.Exec("INSERT INTO debtors (name, chat_id) VALUES (?, ?)", name, chatID)
+			if err != nil {
+				return err
+			}
+			if debtorID, err = result.LastInsertId(); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		result, err := tx.Exec("INSERT INTO debts (debtor_id, amount_cents, reason, tag, group_id, created_at) VALUES (?, ?, ?, ?, ?, ?)", debtorID, shares[i], reason, tag, groupID, time.Now())
+		if err != nil {
+			return err
+		}
+		debtID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		added = append(added, Debt{ID: int(debtID), DebtorID: int(debtorID), Amount: shares[i], Reason: reason, Tag: tag})
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, debt := range added {
+		emitDebtEvent(EventDebtAdded, debt, nil)
+	}
+	return nil
+}
+
+// --- Split Flow ---
+
+func startSplitAdd(bot Sender, chatID int64, names []string) {
+	setSplitNames(chatID, names)
+	setUserState(chatID, StateAddingSplitReason)
+	sendReasonPrompt(bot, chatID, fmt.Sprintf("Делим долг между: *%s*.\n\nКакова причина долга?", escapeBold(strings.Join(names, ", "))))
+}
+
+func handleSplitReason(bot Sender, chatID int64, text string) {
+	setSplitReason(chatID, text)
+	setUserState(chatID, StateAddingSplitAmount)
+	sendPrompt(bot, chatID, fmt.Sprintf("Какую общую сумму за *%s* нужно разделить?", escapeBold(text)))
+}
+
+func handleSplitAmount(bot Sender, chatID int64, text string) {
+	total, err := parseAmount(getChatSettings(chatID), text)
+	if err != nil || total <= 0 {
+		sendPrompt(bot, chatID, "Пожалуйста, введи корректную общую сумму (положительное число).")
+		return
+	}
+	if checkAmount(bot, chatID, total) {
+		askSplitMode(bot, chatID, total)
+	}
+}
+
+func askSplitMode(bot Sender, chatID int64, total Money) {
+	setSplitTotal(chatID, total)
+	setUserState(chatID, StateChoosingSplitMode)
+
+	session := getSession(chatID)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			callbackButton("➗ Поровну", "split_equal"),
+			callbackButton("✍️ Свои доли", "split_custom"),
+		),
+		tgbotapi.NewInlineKeyboardRow(callbackButton("❌ Отмена", "cancel_operation")),
+	)
+	sendWithKeyboard(bot, chatID, fmt.Sprintf("Как разделить *%s* между %d людьми?", formatChatAmount(chatID, total), len(session.SplitNames)), keyboard)
+}
+
+func handleSplitCallback(bot Sender, chatID int64, messageID int, data string) {
+	session := getSession(chatID)
+	if session.State != StateChoosingSplitMode {
+		editMessageWithKeyboard(bot, chatID, messageID, "Этот выбор уже неактуален.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+
+	switch data {
+	case "split_equal":
+		editMessageWithKeyboard(bot, chatID, messageID, "Делим поровну.", tgbotapi.InlineKeyboardMarkup{})
+		finishSplitAdd(bot, chatID, splitEqually(session.SplitTotal, len(session.SplitNames)))
+
+	case "split_custom":
+		setUserState(chatID, StateEnteringSplitShares)
+		editPrompt(bot, chatID, messageID, fmt.Sprintf("Введи доли через пробел в порядке: *%s*.\nВ сумме должно получиться *%s*.",
+			escapeBold(strings.Join(session.SplitNames, ", ")), formatChatAmount(chatID, session.SplitTotal)))
+	}
+}
+
+func handleSplitShares(bot Sender, chatID int64, text string) {
+	session := getSession(chatID)
+	shares, err := parseSplitShares(getChatSettings(chatID), text, len(session.SplitNames), session.SplitTotal)
+	if err != nil {
+		sendPrompt(bot, chatID, fmt.Sprintf("Нужно ввести %d положительных чисел через пробел, которые в сумме дают *%s*.",
+			len(session.SplitNames), formatChatAmount(chatID, session.SplitTotal)))
+		return
+	}
+	finishSplitAdd(bot, chatID, shares)
+}
+
+func finishSplitAdd(bot Sender, chatID int64, shares []Money) {
+	session := getSession(chatID)
+	defer clearUserState(chatID)
+
+	if err := addSplitDebts(chatID, session.SplitNames, session.SplitReason, shares); err != nil {
+		log.Printf("Error adding split debts: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при добавлении долгов. Ничего не сохранено.")
+		return
+	}
+	reason, tag := splitDebtTag(session.SplitReason)
+	recordReasonUse(chatID, reason+formatDebtTag(tag))
+
+	settings := getChatSettings(chatID)
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("✅ Долг за *%s* разделён:\n\n", escapeBold(session.SplitReason)))
+	for i, name := range session.SplitNames {
+		text.WriteString(fmt.Sprintf("- *%s* должен *%s*\n", escapeBold(name), formatAmount(settings, shares[i])))
+	}
+	text.WriteString(fmt.Sprintf("\n*Итого: %s*", formatAmount(settings, session.SplitTotal)))
+	text.WriteString("\n\n🧾 Долги связаны: их можно закрыть все сразу из карточки любого участника.")
+	sendSimpleMessage(bot, chatID, text.String())
+	notifyCoOwners(bot, chatID, fmt.Sprintf("Новый общий долг за *%s* на *%s*: %s.", escapeBold(session.SplitReason), formatAmount(settings, session.SplitTotal), escapeMarkdown(strings.Join(session.SplitNames, ", "))))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// --- Debtor Statement ---
+
+// A statement is a self-contained message addressed to the debtor, meant to
+// be forwarded or copied as is: the open debts with their dates, the total
+// and the agreed payment.
+
+func debtorStatementText(chatID int64, debtor Debtor, debts []Debt) string {
+	settings := getChatSettings(chatID)
+	loc := chatLocation(settings)
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("🧾 *Выписка по долгам*\n\n%s, вот что за тобой числится:\n\n", escapeMarkdown(debtor.Name)))
+	var total Money
+	for _, debt := range debts {
+		text.WriteString(fmt.Sprintf("• %s — *%s*", escapeMarkdown(debt.Reason), formatAmount(settings, debt.Amount)))
+		if debt.CreatedAt.Valid {
+			text.WriteString(fmt.Sprintf(" (от %s)", formatDate(settings, debt.CreatedAt.Time.In(loc))))
+		}
+		text.WriteString("\n")
+		total += debt.Amount
+	}
+	text.WriteString(fmt.Sprintf("\n*Итого: %s*", formatAmount(settings, total)))
+	if debtor.PaymentDate.Valid {
+		text.WriteString(fmt.Sprintf("\nВернуть до: *%s*", formatDate(settings, debtor.PaymentDate.Time)))
+	}
+	if debtor.PaymentAmount.Valid {
+		text.WriteString(fmt.Sprintf("\nСумма платежа: *%s*", formatAmount(settings, debtor.PaymentAmount.V)))
+	}
+	text.WriteString(fmt.Sprintf("\n\nВыписка на %s", formatDate(settings, time.Now().In(loc))))
+	return text.String()
+}
+
+func handleStatementCallback(bot Sender, chatID int64, data string) {
+	debtor, ok := callbackDebtor(chatID, strings.TrimPrefix(data, "statement:"))
+	if !ok {
+		sendSimpleMessage(bot, chatID, "Должник не найден.")
+		return
+	}
+	debts, err := listDebts(debtor.ID)
+	if err != nil {
+		log.Printf("Error listing debts for statement: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при подготовке выписки.")
+		return
+	}
+	if len(debts) == 0 {
+		sendSimpleMessage(bot, chatID, fmt.Sprintf("У *%s* нет открытых долгов.", escapeBold(debtor.Name)))
+		return
+	}
+	sendSimpleMessage(bot, chatID, "Перешли сообщение ниже должнику или скопируй его текст:")
+	sendSimpleMessage(bot, chatID, debtorStatementText(chatID, debtor, debts))
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Health And Status ---
+
+// HEALTH_LISTEN turns on /healthz (the process is up) and /readyz (the
+// database answers and the scheduler keeps running) for monitoring; owners
+// listed in OWNER_CHAT_IDS get the same picture and more with /status.
+
+type runtimeStatus struct {
+	StartedAt  time.Time
+	LastUpdate time.Time
+	// SchedulerStarted and SchedulerFinished bound the latest run of the
+	// scheduled jobs; a run is in progress while Started is the later one.
+	SchedulerStarted  time.Time
+	SchedulerFinished time.Time
+}
+
+var (
+	botStatusMu sync.Mutex
+	botStatus   = runtimeStatus{StartedAt: time.Now()}
+)
+
+// healthCheckTimeout bounds the database check of /readyz.
+const healthCheckTimeout = 5 * time.Second
+
+func recordUpdateReceived() {
+	botStatusMu.Lock()
+	defer botStatusMu.Unlock()
+	botStatus.LastUpdate = time.Now()
+}
+
+func recordSchedulerStarted() {
+	botStatusMu.Lock()
+	defer botStatusMu.Unlock()
+	botStatus.SchedulerStarted = time.Now()
+}
+
+func recordSchedulerFinished() {
+	botStatusMu.Lock()
+	defer botStatusMu.Unlock()
+	botStatus.SchedulerFinished = time.Now()
+}
+
+func getRuntimeStatus() runtimeStatus {
+	botStatusMu.Lock()
+	defer botStatusMu.Unlock()
+	return botStatus
+}
+
+func (s runtimeStatus) schedulerRunning() bool {
+	return s.SchedulerStarted.After(s.SchedulerFinished)
+}
+
+// schedulerHealthy reports whether a run has finished within two intervals,
+// counting from startup until the first one does.
+func (s runtimeStatus) schedulerHealthy(now time.Time) bool {
+	last := s.SchedulerFinished
+	if last.Before(s.StartedAt) {
+		last = s.StartedAt
+	}
+	return now.Sub(last) <= 2*schedulerInterval
+}
+
+func checkDatabase() error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	return DB.PingContext(ctx)
+}
+
+type healthResponse struct {
+	Status    string `json:"status"`
+	Database  string `json:"database,omitempty"`
+	Scheduler string `json:"scheduler,omitempty"`
+}
+
+func newHealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, healthResponse{Status: "ok"})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		response := healthResponse{Status: "ok", Database: "ok", Scheduler: "ok"}
+		if err := checkDatabase(); err != nil {
+			log.Printf("Readiness check: database unavailable: %v", err)
+			response.Status, response.Database = "unavailable", "unavailable"
+		}
+		if !getRuntimeStatus().schedulerHealthy(time.Now()) {
+			response.Status, response.Scheduler = "unavailable", "stalled"
+		}
+		status := http.StatusOK
+		if response.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, response)
+	})
+	return mux
+}
+
+func startHealthServer(listenAddr string) {
+	server := &http.Server{
+		Addr:              listenAddr,
+		Handler:           newHealthHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Printf("Health checks listening on %s", listenAddr)
+		if err := server.ListenAndServe(); err != nil {
+			log.Fatalf("Health check server failed: %v", err)
+		}
+	}()
+}
+
+type databaseStats struct {
+	SizeBytes     int64
+	Chats         int
+	ArchivedChats int
+	Debtors       int
+	Debts         int
+	Outbox        int
+}
+
+func getDatabaseStats() (databaseStats, error) {
+	var stats databaseStats
+	err := DB.QueryRow(`SELECT
+        (SELECT page_count FROM pragma_page_count()) * (SELECT page_size FROM pragma_page_size()),
+        (SELECT COUNT(*) FROM chat_activity),
+        (SELECT COUNT(*) FROM chat_activity WHERE archived_at IS NOT NULL),
+        (SELECT COUNT(*) FROM debtors),
+        (SELECT COUNT(*) FROM debts),
+        (SELECT COUNT(*) FROM outbox)`).
+		Scan(&stats.SizeBytes, &stats.Chats, &stats.ArchivedChats, &stats.Debtors, &stats.Debts, &stats.Outbox)
+	return stats, err
+}
+
+// formatElapsed renders a duration as days, hours and minutes, or seconds when shorter.
+func formatElapsed(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d с", int(d.Seconds()))
+	}
+	days, hours, minutes := int(d.Hours())/24, int(d.Hours())%24, int(d.Minutes())%60
+	var parts []string
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%d д.", days))
+	}
+	if days > 0 || hours > 0 {
+		parts = append(parts, fmt.Sprintf("%d ч.", hours))
+	}
+	return strings.Join(append(parts, fmt.Sprintf("%d мин.", minutes)), " ")
+}
+
+// formatFileSize renders a size in megabytes with the chat's decimal mark.
+func formatFileSize(settings ChatSettings, size int64) string {
+	hundredths := Money(size * 100 >> 20)
+	return formatNumber(ChatSettings{NumberFormat: settings.NumberFormat, CurrencyDecimals: 1}, hundredths) + " МБ"
+}
+
+func statusText(settings ChatSettings, status runtimeStatus, stats databaseStats, databaseErr error, now time.Time) string {
+	var text strings.Builder
+	text.WriteString("🩺 *Состояние бота*\n\n")
+	text.WriteString(fmt.Sprintf("Работает: %s (с %s)\n", formatElapsed(now.Sub(status.StartedAt)), formatDateTime(settings, status.StartedAt)))
+
+	if databaseErr != nil {
+		text.WriteString("База данных: ⚠️ недоступна\n")
+	} else {
+		text.WriteString(fmt.Sprintf("База данных: %s\n", formatFileSize(settings, stats.SizeBytes)))
+		text.WriteString(fmt.Sprintf("Чатов: %d (в архиве %d), должников: %d, долгов: %d\n", stats.Chats, stats.ArchivedChats, stats.Debtors, stats.Debts))
+		text.WriteString(fmt.Sprintf("Неотправленных сообщений: %d\n", stats.Outbox))
+	}
+
+	if status.LastUpdate.IsZero() {
+		text.WriteString("Последнее обновление: ещё не было\n")
+	} else {
+		text.WriteString(fmt.Sprintf("Последнее обновление: %s назад\n", formatElapsed(now.Sub(status.LastUpdate))))
+	}
+
+	scheduler := "ещё не запускался"
+	switch {
+	case status.schedulerRunning():
+		scheduler = fmt.Sprintf("выполняется с %s", formatDateTime(settings, status.SchedulerStarted))
+	case !status.SchedulerFinished.IsZero():
+		scheduler = fmt.Sprintf("последний запуск %s, %s", formatDateTime(settings, status.SchedulerStarted),
+			formatElapsed(status.SchedulerFinished.Sub(status.SchedulerStarted)))
+	}
+	if !status.schedulerHealthy(now) {
+		scheduler = "⚠️ " + scheduler
+	}
+	text.WriteString(fmt.Sprintf("Планировщик: %s", scheduler))
+	return text.String()
+}
+
+// handleStatusCommand answers owners only; for everyone else /status does not exist.
+func handleStatusCommand(bot Sender, chatID int64) {
+	if !config.OwnerChats[chatID] {
+		sendSimpleMessage(bot, chatID, "Неизвестная команда. Используй /help для списка команд.")
+		return
+	}
+	stats, err := getDatabaseStats()
+	if err != nil {
+		log.Printf("Error getting database stats: %v", err)
+	}
+	sendSimpleMessage(bot, chatID, statusText(getChatSettings(chatID), getRuntimeStatus(), stats, err, time.Now()))
+}
+
+// ownerCommands is the command menu of an owner's chat: the regular one plus
+// /status and /broadcast.
+func ownerCommands(chatID int64) []tgbotapi.BotCommand {
+	return append(menuCommands(chatID < 0),
+		tgbotapi.BotCommand{Command: "status", Description: "Состояние бота"},
+		tgbotapi.BotCommand{Command: "broadcast", Description: "Рассылка всем чатам"},
+	)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// --- Text Summary ---
+
+// /summary sends the debtors and totals as a monospace block: it lines up in
+// the chat and copies as plain text, for forwarding or pinning.
+
+// summaryMessageLimit keeps each message well under Telegram's 4096 characters.
+const summaryMessageLimit = 3500
+
+type summaryLine struct {
+	Name   string
+	Amount string
+	Count  int
+	Due    string
+}
+
+func summaryLines(chatID int64, settings ChatSettings) ([]summaryLine, Money, int, error) {
+	debtors, err := listDebtors(chatID)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	totals := make(map[int]Money, len(debtors))
+	counts := make(map[int]int, len(debtors))
+	var owing []Debtor
+	for _, debtor := range debtors {
+		debts, err := listDebts(debtor.ID)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if len(debts) == 0 {
+			continue
+		}
+		for _, debt := range debts {
+			totals[debtor.ID] += debt.Amount
+		}
+		counts[debtor.ID] = len(debts)
+		owing = append(owing, debtor)
+	}
+	sortDebtors(owing, settings.DebtorSort, totals)
+
+	var lines []summaryLine
+	var total Money
+	debts := 0
+	for _, debtor := range owing {
+		line := summaryLine{Name: debtor.Name, Amount: formatAmount(settings, totals[debtor.ID]), Count: counts[debtor.ID]}
+		if debtor.PaymentDate.Valid {
+			line.Due = formatDate(settings, debtor.PaymentDate.Time)
+		}
+		lines = append(lines, line)
+		total += totals[debtor.ID]
+		debts += counts[debtor.ID]
+	}
+	return lines, total, debts, nil
+}
+
+// summaryText lays the lines out in columns and splits them into messages.
+func summaryText(settings ChatSettings, lines []summaryLine, total Money, debts int, now time.Time) []string {
+	nameWidth, amountWidth := len([]rune("Итого")), len([]rune(formatAmount(settings, total)))
+	for _, line := range lines {
+		nameWidth = max(nameWidth, len([]rune(line.Name)))
+		amountWidth = max(amountWidth, len([]rune(line.Amount)))
+	}
+	pad := func(text string, width int, right bool) string {
+		fill := strings.Repeat(" ", max(0, width-len([]rune(text))))
+		if right {
+			return fill + text
+		}
+		return text + fill
+	}
+	// Backticks would end the code block early.
+	clean := func(text string) string { return strings.ReplaceAll(text, "`", "'") }
+
+	var rows []string
+	for _, line := range lines {
+		row := fmt.Sprintf("%s  %s  (%d)", pad(clean(line.Name), nameWidth, false), pad(line.Amount, amountWidth, true), line.Count)
+		if line.Due != "" {
+			row += " до " + line.Due
+		}
+		rows = append(rows, row)
+	}
+	rows = append(rows,
+		strings.Repeat("─", nameWidth+amountWidth+2),
+		fmt.Sprintf("%s  %s", pad("Итого", nameWidth, false), pad(formatAmount(settings, total), amountWidth, true)),
+		fmt.Sprintf("Должников: %d, долгов: %d", len(lines), debts),
+	)
+
+	header := fmt.Sprintf("📋 *Долги на %s*\n", formatDate(settings, now))
+	var messages []string
+	var block strings.Builder
+	flush := func() {
+		messages = append(messages, header+"```\n"+block.String()+"```")
+		header = ""
+		block.Reset()
+	}
+	for _, row := range rows {
+		if block.Len() > 0 && block.Len()+len(row) > summaryMessageLimit {
+			flush()
+		}
+		block.WriteString(row + "\n")
+	}
+	flush()
+	return messages
+}
+
+func handleSummaryCommand(bot Sender, chatID int64) {
+	clearUserState(chatID)
+	settings := getChatSettings(chatID)
+	lines, total, debts, err := summaryLines(chatID, settings)
+	if err != nil {
+		log.Printf("Error building summary: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при подготовке сводки.")
+		return
+	}
+	if len(lines) == 0 {
+		sendSimpleMessage(bot, chatID, "Открытых долгов нет.")
+		return
+	}
+	for _, text := range summaryText(settings, lines, total, debts, time.Now().In(chatLocation(settings))) {
+		sendSimpleMessage(bot, chatID, text)
+	}
+}
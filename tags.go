@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Debt Tags ---
+
+// A debt has at most one tag (category) such as "еда" or "аренда". It is set
+// by writing a hashtag in the reason ("ужин #еда") or from the debt's edit
+// menu, and is stored lowercased without the "#".
+
+const (
+	maxTagLength = 20
+	// maxTagButtons limits how many existing tags are offered as buttons.
+	maxTagButtons = 8
+)
+
+type tagTotal struct {
+	Tag    string
+	Count  int
+	Amount Money
+}
+
+// normalizeTag lowercases a tag and checks it is a single short word.
+func normalizeTag(text string) (string, bool) {
+	tag := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(text), "#"))
+	if tag == "" || len([]rune(tag)) > maxTagLength {
+		return "", false
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' {
+			return "", false
+		}
+	}
+	return tag, true
+}
+
+// splitDebtTag takes the first hashtag out of a reason: "ужин #еда" becomes
+// reason "ужин" and tag "еда". A reason that is only a hashtag keeps the tag
+// as its text.
+func splitDebtTag(text string) (reason, tag string) {
+	fields := strings.Fields(text)
+	for i, field := range fields {
+		if !strings.HasPrefix(field, "#") {
+			continue
+		}
+		if t, ok := normalizeTag(field); ok {
+			reason = strings.Join(append(fields[:i:i], fields[i+1:]...), " ")
+			if reason == "" {
+				reason = t
+			}
+			return reason, t
+		}
+	}
+	return text, ""
+}
+
+func formatDebtTag(tag string) string {
+	if tag == "" {
+		return ""
+	}
+	return " #" + tag
+}
+
+func updateDebtTag(debtID int, tag string) error {
+	_, err := DB.Exec("UPDATE debts SET tag = ? WHERE id = ?", tag, debtID)
+	return err
+}
+
+// listChatTags returns the tags used on the chat's open debts, most used first.
+func listChatTags(chatID int64) ([]string, error) {
+	totals, err := chatTagTotals(chatID)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, total := range totals {
+		if total.Tag != "" {
+			tags = append(tags, total.Tag)
+		}
+	}
+	return tags, nil
+}
+
+// chatTagTotals sums the chat's open debts per tag; untagged debts have an empty tag.
+func chatTagTotals(chatID int64) ([]tagTotal, error) {
+	rows, err := DB.Query(`
+		SELECT d.tag, COUNT(*), SUM(d.amount_cents)
+		FROM debts d
+		JOIN debtors r ON r.id = d.debtor_id
+		WHERE r.chat_id = ?
+		GROUP BY d.tag
+		ORDER BY COUNT(*) DESC, d.tag`, ledgerChatID(chatID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []tagTotal
+	for rows.Next() {
+		var total tagTotal
+		if err := rows.Scan(&total.Tag, &total.Count, &total.Amount); err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+// filterDebtsByTag keeps the debts with the given tag; an empty tag keeps all.
+func filterDebtsByTag(debts []Debt, tag string) []Debt {
+	if tag == "" {
+		return debts
+	}
+	var filtered []Debt
+	for _, debt := range debts {
+		if debt.Tag == tag {
+			filtered = append(filtered, debt)
+		}
+	}
+	return filtered
+}
+
+// --- Stats ---
+
+func handleStatsCommand(bot Sender, chatID int64, args string) {
+	clearUserState(chatID)
+	settings := getChatSettings(chatID)
+
+	if args = strings.TrimSpace(args); args != "" {
+		tag, ok := normalizeTag(args)
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Укажи тег одним словом, например: /stats еда")
+			return
+		}
+		sendSimpleMessage(bot, chatID, tagStatsText(settings, chatID, tag))
+		return
+	}
+
+	totals, err := chatTagTotals(chatID)
+	if err != nil {
+		log.Printf("Error summing debts by tag: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при подсчёте статистики.")
+		return
+	}
+	if len(totals) == 0 {
+		sendSimpleMessage(bot, chatID, "Открытых долгов нет.")
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString("📈 *Долги по категориям:*\n\n")
+	var sum Money
+	for _, total := range totals {
+		name := "#" + total.Tag
+		if total.Tag == "" {
+			name = "без тега"
+		}
+		text.WriteString(fmt.Sprintf("%s — *%s* (%d)\n", name, formatAmount(settings, total.Amount), total.Count))
+		sum += total.Amount
+	}
+	text.WriteString(fmt.Sprintf("\n*Всего: %s*\n\nПодробнее по тегу: /stats <тег>", formatAmount(settings, sum)))
+	sendSimpleMessage(bot, chatID, text.String())
+}
+
+// tagStatsText lists who owes how much within one tag.
+func tagStatsText(settings ChatSettings, chatID int64, tag string) string {
+	debtors, err := listDebtors(chatID)
+	if err != nil {
+		log.Printf("Error listing debtors: %v", err)
+		return "Произошла ошибка при подсчёте статистики."
+	}
+	var text strings.Builder
+	var sum Money
+	for _, debtor := range debtors {
+		debts, err := listDebts(debtor.ID)
+		if err != nil {
+			log.Printf("Error listing debts: %v", err)
+			return "Произошла ошибка при подсчёте статистики."
+		}
+		var total Money
+		debts = filterDebtsByTag(debts, tag)
+		for _, debt := range debts {
+			total += debt.Amount
+		}
+		if len(debts) > 0 {
+			text.WriteString(fmt.Sprintf("- *%s* — %s (%d)\n", escapeBold(debtor.Name), formatAmount(settings, total), len(debts)))
+			sum += total
+		}
+	}
+	if text.Len() == 0 {
+		return fmt.Sprintf("Открытых долгов с тегом #%s нет.", tag)
+	}
+	return fmt.Sprintf("📈 *#%s:*\n\n%s\n*Всего: %s*", tag, text.String(), formatAmount(settings, sum))
+}
+
+// --- Tag Editing Flow ---
+
+func handleDebtTagCallback(bot Sender, chatID int64, messageID int, data string) {
+	switch {
+	case strings.HasPrefix(data, "edit_tag:"):
+		debt, ok := callbackDebt(chatID, strings.TrimPrefix(data, "edit_tag:"))
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
+			return
+		}
+		debtID := debt.ID
+		setSelectedDebt(chatID, Debt{ID: debtID})
+		setUserState(chatID, StateEditingDebtTag)
+
+		tags, err := listChatTags(chatID)
+		if err != nil {
+			log.Printf("Error listing tags: %v", err)
+		}
+		if len(tags) > maxTagButtons {
+			tags = tags[:maxTagButtons]
+		}
+		var rows [][]tgbotapi.InlineKeyboardButton
+		var row []tgbotapi.InlineKeyboardButton
+		for _, tag := range tags {
+			row = append(row, callbackButton("#"+tag, fmt.Sprintf("set_tag:%d:%s", debtID, tag)))
+			if len(row) == 4 {
+				rows = append(rows, row)
+				row = nil
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+		screen := navScreen{Kind: navDebtTags, ID: debtID}
+		enterNavScreen(chatID, screen)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			callbackButton("Убрать тег", fmt.Sprintf("set_tag:%d:", debtID)),
+			backButton(screen),
+		))
+		editMessageWithKeyboard(bot, chatID, messageID, "Выбери тег или введи новый одним словом, например *еда*:", tgbotapi.NewInlineKeyboardMarkup(rows...))
+
+	case strings.HasPrefix(data, "set_tag:"):
+		idText, tag, _ := strings.Cut(strings.TrimPrefix(data, "set_tag:"), ":")
+		debt, ok := callbackDebt(chatID, idText)
+		if !ok {
+			sendSimpleMessage(bot, chatID, "Долг не найден.")
+			return
+		}
+		if err := updateDebtTag(debt.ID, tag); err != nil {
+			log.Printf("Error updating debt tag: %v", err)
+			sendSimpleMessage(bot, chatID, "Не удалось обновить тег.")
+			return
+		}
+		editMessageWithKeyboard(bot, chatID, messageID, "Тег обновлён.", tgbotapi.InlineKeyboardMarkup{})
+		debtor, ok := lookupCurrentDebtor(chatID)
+		clearUserState(chatID)
+		if ok && debtor.ID != 0 {
+			showDebtorDetails(bot, chatID, debtor.ID)
+		}
+	}
+}
+
+func handleDebtTagInput(bot Sender, chatID int64, text string) {
+	tag, ok := normalizeTag(text)
+	if !ok {
+		sendPrompt(bot, chatID, fmt.Sprintf("Тег — одно слово до %d символов, например *еда*.", maxTagLength))
+		return
+	}
+	debtID := selectedDebt(chatID).ID
+	debtor, hasDebtor := lookupCurrentDebtor(chatID)
+	clearUserState(chatID)
+	if err := updateDebtTag(debtID, tag); err != nil {
+		log.Printf("Error updating debt tag: %v", err)
+		sendSimpleMessage(bot, chatID, "Не удалось обновить тег.")
+		return
+	}
+	sendSimpleMessage(bot, chatID, fmt.Sprintf("Тег *#%s* сохранён.", tag))
+	if hasDebtor && debtor.ID != 0 {
+		showDebtorDetails(bot, chatID, debtor.ID)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Top Debtors ---
+
+const (
+	topDebtorsLimit = 10
+	TopByAmount     = "amount"
+	TopByAge        = "age"
+)
+
+var topMedals = []string{"🥇", "🥈", "🥉"}
+
+// debtorStanding is one debtor's open debts, summed up for the rankings.
+type debtorStanding struct {
+	Debtor Debtor
+	Total  Money
+	Count  int
+	// Oldest is the oldest open debt with a known creation time.
+	Oldest Debt
+}
+
+func listDebtorStandings(chatID int64) ([]debtorStanding, error) {
+	debtors, err := listDebtors(chatID)
+	if err != nil {
+		return nil, err
+	}
+	var standings []debtorStanding
+	for _, debtor := range debtors {
+		debts, err := listDebts(debtor.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(debts) == 0 {
+			continue
+		}
+		standing := debtorStanding{Debtor: debtor, Count: len(debts)}
+		for _, debt := range debts {
+			standing.Total += debt.Amount
+			if debt.CreatedAt.Valid && (!standing.Oldest.CreatedAt.Valid || debt.CreatedAt.Time.Before(standing.Oldest.CreatedAt.Time)) {
+				standing.Oldest = debt
+			}
+		}
+		standings = append(standings, standing)
+	}
+	return standings, nil
+}
+
+// rankDebtors orders the standings by outstanding amount or by the age of the
+// oldest debt; debtors whose debts are all of unknown age are left out of the latter.
+func rankDebtors(standings []debtorStanding, by string) []debtorStanding {
+	ranked := make([]debtorStanding, 0, len(standings))
+	for _, s := range standings {
+		if by == TopByAge && !s.Oldest.CreatedAt.Valid {
+			continue
+		}
+		ranked = append(ranked, s)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if by == TopByAge {
+			return a.Oldest.CreatedAt.Time.Before(b.Oldest.CreatedAt.Time)
+		}
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.Debtor.Name < b.Debtor.Name
+	})
+	if len(ranked) > topDebtorsLimit {
+		ranked = ranked[:topDebtorsLimit]
+	}
+	return ranked
+}
+
+func topPlace(i int) string {
+	if i < len(topMedals) {
+		return topMedals[i]
+	}
+	return fmt.Sprintf("%d.", i+1)
+}
+
+func topDebtorsView(chatID int64, by string) (string, tgbotapi.InlineKeyboardMarkup) {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		callbackButton(markSelected("💰 По сумме", by == TopByAmount), "top:"+TopByAmount),
+		callbackButton(markSelected("⏳ По давности", by == TopByAge), "top:"+TopByAge),
+	))
+	standings, err := listDebtorStandings(chatID)
+	if err != nil {
+		log.Printf("Error listing debtor standings: %v", err)
+		return "Произошла ошибка при подсчёте статистики.", keyboard
+	}
+	if len(standings) == 0 {
+		return "Открытых долгов нет.", tgbotapi.InlineKeyboardMarkup{}
+	}
+
+	settings := getChatSettings(chatID)
+	now := time.Now()
+	var text strings.Builder
+	if by == TopByAge {
+		text.WriteString("🏆 *Топ должников по давности долга*\n\n")
+	} else {
+		text.WriteString("🏆 *Топ должников по сумме*\n\n")
+	}
+	ranked := rankDebtors(standings, by)
+	if len(ranked) == 0 {
+		text.WriteString("Дата создания долгов неизвестна.")
+	}
+	for i, s := range ranked {
+		if by == TopByAge {
+			text.WriteString(fmt.Sprintf("%s *%s* — %s (%s)\n", topPlace(i), escapeBold(s.Debtor.Name), debtAgeText(settings, s.Oldest, now), escapeMarkdown(s.Oldest.Reason)))
+		} else {
+			text.WriteString(fmt.Sprintf("%s *%s* — %s (%d)\n", topPlace(i), escapeBold(s.Debtor.Name), formatAmount(settings, s.Total), s.Count))
+		}
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+			callbackButton(fmt.Sprintf("%s %s", topPlace(i), s.Debtor.Name), fmt.Sprintf("select_debtor:%d", s.Debtor.ID)),
+		))
+	}
+	return text.String(), keyboard
+}
+
+func handleTopCommand(bot Sender, chatID int64) {
+	clearUserState(chatID)
+	text, keyboard := topDebtorsView(chatID, TopByAmount)
+	sendWithKeyboard(bot, chatID, text, keyboard)
+}
+
+func handleTopCallback(bot Sender, chatID int64, messageID int, by string) {
+	if by != TopByAmount && by != TopByAge {
+		log.Printf("Invalid top debtors ranking in callback: %s", by)
+		return
+	}
+	text, keyboard := topDebtorsView(chatID, by)
+	editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+}
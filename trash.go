@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Trash ---
+
+// Deleting a debtor moves the debtor and everything it owns into the trash
+// table, in the same row format as chat archives. /trash lists the chat's
+// deleted debtors and restores them with their original IDs; entries older
+// than trashRetention are purged by the scheduler.
+
+const trashRetention = 30 * 24 * time.Hour
+
+// trashTables are the tables a debtor owns, in restore order; the single
+// placeholder is the debtor ID.
+var trashTables = []archiveTable{
+	{"debtors", "id = ?"},
+	{"debts", "debtor_id = ?"},
+	{"installments", "debt_id IN (SELECT id FROM debts WHERE debtor_id = ?)"},
+	{"debt_events", "debtor_id = ?"},
+	{"loans", "debtor_id = ?"},
+	{"loan_payments", "loan_id IN (SELECT id FROM loans WHERE debtor_id = ?)"},
+	{"payments", "debtor_id = ?"},
+	{"forgiven_debts", "debtor_id = ?"},
+	{"cosigners", "debtor_id = ?"},
+	{"debtor_links", "debtor_id = ?"},
+	{"debtor_nudges", "debtor_id = ?"},
+}
+
+type TrashEntry struct {
+	ID         int
+	DebtorName string
+	DebtCount  int
+	DebtTotal  Money
+	DeletedAt  time.Time
+}
+
+// clearDebtorEvents drops the ledger rows the debts triggers write while a
+// debtor is moved to or from the trash; the trashed ledger is kept as is.
+func clearDebtorEvents(tx *sql.Tx, debtorID int) error {
+	_, err := tx.Exec("DELETE FROM debt_events WHERE debtor_id = ?", debtorID)
+	return err
+}
+
+// trashDebtor moves the debtor and all its rows into the trash in one
+// transaction. It returns sql.ErrNoRows if the debtor no longer exists.
+func trashDebtor(debtor Debtor) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tables := make(map[string][]map[string]interface{})
+	for _, table := range trashTables {
+		rows, err := dumpArchiveTable(tx, table, int64(debtor.ID))
+		if err != nil {
+			return fmt.Errorf("export %s: %w", table.Name, err)
+		}
+		tables[table.Name] = rows
+	}
+	// The debtor is already gone, for example deleted by a co-owner.
+	if len(tables["debtors"]) == 0 {
+		return sql.ErrNoRows
+	}
+	data, err := json.Marshal(tables)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	var total Money
+	if err := tx.QueryRow("SELECT COUNT(*), COALESCE(SUM(amount_cents), 0) FROM debts WHERE debtor_id = ?", debtor.ID).Scan(&count, &total); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO trash (chat_id, debtor_name, debt_count, debt_total_cents, data, deleted_at) VALUES (?, ?, ?, ?, ?, ?)",
+		debtor.ChatID, debtor.Name, count, total, string(data), time.Now()); err != nil {
+		return err
+	}
+
+	for i := len(trashTables) - 1; i >= 0; i-- {
+		table := trashTables[i]
+		if _, err := tx.Exec("DELETE FROM "+table.Name+" WHERE "+table.Where, debtor.ID); err != nil {
+			return fmt.Errorf("purge %s: %w", table.Name, err)
+		}
+		if table.Name == "debts" {
+			if err := clearDebtorEvents(tx, debtor.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	emitEvent(EventDebtorDeleted, debtor, nil, nil)
+	return nil
+}
+
+func listTrash(chatID int64) ([]TrashEntry, error) {
+	rows, err := DB.Query("SELECT id, debtor_name, debt_count, debt_total_cents, deleted_at FROM trash WHERE chat_id = ? ORDER BY deleted_at DESC", ledgerChatID(chatID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []TrashEntry
+	for rows.Next() {
+		var e TrashEntry
+		if err := rows.Scan(&e.ID, &e.DebtorName, &e.DebtCount, &e.DebtTotal, &e.DeletedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// restoreFromTrash puts a trashed debtor back and returns its name. It fails
+// with "debtor already exists" if the chat has a new debtor with the same name.
+func restoreFromTrash(chatID int64, entryID int) (string, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var name, data string
+	if err := tx.QueryRow("SELECT debtor_name, data FROM trash WHERE id = ? AND chat_id = ?", entryID, ledgerChatID(chatID)).Scan(&name, &data); err != nil {
+		return "", err
+	}
+	var tables map[string][]map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tables); err != nil {
+		return name, err
+	}
+
+	var debtorID int
+	for _, row := range tables["debtors"] {
+		id, err := strconv.Atoi(fmt.Sprint(row["id"]))
+		if err != nil {
+			return name, fmt.Errorf("invalid debtor id in trash entry %d", entryID)
+		}
+		debtorID = id
+	}
+	for _, table := range trashTables {
+		for _, row := range tables[table.Name] {
+			if err := insertArchiveRow(tx, table.Name, row); err != nil {
+				if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+					return name, fmt.Errorf("debtor already exists")
+				}
+				return name, fmt.Errorf("restore %s: %w", table.Name, err)
+			}
+		}
+		if table.Name == "debts" {
+			if err := clearDebtorEvents(tx, debtorID); err != nil {
+				return name, err
+			}
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM trash WHERE id = ?", entryID); err != nil {
+		return name, err
+	}
+	return name, tx.Commit()
+}
+
+// purgeTrash permanently deletes entries older than trashRetention. Times are
+// compared in Go, like chat activity.
+func purgeTrash() {
+	rows, err := DB.Query("SELECT id, deleted_at FROM trash")
+	if err != nil {
+		log.Printf("Error listing trash: %v", err)
+		return
+	}
+	cutoff := time.Now().Add(-trashRetention)
+	var expired []int
+	for rows.Next() {
+		var id int
+		var deletedAt time.Time
+		if err := rows.Scan(&id, &deletedAt); err != nil {
+			log.Printf("Error scanning trash entry: %v", err)
+			continue
+		}
+		if deletedAt.Before(cutoff) {
+			expired = append(expired, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range expired {
+		if _, err := DB.Exec("DELETE FROM trash WHERE id = ?", id); err != nil {
+			log.Printf("Error purging trash entry %d: %v", id, err)
+		}
+	}
+}
+
+// --- Trash Handlers ---
+
+func handleTrashCommand(bot Sender, chatID int64) {
+	clearUserState(chatID)
+	text, keyboard := trashView(chatID)
+	sendWithKeyboard(bot, chatID, text, keyboard)
+}
+
+func trashView(chatID int64) (string, tgbotapi.InlineKeyboardMarkup) {
+	entries, err := listTrash(chatID)
+	if err != nil {
+		log.Printf("Error listing trash: %v", err)
+		return "Произошла ошибка при получении корзины.", tgbotapi.InlineKeyboardMarkup{}
+	}
+	if len(entries) == 0 {
+		return "Корзина пуста.", tgbotapi.InlineKeyboardMarkup{}
+	}
+
+	settings := getChatSettings(chatID)
+	loc := chatLocation(settings)
+	var text strings.Builder
+	text.WriteString("🗑 *Корзина*\n\nУдалённые должники хранятся 30 дней, потом удаляются навсегда.\n\n")
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, e := range entries {
+		text.WriteString(fmt.Sprintf("*%s* — долгов: %d на %s\nудалён %s, хранится до %s\n\n", escapeBold(e.DebtorName), e.DebtCount,
+			formatAmount(settings, e.DebtTotal), formatDate(settings, e.DeletedAt.In(loc)), formatDate(settings, e.DeletedAt.Add(trashRetention).In(loc))))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			callbackButton("♻️ Восстановить "+e.DebtorName, fmt.Sprintf("trash_restore:%d", e.ID)),
+		))
+	}
+	return text.String(), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func handleTrashCallback(bot Sender, chatID int64, messageID int, data string) {
+	entryID, err := strconv.Atoi(strings.TrimPrefix(data, "trash_restore:"))
+	if err != nil {
+		log.Printf("Invalid trash entry in callback: %s", data)
+		return
+	}
+	name, err := restoreFromTrash(chatID, entryID)
+	switch {
+	case err == sql.ErrNoRows:
+		sendSimpleMessage(bot, chatID, "Этого должника уже нет в корзине.")
+	case err != nil && strings.Contains(err.Error(), "debtor already exists"):
+		sendSimpleMessage(bot, chatID, fmt.Sprintf("Не удалось восстановить: должник *%s* уже есть. Переименуй его и попробуй снова.", escapeBold(name)))
+	case err != nil:
+		log.Printf("Error restoring debtor from trash: %v", err)
+		sendSimpleMessage(bot, chatID, "Произошла ошибка при восстановлении должника.")
+	default:
+		sendSimpleMessage(bot, chatID, fmt.Sprintf("Должник *%s* восстановлен со всеми долгами.", escapeBold(name)))
+		notifyCoOwners(bot, chatID, fmt.Sprintf("Должник *%s* восстановлен из корзины.", escapeBold(name)))
+	}
+	text, keyboard := trashView(chatID)
+	editMessageWithKeyboard(bot, chatID, messageID, text, keyboard)
+}
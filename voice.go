@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Voice Input ---
+
+// A voice message like "Иван 500 за обед" is turned into text by a speech
+// recognition service, parsed like a one-line /add and confirmed before the
+// debt is saved. The service is chosen with SPEECH_PROVIDER.
+
+type speechRecognizer interface {
+	// Recognize returns the text spoken in a Telegram voice message (OGG/Opus).
+	Recognize(audio []byte) (string, error)
+}
+
+const (
+	defaultWhisperURL   = "https://api.openai.com/v1/audio/transcriptions"
+	defaultWhisperModel = "whisper-1"
+	yandexSpeechKitURL  = "https://stt.api.cloud.yandex.net/speech/v1/stt:recognize"
+	speechTimeout       = 30 * time.Second
+	// SpeechKit's synchronous recognition takes up to 30 seconds and 1 MB of audio.
+	maxVoiceDuration = 30
+	maxVoiceFileSize = 1 << 20
+)
+
+// loadSpeechRecognizer reads SPEECH_PROVIDER (whisper or yandex) and the
+// provider's settings: WHISPER_API_KEY, WHISPER_API_URL and WHISPER_MODEL, or
+// YANDEX_SPEECHKIT_API_KEY and YANDEX_FOLDER_ID.
+func loadSpeechRecognizer(env envSource) (speechRecognizer, error) {
+	switch provider := strings.ToLower(env.get("SPEECH_PROVIDER")); provider {
+	case "":
+		return nil, nil
+	case "whisper":
+		recognizer := whisperRecognizer{APIKey: env.get("WHISPER_API_KEY"), URL: env.get("WHISPER_API_URL"), Model: env.get("WHISPER_MODEL")}
+		if recognizer.APIKey == "" {
+			return nil, fmt.Errorf("SPEECH_PROVIDER=whisper requires WHISPER_API_KEY")
+		}
+		if recognizer.URL == "" {
+			recognizer.URL = defaultWhisperURL
+		}
+		if recognizer.Model == "" {
+			recognizer.Model = defaultWhisperModel
+		}
+		return recognizer, nil
+	case "yandex":
+		recognizer := yandexRecognizer{APIKey: env.get("YANDEX_SPEECHKIT_API_KEY"), FolderID: env.get("YANDEX_FOLDER_ID")}
+		if recognizer.APIKey == "" {
+			return nil, fmt.Errorf("SPEECH_PROVIDER=yandex requires YANDEX_SPEECHKIT_API_KEY")
+		}
+		return recognizer, nil
+	default:
+		return nil, fmt.Errorf("invalid SPEECH_PROVIDER %q: use whisper or yandex", provider)
+	}
+}
+
+// whisperRecognizer uses the OpenAI transcription API or a compatible server.
+type whisperRecognizer struct {
+	APIKey string
+	URL    string
+	Model  string
+}
+
+func (w whisperRecognizer) Recognize(audio []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "voice.ogg")
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(audio); err != nil {
+		return "", err
+	}
+	for field, value := range map[string]string{"model": w.Model, "language": "ru", "response_format": "json"} {
+		if err := form.WriteField(field, value); err != nil {
+			return "", err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+w.APIKey)
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := doSpeechRequest(req, &result); err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// yandexRecognizer uses Yandex SpeechKit synchronous recognition.
+type yandexRecognizer struct {
+	APIKey string
+	// FolderID is only needed for keys that do not belong to a service account.
+	FolderID string
+}
+
+func (y yandexRecognizer) Recognize(audio []byte) (string, error) {
+	query := url.Values{"lang": {"ru-RU"}, "format": {"oggopus"}}
+	if y.FolderID != "" {
+		query.Set("folderId", y.FolderID)
+	}
+	req, err := http.NewRequest(http.MethodPost, yandexSpeechKitURL+"?"+query.Encode(), bytes.NewReader(audio))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Api-Key "+y.APIKey)
+	var result struct {
+		Result string `json:"result"`
+	}
+	if err := doSpeechRequest(req, &result); err != nil {
+		return "", err
+	}
+	return result.Result, nil
+}
+
+func doSpeechRequest(req *http.Request, result any) error {
+	client := &http.Client{Timeout: speechTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("speech recognition failed: %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Words that are said around a debt but are not part of it.
+var (
+	voiceLeadWords     = map[string]bool{"добавь": true, "добавить": true, "запиши": true, "записать": true, "долг": true}
+	voiceVerbWords     = map[string]bool{"должен": true, "должна": true, "должны": true, "занял": true, "заняла": true, "заняли": true}
+	voiceThousandWords = map[string]bool{"тысяча": true, "тысячи": true, "тысяч": true, "тыс": true}
+	voiceCurrencyWords = map[string]bool{"рубль": true, "рубля": true, "рублей": true, "руб": true, "р": true, "₽": true}
+)
+
+// parseVoiceDebt finds the name, amount and reason in a transcript such as
+// "Добавь Иван должен 5 тысяч рублей за ремонт.".
+func parseVoiceDebt(settings ChatSettings, text string) (name string, amount Money, reason string, ok bool) {
+	// bare drops the punctuation speech recognition puts around words.
+	bare := func(field string) string {
+		return strings.ToLower(strings.TrimFunc(field, func(r rune) bool { return unicode.IsPunct(r) && r != '#' }))
+	}
+	fields := strings.Fields(text)
+	for len(fields) > 0 && voiceLeadWords[bare(fields[0])] {
+		fields = fields[1:]
+	}
+
+	for i := 1; i < len(fields); i++ {
+		value, err := parseAmount(settings, bare(fields[i]))
+		if err != nil || value <= 0 {
+			continue
+		}
+		var nameFields []string
+		for _, field := range fields[:i] {
+			if !voiceVerbWords[bare(field)] {
+				nameFields = append(nameFields, field)
+			}
+		}
+		rest := fields[i+1:]
+		if len(rest) > 0 && voiceThousandWords[bare(rest[0])] {
+			value = value.Times(1000)
+			rest = rest[1:]
+		}
+		if len(rest) > 0 && voiceCurrencyWords[bare(rest[0])] {
+			rest = rest[1:]
+		}
+		if len(rest) > 0 && bare(rest[0]) == "за" {
+			rest = rest[1:]
+		}
+		// Commas between names are kept for splitting the debt.
+		trim := func(words []string) string {
+			return strings.TrimRightFunc(strings.Join(words, " "), unicode.IsPunct)
+		}
+		name, reason = trim(nameFields), trim(rest)
+		return name, value, reason, name != "" && reason != ""
+	}
+	return "", 0, "", false
+}
+
+// voiceAccepted reports whether a voice message is meant for adding a debt:
+// in private chats whenever no other dialog is open, in groups only after /add.
+func voiceAccepted(state int, private bool) bool {
+	return state == StateAddingDebtorName || (private && state == StateIdle)
+}
+
+func handleVoiceMessage(bot Sender, chatID int64, voice *tgbotapi.Voice, private bool) {
+	state := getUserState(chatID)
+	if !voiceAccepted(state, private) {
+		if private {
+			sendSimpleMessage(bot, chatID, "Голосом можно добавить долг. Сначала закончи текущее действие или отмени его: /cancel.")
+		}
+		return
+	}
+	if config.Speech == nil {
+		sendSimpleMessage(bot, chatID, "Голосовой ввод не настроен. Напиши долг текстом, например: /add Иван 500 за обед")
+		return
+	}
+	if voice.Duration > maxVoiceDuration || voice.FileSize > maxVoiceFileSize {
+		sendSimpleMessage(bot, chatID, fmt.Sprintf("Голосовое слишком длинное — уложись в %d секунд.", maxVoiceDuration))
+		return
+	}
+
+	audio, err := downloadFile(bot, voice.FileID, maxVoiceFileSize)
+	if err != nil {
+		log.Printf("Error downloading voice message: %v", err)
+		sendSimpleMessage(bot, chatID, "Не удалось получить голосовое. Попробуй ещё раз.")
+		return
+	}
+	text, err := config.Speech.Recognize(audio)
+	if err != nil {
+		log.Printf("Error recognizing voice message: %v", err)
+		sendSimpleMessage(bot, chatID, "Не удалось распознать голосовое. Попробуй ещё раз или напиши текстом.")
+		return
+	}
+	heard := fmt.Sprintf("🎤 Распознано: «%s»", escapeMarkdown(strings.TrimSpace(text)))
+
+	name, amount, reason, ok := parseVoiceDebt(getChatSettings(chatID), text)
+	if !ok {
+		sendSimpleMessage(bot, chatID, heard+"\n\nНе получилось разобрать имя, сумму и причину. Скажи, например: «Иван 500 за обед».")
+		return
+	}
+	setPendingName(chatID, name)
+	setPendingQuickAdd(chatID, amount, reason)
+	setUserState(chatID, StateConfirmingVoiceDebt)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		callbackButton("✅ Добавить", "voice_confirm"),
+		callbackButton("❌ Отмена", "cancel_operation"),
+	))
+	sendWithKeyboard(bot, chatID, fmt.Sprintf("%s\n\nДобавить долг?\nДолжник: *%s*\nСумма: *%s*\nПричина: *%s*",
+		heard, escapeBold(name), formatAmount(getChatSettings(chatID), amount), escapeBold(reason)), keyboard)
+}
+
+func handleVoiceConfirm(bot Sender, chatID int64, messageID int) {
+	session := getSession(chatID)
+	if session.State != StateConfirmingVoiceDebt {
+		editMessageWithKeyboard(bot, chatID, messageID, "Эта операция уже завершена.", tgbotapi.InlineKeyboardMarkup{})
+		return
+	}
+	editMessageWithKeyboard(bot, chatID, messageID, fmt.Sprintf("🎤 Добавляю долг: *%s* — *%s* за *%s*.",
+		escapeBold(session.PendingName), formatAmount(getChatSettings(chatID), session.QuickAddAmount), escapeBold(session.QuickAddReason)), tgbotapi.InlineKeyboardMarkup{})
+	clearUserState(chatID)
+	quickAdd(bot, chatID, session.PendingName, session.QuickAddAmount, session.QuickAddReason)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Webhook Mode ---
+
+const (
+	webhookSecretHeader  = "X-Telegram-Bot-Api-Secret-Token"
+	defaultWebhookListen = ":8443"
+	seenUpdatesCapacity  = 10000
+	maxWebhookBodyBytes  = 1 << 20
+)
+
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// webhookSettings is empty (the bot polls getUpdates) unless WEBHOOK_URL is set.
+type webhookSettings struct {
+	URL    string
+	Listen string
+	Secret string
+}
+
+func loadWebhookConfig(env envSource) (webhookSettings, error) {
+	cfg := webhookSettings{URL: env.get("WEBHOOK_URL"), Listen: env.get("WEBHOOK_LISTEN"), Secret: env.get("WEBHOOK_SECRET")}
+	if cfg.URL == "" {
+		return webhookSettings{}, nil
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = defaultWebhookListen
+	}
+	if !webhookSecretPattern.MatchString(cfg.Secret) {
+		return cfg, fmt.Errorf("WEBHOOK_SECRET must be 1-256 characters of A-Z, a-z, 0-9, _ or -")
+	}
+	if parsed, err := url.Parse(cfg.URL); err != nil || parsed.Scheme != "https" {
+		return cfg, fmt.Errorf("WEBHOOK_URL must be an https URL, got %q", cfg.URL)
+	}
+	return cfg, nil
+}
+
+// seenUpdates remembers recently received update IDs so redelivered or
+// replayed updates are acknowledged without being processed twice.
+type seenUpdates struct {
+	mu    sync.Mutex
+	ids   map[int]struct{}
+	order []int
+	next  int
+}
+
+func newSeenUpdates(capacity int) *seenUpdates {
+	return &seenUpdates{ids: make(map[int]struct{}, capacity), order: make([]int, 0, capacity)}
+}
+
+// add records id and reports whether it had not been seen before.
+func (s *seenUpdates) add(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	if len(s.order) < cap(s.order) {
+		s.order = append(s.order, id)
+	} else {
+		delete(s.ids, s.order[s.next])
+		s.order[s.next] = id
+		s.next = (s.next + 1) % len(s.order)
+	}
+	s.ids[id] = struct{}{}
+	return true
+}
+
+func setWebhook(bot Sender, webhookURL, secret string) error {
+	params := tgbotapi.Params{}
+	params["url"] = webhookURL
+	params["secret_token"] = secret
+	params.AddBool("drop_pending_updates", false)
+	_, err := bot.MakeRequest("setWebhook", params)
+	return err
+}
+
+// serveWebhook registers the webhook with Telegram and serves updates until the
+// HTTP server fails. Updates are acknowledged immediately and processed by the
+// worker pool, so slow handlers never hit Telegram's delivery timeout.
+func serveWebhook(bot Sender, dispatcher *updateDispatcher, cfg webhookSettings) error {
+	webhookURL, secret := cfg.URL, cfg.Secret
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	if err := setWebhook(bot, webhookURL, secret); err != nil {
+		return fmt.Errorf("setting webhook: %w", err)
+	}
+
+	seen := newSeenUpdates(seenUpdatesCapacity)
+	mux := http.NewServeMux()
+	mux.HandleFunc(parsed.Path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretHeader)), []byte(secret)) != 1 {
+			log.Printf("Rejected webhook request from %s: bad secret token", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes)).Decode(&update); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if !seen.add(update.UpdateID) {
+			log.Printf("Ignoring replayed update %d", update.UpdateID)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		dispatcher.dispatch(update)
+	})
+
+	log.Printf("Listening for webhook updates on %s%s", cfg.Listen, parsed.Path)
+	return http.ListenAndServe(cfg.Listen, mux)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// --- Update Workers ---
+
+const (
+	updateWorkerCount = 8
+	updateQueueSize   = 100
+)
+
+// updateDispatcher fans updates out to a fixed pool of workers. Every chat is
+// pinned to one worker, so a chat's updates are still handled in order while a
+// slow chat no longer blocks the others.
+type updateDispatcher struct {
+	queues []chan tgbotapi.Update
+}
+
+func startUpdateWorkers(bot Sender, workers int) *updateDispatcher {
+	d := &updateDispatcher{queues: make([]chan tgbotapi.Update, workers)}
+	for i := range d.queues {
+		queue := make(chan tgbotapi.Update, updateQueueSize)
+		d.queues[i] = queue
+		go func() {
+			for update := range queue {
+				processUpdate(bot, update)
+			}
+		}()
+	}
+	return d
+}
+
+func (d *updateDispatcher) dispatch(update tgbotapi.Update) {
+	recordUpdateReceived()
+	chatID := updateChatID(update)
+	if chatID < 0 {
+		chatID = -chatID
+	}
+	d.queues[chatID%int64(len(d.queues))] <- update
+}
+
+func processUpdate(bot Sender, update tgbotapi.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic while handling update %d: %v", update.UpdateID, r)
+		}
+	}()
+	handleUpdate(bot, update)
+}
+
+func updateChatID(update tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return update.CallbackQuery.Message.Chat.ID
+	}
+	return 0
+}